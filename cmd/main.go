@@ -1,25 +1,81 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"flag"
 	"fmt"
+	"net"
 	"net/http"
+	"net/smtp"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"asperitas-clone/pkg/comment_repo"
+	"asperitas-clone/pkg/credentials"
+	"asperitas-clone/pkg/emailtoken"
+	"asperitas-clone/pkg/events"
 	"asperitas-clone/pkg/handlers"
+	"asperitas-clone/pkg/identity_repo"
+	"asperitas-clone/pkg/lockout_repo"
+	"asperitas-clone/pkg/mail"
+	"asperitas-clone/pkg/metrics"
 	"asperitas-clone/pkg/middleware"
+	"asperitas-clone/pkg/migrate"
+	"asperitas-clone/pkg/notification_repo"
+	"asperitas-clone/pkg/oidc"
 	"asperitas-clone/pkg/post_repo"
+	"asperitas-clone/pkg/profile_repo"
+	"asperitas-clone/pkg/reset_repo"
+	"asperitas-clone/pkg/saved_repo"
+	"asperitas-clone/pkg/search"
 	"asperitas-clone/pkg/session"
+	"asperitas-clone/pkg/subscription_repo"
+	"asperitas-clone/pkg/totp_repo"
+	"asperitas-clone/pkg/tracing"
 	"asperitas-clone/pkg/user_repo"
 
 	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"go.uber.org/zap"
-	mgo "gopkg.in/mgo.v2"
 
 	_ "github.com/go-sql-driver/mysql"
-	_ "go.mongodb.org/mongo-driver/mongo"
 )
 
 func main() {
+	searchBackend := flag.String("search", "memory", "search index backend: memory or mongo")
+	savedBackend := flag.String("saved", "mysql", "saved posts storage: mysql or memory")
+	eventsBroker := flag.String("events", "local", "post events broker: local or mongo")
+	rebuildComments := flag.Bool("rebuild-comments", false, "refill comment history from existing posts")
+	unlockUser := flag.String("unlock", "", "unlock logins of the username and exit")
+	unlockIP := flag.String("unlock-ip", "", "unlock logins from the address and exit")
+	resetTwoFactor := flag.String("reset-2fa", "", "turn off two-factor authentication of the username and exit")
+	drainDelay := flag.Duration("drain", 5*time.Second, "how long /readyz fails before the server stops on SIGTERM")
+	accessLogFormat := flag.String("access-log", middleware.FormatJSON, "access log format: json, common or combined")
+	requestTimeout := flag.Duration("request-timeout", 10*time.Second, "deadline of database work of a request, 0 disables it")
+	usernameMin := flag.Int("username-min", 3, "minimal username length of new users")
+	usernameMax := flag.Int("username-max", 32, "maximal username length of new users")
+	passwordMin := flag.Int("password-min", 8, "minimal password length of new users")
+	mailer := flag.String("mailer", "outbox", "how mail is sent: outbox writes it to -outbox, smtp sends it to -smtp-addr")
+	outboxDir := flag.String("outbox", "outbox", "directory of mail written by -mailer=outbox")
+	smtpAddr := flag.String("smtp-addr", "localhost:25", "mail server, SMTP_USER and SMTP_PASSWORD log in to it if set")
+	mailFrom := flag.String("mail-from", "noreply@localhost", "sender of mail")
+	baseURL := flag.String("base-url", "http://localhost:8080", "address of the site in links sent by mail")
+	resetTTL := flag.Duration("reset-ttl", time.Hour, "how long password reset links work")
+	resetResend := flag.Duration("reset-resend", handlers.DefaultResendInterval, "least time between password reset mails of a user")
+	verifyTTL := flag.Duration("verify-ttl", emailtoken.DefaultTTL, "how long email verification links work")
+	verifyResend := flag.Duration("verify-resend", handlers.DefaultResendInterval, "least time between verification mails of a user")
+	requireVerified := flag.Bool("require-verified-email", false, "let only users with a verified email post and comment")
+	totpIssuer := flag.String("totp-issuer", handlers.DefaultTOTPIssuer, "name of the site in authenticator apps")
+	oidcConfig := flag.String("oidc-config", "", "JSON file with the OpenID Connect providers users can log in with")
+	traceOut := flag.String("trace-out", "", "write trace spans as JSON lines to this file, - for stdout, empty disables tracing")
+	flag.Parse()
+
 	r := mux.NewRouter()
 
 	zapLogger, err := zap.NewProduction()
@@ -30,7 +86,81 @@ func main() {
 	defer zapLogger.Sync()
 	logger := zapLogger.Sugar()
 
-	dsn := "root:g9mF7ztS@tcp(localhost:3306)/items"
+	switch *accessLogFormat {
+	case middleware.FormatJSON, middleware.FormatCommon, middleware.FormatCombined:
+	default:
+		fmt.Println("Unknown access log format", *accessLogFormat)
+		return
+	}
+
+	var mailSender handlers.MailerInterface
+	switch *mailer {
+	case "outbox":
+		mailSender = &mail.OutboxMailer{Dir: *outboxDir, From: *mailFrom}
+	case "smtp":
+		smtpMailer := &mail.SMTPMailer{Addr: *smtpAddr, From: *mailFrom}
+		if user := os.Getenv("SMTP_USER"); user != "" {
+			host, _, _ := net.SplitHostPort(*smtpAddr)
+			smtpMailer.Auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		mailSender = smtpMailer
+	default:
+		fmt.Println("Unknown mailer", *mailer)
+		return
+	}
+
+	// links must survive restarts and work on every instance, so the key
+	// should be set, a random one is only good for trying things out
+	emailKey := []byte(os.Getenv("EMAIL_SIGNING_KEY"))
+	if len(emailKey) == 0 {
+		emailKey = make([]byte, 32)
+		if _, err := rand.Read(emailKey); err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		logger.Warn("EMAIL_SIGNING_KEY is not set, verification links stop working on restart")
+	}
+	signer := &emailtoken.Signer{Key: emailKey, TTL: *verifyTTL}
+
+	providers := map[string]*oidc.Provider{}
+	if *oidcConfig != "" {
+		configFile, err := os.Open(*oidcConfig)
+		if err != nil {
+			fmt.Println(err.Error())
+			fmt.Println("Can't open OIDC config")
+			return
+		}
+		configs, err := oidc.ReadConfig(configFile)
+		configFile.Close()
+		if err != nil {
+			fmt.Println(err.Error())
+			fmt.Println("Can't read OIDC config")
+			return
+		}
+		for _, cfg := range configs {
+			providers[cfg.Name] = oidc.New(cfg)
+		}
+	}
+
+	switch *traceOut {
+	case "":
+	case "-":
+		tracing.Default.Exporter = tracing.NewWriterExporter(os.Stdout)
+	default:
+		traceFile, err := os.OpenFile(*traceOut, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Println(err.Error())
+			fmt.Println("Can't open trace file")
+			return
+		}
+		defer traceFile.Close()
+		tracing.Default.Exporter = tracing.NewWriterExporter(traceFile)
+	}
+	tracing.Default.OnError = func(err error) {
+		logger.Warnw("can't export span", "err", err)
+	}
+
+	dsn := "root:g9mF7ztS@tcp(localhost:3306)/items?parseTime=true"
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		fmt.Println(err.Error())
@@ -44,54 +174,351 @@ func main() {
 		return
 	}
 
-	sess, err := mgo.Dial("mongodb://localhost")
+	mongoOpts := options.Client().
+		ApplyURI("mongodb://localhost").
+		SetMaxPoolSize(100).
+		SetConnectTimeout(10 * time.Second).
+		SetServerSelectionTimeout(5 * time.Second)
+	client, err := mongo.Connect(context.Background(), mongoOpts)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer client.Disconnect(context.Background())
+	err = client.Ping(context.Background(), readpref.Primary())
+	if err != nil {
+		fmt.Println(err.Error())
+		fmt.Println("Can't ping mongo db")
+		return
+	}
+	collection := client.Database("posts").Collection("items")
+
+	migrator := migrate.New(db, client.Database("posts"))
+	err = migrator.Check(context.Background())
 	if err != nil {
 		fmt.Println(err.Error())
+		fmt.Println("Run bin/migrate up first")
+		return
+	}
+
+	metrics.RegisterDBStats(metrics.Default, "mysql", db)
+	sm := handlers.InstrumentedSessions{Sessions: &session.SessionManager{SessionDB: db}}
+
+	postRepo := handlers.InstrumentedPostRepo{Repo: &post_repo.PostRepo{PostDB: collection}}
+	userRepo := handlers.InstrumentedUserRepo{Repo: &user_repo.UserRepo{UserDB: db}}
+	emailRepo := &user_repo.UserRepo{UserDB: db}
+	profileRepo := &profile_repo.ProfileRepo{ProfileDB: db}
+	commentRepo := &comment_repo.CommentRepo{CommentDB: db}
+	subscriptionRepo := &subscription_repo.SubscriptionRepo{SubscriptionDB: db}
+	notificationRepo := &notification_repo.NotificationRepo{
+		NotificationDB: db,
+		MaxPerUser:     notification_repo.DefaultMaxPerUser,
+		MaxAge:         notification_repo.DefaultMaxAge,
+	}
+	identityRepo := &identity_repo.IdentityRepo{IdentityDB: db}
+	totpRepo := &totp_repo.TOTPRepo{
+		TOTPDB:       db,
+		ChallengeTTL: totp_repo.DefaultChallengeTTL,
+		MaxAttempts:  totp_repo.DefaultMaxAttempts,
+	}
+	resetRepo := &reset_repo.ResetRepo{ResetDB: db, TTL: *resetTTL}
+	lockoutRepo := &lockout_repo.LockoutRepo{
+		LockoutDB:     db,
+		UserThreshold: lockout_repo.DefaultUserThreshold,
+		IPThreshold:   lockout_repo.DefaultIPThreshold,
+		BaseLock:      lockout_repo.DefaultBaseLock,
+		MaxLock:       lockout_repo.DefaultMaxLock,
+		Window:        lockout_repo.DefaultWindow,
+	}
+	if *unlockUser != "" || *unlockIP != "" {
+		if *unlockUser != "" {
+			err = lockoutRepo.Reset(context.Background(), *unlockUser)
+		}
+		if err == nil && *unlockIP != "" {
+			err = lockoutRepo.ResetIP(context.Background(), *unlockIP)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			fmt.Println("Can't unlock logins")
+		}
 		return
 	}
-	collection := sess.DB("posts").C("items")
-	if collection == nil {
-		fmt.Println("Mongo DB is nil")
+	if *resetTwoFactor != "" {
+		user, err := userRepo.GetUserByUsername(context.Background(), *resetTwoFactor)
+		if err == nil && user == nil {
+			err = fmt.Errorf("no user %q", *resetTwoFactor)
+		}
+		if err == nil {
+			err = totpRepo.Disable(context.Background(), user.ID)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			fmt.Println("Can't reset two-factor authentication")
+		}
 		return
 	}
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := notificationRepo.Prune(context.Background()); err != nil {
+				logger.Warnw("can't prune notifications", "err", err)
+			}
+		}
+	}()
 
-	sm := &session.SessionManager{SessionDB: db}
+	var savedRepo handlers.SavedRepositoryInterface
+	switch *savedBackend {
+	case "mysql":
+		savedRepo = &saved_repo.SavedRepo{SavedDB: db}
+	case "memory":
+		savedRepo = saved_repo.NewMemorySavedRepo()
+	default:
+		fmt.Println("Unknown saved posts storage", *savedBackend)
+		return
+	}
 
-	postRepo := &post_repo.PostRepo{PostDB: collection}
-	userRepo := &user_repo.UserRepo{UserDB: db}
+	var broker events.Broker
+	switch *eventsBroker {
+	case "local":
+		broker = events.NewLocalBroker()
+	case "mongo":
+		broker, err = events.NewMongoBroker(client.Database("posts").Collection("events"))
+		if err != nil {
+			fmt.Println(err.Error())
+			fmt.Println("Can't create events collection")
+			return
+		}
+	default:
+		fmt.Println("Unknown events broker", *eventsBroker)
+		return
+	}
+	hub, err := events.NewHub(broker, events.DefaultBuffer)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer hub.Close()
 
+	if *rebuildComments {
+		posts, err := postRepo.GetAllPosts(context.Background())
+		if err == nil {
+			err = commentRepo.Rebuild(context.Background(), posts)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			fmt.Println("Can't rebuild comment history")
+			return
+		}
+	}
+
+	var searchIndex handlers.SearchIndexInterface
+	switch *searchBackend {
+	case "memory":
+		posts, err := postRepo.GetAllPosts(context.Background())
+		if err != nil {
+			fmt.Println(err.Error())
+			fmt.Println("Can't load posts into search index")
+			return
+		}
+		index := search.NewMemoryIndex()
+		index.Rebuild(posts)
+		searchIndex = index
+	case "mongo":
+		searchIndex, err = search.NewMongoIndex(collection)
+		if err != nil {
+			fmt.Println(err.Error())
+			fmt.Println("Can't create mongo text index")
+			return
+		}
+	default:
+		fmt.Println("Unknown search backend", *searchBackend)
+		return
+	}
+
+	policy := credentials.DefaultPolicy()
+	policy.UsernameMin = *usernameMin
+	policy.UsernameMax = *usernameMax
+	policy.PasswordMin = *passwordMin
+
+	emailHandler := handlers.EmailHandler{
+		UserRepo:       userRepo,
+		Emails:         emailRepo,
+		Sessions:       sm,
+		Mailer:         mailSender,
+		Signer:         signer,
+		BaseURL:        *baseURL,
+		ResendInterval: *verifyResend,
+		Logger:         logger,
+	}
 	userHandler := handlers.UserHandler{
-		PostRepo: postRepo,
+		PostRepo:     postRepo,
+		UserRepo:     userRepo,
+		Logger:       logger,
+		Sessions:     sm,
+		Profiles:     profileRepo,
+		Comments:     commentRepo,
+		Saved:        savedRepo,
+		Lockout:      lockoutRepo,
+		TwoFactor:    totpRepo,
+		Policy:       policy,
+		Verification: &emailHandler,
+	}
+	postDeleter := &handlers.PostDeleter{
+		PostRepo:      postRepo,
+		Search:        searchIndex,
+		Profiles:      profileRepo,
+		Comments:      commentRepo,
+		Saved:         savedRepo,
+		Notifications: notificationRepo,
+		Events:        hub,
+		Logger:        logger,
+	}
+	postHandler := handlers.PostHandler{
+		PostRepo:             postRepo,
+		UserRepo:             userRepo,
+		Sessions:             sm,
+		Search:               searchIndex,
+		Profiles:             profileRepo,
+		Comments:             commentRepo,
+		Saved:                savedRepo,
+		Logger:               logger,
+		Notifications:        notificationRepo,
+		Events:               hub,
+		Deleter:              postDeleter,
+		Emails:               emailRepo,
+		RequireVerifiedEmail: *requireVerified,
+	}
+	resetHandler := handlers.ResetHandler{
+		UserRepo:       userRepo,
+		Resets:         resetRepo,
+		Mailer:         mailSender,
+		Sessions:       sm,
+		Lockout:        lockoutRepo,
+		Policy:         policy,
+		Emails:         emailRepo,
+		ResendInterval: *resetResend,
+		BaseURL:        *baseURL,
+		TTL:            *resetTTL,
+		Logger:         logger,
+	}
+	oidcHandler := handlers.OIDCHandler{
+		Providers:  providers,
+		Identities: identityRepo,
+		UserRepo:   userRepo,
+		Sessions:   sm,
+		Profiles:   profileRepo,
+		TwoFactor:  totpRepo,
+		Policy:     policy,
+		Logger:     logger,
+	}
+	twoFactorHandler := handlers.TwoFactorHandler{
+		UserRepo:  userRepo,
+		TwoFactor: totpRepo,
+		Sessions:  sm,
+		Issuer:    *totpIssuer,
+		Logger:    logger,
+	}
+	accountHandler := handlers.AccountHandler{
 		UserRepo: userRepo,
-		Logger:   logger,
+		PostRepo: postRepo,
 		Sessions: sm,
+		Search:   searchIndex,
+		Deleter:  postDeleter,
+		Policy:   policy,
+		Logger:   logger,
 	}
-	postHandler := handlers.PostHandler{
+	eventHandler := handlers.EventHandler{
+		Hub:      hub,
 		PostRepo: postRepo,
+	}
+	notificationHandler := handlers.NotificationHandler{
+		Notifications: notificationRepo,
+		Sessions:      sm,
+	}
+	profileHandler := handlers.ProfileHandler{
+		Profiles: profileRepo,
 		UserRepo: userRepo,
 		Sessions: sm,
 	}
+	feedHandler := handlers.FeedHandler{
+		PostRepo:      postRepo,
+		Subscriptions: subscriptionRepo,
+		Sessions:      sm,
+		Saved:         savedRepo,
+	}
+	searchHandler := handlers.SearchHandler{
+		Index: searchIndex,
+	}
+	health := &handlers.HealthHandler{
+		Timeout: 2 * time.Second,
+		Checks: []handlers.HealthCheck{
+			{
+				Name:  "mysql",
+				Check: db.PingContext,
+			},
+			{
+				Name: "mongo",
+				Check: func(ctx context.Context) error {
+					return client.Ping(ctx, readpref.Primary())
+				},
+			},
+		},
+	}
 
 	r.StrictSlash(true)
 	r.HandleFunc("/api/login", userHandler.Login).Methods("POST")
+	r.HandleFunc("/api/login/2fa", userHandler.LoginTwoFactor).Methods("POST")
 	r.HandleFunc("/api/register", userHandler.Register).Methods("POST")
+	r.HandleFunc("/api/password-reset", resetHandler.RequestReset).Methods("POST")
+	r.HandleFunc("/api/password-reset/confirm", resetHandler.ConfirmReset).Methods("POST")
+	r.HandleFunc("/api/oidc/providers", oidcHandler.GetProviders).Methods("GET")
+	r.HandleFunc("/api/oidc/{PROVIDER}/login", oidcHandler.Login).Methods("GET")
+	r.HandleFunc("/api/oidc/{PROVIDER}/callback", oidcHandler.Callback).Methods("GET")
 
 	r.HandleFunc("/api/posts", postHandler.AddPost).Methods("POST")
 	r.HandleFunc("/api/posts", postHandler.GetAllPosts).Methods("GET")
 	r.HandleFunc("/api/posts/{CATEGORY_NAME}", postHandler.GetPostsByCategory).Methods("GET")
 	r.HandleFunc("/api/post/{POST_ID}", postHandler.GetPostByID).Methods("GET")
 	r.HandleFunc("/api/post/{POST_ID}", postHandler.PostComment).Methods("POST")
+	r.HandleFunc("/api/post/{POST_ID}/save", postHandler.Save).Methods("PUT")
+	r.HandleFunc("/api/post/{POST_ID}/save", postHandler.Unsave).Methods("DELETE")
+	r.HandleFunc("/api/post/{POST_ID}/events", eventHandler.Stream).Methods("GET")
 	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}", postHandler.DeleteComment).Methods("DELETE")
 	r.HandleFunc("/api/post/{POST_ID}", postHandler.DeletePost).Methods("DELETE")
 	r.HandleFunc("/api/post/{POST_ID}/{VOTE}", postHandler.Vote).Methods("GET")
+	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}/{VOTE}", postHandler.VoteComment).Methods("GET")
 
+	r.HandleFunc("/api/user/me/saved", postHandler.GetSaved).Methods("GET")
+	r.HandleFunc("/api/user/me/password", accountHandler.ChangePassword).Methods("PUT")
+	r.HandleFunc("/api/user/me/username", accountHandler.ChangeUsername).Methods("PUT")
+	r.HandleFunc("/api/user/me", accountHandler.DeleteAccount).Methods("DELETE")
+	r.HandleFunc("/api/user/me/email", emailHandler.GetEmail).Methods("GET")
+	r.HandleFunc("/api/user/me/email", emailHandler.ChangeEmail).Methods("PUT")
+	r.HandleFunc("/api/user/me/email/verify", emailHandler.ResendVerification).Methods("POST")
+	r.HandleFunc("/api/verify-email", emailHandler.VerifyEmail).Methods("POST")
+	r.HandleFunc("/api/user/me/2fa", twoFactorHandler.GetTwoFactor).Methods("GET")
+	r.HandleFunc("/api/user/me/2fa", twoFactorHandler.BeginTwoFactor).Methods("POST")
+	r.HandleFunc("/api/user/me/2fa/enable", twoFactorHandler.EnableTwoFactor).Methods("POST")
+	r.HandleFunc("/api/user/me/2fa", twoFactorHandler.DisableTwoFactor).Methods("DELETE")
 	r.HandleFunc("/api/user/{USERNAME}", userHandler.GetPosts).Methods("GET")
+	r.HandleFunc("/api/user/{USERNAME}/profile", profileHandler.GetProfile).Methods("GET")
+	r.HandleFunc("/api/user/{USERNAME}/comments", userHandler.GetComments).Methods("GET")
+	r.HandleFunc("/api/user/{USERNAME}/profile", profileHandler.UpdateProfile).Methods("PUT")
+
+	r.HandleFunc("/api/search", searchHandler.Search).Methods("GET")
+
+	r.HandleFunc("/api/feed", feedHandler.GetFeed).Methods("GET")
+	r.HandleFunc("/api/notifications", notificationHandler.GetNotifications).Methods("GET")
+	r.HandleFunc("/api/notifications/unread", notificationHandler.CountUnread).Methods("GET")
+	r.HandleFunc("/api/notifications/read", notificationHandler.MarkAllRead).Methods("POST")
+	r.HandleFunc("/api/notifications/{NOTIFICATION_ID}/read", notificationHandler.MarkRead).Methods("POST")
+	r.HandleFunc("/api/subscriptions", feedHandler.GetSubscriptions).Methods("GET")
+	r.HandleFunc("/api/subscriptions/{CATEGORY_NAME}", feedHandler.Subscribe).Methods("PUT")
+	r.HandleFunc("/api/subscriptions/{CATEGORY_NAME}", feedHandler.Unsubscribe).Methods("DELETE")
 
 	r.StrictSlash(false)
-	r.PathPrefix("/static").Handler(http.FileServer(http.Dir("./template/")))
-	r.PathPrefix("/").Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "./template/index.html")
-	}))
+	healthRoutes(r, health)
+	metricsRoutes(r, metrics.Default)
+	frontendRoutes(r, "./template")
 
 	auth := middleware.AuthService{
 		SessionManager: sm,
@@ -112,21 +539,254 @@ func main() {
 				Method: "GET",
 				Reg:    `/api/post/{POST_ID}/{VOTE}`,
 			},
+			{
+				Method: "GET",
+				Reg:    `/api/post/{POST_ID}/{COMMENT_ID}/{VOTE}`,
+			},
+			{
+				Method: "DELETE",
+				Reg:    `/api/post/{POST_ID}`,
+			},
+			{
+				Method: "PUT",
+				Reg:    `/api/user/{USERNAME}/profile`,
+			},
+			{
+				Method: "PUT",
+				Reg:    `/api/post/{POST_ID}/save`,
+			},
+			{
+				Method: "DELETE",
+				Reg:    `/api/post/{POST_ID}/save`,
+			},
+			{
+				Method: "GET",
+				Reg:    `/api/user/me/saved`,
+			},
+			{
+				Method: "PUT",
+				Reg:    `/api/user/me/password`,
+			},
+			{
+				Method: "PUT",
+				Reg:    `/api/user/me/username`,
+			},
+			{
+				Method: "DELETE",
+				Reg:    `/api/user/me`,
+			},
+			{
+				Method: "GET",
+				Reg:    `/api/user/me/email`,
+			},
+			{
+				Method: "PUT",
+				Reg:    `/api/user/me/email`,
+			},
+			{
+				Method: "POST",
+				Reg:    `/api/user/me/email/verify`,
+			},
+			{
+				Method: "GET",
+				Reg:    `/api/user/me/2fa`,
+			},
+			{
+				Method: "POST",
+				Reg:    `/api/user/me/2fa`,
+			},
+			{
+				Method: "POST",
+				Reg:    `/api/user/me/2fa/enable`,
+			},
 			{
 				Method: "DELETE",
+				Reg:    `/api/user/me/2fa`,
+			},
+			{
+				Method: "GET",
+				Reg:    `/api/subscriptions`,
+			},
+			{
+				Method: "PUT",
+				Reg:    `/api/subscriptions/{CATEGORY_NAME}`,
+			},
+			{
+				Method: "DELETE",
+				Reg:    `/api/subscriptions/{CATEGORY_NAME}`,
+			},
+			{
+				Method: "GET",
+				Reg:    `/api/notifications`,
+			},
+			{
+				Method: "GET",
+				Reg:    `/api/notifications/unread`,
+			},
+			{
+				Method: "POST",
+				Reg:    `/api/notifications/read`,
+			},
+			{
+				Method: "POST",
+				Reg:    `/api/notifications/{NOTIFICATION_ID}/read`,
+			},
+		},
+	}
+
+	limiter := middleware.RateLimiter{
+		Store:  middleware.NewMemoryRateStore(),
+		Logger: logger,
+		Policies: []middleware.RatePolicy{
+			{
+				Method: "POST",
+				Reg:    `/api/login`,
+				Limit:  middleware.PerMinute(10, 5),
+			},
+			{
+				Method: "POST",
+				Reg:    `/api/login/2fa`,
+				Limit:  middleware.PerMinute(10, 5),
+			},
+			{
+				Method: "POST",
+				Reg:    `/api/register`,
+				Limit:  middleware.PerMinute(5, 3),
+			},
+			{
+				Method: "POST",
+				Reg:    `/api/password-reset`,
+				Limit:  middleware.PerMinute(3, 3),
+			},
+			{
+				Method: "POST",
+				Reg:    `/api/password-reset/confirm`,
+				Limit:  middleware.PerMinute(10, 5),
+			},
+			{
+				Method: "GET",
+				Reg:    `/api/oidc/{PROVIDER}/login`,
+				Limit:  middleware.PerMinute(10, 5),
+			},
+			{
+				Method: "GET",
+				Reg:    `/api/oidc/{PROVIDER}/callback`,
+				Limit:  middleware.PerMinute(10, 5),
+			},
+			{
+				Method: "POST",
+				Reg:    `/api/posts`,
+				Limit:  middleware.PerMinute(5, 5),
+			},
+			{
+				Method: "POST",
 				Reg:    `/api/post/{POST_ID}`,
+				Limit:  middleware.PerMinute(10, 10),
+			},
+			{
+				Method: "GET",
+				Reg:    `/api/post/{POST_ID}/{VOTE}`,
+				Limit:  middleware.PerMinute(60, 30),
+			},
+			{
+				Method: "GET",
+				Reg:    `/api/post/{POST_ID}/{COMMENT_ID}/{VOTE}`,
+				Limit:  middleware.PerMinute(60, 30),
+			},
+			{
+				Method: "PUT",
+				Reg:    `/api/user/me/password`,
+				Limit:  middleware.PerMinute(5, 3),
+			},
+			{
+				Method: "PUT",
+				Reg:    `/api/user/me/username`,
+				Limit:  middleware.PerMinute(5, 3),
+			},
+			{
+				Method: "DELETE",
+				Reg:    `/api/user/me`,
+				Limit:  middleware.PerMinute(5, 3),
+			},
+			{
+				Method: "PUT",
+				Reg:    `/api/user/me/email`,
+				Limit:  middleware.PerMinute(5, 3),
+			},
+			{
+				Method: "POST",
+				Reg:    `/api/verify-email`,
+				Limit:  middleware.PerMinute(10, 5),
+			},
+			{
+				Method: "POST",
+				Reg:    `/api/user/me/2fa`,
+				Limit:  middleware.PerMinute(5, 3),
+			},
+			{
+				Method: "POST",
+				Reg:    `/api/user/me/2fa/enable`,
+				Limit:  middleware.PerMinute(5, 3),
+			},
+			{
+				Method: "DELETE",
+				Reg:    `/api/user/me/2fa`,
+				Limit:  middleware.PerMinute(5, 3),
 			},
 		},
 	}
 
-	r.Use(auth.Auth)
-	reqlog := middleware.ReqLogger{Logger: logger}
+	deadlines := middleware.Deadlines{
+		Default: *requestTimeout,
+		Policies: []middleware.TimeoutPolicy{
+			// event streams stay open until the client leaves
+			{Method: "GET", Reg: "/api/post/{POST_ID}/events"},
+		},
+	}
+
+	reqlog := middleware.ReqLogger{
+		Logger: logger,
+		Format: *accessLogFormat,
+		Output: os.Stdout,
+	}
 	r.Use(reqlog.AccessLog)
-	r.Use(middleware.Panic)
+	r.Use(middleware.Tracing)
+	r.Use(middleware.Metrics)
+	r.Use(deadlines.Deadline)
+	r.Use(auth.Auth)
+	r.Use(limiter.Limit)
+	recovery := middleware.PanicRecovery{Logger: logger}
 
 	port := ":8080"
+	srv := &http.Server{Addr: port, Handler: recovery.Recover(r)}
+	// event streams never finish on their own
+	srv.RegisterOnShutdown(hub.Close)
+	done := make(chan struct{})
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		logger.Infow("shutting down", "type", "STOP", "drain", *drainDelay)
+		health.Shutdown()
+		time.Sleep(*drainDelay)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Warnw("can't shut down gracefully", "err", err)
+		}
+		close(done)
+	}()
+
 	logger.Infow("starting server",
 		"type", "START", "port", port,
 	)
-	http.ListenAndServe(port, r)
+	err = srv.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		logger.Errorw("server error", "err", err)
+		return
+	}
+	// ListenAndServe returns as soon as Shutdown starts, requests in flight
+	// still need the databases
+	<-done
+	resetHandler.Wait()
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"asperitas-clone/pkg/migrate"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+const usage = `usage: migrate [flags] command [version]
+
+commands:
+  up [version]    apply migrations up to version, all by default
+  down [version]  revert migrations above version, the last one by default
+  version         print the current and the latest version
+`
+
+func main() {
+	dsn := flag.String("mysql", "root:g9mF7ztS@tcp(localhost:3306)/items?parseTime=true", "mysql data source name")
+	mongoURI := flag.String("mongo", "mongodb://localhost", "mongo connection string")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		fmt.Println(err.Error())
+		fmt.Println("Can't open mysql db")
+		os.Exit(1)
+	}
+	defer db.Close()
+	client, err := mongo.Connect(ctx, options.Client().
+		ApplyURI(*mongoURI).
+		SetServerSelectionTimeout(5*time.Second))
+	if err != nil {
+		fmt.Println(err.Error())
+		fmt.Println("Can't connect to mongo db")
+		os.Exit(1)
+	}
+	defer client.Disconnect(ctx)
+	migrator := migrate.New(db, client.Database("posts"))
+
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		fmt.Println(err.Error())
+		fmt.Println("Can't get schema version")
+		os.Exit(1)
+	}
+	target := -1
+	if flag.NArg() == 2 {
+		target, err = strconv.Atoi(flag.Arg(1))
+		if err != nil || target < 0 {
+			fmt.Println("Bad version", flag.Arg(1))
+			os.Exit(2)
+		}
+	}
+
+	switch flag.Arg(0) {
+	case "up":
+		if target < 0 {
+			target = migrator.Latest()
+		}
+		err = migrator.Up(ctx, target)
+	case "down":
+		if target < 0 {
+			target = previous(migrator, version)
+		}
+		err = migrator.Down(ctx, target)
+	case "version":
+		fmt.Printf("version %d, latest %d\n", version, migrator.Latest())
+		return
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	version, err = migrator.Version(ctx)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("version %d, latest %d\n", version, migrator.Latest())
+}
+
+// previous is the version before the current one.
+func previous(migrator *migrate.Migrator, version int) int {
+	target := 0
+	for _, migration := range migrator.Migrations {
+		if migration.Version < version {
+			target = migration.Version
+		}
+	}
+	return target
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"asperitas-clone/pkg/handlers"
+
+	"github.com/gorilla/mux"
+)
+
+// healthRoutes serves the probes of the orchestrator. mux takes the first
+// route that matches, so they go before frontendRoutes.
+func healthRoutes(r *mux.Router, health *handlers.HealthHandler) {
+	r.HandleFunc("/healthz", health.Live).Methods("GET")
+	r.HandleFunc("/readyz", health.Ready).Methods("GET")
+}
+
+// metricsRoutes serves the metrics for Prometheus, before frontendRoutes
+// too.
+func metricsRoutes(r *mux.Router, metrics http.Handler) {
+	r.Handle("/metrics", metrics).Methods("GET")
+}
+
+// frontendRoutes serves the static files in dir and index.html for every
+// other path, the frontend routes those itself. It takes everything, so it
+// is registered last.
+func frontendRoutes(r *mux.Router, dir string) {
+	r.PathPrefix("/static").Handler(http.FileServer(http.Dir(dir)))
+	r.PathPrefix("/").Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join(dir, "index.html"))
+	}))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"asperitas-clone/pkg/handlers"
+	"asperitas-clone/pkg/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// newRouter registers the routes in the order main does.
+func newRouter(t *testing.T, health *handlers.HealthHandler) *mux.Router {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>index</html>"), 0644); err != nil {
+		t.Fatalf("can't write index.html: %s", err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "static"), 0755); err != nil {
+		t.Fatalf("can't create static: %s", err)
+	}
+	r := mux.NewRouter()
+	healthRoutes(r, health)
+	metricsRoutes(r, metrics.Default)
+	frontendRoutes(r, dir)
+	return r
+}
+
+func get(r *mux.Router, path string) (int, string) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	return w.Result().StatusCode, string(body)
+}
+
+func TestHealthRoutes(t *testing.T) {
+	health := &handlers.HealthHandler{
+		Checks: []handlers.HealthCheck{
+			{Name: "mysql", Check: func(context.Context) error { return errors.New("down") }},
+		},
+	}
+	r := newRouter(t, health)
+
+	//Live
+	code, body := get(r, "/healthz")
+	if code != 200 || !strings.Contains(body, `"status":"ok"`) {
+		t.Errorf("unexpected /healthz: %d %s", code, body)
+		return
+	}
+
+	//A dependency is down
+	code, body = get(r, "/readyz")
+	if code != 503 || !strings.Contains(body, `"mysql"`) {
+		t.Errorf("unexpected /readyz: %d %s", code, body)
+		return
+	}
+
+	//Shutting down
+	health.Checks = nil
+	health.Shutdown()
+	code, body = get(r, "/readyz")
+	if code != 503 || !strings.Contains(body, "shutting down") {
+		t.Errorf("unexpected /readyz: %d %s", code, body)
+		return
+	}
+
+	//Other paths get the frontend
+	code, body = get(r, "/u/admin")
+	if code != 200 || body != "<html>index</html>" {
+		t.Errorf("unexpected frontend: %d %s", code, body)
+		return
+	}
+}
+
+func TestMetricsRoute(t *testing.T) {
+	r := newRouter(t, &handlers.HealthHandler{})
+	metrics.Logins.Inc("success")
+	code, body := get(r, "/metrics")
+	if code != 200 || !strings.Contains(body, "# TYPE") || strings.Contains(body, "<html>") {
+		t.Errorf("unexpected /metrics: %d %s", code, body)
+		return
+	}
+}
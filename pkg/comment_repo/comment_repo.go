@@ -0,0 +1,112 @@
+package comment_repo
+
+import (
+	"context"
+	"database/sql"
+
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/logging"
+
+	_ "github.com/go-sql-driver/mysql"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CommentRepo keeps a copy of every comment keyed by its author, so the
+// comment history of a user doesn't have to scan the posts collection.
+type CommentRepo struct {
+	CommentDB *sql.DB
+}
+
+func (repo *CommentRepo) AddComment(ctx context.Context, post *items.Post, comment *items.Comment) error {
+	_, err := repo.CommentDB.ExecContext(
+		ctx,
+		"INSERT INTO `comments` (`id`, `post_id`, `post_title`, `userid`, `body`, `created`) VALUES (?, ?, ?, ?, ?, ?)",
+		comment.ID.Hex(),
+		post.ID.Hex(),
+		post.Title,
+		comment.Author.ID,
+		comment.Body,
+		comment.Created,
+	)
+	return err
+}
+
+func (repo *CommentRepo) DeleteComment(ctx context.Context, commentID primitive.ObjectID) error {
+	_, err := repo.CommentDB.ExecContext(ctx, "DELETE FROM `comments` WHERE `id` = ?", commentID.Hex())
+	return err
+}
+
+func (repo *CommentRepo) DeletePostComments(ctx context.Context, postID primitive.ObjectID) error {
+	_, err := repo.CommentDB.ExecContext(ctx, "DELETE FROM `comments` WHERE `post_id` = ?", postID.Hex())
+	return err
+}
+
+// GetCommentsByUsername returns comments of the user, newest first.
+func (repo *CommentRepo) GetCommentsByUsername(ctx context.Context, username string, offset, limit int) ([]*items.UserComment, error) {
+	rows, err := repo.CommentDB.QueryContext(
+		ctx,
+		"SELECT c.id, c.post_id, c.post_title, c.body, c.created FROM comments c "+
+			"JOIN users u ON u.id = c.userid WHERE u.username = ? ORDER BY c.created DESC LIMIT ? OFFSET ?",
+		username,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	comments := []*items.UserComment{}
+	for rows.Next() {
+		var id, postID string
+		comment := &items.UserComment{}
+		err = rows.Scan(&id, &postID, &comment.PostTitle, &comment.Body, &comment.Created)
+		if err != nil {
+			return nil, err
+		}
+		comment.ID, err = primitive.ObjectIDFromHex(id)
+		if err == nil {
+			comment.PostID, err = primitive.ObjectIDFromHex(postID)
+		}
+		if err != nil {
+			logging.FromContext(ctx, nil).Warnw("skipping comment with a bad id", "id", id, "post", postID)
+			continue
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// Rebuild replaces the stored comments with the ones found in posts. It is
+// meant for filling the table once from already existing posts.
+func (repo *CommentRepo) Rebuild(ctx context.Context, posts []*items.Post) error {
+	tx, err := repo.CommentDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM `comments`"); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, post := range posts {
+		for _, comment := range post.Comments {
+			if comment.Author == nil {
+				continue
+			}
+			_, err = tx.ExecContext(
+				ctx,
+				"INSERT INTO `comments` (`id`, `post_id`, `post_title`, `userid`, `body`, `created`) VALUES (?, ?, ?, ?, ?, ?)",
+				comment.ID.Hex(),
+				post.ID.Hex(),
+				post.Title,
+				comment.Author.ID,
+				comment.Body,
+				comment.Created,
+			)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,102 @@
+package comment_repo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"asperitas-clone/pkg/items"
+
+	_ "github.com/go-sql-driver/mysql"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var (
+	ErrDB = errors.New("DB_ERROR")
+)
+
+func TestGetCommentsByUsername(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	created := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	expect := []*items.UserComment{
+		{
+			ID:        primitive.NewObjectID(),
+			Created:   created,
+			Body:      "abacaba",
+			PostID:    primitive.NewObjectID(),
+			PostTitle: "title",
+		},
+	}
+	rows := sqlmock.NewRows([]string{"id", "post_id", "post_title", "body", "created"})
+	for _, c := range expect {
+		rows.AddRow(c.ID.Hex(), c.PostID.Hex(), c.PostTitle, c.Body, c.Created)
+	}
+
+	// Good query
+	mock.
+		ExpectQuery("SELECT c.id, c.post_id, c.post_title, c.body, c.created FROM comments c").
+		WithArgs("admin", 10, 0).
+		WillReturnRows(rows)
+	repo := &CommentRepo{CommentDB: db}
+	comments, err := repo.GetCommentsByUsername(context.Background(), "admin", 0, 10)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+	if !reflect.DeepEqual(comments, expect) {
+		t.Errorf("results not match, want %v, have %v", expect, comments)
+		return
+	}
+
+	// DB error
+	mock.
+		ExpectQuery("SELECT c.id, c.post_id, c.post_title, c.body, c.created FROM comments c").
+		WithArgs("admin", 10, 0).
+		WillReturnError(ErrDB)
+	_, err = repo.GetCommentsByUsername(context.Background(), "admin", 0, 10)
+	if !errors.Is(err, ErrDB) {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+}
+
+func TestAddComment(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	post := &items.Post{ID: primitive.NewObjectID(), Title: "title"}
+	comment := &items.Comment{
+		ID:      primitive.NewObjectID(),
+		Author:  &items.User{ID: 1, Username: "admin"},
+		Body:    "abacaba",
+		Created: time.Now(),
+	}
+	mock.
+		ExpectExec("INSERT INTO `comments`").
+		WithArgs(comment.ID.Hex(), post.ID.Hex(), post.Title, 1, comment.Body, comment.Created).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	repo := &CommentRepo{CommentDB: db}
+	if err := repo.AddComment(context.Background(), post, comment); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
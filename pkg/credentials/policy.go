@@ -0,0 +1,118 @@
+package credentials
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"asperitas-clone/pkg/items"
+)
+
+//go:embed common-passwords.txt
+var commonPasswords string
+
+// DefaultUsernamePattern allows letters and digits of any script and _ . -
+var DefaultUsernamePattern = regexp.MustCompile(`^[\p{L}\p{N}_.-]+$`)
+
+// Policy are the rules for new credentials. Zero limits and a nil pattern or
+// list turn the rule off.
+type Policy struct {
+	UsernameMin     int
+	UsernameMax     int
+	UsernamePattern *regexp.Regexp
+	PasswordMin     int
+	PasswordMax     int
+	// Common passwords are rejected, they are matched case-insensitively.
+	Common map[string]bool
+}
+
+func DefaultPolicy() *Policy {
+	return &Policy{
+		UsernameMin:     3,
+		UsernameMax:     32,
+		UsernamePattern: DefaultUsernamePattern,
+		PasswordMin:     8,
+		PasswordMax:     128,
+		Common:          CommonPasswords(),
+	}
+}
+
+// CommonPasswords is the bundled list of breached passwords.
+func CommonPasswords() map[string]bool {
+	list, _ := ReadList(strings.NewReader(commonPasswords))
+	return list
+}
+
+// ReadList reads a password list with one password per line, lines starting
+// with # are comments.
+func ReadList(r io.Reader) (map[string]bool, error) {
+	list := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list[strings.ToLower(line)] = true
+	}
+	return list, scanner.Err()
+}
+
+// Check returns an error for every rule the credentials break. Passwords are
+// never echoed back.
+func (p *Policy) Check(username, password string) []items.MessageAuthError {
+	return append(p.CheckUsername(username), p.CheckPassword("password", username, password)...)
+}
+
+func (p *Policy) CheckUsername(username string) []items.MessageAuthError {
+	errs := []items.MessageAuthError{}
+	usernameError := func(msg string) {
+		errs = append(errs, items.MessageAuthError{
+			Location: "body",
+			Param:    "username",
+			Value:    username,
+			Msg:      msg,
+		})
+	}
+	length := utf8.RuneCountInString(username)
+	if p.UsernameMin > 0 && length < p.UsernameMin {
+		usernameError(fmt.Sprintf("must be at least %d characters long", p.UsernameMin))
+	}
+	if p.UsernameMax > 0 && length > p.UsernameMax {
+		usernameError(fmt.Sprintf("must be at most %d characters long", p.UsernameMax))
+	}
+	if p.UsernamePattern != nil && username != "" && !p.UsernamePattern.MatchString(username) {
+		usernameError("contains invalid characters")
+	}
+	return errs
+}
+
+// CheckPassword reports the errors under param, the name of the form field.
+func (p *Policy) CheckPassword(param, username, password string) []items.MessageAuthError {
+	errs := []items.MessageAuthError{}
+	passwordError := func(msg string) {
+		errs = append(errs, items.MessageAuthError{
+			Location: "body",
+			Param:    param,
+			Msg:      msg,
+		})
+	}
+	length := utf8.RuneCountInString(password)
+	if p.PasswordMin > 0 && length < p.PasswordMin {
+		passwordError(fmt.Sprintf("must be at least %d characters long", p.PasswordMin))
+	}
+	if p.PasswordMax > 0 && length > p.PasswordMax {
+		passwordError(fmt.Sprintf("must be at most %d characters long", p.PasswordMax))
+	}
+	if p.Common[strings.ToLower(password)] {
+		passwordError("is too common")
+	}
+	if password != "" && strings.EqualFold(password, username) {
+		passwordError("must differ from the username")
+	}
+	return errs
+}
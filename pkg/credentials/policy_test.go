@@ -0,0 +1,87 @@
+package credentials
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func params(t *testing.T, p *Policy, username, password string) []string {
+	result := []string{}
+	for _, err := range p.Check(username, password) {
+		if err.Param == "password" && err.Value != nil {
+			t.Errorf("password is echoed back: %v", err)
+		}
+		result = append(result, err.Param+" "+err.Msg)
+	}
+	return result
+}
+
+func TestPolicyCheck(t *testing.T) {
+	p := DefaultPolicy()
+
+	// Good credentials
+	if errs := p.Check("rené_42", "correct horse battery"); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+		return
+	}
+
+	// One error per rule
+	have := params(t, p, "a b", "Password")
+	want := []string{
+		"username contains invalid characters",
+		"password is too common",
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("results not match, want %v, have %v", want, have)
+		return
+	}
+	have = params(t, p, "", "")
+	want = []string{
+		"username must be at least 3 characters long",
+		"password must be at least 8 characters long",
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("results not match, want %v, have %v", want, have)
+		return
+	}
+	have = params(t, p, strings.Repeat("a", 33), "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA")
+	want = []string{
+		"username must be at most 32 characters long",
+		"password must differ from the username",
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("results not match, want %v, have %v", want, have)
+		return
+	}
+
+	// Password errors are reported under the given field
+	errs := p.CheckPassword("newPassword", "administrator", "Administrator")
+	if len(errs) != 2 || errs[0].Param != "newPassword" || errs[1].Msg != "must differ from the username" {
+		t.Errorf("unexpected errors: %v", errs)
+		return
+	}
+
+	// Rules can be turned off
+	if errs := (&Policy{}).Check("", "123"); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+		return
+	}
+}
+
+func TestReadList(t *testing.T) {
+	list, err := ReadList(strings.NewReader("# comment\n\nHunter2\n  qwerty \n"))
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	want := map[string]bool{"hunter2": true, "qwerty": true}
+	if !reflect.DeepEqual(list, want) {
+		t.Errorf("results not match, want %v, have %v", want, list)
+		return
+	}
+	if !CommonPasswords()["123456"] {
+		t.Errorf("expected bundled list to be loaded")
+		return
+	}
+}
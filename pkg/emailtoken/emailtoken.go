@@ -0,0 +1,84 @@
+package emailtoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const DefaultTTL = 48 * time.Hour
+
+var (
+	ErrInvalid = errors.New("token is invalid")
+	ErrExpired = errors.New("token is expired")
+)
+
+// Signer makes links that prove the user got mail at an address. Nothing is
+// stored, a token carries the user, the address and when it expires, signed
+// with Key. Changing the address makes older tokens useless, the caller
+// compares it with the current one.
+type Signer struct {
+	Key []byte
+	TTL time.Duration
+	now func() time.Time
+}
+
+func (s *Signer) time() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+func (s *Signer) mac(payload string) []byte {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func (s *Signer) Sign(userID int, email string) string {
+	ttl := s.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	payload := fmt.Sprintf("%d:%d:%s", userID, s.time().Add(ttl).Unix(), email)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(s.mac(payload))
+}
+
+// Verify returns the user and the address of a token signed with the same
+// key.
+func (s *Signer) Verify(token string) (int, string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return 0, "", ErrInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return 0, "", ErrInvalid
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sum, s.mac(string(payload))) {
+		return 0, "", ErrInvalid
+	}
+	var userID int
+	var expires int64
+	fields := strings.SplitN(string(payload), ":", 3)
+	if len(fields) != 3 {
+		return 0, "", ErrInvalid
+	}
+	if _, err := fmt.Sscan(fields[0], &userID); err != nil {
+		return 0, "", ErrInvalid
+	}
+	if _, err := fmt.Sscan(fields[1], &expires); err != nil {
+		return 0, "", ErrInvalid
+	}
+	if s.time().Unix() > expires {
+		return 0, "", ErrExpired
+	}
+	return userID, fields[2], nil
+}
@@ -0,0 +1,49 @@
+package emailtoken
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	now := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+	signer := &Signer{Key: []byte("key"), TTL: time.Hour, now: func() time.Time { return now }}
+
+	// Good token
+	token := signer.Sign(10, "bob@example.com")
+	userID, email, err := signer.Verify(token)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	} else if userID != 10 || email != "bob@example.com" {
+		t.Errorf("results not match, want %v %v, have %v %v", 10, "bob@example.com", userID, email)
+		return
+	}
+
+	// Other key
+	other := &Signer{Key: []byte("other key"), now: signer.now}
+	if _, _, err := other.Verify(token); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected ErrInvalid, got %v", err)
+		return
+	}
+
+	// Tampered
+	forged := &Signer{Key: []byte("key"), now: signer.now}
+	payload := strings.Split(forged.Sign(11, "bob@example.com"), ".")[0]
+	tampered := payload + "." + strings.Split(token, ".")[1]
+	for _, bad := range []string{tampered, "", "abc", "a.b.c", token + "x"} {
+		if _, _, err := signer.Verify(bad); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected ErrInvalid for %q, got %v", bad, err)
+			return
+		}
+	}
+
+	// Expired
+	now = now.Add(time.Hour + time.Second)
+	if _, _, err := signer.Verify(token); !errors.Is(err, ErrExpired) {
+		t.Errorf("expected ErrExpired, got %v", err)
+		return
+	}
+}
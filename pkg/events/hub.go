@@ -0,0 +1,133 @@
+package events
+
+import (
+	"sync"
+
+	"asperitas-clone/pkg/items"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	TypeVote           = "vote"
+	TypeComment        = "comment"
+	TypeCommentDeleted = "comment_deleted"
+	TypePostDeleted    = "post_deleted"
+
+	DefaultBuffer = 16
+)
+
+// Event describes a change of a post. Post holds the post as it is after the
+// change and is empty for deleted posts.
+type Event struct {
+	Type      string              `json:"type"`
+	PostID    primitive.ObjectID  `json:"postId"`
+	Post      *items.Post         `json:"post,omitempty"`
+	Comment   *items.Comment      `json:"comment,omitempty"`
+	CommentID *primitive.ObjectID `json:"commentId,omitempty"`
+}
+
+// Broker carries events between server instances. Every event published on
+// any instance is passed to deliver on every instance, this one included.
+type Broker interface {
+	Publish(Event) error
+	Subscribe(deliver func(Event)) (stop func(), err error)
+}
+
+type subscriber struct {
+	ch chan Event
+}
+
+// Hub fans events out to the clients watching a post. A client that doesn't
+// keep up and fills its buffer is disconnected instead of slowing down the
+// others, it is expected to reconnect and reload the post.
+type Hub struct {
+	broker    Broker
+	buffer    int
+	stop      func()
+	closeOnce sync.Once
+
+	mu   sync.Mutex
+	subs map[primitive.ObjectID]map[*subscriber]struct{}
+}
+
+func NewHub(broker Broker, buffer int) (*Hub, error) {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	h := &Hub{
+		broker: broker,
+		buffer: buffer,
+		subs:   make(map[primitive.ObjectID]map[*subscriber]struct{}),
+	}
+	stop, err := broker.Subscribe(h.dispatch)
+	if err != nil {
+		return nil, err
+	}
+	h.stop = stop
+	return h, nil
+}
+
+func (h *Hub) Publish(e Event) error {
+	return h.broker.Publish(e)
+}
+
+// Subscribe returns a channel of events of the post. The channel is closed
+// when cancel is called or when the subscriber falls behind.
+func (h *Hub) Subscribe(postID primitive.ObjectID) (<-chan Event, func()) {
+	sub := &subscriber{ch: make(chan Event, h.buffer)}
+	h.mu.Lock()
+	if h.subs[postID] == nil {
+		h.subs[postID] = make(map[*subscriber]struct{})
+	}
+	h.subs[postID][sub] = struct{}{}
+	h.mu.Unlock()
+	return sub.ch, func() {
+		h.mu.Lock()
+		h.remove(postID, sub)
+		h.mu.Unlock()
+	}
+}
+
+func (h *Hub) dispatch(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs[e.PostID] {
+		select {
+		case sub.ch <- e:
+		default:
+			h.remove(e.PostID, sub)
+		}
+	}
+	if e.Type == TypePostDeleted {
+		for sub := range h.subs[e.PostID] {
+			h.remove(e.PostID, sub)
+		}
+	}
+}
+
+// remove must be called with mu held.
+func (h *Hub) remove(postID primitive.ObjectID, sub *subscriber) {
+	if _, ok := h.subs[postID][sub]; !ok {
+		return
+	}
+	delete(h.subs[postID], sub)
+	if len(h.subs[postID]) == 0 {
+		delete(h.subs, postID)
+	}
+	close(sub.ch)
+}
+
+// Close disconnects all subscribers, it is safe to call more than once.
+func (h *Hub) Close() {
+	h.closeOnce.Do(func() {
+		h.stop()
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for postID, subs := range h.subs {
+			for sub := range subs {
+				h.remove(postID, sub)
+			}
+		}
+	})
+}
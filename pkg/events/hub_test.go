@@ -0,0 +1,94 @@
+package events
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestHubDelivers(t *testing.T) {
+	hub, err := NewHub(NewLocalBroker(), 2)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+		return
+	}
+	defer hub.Close()
+	postID := primitive.NewObjectID()
+	other := primitive.NewObjectID()
+	stream, cancel := hub.Subscribe(postID)
+
+	// Events of other posts are not delivered
+	hub.Publish(Event{Type: TypeVote, PostID: other})
+	hub.Publish(Event{Type: TypeVote, PostID: postID})
+	e := <-stream
+	if e.PostID != postID || e.Type != TypeVote {
+		t.Errorf("unexpected event %+v", e)
+		return
+	}
+	select {
+	case e := <-stream:
+		t.Errorf("unexpected event %+v", e)
+		return
+	default:
+	}
+
+	cancel()
+	if _, ok := <-stream; ok {
+		t.Errorf("expected closed channel after cancel")
+		return
+	}
+	// Calling cancel twice is harmless
+	cancel()
+}
+
+func TestHubSlowSubscriber(t *testing.T) {
+	hub, err := NewHub(NewLocalBroker(), 1)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+		return
+	}
+	defer hub.Close()
+	postID := primitive.NewObjectID()
+	slow, cancel := hub.Subscribe(postID)
+	defer cancel()
+
+	hub.Publish(Event{Type: TypeVote, PostID: postID})
+	hub.Publish(Event{Type: TypeVote, PostID: postID})
+	if _, ok := <-slow; !ok {
+		t.Errorf("expected buffered event")
+		return
+	}
+	if _, ok := <-slow; ok {
+		t.Errorf("expected slow subscriber to be disconnected")
+		return
+	}
+}
+
+func TestHubPostDeleted(t *testing.T) {
+	hub, err := NewHub(NewLocalBroker(), 0)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+		return
+	}
+	postID := primitive.NewObjectID()
+	stream, cancel := hub.Subscribe(postID)
+	defer cancel()
+
+	hub.Publish(Event{Type: TypePostDeleted, PostID: postID})
+	e, ok := <-stream
+	if !ok || e.Type != TypePostDeleted {
+		t.Errorf("expected post_deleted event, got %+v", e)
+		return
+	}
+	if _, ok := <-stream; ok {
+		t.Errorf("expected closed channel after post_deleted")
+		return
+	}
+
+	other, _ := hub.Subscribe(primitive.NewObjectID())
+	hub.Close()
+	if _, ok := <-other; ok {
+		t.Errorf("expected closed channel after Close")
+		return
+	}
+}
@@ -0,0 +1,36 @@
+package events
+
+import "sync"
+
+// LocalBroker delivers events inside a single process.
+type LocalBroker struct {
+	mu       sync.RWMutex
+	seq      int
+	handlers map[int]func(Event)
+}
+
+func NewLocalBroker() *LocalBroker {
+	return &LocalBroker{handlers: make(map[int]func(Event))}
+}
+
+func (b *LocalBroker) Publish(e Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, deliver := range b.handlers {
+		deliver(e)
+	}
+	return nil
+}
+
+func (b *LocalBroker) Subscribe(deliver func(Event)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	id := b.seq
+	b.handlers[id] = deliver
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+	}, nil
+}
@@ -0,0 +1,92 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	eventsCollectionSize = 16 << 20
+	tailTimeout          = 5 * time.Second
+	publishTimeout       = 5 * time.Second
+	retryDelay           = time.Second
+)
+
+type eventDoc struct {
+	ID    primitive.ObjectID `bson:"_id"`
+	Event Event              `bson:"event"`
+}
+
+// MongoBroker shares events between instances through a capped collection
+// that every instance tails.
+type MongoBroker struct {
+	Events *mongo.Collection
+}
+
+func NewMongoBroker(collection *mongo.Collection) (*MongoBroker, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	err := collection.Database().RunCommand(ctx, bson.D{
+		{Key: "create", Value: collection.Name()},
+		{Key: "capped", Value: true},
+		{Key: "size", Value: eventsCollectionSize},
+	}).Err()
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == 48 {
+		// collection already exists
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &MongoBroker{Events: collection}, nil
+}
+
+func (b *MongoBroker) Publish(e Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	_, err := b.Events.InsertOne(ctx, eventDoc{ID: primitive.NewObjectID(), Event: e})
+	return err
+}
+
+func (b *MongoBroker) Subscribe(deliver func(Event)) (func(), error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go b.tail(ctx, deliver)
+	return cancel, nil
+}
+
+func (b *MongoBroker) tail(ctx context.Context, deliver func(Event)) {
+	lastID := primitive.NewObjectIDFromTimestamp(time.Now())
+	opts := options.Find().
+		SetCursorType(options.TailableAwait).
+		SetMaxAwaitTime(tailTimeout).
+		SetSort(bson.D{{Key: "$natural", Value: 1}})
+	for {
+		cursor, err := b.Events.Find(ctx, bson.M{"_id": bson.M{"$gt": lastID}}, opts)
+		if err == nil {
+			for cursor.Next(ctx) {
+				doc := eventDoc{}
+				if cursor.Decode(&doc) != nil {
+					continue
+				}
+				lastID = doc.ID
+				deliver(doc.Event)
+			}
+			err = cursor.Err()
+			cursor.Close(context.Background())
+		}
+		// a tailable cursor also dies without an error, on an empty
+		// collection right away, so every new one waits
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"asperitas-clone/pkg/credentials"
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/session"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+const (
+	ContentAnonymize = "anonymize"
+	ContentRemove    = "remove"
+)
+
+// AccountHandler lets users manage their own account.
+type AccountHandler struct {
+	UserRepo UserRepositoryInterface
+	PostRepo PostRepositoryInterface
+	Sessions session.SessionManagerInterface
+	Search   SearchIndexInterface
+	// Deleter deletes the posts of removed accounts.
+	Deleter *PostDeleter
+	Policy  *credentials.Policy
+	Logger  *zap.SugaredLogger
+}
+
+type passwordChange struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type usernameChange struct {
+	Username string `json:"username"`
+}
+
+type accountDeletion struct {
+	Password string `json:"password"`
+	// Content is ContentAnonymize or ContentRemove.
+	Content string `json:"content"`
+}
+
+// currentUser answers the request itself when there is no logged in user.
+func currentUser(w http.ResponseWriter, r *http.Request, sessions session.SessionManagerInterface, users UserRepositoryInterface) (*session.Session, *items.User, bool) {
+	sess, err := sessions.Check(r)
+	if err != nil {
+		http.Error(w, `Can't get session`, http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if sess == nil {
+		http.Redirect(w, r, "/", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+	user, err := users.GetUserByID(r.Context(), sess.UserID)
+	if err != nil {
+		http.Error(w, `Can't get user`, http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if user == nil {
+		http.Error(w, `Can't get user`, http.StatusBadRequest)
+		return nil, nil, false
+	}
+	return sess, user, true
+}
+
+// checkPassword answers 422 when password is not the password of the user.
+func checkPassword(w http.ResponseWriter, r *http.Request, users UserRepositoryInterface, user *items.User, param, password string) bool {
+	_, err := users.Authorize(r.Context(), user.Username, password)
+	if errors.Is(err, items.ErrBadPass) || errors.Is(err, items.ErrNoUser) {
+		writeErrors(w, []items.MessageAuthError{{
+			Location: "body",
+			Param:    param,
+			Msg:      "is wrong",
+		}})
+		return false
+	} else if err != nil {
+		http.Error(w, `Can't check password`, http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// ChangePassword sets a new password and ends all other sessions of the user.
+func (h *AccountHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	change := passwordChange{}
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		http.Error(w, `Can't decode`, http.StatusInternalServerError)
+		return
+	}
+	sess, user, ok := currentUser(w, r, h.Sessions, h.UserRepo)
+	if !ok {
+		return
+	}
+	if !checkPassword(w, r, h.UserRepo, user, "currentPassword", change.CurrentPassword) {
+		return
+	}
+	if h.Policy != nil {
+		if errs := h.Policy.CheckPassword("newPassword", user.Username, change.NewPassword); len(errs) != 0 {
+			writeErrors(w, errs)
+			return
+		}
+	}
+	err := h.UserRepo.ChangePassword(r.Context(), user.ID, change.NewPassword)
+	if err != nil {
+		http.Error(w, `Can't change password`, http.StatusInternalServerError)
+		return
+	}
+	err = h.Sessions.DestroyOthers(r.Context(), user.ID, sess.ID)
+	if err != nil {
+		http.Error(w, `Can't end other sessions`, http.StatusInternalServerError)
+		return
+	}
+	logger(r, h.Logger).Infow("password changed", "user", user.ID)
+	w.Write([]byte(`{"message":"success"}`))
+}
+
+// ChangeUsername renames the user everywhere and answers with a new token.
+func (h *AccountHandler) ChangeUsername(w http.ResponseWriter, r *http.Request) {
+	change := usernameChange{}
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		http.Error(w, `Can't decode`, http.StatusInternalServerError)
+		return
+	}
+	_, user, ok := currentUser(w, r, h.Sessions, h.UserRepo)
+	if !ok {
+		return
+	}
+	if h.Policy != nil {
+		if errs := h.Policy.CheckUsername(change.Username); len(errs) != 0 {
+			writeErrors(w, errs)
+			return
+		}
+	}
+	err := h.UserRepo.ChangeUsername(r.Context(), user.ID, change.Username)
+	if msg, ok := usernameErrors[err]; ok {
+		writeErrors(w, []items.MessageAuthError{{
+			Location: "body",
+			Param:    "username",
+			Value:    change.Username,
+			Msg:      msg,
+		}})
+		return
+	} else if err != nil {
+		http.Error(w, `Can't change username`, http.StatusInternalServerError)
+		return
+	}
+	// posts and comments keep a copy of the name, a retry renames them again
+	err = h.PostRepo.RenameAuthor(r.Context(), user.ID, change.Username)
+	if err != nil {
+		logger(r, h.Logger).Errorw("can't rename author of posts", "user", user.ID, "err", err)
+		http.Error(w, `Can't rename posts`, http.StatusInternalServerError)
+		return
+	}
+	if h.Search != nil {
+		posts, err := h.PostRepo.GetPostsByUsername(r.Context(), change.Username)
+		if err != nil {
+			logger(r, h.Logger).Warnw("can't reindex renamed posts", "user", user.ID, "err", err)
+		}
+		for _, post := range posts {
+			h.Search.Index(r.Context(), post)
+		}
+		// comments are indexed with their posts
+		posts, err = h.PostRepo.GetPostsByCommenter(r.Context(), user.ID)
+		if err != nil {
+			logger(r, h.Logger).Warnw("can't reindex commented posts", "user", user.ID, "err", err)
+		}
+		for _, post := range posts {
+			h.Search.Index(r.Context(), post)
+		}
+	}
+
+	token, err := createToken(change.Username, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger(r, h.Logger).Infow("username changed", "user", user.ID, "from", user.Username, "to", change.Username)
+	w.Write(token)
+}
+
+// DeleteAccount deletes the user. Their posts and comments are either kept
+// under items.DeletedUsername or removed.
+func (h *AccountHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	deletion := accountDeletion{}
+	if err := json.NewDecoder(r.Body).Decode(&deletion); err != nil {
+		http.Error(w, `Can't decode`, http.StatusInternalServerError)
+		return
+	}
+	if deletion.Content != ContentAnonymize && deletion.Content != ContentRemove {
+		writeErrors(w, []items.MessageAuthError{{
+			Location: "body",
+			Param:    "content",
+			Value:    deletion.Content,
+			Msg:      "must be anonymize or remove",
+		}})
+		return
+	}
+	_, user, ok := currentUser(w, r, h.Sessions, h.UserRepo)
+	if !ok {
+		return
+	}
+	if !checkPassword(w, r, h.UserRepo, user, "password", deletion.Password) {
+		return
+	}
+
+	// content goes first, the account is still there for a retry if it fails
+	posts, err := h.PostRepo.GetPostsByUsername(r.Context(), user.Username)
+	if err != nil {
+		http.Error(w, `Can't get posts`, http.StatusInternalServerError)
+		return
+	}
+	commented := h.commentedPosts(r, user.ID)
+	remove := deletion.Content == ContentRemove
+	if remove {
+		for _, post := range posts {
+			err = h.Deleter.Delete(r, post.ID, user)
+			if err != nil && !errors.Is(err, items.ErrPostNotFound) {
+				http.Error(w, `Can't delete posts`, http.StatusInternalServerError)
+				return
+			}
+		}
+		err = h.PostRepo.DeleteAuthorComments(r.Context(), user.ID)
+	} else {
+		err = h.PostRepo.AnonymizeAuthor(r.Context(), user.ID)
+		if err == nil && h.Search != nil {
+			for _, post := range posts {
+				post.Author = items.DeletedUser()
+				h.Search.Index(r.Context(), post)
+			}
+		}
+	}
+	if err != nil {
+		http.Error(w, `Can't delete comments`, http.StatusInternalServerError)
+		return
+	}
+	h.reindex(r, commented)
+
+	err = h.UserRepo.DeleteUser(r.Context(), user.ID, remove)
+	if err != nil {
+		http.Error(w, `Can't delete user`, http.StatusInternalServerError)
+		return
+	}
+	session.ExpireCookie(w)
+	logger(r, h.Logger).Infow("account deleted", "user", user.ID, "content", deletion.Content)
+	w.Write([]byte(`{"message":"success"}`))
+}
+
+// commentedPosts returns the ids of the posts with comments of the user,
+// their index entries go stale when the comments change.
+func (h *AccountHandler) commentedPosts(r *http.Request, userID int) []primitive.ObjectID {
+	if h.Search == nil {
+		return nil
+	}
+	posts, err := h.PostRepo.GetPostsByCommenter(r.Context(), userID)
+	if err != nil {
+		logger(r, h.Logger).Warnw("can't find commented posts", "user", userID, "err", err)
+		return nil
+	}
+	ids := make([]primitive.ObjectID, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+	return ids
+}
+
+// reindex indexes the posts as they are now, deleted ones were removed
+// from the index already.
+func (h *AccountHandler) reindex(r *http.Request, ids []primitive.ObjectID) {
+	if h.Search == nil || len(ids) == 0 {
+		return
+	}
+	posts, err := h.PostRepo.GetPostsByIDs(r.Context(), ids)
+	if err != nil {
+		logger(r, h.Logger).Warnw("can't reindex commented posts", "err", err)
+		return
+	}
+	for _, post := range posts {
+		h.Search.Index(r.Context(), post)
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"asperitas-clone/pkg/items"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mockgen -source="comment.go" -destination="comment_mock.go" -package=handlers CommentRepositoryInterface
+
+type CommentRepositoryInterface interface {
+	AddComment(context.Context, *items.Post, *items.Comment) error
+	DeleteComment(context.Context, primitive.ObjectID) error
+	DeletePostComments(context.Context, primitive.ObjectID) error
+	GetCommentsByUsername(context.Context, string, int, int) ([]*items.UserComment, error)
+}
+
+func (h *UserHandler) GetComments(w http.ResponseWriter, r *http.Request) {
+	username, ok := mux.Vars(r)["USERNAME"]
+	if !ok {
+		http.Error(w, `Can't get USERNAME`, http.StatusInternalServerError)
+		return
+	}
+	offset, limit, err := parsePage(r)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	elems, err := h.Comments.GetCommentsByUsername(r.Context(), username, offset, limit)
+	if err != nil {
+		http.Error(w, `Can't get comments`, http.StatusInternalServerError)
+		return
+	}
+
+	respJSON, err := json.Marshal(elems)
+	if err != nil {
+		http.Error(w, `json marshalling error`, http.StatusInternalServerError)
+		return
+	}
+	w.Write(respJSON)
+}
@@ -0,0 +1,94 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: comment.go
+
+// Package handlers is a generated GoMock package.
+package handlers
+
+import (
+	items "asperitas-clone/pkg/items"
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	primitive "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MockCommentRepositoryInterface is a mock of CommentRepositoryInterface interface.
+type MockCommentRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockCommentRepositoryInterfaceMockRecorder
+}
+
+// MockCommentRepositoryInterfaceMockRecorder is the mock recorder for MockCommentRepositoryInterface.
+type MockCommentRepositoryInterfaceMockRecorder struct {
+	mock *MockCommentRepositoryInterface
+}
+
+// NewMockCommentRepositoryInterface creates a new mock instance.
+func NewMockCommentRepositoryInterface(ctrl *gomock.Controller) *MockCommentRepositoryInterface {
+	mock := &MockCommentRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockCommentRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCommentRepositoryInterface) EXPECT() *MockCommentRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// AddComment mocks base method.
+func (m *MockCommentRepositoryInterface) AddComment(arg0 context.Context, arg1 *items.Post, arg2 *items.Comment) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddComment", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddComment indicates an expected call of AddComment.
+func (mr *MockCommentRepositoryInterfaceMockRecorder) AddComment(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddComment", reflect.TypeOf((*MockCommentRepositoryInterface)(nil).AddComment), arg0, arg1, arg2)
+}
+
+// DeleteComment mocks base method.
+func (m *MockCommentRepositoryInterface) DeleteComment(arg0 context.Context, arg1 primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteComment", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteComment indicates an expected call of DeleteComment.
+func (mr *MockCommentRepositoryInterfaceMockRecorder) DeleteComment(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteComment", reflect.TypeOf((*MockCommentRepositoryInterface)(nil).DeleteComment), arg0, arg1)
+}
+
+// DeletePostComments mocks base method.
+func (m *MockCommentRepositoryInterface) DeletePostComments(arg0 context.Context, arg1 primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletePostComments", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeletePostComments indicates an expected call of DeletePostComments.
+func (mr *MockCommentRepositoryInterfaceMockRecorder) DeletePostComments(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePostComments", reflect.TypeOf((*MockCommentRepositoryInterface)(nil).DeletePostComments), arg0, arg1)
+}
+
+// GetCommentsByUsername mocks base method.
+func (m *MockCommentRepositoryInterface) GetCommentsByUsername(arg0 context.Context, arg1 string, arg2, arg3 int) ([]*items.UserComment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCommentsByUsername", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]*items.UserComment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCommentsByUsername indicates an expected call of GetCommentsByUsername.
+func (mr *MockCommentRepositoryInterfaceMockRecorder) GetCommentsByUsername(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommentsByUsername", reflect.TypeOf((*MockCommentRepositoryInterface)(nil).GetCommentsByUsername), arg0, arg1, arg2, arg3)
+}
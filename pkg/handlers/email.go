@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"asperitas-clone/pkg/emailtoken"
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/mail"
+	"asperitas-clone/pkg/session"
+
+	"go.uber.org/zap"
+)
+
+// mockgen -source="email.go" -destination="email_mock.go" -package=handlers EmailRepositoryInterface
+
+type EmailRepositoryInterface interface {
+	GetEmail(context.Context, int) (string, bool, error)
+	SetEmail(context.Context, int, string) error
+	VerifyEmail(context.Context, int, string) error
+	MarkVerificationSent(context.Context, int, time.Duration) (bool, error)
+	MarkResetSent(context.Context, int, time.Duration) (bool, error)
+}
+
+const DefaultResendInterval = 5 * time.Minute
+
+var errVerificationThrottled = errors.New("verification mail was sent recently")
+
+// EmailHandler manages the address of a user and proves it belongs to them
+// with signed links sent there.
+type EmailHandler struct {
+	UserRepo UserRepositoryInterface
+	Emails   EmailRepositoryInterface
+	Sessions session.SessionManagerInterface
+	Mailer   MailerInterface
+	Signer   *emailtoken.Signer
+	// BaseURL is where the site is reachable, links in mails point there.
+	BaseURL string
+	// ResendInterval is the least time between verification mails of a user.
+	ResendInterval time.Duration
+	Logger         *zap.SugaredLogger
+}
+
+type emailInfo struct {
+	Email    string `json:"email"`
+	Verified bool   `json:"verified"`
+}
+
+type emailChange struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type emailVerification struct {
+	Token string `json:"token"`
+}
+
+func (h *EmailHandler) resendInterval() time.Duration {
+	if h.ResendInterval <= 0 {
+		return DefaultResendInterval
+	}
+	return h.ResendInterval
+}
+
+// sendVerification mails a verification link for email, at most once per
+// ResendInterval.
+func (h *EmailHandler) sendVerification(r *http.Request, user *items.User, email string) error {
+	ok, err := h.Emails.MarkVerificationSent(r.Context(), user.ID, h.resendInterval())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errVerificationThrottled
+	}
+	link := h.BaseURL + "/verify-email?token=" + url.QueryEscape(h.Signer.Sign(user.ID, email))
+	err = h.Mailer.Send(r.Context(), &mail.Message{
+		To:      email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"please confirm this is your address by opening\n\n"+
+			"%s\n\n"+
+			"If you didn't add it to an account, ignore this mail.\n",
+			user.Username, link),
+	})
+	if err != nil {
+		return err
+	}
+	logger(r, h.Logger).Infow("verification mail sent", "user", user.ID)
+	return nil
+}
+
+// GetEmail shows the address of the logged in user.
+func (h *EmailHandler) GetEmail(w http.ResponseWriter, r *http.Request) {
+	_, user, ok := currentUser(w, r, h.Sessions, h.UserRepo)
+	if !ok {
+		return
+	}
+	email, verified, err := h.Emails.GetEmail(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	resp, err := json.Marshal(emailInfo{Email: email, Verified: verified})
+	if err != nil {
+		http.Error(w, `Can't marshal email`, http.StatusInternalServerError)
+		return
+	}
+	w.Write(resp)
+}
+
+// ChangeEmail sets a new, unverified address and mails a link to verify it,
+// an empty one removes the address. Password resets go to this address, so
+// the password is asked for.
+func (h *EmailHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	change := emailChange{}
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		http.Error(w, `Can't decode`, http.StatusInternalServerError)
+		return
+	}
+	_, user, ok := currentUser(w, r, h.Sessions, h.UserRepo)
+	if !ok {
+		return
+	}
+	if !checkPassword(w, r, h.UserRepo, user, "password", change.Password) {
+		return
+	}
+	err := h.Emails.SetEmail(r.Context(), user.ID, change.Email)
+	if msg, ok := emailErrors[err]; ok {
+		writeErrors(w, []items.MessageAuthError{{
+			Location: "body",
+			Param:    "email",
+			Value:    change.Email,
+			Msg:      msg,
+		}})
+		return
+	} else if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	email, verified, err := h.Emails.GetEmail(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	if email != "" {
+		// a throttled user asks for the mail again with ResendVerification
+		err := h.sendVerification(r, user, email)
+		if errors.Is(err, errVerificationThrottled) {
+			logger(r, h.Logger).Infow("verification mail was sent recently", "user", user.ID)
+		} else if err != nil {
+			logger(r, h.Logger).Errorw("can't send verification mail", "user", user.ID, "err", err)
+		}
+	}
+	resp, err := json.Marshal(emailInfo{Email: email, Verified: verified})
+	if err != nil {
+		http.Error(w, `Can't marshal email`, http.StatusInternalServerError)
+		return
+	}
+	w.Write(resp)
+}
+
+// ResendVerification mails the link again, 429 if the last one is too
+// recent.
+func (h *EmailHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	_, user, ok := currentUser(w, r, h.Sessions, h.UserRepo)
+	if !ok {
+		return
+	}
+	email, verified, err := h.Emails.GetEmail(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	if email == "" || verified {
+		jsonError(w, "there is no address to verify", http.StatusConflict)
+		return
+	}
+	err = h.sendVerification(r, user, email)
+	if errors.Is(err, errVerificationThrottled) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(h.resendInterval().Seconds()))))
+		jsonError(w, "verification mail was sent recently, try again later", http.StatusTooManyRequests)
+		return
+	} else if err != nil {
+		logger(r, h.Logger).Errorw("can't send verification mail", "user", user.ID, "err", err)
+		jsonError(w, "can't send mail", http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte(`{"message":"success"}`))
+}
+
+// VerifyEmail checks the token of a verification link. It needs no session,
+// the link may be opened on another device.
+func (h *EmailHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	verification := emailVerification{}
+	if err := json.NewDecoder(r.Body).Decode(&verification); err != nil {
+		http.Error(w, `Can't decode`, http.StatusInternalServerError)
+		return
+	}
+	userID, email, err := h.Signer.Verify(verification.Token)
+	if err != nil {
+		badVerificationToken(w)
+		return
+	}
+	current, _, err := h.Emails.GetEmail(r.Context(), userID)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	// the address changed since the mail was sent
+	if current != email {
+		badVerificationToken(w)
+		return
+	}
+	err = h.Emails.VerifyEmail(r.Context(), userID, email)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	logger(r, h.Logger).Infow("email verified", "user", userID)
+	w.Write([]byte(`{"message":"success"}`))
+}
+
+func badVerificationToken(w http.ResponseWriter) {
+	writeErrors(w, []items.MessageAuthError{{
+		Location: "body",
+		Param:    "token",
+		Msg:      "is invalid or expired",
+	}})
+}
+
+// emailVerified answers 403 unless the user has verified their address.
+func emailVerified(w http.ResponseWriter, r *http.Request, emails EmailRepositoryInterface, userID int) bool {
+	_, verified, err := emails.GetEmail(r.Context(), userID)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return false
+	}
+	if !verified {
+		jsonError(w, "verify your email first", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: email.go
+
+// Package handlers is a generated GoMock package.
+package handlers
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockEmailRepositoryInterface is a mock of EmailRepositoryInterface interface.
+type MockEmailRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockEmailRepositoryInterfaceMockRecorder
+}
+
+// MockEmailRepositoryInterfaceMockRecorder is the mock recorder for MockEmailRepositoryInterface.
+type MockEmailRepositoryInterfaceMockRecorder struct {
+	mock *MockEmailRepositoryInterface
+}
+
+// NewMockEmailRepositoryInterface creates a new mock instance.
+func NewMockEmailRepositoryInterface(ctrl *gomock.Controller) *MockEmailRepositoryInterface {
+	mock := &MockEmailRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockEmailRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockEmailRepositoryInterface) EXPECT() *MockEmailRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// GetEmail mocks base method.
+func (m *MockEmailRepositoryInterface) GetEmail(arg0 context.Context, arg1 int) (string, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEmail", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetEmail indicates an expected call of GetEmail.
+func (mr *MockEmailRepositoryInterfaceMockRecorder) GetEmail(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEmail", reflect.TypeOf((*MockEmailRepositoryInterface)(nil).GetEmail), arg0, arg1)
+}
+
+// MarkResetSent mocks base method.
+func (m *MockEmailRepositoryInterface) MarkResetSent(arg0 context.Context, arg1 int, arg2 time.Duration) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkResetSent", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MarkResetSent indicates an expected call of MarkResetSent.
+func (mr *MockEmailRepositoryInterfaceMockRecorder) MarkResetSent(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkResetSent", reflect.TypeOf((*MockEmailRepositoryInterface)(nil).MarkResetSent), arg0, arg1, arg2)
+}
+
+// MarkVerificationSent mocks base method.
+func (m *MockEmailRepositoryInterface) MarkVerificationSent(arg0 context.Context, arg1 int, arg2 time.Duration) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkVerificationSent", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MarkVerificationSent indicates an expected call of MarkVerificationSent.
+func (mr *MockEmailRepositoryInterfaceMockRecorder) MarkVerificationSent(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkVerificationSent", reflect.TypeOf((*MockEmailRepositoryInterface)(nil).MarkVerificationSent), arg0, arg1, arg2)
+}
+
+// SetEmail mocks base method.
+func (m *MockEmailRepositoryInterface) SetEmail(arg0 context.Context, arg1 int, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetEmail", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetEmail indicates an expected call of SetEmail.
+func (mr *MockEmailRepositoryInterfaceMockRecorder) SetEmail(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetEmail", reflect.TypeOf((*MockEmailRepositoryInterface)(nil).SetEmail), arg0, arg1, arg2)
+}
+
+// VerifyEmail mocks base method.
+func (m *MockEmailRepositoryInterface) VerifyEmail(arg0 context.Context, arg1 int, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyEmail", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VerifyEmail indicates an expected call of VerifyEmail.
+func (mr *MockEmailRepositoryInterfaceMockRecorder) VerifyEmail(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyEmail", reflect.TypeOf((*MockEmailRepositoryInterface)(nil).VerifyEmail), arg0, arg1, arg2)
+}
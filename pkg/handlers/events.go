@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"asperitas-clone/pkg/events"
+	"asperitas-clone/pkg/items"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const defaultHeartbeat = 25 * time.Second
+
+// mockgen -source="events.go" -destination="events_mock.go" -package=handlers EventHubInterface
+
+type EventHubInterface interface {
+	Publish(events.Event) error
+	Subscribe(primitive.ObjectID) (<-chan events.Event, func())
+}
+
+type EventHandler struct {
+	Hub      EventHubInterface
+	PostRepo PostRepositoryInterface
+	// Heartbeat is how often a comment line is sent to keep idle connections
+	// open through proxies.
+	Heartbeat time.Duration
+}
+
+// Stream pushes changes of a post to the client as Server-Sent Events until
+// the client goes away or the post is deleted.
+func (h *EventHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	postid, ok := mux.Vars(r)["POST_ID"]
+	postuid, err := primitive.ObjectIDFromHex(postid)
+	if !ok || err != nil {
+		http.Error(w, `Can't get POST_ID`, http.StatusInternalServerError)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, `Streaming unsupported`, http.StatusInternalServerError)
+		return
+	}
+	_, err = h.PostRepo.GetPostByID(r.Context(), postuid)
+	if errors.Is(err, items.ErrPostNotFound) {
+		jsonError(w, "post not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, `Can't get post`, http.StatusInternalServerError)
+		return
+	}
+
+	stream, cancel := h.Hub.Subscribe(postuid)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := h.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = defaultHeartbeat
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case e, ok := <-stream:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		}
+		flusher.Flush()
+	}
+}
+
+func (h *PostHandler) publish(r *http.Request, e events.Event) {
+	if h.Events == nil {
+		return
+	}
+	if err := h.Events.Publish(e); err != nil {
+		logger(r, h.Logger).Warnw("can't publish post event", "post", e.PostID.Hex(), "type", e.Type, "err", err)
+	}
+}
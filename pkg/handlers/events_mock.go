@@ -0,0 +1,65 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: events.go
+
+// Package handlers is a generated GoMock package.
+package handlers
+
+import (
+	events "asperitas-clone/pkg/events"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	primitive "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MockEventHubInterface is a mock of EventHubInterface interface.
+type MockEventHubInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockEventHubInterfaceMockRecorder
+}
+
+// MockEventHubInterfaceMockRecorder is the mock recorder for MockEventHubInterface.
+type MockEventHubInterfaceMockRecorder struct {
+	mock *MockEventHubInterface
+}
+
+// NewMockEventHubInterface creates a new mock instance.
+func NewMockEventHubInterface(ctrl *gomock.Controller) *MockEventHubInterface {
+	mock := &MockEventHubInterface{ctrl: ctrl}
+	mock.recorder = &MockEventHubInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockEventHubInterface) EXPECT() *MockEventHubInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Publish mocks base method.
+func (m *MockEventHubInterface) Publish(arg0 events.Event) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Publish", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Publish indicates an expected call of Publish.
+func (mr *MockEventHubInterfaceMockRecorder) Publish(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Publish", reflect.TypeOf((*MockEventHubInterface)(nil).Publish), arg0)
+}
+
+// Subscribe mocks base method.
+func (m *MockEventHubInterface) Subscribe(arg0 primitive.ObjectID) (<-chan events.Event, func()) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Subscribe", arg0)
+	ret0, _ := ret[0].(<-chan events.Event)
+	ret1, _ := ret[1].(func())
+	return ret0, ret1
+}
+
+// Subscribe indicates an expected call of Subscribe.
+func (mr *MockEventHubInterfaceMockRecorder) Subscribe(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockEventHubInterface)(nil).Subscribe), arg0)
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/session"
+
+	"github.com/gorilla/mux"
+)
+
+// mockgen -source="feed.go" -destination="feed_mock.go" -package=handlers SubscriptionRepositoryInterface
+
+type SubscriptionRepositoryInterface interface {
+	Subscribe(context.Context, int, string) error
+	Unsubscribe(context.Context, int, string) error
+	GetSubscriptions(context.Context, int) ([]string, error)
+}
+
+const (
+	// DefaultFeedWindow is how far back the feed looks for posts. A week old
+	// post needs 10^13 times the score of a new one to rank above it.
+	DefaultFeedWindow = 7 * 24 * time.Hour
+	// DefaultFeedCandidates is how many posts are ranked at most, the feed
+	// ends after them.
+	DefaultFeedCandidates = 1000
+)
+
+type FeedHandler struct {
+	PostRepo      PostRepositoryInterface
+	Subscriptions SubscriptionRepositoryInterface
+	Sessions      session.SessionManagerInterface
+	Saved         SavedRepositoryInterface
+	// DefaultCategories make up the feed of logged out users and of users
+	// without subscriptions, all categories are used when it is empty.
+	DefaultCategories []string
+	// Window and MaxCandidates limit the posts ranked for the feed, they
+	// default to DefaultFeedWindow and DefaultFeedCandidates.
+	Window        time.Duration
+	MaxCandidates int
+}
+
+func (h *FeedHandler) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		http.Error(w, `Can't get session`, http.StatusInternalServerError)
+		return
+	}
+	if sess == nil {
+		http.Redirect(w, r, "/", http.StatusUnauthorized)
+		return
+	}
+	categories, err := h.Subscriptions.GetSubscriptions(r.Context(), sess.UserID)
+	if err != nil {
+		http.Error(w, `Can't get subscriptions`, http.StatusInternalServerError)
+		return
+	}
+
+	respJSON, err := json.Marshal(categories)
+	if err != nil {
+		http.Error(w, `json marshalling error`, http.StatusInternalServerError)
+		return
+	}
+	w.Write(respJSON)
+}
+
+func (h *FeedHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	h.setSubscribed(w, r, true)
+}
+
+func (h *FeedHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	h.setSubscribed(w, r, false)
+}
+
+func (h *FeedHandler) setSubscribed(w http.ResponseWriter, r *http.Request, subscribed bool) {
+	category, ok := mux.Vars(r)["CATEGORY_NAME"]
+	if !ok {
+		http.Error(w, `Can't get category`, http.StatusInternalServerError)
+		return
+	}
+	if !isCategory(category) {
+		jsonError(w, "unknown category", http.StatusNotFound)
+		return
+	}
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		http.Error(w, `Can't get session`, http.StatusInternalServerError)
+		return
+	}
+	if sess == nil {
+		http.Redirect(w, r, "/", http.StatusUnauthorized)
+		return
+	}
+	if subscribed {
+		err = h.Subscriptions.Subscribe(r.Context(), sess.UserID, category)
+	} else {
+		err = h.Subscriptions.Unsubscribe(r.Context(), sess.UserID, category)
+	}
+	if err != nil {
+		http.Error(w, `Can't change subscription`, http.StatusInternalServerError)
+		return
+	}
+	h.GetSubscriptions(w, r)
+}
+
+func (h *FeedHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	offset, limit, err := parsePage(r)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	categories := h.DefaultCategories
+	sess, err := h.Sessions.Check(r)
+	if err == nil && sess != nil {
+		subscribed, err := h.Subscriptions.GetSubscriptions(r.Context(), sess.UserID)
+		if err != nil {
+			http.Error(w, `Can't get subscriptions`, http.StatusInternalServerError)
+			return
+		}
+		if len(subscribed) != 0 {
+			categories = subscribed
+		}
+	}
+
+	window := h.Window
+	if window <= 0 {
+		window = DefaultFeedWindow
+	}
+	maxCandidates := h.MaxCandidates
+	if maxCandidates <= 0 {
+		maxCandidates = DefaultFeedCandidates
+	}
+	elems, err := h.PostRepo.GetRecentPosts(r.Context(), categories, time.Now().Add(-window), maxCandidates)
+	if err != nil {
+		http.Error(w, `DB error`, http.StatusInternalServerError)
+		return
+	}
+	if len(elems) < offset+limit && len(elems) < maxCandidates {
+		// quiet categories don't fill the page from the window, older
+		// posts are all there is then
+		elems, err = h.PostRepo.GetRecentPosts(r.Context(), categories, time.Time{}, maxCandidates)
+		if err != nil {
+			http.Error(w, `DB error`, http.StatusInternalServerError)
+			return
+		}
+	}
+	sort.SliceStable(elems, func(i, j int) bool {
+		return hotness(elems[i]) > hotness(elems[j])
+	})
+	if offset > len(elems) {
+		offset = len(elems)
+	}
+	end := offset + limit
+	if end > len(elems) {
+		end = len(elems)
+	}
+	elems = elems[offset:end]
+	markSaved(r, h.Sessions, h.Saved, elems...)
+
+	respJSON, err := json.Marshal(elems)
+	if err != nil {
+		http.Error(w, `json marshalling error`, http.StatusInternalServerError)
+		return
+	}
+	w.Write(respJSON)
+}
+
+// hotness ranks posts like reddit's "hot" sort: every tenfold increase in
+// score is worth as much as being 12.5 hours newer.
+func hotness(post *items.Post) float64 {
+	order := math.Log10(math.Max(math.Abs(float64(post.Score)), 1))
+	sign := 0.0
+	if post.Score > 0 {
+		sign = 1
+	} else if post.Score < 0 {
+		sign = -1
+	}
+	return sign*order + float64(post.Created.Unix())/45000
+}
+
+func isCategory(category string) bool {
+	for _, c := range items.Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: feed.go
+
+// Package handlers is a generated GoMock package.
+package handlers
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockSubscriptionRepositoryInterface is a mock of SubscriptionRepositoryInterface interface.
+type MockSubscriptionRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockSubscriptionRepositoryInterfaceMockRecorder
+}
+
+// MockSubscriptionRepositoryInterfaceMockRecorder is the mock recorder for MockSubscriptionRepositoryInterface.
+type MockSubscriptionRepositoryInterfaceMockRecorder struct {
+	mock *MockSubscriptionRepositoryInterface
+}
+
+// NewMockSubscriptionRepositoryInterface creates a new mock instance.
+func NewMockSubscriptionRepositoryInterface(ctrl *gomock.Controller) *MockSubscriptionRepositoryInterface {
+	mock := &MockSubscriptionRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockSubscriptionRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSubscriptionRepositoryInterface) EXPECT() *MockSubscriptionRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// GetSubscriptions mocks base method.
+func (m *MockSubscriptionRepositoryInterface) GetSubscriptions(arg0 context.Context, arg1 int) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSubscriptions", arg0, arg1)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSubscriptions indicates an expected call of GetSubscriptions.
+func (mr *MockSubscriptionRepositoryInterfaceMockRecorder) GetSubscriptions(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSubscriptions", reflect.TypeOf((*MockSubscriptionRepositoryInterface)(nil).GetSubscriptions), arg0, arg1)
+}
+
+// Subscribe mocks base method.
+func (m *MockSubscriptionRepositoryInterface) Subscribe(arg0 context.Context, arg1 int, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Subscribe", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Subscribe indicates an expected call of Subscribe.
+func (mr *MockSubscriptionRepositoryInterfaceMockRecorder) Subscribe(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockSubscriptionRepositoryInterface)(nil).Subscribe), arg0, arg1, arg2)
+}
+
+// Unsubscribe mocks base method.
+func (m *MockSubscriptionRepositoryInterface) Unsubscribe(arg0 context.Context, arg1 int, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unsubscribe", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unsubscribe indicates an expected call of Unsubscribe.
+func (mr *MockSubscriptionRepositoryInterfaceMockRecorder) Unsubscribe(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unsubscribe", reflect.TypeOf((*MockSubscriptionRepositoryInterface)(nil).Unsubscribe), arg0, arg1, arg2)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultHealthTimeout = 2 * time.Second
+
+// HealthCheck is a dependency the server can't work without.
+type HealthCheck struct {
+	Name  string
+	Check func(context.Context) error
+}
+
+type HealthHandler struct {
+	Checks []HealthCheck
+	// Timeout bounds every check, a dependency that doesn't answer in time
+	// is reported as down.
+	Timeout time.Duration
+
+	shuttingDown int32
+}
+
+type checkStatus struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Latency string `json:"latency"`
+}
+
+type healthStatus struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkStatus `json:"checks,omitempty"`
+}
+
+// Live reports that the process is up, it doesn't look at dependencies so a
+// database outage doesn't get the server restarted.
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, healthStatus{Status: "ok"}, http.StatusOK)
+}
+
+// Ready reports whether the server should get traffic: all dependencies
+// answer and it isn't shutting down.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&h.shuttingDown) != 0 {
+		writeHealth(w, healthStatus{Status: "shutting down"}, http.StatusServiceUnavailable)
+		return
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	status := healthStatus{Status: "ok", Checks: make(map[string]checkStatus, len(h.Checks))}
+	code := http.StatusOK
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, check := range h.Checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+			start := time.Now()
+			err := runCheck(ctx, check.Check)
+			result := checkStatus{Status: "ok", Latency: time.Since(start).String()}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				result.Status = "down"
+				result.Error = err.Error()
+				status.Status = "unavailable"
+				code = http.StatusServiceUnavailable
+			}
+			status.Checks[check.Name] = result
+		}(check)
+	}
+	wg.Wait()
+	writeHealth(w, status, code)
+}
+
+// Shutdown makes Ready fail, so that load balancers stop sending requests
+// before the server stops accepting them.
+func (h *HealthHandler) Shutdown() {
+	atomic.StoreInt32(&h.shuttingDown, 1)
+}
+
+// runCheck gives up on checks that ignore the context when it is done.
+func runCheck(ctx context.Context, check func(context.Context) error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func writeHealth(w http.ResponseWriter, status healthStatus, code int) {
+	respJSON, err := json.Marshal(status)
+	if err != nil {
+		http.Error(w, `json marshalling error`, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	w.Write(respJSON)
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/logging"
+	"asperitas-clone/pkg/metrics"
+	"asperitas-clone/pkg/query"
+	"asperitas-clone/pkg/session"
+	"asperitas-clone/pkg/tracing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InstrumentedPostRepo records latency and errors of every PostRepo call and
+// traces it as a child of the request span.
+type InstrumentedPostRepo struct {
+	Repo PostRepositoryInterface
+}
+
+func (i InstrumentedPostRepo) GetAllPosts(ctx context.Context) ([]*items.Post, error) {
+	ctx, done := startRepoCall(ctx, "post", "GetAllPosts")
+	posts, err := i.Repo.GetAllPosts(ctx)
+	done(err)
+	return posts, err
+}
+
+func (i InstrumentedPostRepo) GetPostsByCategory(ctx context.Context, category string) ([]*items.Post, error) {
+	ctx, done := startRepoCall(ctx, "post", "GetPostsByCategory")
+	posts, err := i.Repo.GetPostsByCategory(ctx, category)
+	done(err)
+	return posts, err
+}
+
+func (i InstrumentedPostRepo) GetRecentPosts(ctx context.Context, categories []string, since time.Time, limit int) ([]*items.Post, error) {
+	ctx, done := startRepoCall(ctx, "post", "GetRecentPosts")
+	posts, err := i.Repo.GetRecentPosts(ctx, categories, since, limit)
+	done(err)
+	return posts, err
+}
+
+func (i InstrumentedPostRepo) GetPostByID(ctx context.Context, id primitive.ObjectID) (*items.Post, error) {
+	ctx, done := startRepoCall(ctx, "post", "GetPostByID")
+	post, err := i.Repo.GetPostByID(ctx, id)
+	if err == items.ErrPostNotFound {
+		done(nil)
+	} else {
+		done(err)
+	}
+	return post, err
+}
+
+func (i InstrumentedPostRepo) AddPost(ctx context.Context, post *items.Post) (primitive.ObjectID, error) {
+	ctx, done := startRepoCall(ctx, "post", "AddPost")
+	id, err := i.Repo.AddPost(ctx, post)
+	done(err)
+	return id, err
+}
+
+func (i InstrumentedPostRepo) PostComment(ctx context.Context, post *items.Post, comment *items.Comment) (primitive.ObjectID, error) {
+	ctx, done := startRepoCall(ctx, "post", "PostComment")
+	id, err := i.Repo.PostComment(ctx, post, comment)
+	done(err)
+	return id, err
+}
+
+func (i InstrumentedPostRepo) DeleteComment(ctx context.Context, post *items.Post, commentID primitive.ObjectID, userID int) error {
+	ctx, done := startRepoCall(ctx, "post", "DeleteComment")
+	err := i.Repo.DeleteComment(ctx, post, commentID, userID)
+	done(err)
+	return err
+}
+
+func (i InstrumentedPostRepo) DeletePost(ctx context.Context, postID primitive.ObjectID, user *items.User) error {
+	ctx, done := startRepoCall(ctx, "post", "DeletePost")
+	err := i.Repo.DeletePost(ctx, postID, user)
+	done(err)
+	return err
+}
+
+func (i InstrumentedPostRepo) DeleteUserFromVoteTry(ctx context.Context, post *items.Post, userID int) error {
+	ctx, done := startRepoCall(ctx, "post", "DeleteUserFromVoteTry")
+	err := i.Repo.DeleteUserFromVoteTry(ctx, post, userID)
+	done(err)
+	return err
+}
+
+func (i InstrumentedPostRepo) Vote(ctx context.Context, post *items.Post, userID int, vote int) error {
+	ctx, done := startRepoCall(ctx, "post", "Vote")
+	err := i.Repo.Vote(ctx, post, userID, vote)
+	done(err)
+	return err
+}
+
+func (i InstrumentedPostRepo) VoteComment(ctx context.Context, post *items.Post, commentID primitive.ObjectID, userID int, vote int) error {
+	ctx, done := startRepoCall(ctx, "post", "VoteComment")
+	err := i.Repo.VoteComment(ctx, post, commentID, userID, vote)
+	done(err)
+	return err
+}
+
+func (i InstrumentedPostRepo) GetPostsByUsername(ctx context.Context, username string) ([]*items.Post, error) {
+	ctx, done := startRepoCall(ctx, "post", "GetPostsByUsername")
+	posts, err := i.Repo.GetPostsByUsername(ctx, username)
+	done(err)
+	return posts, err
+}
+
+func (i InstrumentedPostRepo) GetPostsByFilter(ctx context.Context, q *query.Query) ([]*items.Post, error) {
+	ctx, done := startRepoCall(ctx, "post", "GetPostsByFilter")
+	posts, err := i.Repo.GetPostsByFilter(ctx, q)
+	done(err)
+	return posts, err
+}
+
+func (i InstrumentedPostRepo) GetPostsByCommenter(ctx context.Context, userID int) ([]*items.Post, error) {
+	ctx, done := startRepoCall(ctx, "post", "GetPostsByCommenter")
+	posts, err := i.Repo.GetPostsByCommenter(ctx, userID)
+	done(err)
+	return posts, err
+}
+
+func (i InstrumentedPostRepo) GetPostsByIDs(ctx context.Context, ids []primitive.ObjectID) ([]*items.Post, error) {
+	ctx, done := startRepoCall(ctx, "post", "GetPostsByIDs")
+	posts, err := i.Repo.GetPostsByIDs(ctx, ids)
+	done(err)
+	return posts, err
+}
+
+func (i InstrumentedPostRepo) RenameAuthor(ctx context.Context, userID int, username string) error {
+	ctx, done := startRepoCall(ctx, "post", "RenameAuthor")
+	err := i.Repo.RenameAuthor(ctx, userID, username)
+	done(err)
+	return err
+}
+
+func (i InstrumentedPostRepo) AnonymizeAuthor(ctx context.Context, userID int) error {
+	ctx, done := startRepoCall(ctx, "post", "AnonymizeAuthor")
+	err := i.Repo.AnonymizeAuthor(ctx, userID)
+	done(err)
+	return err
+}
+
+func (i InstrumentedPostRepo) DeleteAuthorComments(ctx context.Context, userID int) error {
+	ctx, done := startRepoCall(ctx, "post", "DeleteAuthorComments")
+	err := i.Repo.DeleteAuthorComments(ctx, userID)
+	done(err)
+	return err
+}
+
+// startRepoCall starts a span for a repository call, done records the
+// outcome in the span and in metrics. Errors are logged with the logger of
+// the request, so they carry its request ID.
+func startRepoCall(ctx context.Context, repo, method string) (context.Context, func(error)) {
+	ctx, span := tracing.Start(ctx, repo+"."+method)
+	span.SetAttribute("repo", repo)
+	start := time.Now()
+	return ctx, func(err error) {
+		metrics.ObserveRepo(repo, method, start, err)
+		if err != nil {
+			logging.FromContext(ctx, nil).Warnw("repository call failed", "repo", repo, "method", method, "err", err)
+		}
+		span.RecordError(err)
+		span.End()
+	}
+}
+
+// InstrumentedUserRepo records latency and errors of every UserRepo call and
+// traces it. Failed logins are not errors of the repository.
+type InstrumentedUserRepo struct {
+	Repo UserRepositoryInterface
+}
+
+func (i InstrumentedUserRepo) GetUserByID(ctx context.Context, id int) (*items.User, error) {
+	ctx, done := startRepoCall(ctx, "user", "GetUserByID")
+	user, err := i.Repo.GetUserByID(ctx, id)
+	done(err)
+	return user, err
+}
+
+func (i InstrumentedUserRepo) GetUserByUsername(ctx context.Context, username string) (*items.User, error) {
+	ctx, done := startRepoCall(ctx, "user", "GetUserByUsername")
+	user, err := i.Repo.GetUserByUsername(ctx, username)
+	done(err)
+	return user, err
+}
+
+func (i InstrumentedUserRepo) GetUserByEmail(ctx context.Context, email string) (*items.User, error) {
+	ctx, done := startRepoCall(ctx, "user", "GetUserByEmail")
+	user, err := i.Repo.GetUserByEmail(ctx, email)
+	done(err)
+	return user, err
+}
+
+func (i InstrumentedUserRepo) AddUser(ctx context.Context, user *items.User) (int, error) {
+	ctx, done := startRepoCall(ctx, "user", "AddUser")
+	id, err := i.Repo.AddUser(ctx, user)
+	_, badName := usernameErrors[err]
+	_, badEmail := emailErrors[err]
+	if badName || badEmail {
+		done(nil)
+	} else {
+		done(err)
+	}
+	return id, err
+}
+
+func (i InstrumentedUserRepo) Authorize(ctx context.Context, username, password string) (*items.User, error) {
+	ctx, done := startRepoCall(ctx, "user", "Authorize")
+	user, err := i.Repo.Authorize(ctx, username, password)
+	if err == items.ErrNoUser || err == items.ErrBadPass {
+		done(nil)
+	} else {
+		done(err)
+	}
+	return user, err
+}
+
+func (i InstrumentedUserRepo) ChangeUsername(ctx context.Context, id int, username string) error {
+	ctx, done := startRepoCall(ctx, "user", "ChangeUsername")
+	err := i.Repo.ChangeUsername(ctx, id, username)
+	if _, ok := usernameErrors[err]; ok {
+		done(nil)
+	} else {
+		done(err)
+	}
+	return err
+}
+
+func (i InstrumentedUserRepo) ChangePassword(ctx context.Context, id int, password string) error {
+	ctx, done := startRepoCall(ctx, "user", "ChangePassword")
+	err := i.Repo.ChangePassword(ctx, id, password)
+	done(err)
+	return err
+}
+
+func (i InstrumentedUserRepo) DeleteUser(ctx context.Context, id int, removeContent bool) error {
+	ctx, done := startRepoCall(ctx, "user", "DeleteUser")
+	err := i.Repo.DeleteUser(ctx, id, removeContent)
+	done(err)
+	return err
+}
+
+// InstrumentedSessions records latency and errors of every SessionManager
+// call and traces it. Requests without a session cookie are not errors.
+type InstrumentedSessions struct {
+	Sessions session.SessionManagerInterface
+}
+
+func (i InstrumentedSessions) Create(ctx context.Context, w http.ResponseWriter, userID int) (*session.Session, error) {
+	ctx, done := startRepoCall(ctx, "session", "Create")
+	sess, err := i.Sessions.Create(ctx, w, userID)
+	done(err)
+	return sess, err
+}
+
+func (i InstrumentedSessions) Check(r *http.Request) (*session.Session, error) {
+	ctx, done := startRepoCall(r.Context(), "session", "Check")
+	sess, err := i.Sessions.Check(r.WithContext(ctx))
+	if err == session.ErrNoAuth {
+		done(nil)
+	} else {
+		done(err)
+	}
+	return sess, err
+}
+
+func (i InstrumentedSessions) DestroyOthers(ctx context.Context, userID int, keepID string) error {
+	ctx, done := startRepoCall(ctx, "session", "DestroyOthers")
+	err := i.Sessions.DestroyOthers(ctx, userID, keepID)
+	done(err)
+	return err
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"asperitas-clone/pkg/metrics"
+)
+
+// mockgen -source="lockout.go" -destination="lockout_mock.go" -package=handlers LoginGuardInterface
+
+type LoginGuardInterface interface {
+	Check(context.Context, string, string) (time.Duration, error)
+	Fail(context.Context, string, string) error
+	Reset(context.Context, string) error
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginLocked writes 429 and returns true if logins of the username or from
+// the client address are locked.
+func (h *UserHandler) loginLocked(w http.ResponseWriter, r *http.Request, username, ip string) bool {
+	if h.Lockout == nil {
+		return false
+	}
+	wait, err := h.Lockout.Check(r.Context(), username, ip)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return true
+	}
+	if wait <= 0 {
+		return false
+	}
+	metrics.Logins.Inc("locked")
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	jsonError(w, "too many failed login attempts, try again later", http.StatusTooManyRequests)
+	return true
+}
+
+func (h *UserHandler) loginFailed(r *http.Request, username, ip string) {
+	if h.Lockout == nil {
+		return
+	}
+	if err := h.Lockout.Fail(r.Context(), username, ip); err != nil {
+		logger(r, h.Logger).Warnw("can't record failed login", "ip", ip, "err", err)
+	}
+}
+
+func (h *UserHandler) loginSucceeded(r *http.Request, username string) {
+	if h.Lockout == nil {
+		return
+	}
+	if err := h.Lockout.Reset(r.Context(), username); err != nil {
+		logger(r, h.Logger).Warnw("can't reset failed logins", "username", username, "err", err)
+	}
+}
@@ -0,0 +1,79 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: lockout.go
+
+// Package handlers is a generated GoMock package.
+package handlers
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockLoginGuardInterface is a mock of LoginGuardInterface interface.
+type MockLoginGuardInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockLoginGuardInterfaceMockRecorder
+}
+
+// MockLoginGuardInterfaceMockRecorder is the mock recorder for MockLoginGuardInterface.
+type MockLoginGuardInterfaceMockRecorder struct {
+	mock *MockLoginGuardInterface
+}
+
+// NewMockLoginGuardInterface creates a new mock instance.
+func NewMockLoginGuardInterface(ctrl *gomock.Controller) *MockLoginGuardInterface {
+	mock := &MockLoginGuardInterface{ctrl: ctrl}
+	mock.recorder = &MockLoginGuardInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLoginGuardInterface) EXPECT() *MockLoginGuardInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Check mocks base method.
+func (m *MockLoginGuardInterface) Check(arg0 context.Context, arg1, arg2 string) (time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Check", arg0, arg1, arg2)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Check indicates an expected call of Check.
+func (mr *MockLoginGuardInterfaceMockRecorder) Check(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Check", reflect.TypeOf((*MockLoginGuardInterface)(nil).Check), arg0, arg1, arg2)
+}
+
+// Fail mocks base method.
+func (m *MockLoginGuardInterface) Fail(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fail", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Fail indicates an expected call of Fail.
+func (mr *MockLoginGuardInterfaceMockRecorder) Fail(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fail", reflect.TypeOf((*MockLoginGuardInterface)(nil).Fail), arg0, arg1, arg2)
+}
+
+// Reset mocks base method.
+func (m *MockLoginGuardInterface) Reset(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reset", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reset indicates an expected call of Reset.
+func (mr *MockLoginGuardInterfaceMockRecorder) Reset(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reset", reflect.TypeOf((*MockLoginGuardInterface)(nil).Reset), arg0, arg1)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/session"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mockgen -source="notification.go" -destination="notification_mock.go" -package=handlers NotificationRepositoryInterface
+
+type NotificationRepositoryInterface interface {
+	Add(context.Context, int, *items.Notification) error
+	GetNotifications(context.Context, int, bool, int, int) ([]*items.Notification, error)
+	CountUnread(context.Context, int) (int, error)
+	MarkRead(context.Context, int, int) error
+	MarkAllRead(context.Context, int) error
+	DeleteByComment(context.Context, primitive.ObjectID) error
+	DeleteByPost(context.Context, primitive.ObjectID) error
+}
+
+type NotificationHandler struct {
+	Notifications NotificationRepositoryInterface
+	Sessions      session.SessionManagerInterface
+}
+
+type notificationList struct {
+	Unread        int                   `json:"unread"`
+	Notifications []*items.Notification `json:"notifications"`
+}
+
+func (h *NotificationHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	offset, limit, err := parsePage(r)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		http.Error(w, `Can't get session`, http.StatusInternalServerError)
+		return
+	}
+	if sess == nil {
+		http.Redirect(w, r, "/", http.StatusUnauthorized)
+		return
+	}
+	unread, err := h.Notifications.CountUnread(r.Context(), sess.UserID)
+	if err != nil {
+		http.Error(w, `Can't get notifications`, http.StatusInternalServerError)
+		return
+	}
+	elems, err := h.Notifications.GetNotifications(r.Context(), sess.UserID, unreadOnly, offset, limit)
+	if err != nil {
+		http.Error(w, `Can't get notifications`, http.StatusInternalServerError)
+		return
+	}
+
+	respJSON, err := json.Marshal(notificationList{Unread: unread, Notifications: elems})
+	if err != nil {
+		http.Error(w, `json marshalling error`, http.StatusInternalServerError)
+		return
+	}
+	w.Write(respJSON)
+}
+
+func (h *NotificationHandler) CountUnread(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		http.Error(w, `Can't get session`, http.StatusInternalServerError)
+		return
+	}
+	if sess == nil {
+		http.Redirect(w, r, "/", http.StatusUnauthorized)
+		return
+	}
+	unread, err := h.Notifications.CountUnread(r.Context(), sess.UserID)
+	if err != nil {
+		http.Error(w, `Can't get notifications`, http.StatusInternalServerError)
+		return
+	}
+
+	respJSON, err := json.Marshal(map[string]int{"unread": unread})
+	if err != nil {
+		http.Error(w, `json marshalling error`, http.StatusInternalServerError)
+		return
+	}
+	w.Write(respJSON)
+}
+
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["NOTIFICATION_ID"])
+	if err != nil {
+		http.Error(w, `Can't get NOTIFICATION_ID`, http.StatusBadRequest)
+		return
+	}
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		http.Error(w, `Can't get session`, http.StatusInternalServerError)
+		return
+	}
+	if sess == nil {
+		http.Redirect(w, r, "/", http.StatusUnauthorized)
+		return
+	}
+	err = h.Notifications.MarkRead(r.Context(), sess.UserID, id)
+	if errors.Is(err, items.ErrNotificationNotFound) {
+		jsonError(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, `Can't mark notification`, http.StatusInternalServerError)
+		return
+	}
+	h.CountUnread(w, r)
+}
+
+func (h *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		http.Error(w, `Can't get session`, http.StatusInternalServerError)
+		return
+	}
+	if sess == nil {
+		http.Redirect(w, r, "/", http.StatusUnauthorized)
+		return
+	}
+	err = h.Notifications.MarkAllRead(r.Context(), sess.UserID)
+	if err != nil {
+		http.Error(w, `Can't mark notifications`, http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte(`{"unread":0}`))
+}
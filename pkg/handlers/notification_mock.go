@@ -0,0 +1,137 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: notification.go
+
+// Package handlers is a generated GoMock package.
+package handlers
+
+import (
+	items "asperitas-clone/pkg/items"
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	primitive "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MockNotificationRepositoryInterface is a mock of NotificationRepositoryInterface interface.
+type MockNotificationRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockNotificationRepositoryInterfaceMockRecorder
+}
+
+// MockNotificationRepositoryInterfaceMockRecorder is the mock recorder for MockNotificationRepositoryInterface.
+type MockNotificationRepositoryInterfaceMockRecorder struct {
+	mock *MockNotificationRepositoryInterface
+}
+
+// NewMockNotificationRepositoryInterface creates a new mock instance.
+func NewMockNotificationRepositoryInterface(ctrl *gomock.Controller) *MockNotificationRepositoryInterface {
+	mock := &MockNotificationRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockNotificationRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockNotificationRepositoryInterface) EXPECT() *MockNotificationRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Add mocks base method.
+func (m *MockNotificationRepositoryInterface) Add(arg0 context.Context, arg1 int, arg2 *items.Notification) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Add", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Add indicates an expected call of Add.
+func (mr *MockNotificationRepositoryInterfaceMockRecorder) Add(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockNotificationRepositoryInterface)(nil).Add), arg0, arg1, arg2)
+}
+
+// CountUnread mocks base method.
+func (m *MockNotificationRepositoryInterface) CountUnread(arg0 context.Context, arg1 int) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountUnread", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountUnread indicates an expected call of CountUnread.
+func (mr *MockNotificationRepositoryInterfaceMockRecorder) CountUnread(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountUnread", reflect.TypeOf((*MockNotificationRepositoryInterface)(nil).CountUnread), arg0, arg1)
+}
+
+// DeleteByComment mocks base method.
+func (m *MockNotificationRepositoryInterface) DeleteByComment(arg0 context.Context, arg1 primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteByComment", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteByComment indicates an expected call of DeleteByComment.
+func (mr *MockNotificationRepositoryInterfaceMockRecorder) DeleteByComment(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteByComment", reflect.TypeOf((*MockNotificationRepositoryInterface)(nil).DeleteByComment), arg0, arg1)
+}
+
+// DeleteByPost mocks base method.
+func (m *MockNotificationRepositoryInterface) DeleteByPost(arg0 context.Context, arg1 primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteByPost", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteByPost indicates an expected call of DeleteByPost.
+func (mr *MockNotificationRepositoryInterfaceMockRecorder) DeleteByPost(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteByPost", reflect.TypeOf((*MockNotificationRepositoryInterface)(nil).DeleteByPost), arg0, arg1)
+}
+
+// GetNotifications mocks base method.
+func (m *MockNotificationRepositoryInterface) GetNotifications(arg0 context.Context, arg1 int, arg2 bool, arg3, arg4 int) ([]*items.Notification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNotifications", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].([]*items.Notification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNotifications indicates an expected call of GetNotifications.
+func (mr *MockNotificationRepositoryInterfaceMockRecorder) GetNotifications(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNotifications", reflect.TypeOf((*MockNotificationRepositoryInterface)(nil).GetNotifications), arg0, arg1, arg2, arg3, arg4)
+}
+
+// MarkAllRead mocks base method.
+func (m *MockNotificationRepositoryInterface) MarkAllRead(arg0 context.Context, arg1 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkAllRead", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkAllRead indicates an expected call of MarkAllRead.
+func (mr *MockNotificationRepositoryInterfaceMockRecorder) MarkAllRead(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkAllRead", reflect.TypeOf((*MockNotificationRepositoryInterface)(nil).MarkAllRead), arg0, arg1)
+}
+
+// MarkRead mocks base method.
+func (m *MockNotificationRepositoryInterface) MarkRead(arg0 context.Context, arg1, arg2 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkRead", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkRead indicates an expected call of MarkRead.
+func (mr *MockNotificationRepositoryInterfaceMockRecorder) MarkRead(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkRead", reflect.TypeOf((*MockNotificationRepositoryInterface)(nil).MarkRead), arg0, arg1, arg2)
+}
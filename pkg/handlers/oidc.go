@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"asperitas-clone/pkg/credentials"
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/metrics"
+	"asperitas-clone/pkg/oidc"
+	"asperitas-clone/pkg/session"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// mockgen -source="oidc.go" -destination="oidc_mock.go" -package=handlers IdentityRepositoryInterface
+
+type IdentityRepositoryInterface interface {
+	GetUserID(context.Context, string, string) (int, error)
+	Link(context.Context, string, string, int) error
+}
+
+const (
+	oidcCookie     = "oidc"
+	oidcCookiePath = "/api/oidc/"
+	oidcCookieTTL  = 10 * time.Minute
+	// usernameAttempts is how many numbered variants of a taken username are
+	// tried for a new user.
+	usernameAttempts = 20
+)
+
+// oidcDone hands the token to the frontend, it keeps it in local storage
+// like after a password login.
+var oidcDone = template.Must(template.New("oidc").Parse(`<!DOCTYPE html>
+<title>Logging in</title>
+<script>localStorage.setItem("token", {{.Token}}); location.replace({{.Next}});</script>
+`))
+
+// OIDCHandler logs users in with accounts of OpenID Connect providers. An
+// identity unknown so far is linked to the user who is logged in, otherwise
+// a new user is created for it.
+type OIDCHandler struct {
+	// Providers by the name in their URLs.
+	Providers  map[string]*oidc.Provider
+	Identities IdentityRepositoryInterface
+	UserRepo   UserRepositoryInterface
+	Sessions   session.SessionManagerInterface
+	Profiles   ProfileRepositoryInterface
+	// TwoFactor, if set, asks users who enabled it for a code, the provider
+	// doesn't replace it.
+	TwoFactor TwoFactorRepositoryInterface
+	// Policy, if set, decides which usernames of providers new users can
+	// take over, the others are named "user".
+	Policy *credentials.Policy
+	// PostLoginURL is where the browser ends up, "/" if empty.
+	PostLoginURL string
+	Logger       *zap.SugaredLogger
+}
+
+func (h *OIDCHandler) provider(w http.ResponseWriter, r *http.Request) (*oidc.Provider, bool) {
+	p, ok := h.Providers[mux.Vars(r)["PROVIDER"]]
+	if !ok {
+		jsonError(w, "unknown provider", http.StatusNotFound)
+		return nil, false
+	}
+	return p, true
+}
+
+// GetProviders lists the names of the providers.
+func (h *OIDCHandler) GetProviders(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(h.Providers))
+	for name := range h.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	resp, err := json.Marshal(names)
+	if err != nil {
+		http.Error(w, `Can't marshal providers`, http.StatusInternalServerError)
+		return
+	}
+	w.Write(resp)
+}
+
+// Login sends the browser to the provider. State, nonce and PKCE verifier
+// wait for the callback in a cookie only this browser has.
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.provider(w, r)
+	if !ok {
+		return
+	}
+	values := make([]string, 3)
+	for i := range values {
+		value, err := oidc.NewRandom()
+		if err != nil {
+			http.Error(w, `Can't create state`, http.StatusInternalServerError)
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+	authURL, err := p.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		logger(r, h.Logger).Errorw("can't reach provider", "provider", p.Name, "err", err)
+		jsonError(w, "can't reach provider", http.StatusBadGateway)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    strings.Join(values, "."),
+		Path:     oidcCookiePath,
+		MaxAge:   int(oidcCookieTTL.Seconds()),
+		HttpOnly: true,
+		// the callback is a navigation from the provider's site
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback finishes the login the provider sent the browser back from. Users
+// with 2FA get a challenge for LoginTwoFactor instead of a session.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.provider(w, r)
+	if !ok {
+		return
+	}
+	cookie, err := r.Cookie(oidcCookie)
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: oidcCookiePath, MaxAge: -1})
+	if err != nil {
+		jsonError(w, "login expired, try again", http.StatusBadRequest)
+		return
+	}
+	values := strings.Split(cookie.Value, ".")
+	query := r.URL.Query()
+	if len(values) != 3 || subtle.ConstantTimeCompare([]byte(values[0]), []byte(query.Get("state"))) != 1 {
+		jsonError(w, "login expired, try again", http.StatusBadRequest)
+		return
+	}
+	if msg := query.Get("error"); msg != "" {
+		metrics.Logins.Inc("failure")
+		jsonError(w, "provider refused the login: "+msg, http.StatusUnauthorized)
+		return
+	}
+	claims, err := p.Exchange(r.Context(), query.Get("code"), values[2], values[1])
+	if err != nil {
+		logger(r, h.Logger).Warnw("oidc login failed", "provider", p.Name, "err", err)
+		metrics.Logins.Inc("failure")
+		jsonError(w, "login failed", http.StatusUnauthorized)
+		return
+	}
+	userID, ok := h.identityUser(w, r, p.Name, claims)
+	if !ok {
+		return
+	}
+	user, err := h.UserRepo.GetUserByID(r.Context(), userID)
+	if err != nil || user == nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	enabled, err := twoFactorEnabled(r.Context(), h.TwoFactor, user.ID)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		w.Header().Set("Cache-Control", "no-store")
+		askSecondFactor(w, r, h.TwoFactor, user)
+		return
+	}
+	metrics.Logins.Inc("success")
+	tokenJSON, err := createToken(user.Username, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	token := items.Token{}
+	if err := json.Unmarshal(tokenJSON, &token); err != nil {
+		http.Error(w, `Can't unmarshal token`, http.StatusInternalServerError)
+		return
+	}
+	sess, err := h.Sessions.Create(r.Context(), w, user.ID)
+	if err != nil {
+		http.Error(w, `Can't create session`, http.StatusInternalServerError)
+		return
+	}
+	logger(r, h.Logger).Infow("oidc login", "provider", p.Name, "user", sess.UserID)
+	next := h.PostLoginURL
+	if next == "" {
+		next = "/"
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	oidcDone.Execute(w, struct{ Token, Next string }{token.Token, next})
+}
+
+// identityUser finds the user of the identity, linking or creating one when
+// it is new.
+func (h *OIDCHandler) identityUser(w http.ResponseWriter, r *http.Request, provider string, claims *oidc.Claims) (int, bool) {
+	userID, err := h.Identities.GetUserID(r.Context(), provider, claims.Subject)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return 0, false
+	}
+	if userID != 0 {
+		return userID, true
+	}
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		http.Error(w, `Can't get session`, http.StatusInternalServerError)
+		return 0, false
+	}
+	if sess != nil {
+		userID = sess.UserID
+	} else {
+		userID, err = h.createUser(r, claims)
+		if err != nil {
+			logger(r, h.Logger).Errorw("can't create oidc user", "provider", provider, "err", err)
+			http.Error(w, "Can't add user", http.StatusInternalServerError)
+			return 0, false
+		}
+	}
+	err = h.Identities.Link(r.Context(), provider, claims.Subject, userID)
+	if errors.Is(err, items.ErrIdentityLinked) {
+		jsonError(w, "the account is linked to another user", http.StatusConflict)
+		return 0, false
+	} else if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return 0, false
+	}
+	logger(r, h.Logger).Infow("identity linked", "provider", provider, "user", userID)
+	return userID, true
+}
+
+// createUser names the user after the identity, with a number appended
+// while the name is taken. The password is random, the user logs in
+// through the provider.
+func (h *OIDCHandler) createUser(r *http.Request, claims *oidc.Claims) (int, error) {
+	password, err := oidc.NewRandom()
+	if err != nil {
+		return 0, err
+	}
+	base := h.baseUsername(claims)
+	for i := 0; i < usernameAttempts; i++ {
+		username := base
+		if i > 0 {
+			username = fmt.Sprintf("%s%d", base, i+1)
+		}
+		userID, err := h.UserRepo.AddUser(r.Context(), &items.User{Username: username, Password: password})
+		if errors.Is(err, items.ErrUserAlreadyExists) || errors.Is(err, items.ErrUsernameReserved) {
+			continue
+		} else if errors.Is(err, items.ErrBadUsername) && base != "user" {
+			base, i = "user", -1
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		if h.Profiles != nil {
+			if err := h.Profiles.CreateProfile(r.Context(), userID, time.Now().UTC()); err != nil {
+				logger(r, h.Logger).Warnw("can't create profile", "user", userID, "err", err)
+			}
+		}
+		return userID, nil
+	}
+	return 0, fmt.Errorf("usernames %s to %s%d are taken", base, base, usernameAttempts)
+}
+
+func (h *OIDCHandler) baseUsername(claims *oidc.Claims) string {
+	candidates := []string{claims.PreferredUsername}
+	if at := strings.LastIndex(claims.Email, "@"); at > 0 {
+		candidates = append(candidates, claims.Email[:at])
+	}
+	for _, name := range candidates {
+		if name == "" {
+			continue
+		}
+		// leave room for the number
+		if h.Policy != nil && h.Policy.UsernameMax > 2 && len([]rune(name)) > h.Policy.UsernameMax-2 {
+			name = string([]rune(name)[:h.Policy.UsernameMax-2])
+		}
+		if h.Policy == nil || len(h.Policy.CheckUsername(name)) == 0 {
+			return name
+		}
+	}
+	return "user"
+}
@@ -0,0 +1,64 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: oidc.go
+
+// Package handlers is a generated GoMock package.
+package handlers
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockIdentityRepositoryInterface is a mock of IdentityRepositoryInterface interface.
+type MockIdentityRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockIdentityRepositoryInterfaceMockRecorder
+}
+
+// MockIdentityRepositoryInterfaceMockRecorder is the mock recorder for MockIdentityRepositoryInterface.
+type MockIdentityRepositoryInterfaceMockRecorder struct {
+	mock *MockIdentityRepositoryInterface
+}
+
+// NewMockIdentityRepositoryInterface creates a new mock instance.
+func NewMockIdentityRepositoryInterface(ctrl *gomock.Controller) *MockIdentityRepositoryInterface {
+	mock := &MockIdentityRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockIdentityRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIdentityRepositoryInterface) EXPECT() *MockIdentityRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// GetUserID mocks base method.
+func (m *MockIdentityRepositoryInterface) GetUserID(arg0 context.Context, arg1, arg2 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserID", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserID indicates an expected call of GetUserID.
+func (mr *MockIdentityRepositoryInterfaceMockRecorder) GetUserID(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserID", reflect.TypeOf((*MockIdentityRepositoryInterface)(nil).GetUserID), arg0, arg1, arg2)
+}
+
+// Link mocks base method.
+func (m *MockIdentityRepositoryInterface) Link(arg0 context.Context, arg1, arg2 string, arg3 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Link", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Link indicates an expected call of Link.
+func (mr *MockIdentityRepositoryInterfaceMockRecorder) Link(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Link", reflect.TypeOf((*MockIdentityRepositoryInterface)(nil).Link), arg0, arg1, arg2, arg3)
+}
@@ -1,18 +1,22 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"time"
 
+	"asperitas-clone/pkg/events"
 	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/metrics"
+	"asperitas-clone/pkg/query"
 	"asperitas-clone/pkg/session"
 
 	"github.com/gorilla/mux"
-	"gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
 
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -20,31 +24,64 @@ import (
 // mockgen -source="post.go" -destination="post_mock.go" -package=handlers PostRepositoryInterface
 
 type PostRepositoryInterface interface {
-	GetAllPosts() ([]*items.Post, error)
-	GetPostsByCategory(string) ([]*items.Post, error)
-	GetPostByID(bson.ObjectId) (*items.Post, error)
-	AddPost(*items.Post) (bson.ObjectId, error)
-	PostComment(*items.Post, *items.Comment) (bson.ObjectId, error)
-	DeleteComment(*items.Post, bson.ObjectId, int) error
-	DeletePost(bson.ObjectId, *items.User) error
-	DeleteUserFromVoteTry(*items.Post, int) error
-	Vote(*items.Post, int, int) error
-	GetPostsByUsername(string) ([]*items.Post, error)
+	GetAllPosts(context.Context) ([]*items.Post, error)
+	GetPostsByCategory(context.Context, string) ([]*items.Post, error)
+	GetRecentPosts(context.Context, []string, time.Time, int) ([]*items.Post, error)
+	GetPostByID(context.Context, primitive.ObjectID) (*items.Post, error)
+	AddPost(context.Context, *items.Post) (primitive.ObjectID, error)
+	PostComment(context.Context, *items.Post, *items.Comment) (primitive.ObjectID, error)
+	DeleteComment(context.Context, *items.Post, primitive.ObjectID, int) error
+	DeletePost(context.Context, primitive.ObjectID, *items.User) error
+	DeleteUserFromVoteTry(context.Context, *items.Post, int) error
+	Vote(context.Context, *items.Post, int, int) error
+	VoteComment(context.Context, *items.Post, primitive.ObjectID, int, int) error
+	GetPostsByUsername(context.Context, string) ([]*items.Post, error)
+	GetPostsByFilter(context.Context, *query.Query) ([]*items.Post, error)
+	GetPostsByCommenter(context.Context, int) ([]*items.Post, error)
+	GetPostsByIDs(context.Context, []primitive.ObjectID) ([]*items.Post, error)
+	RenameAuthor(context.Context, int, string) error
+	AnonymizeAuthor(context.Context, int) error
+	DeleteAuthorComments(context.Context, int) error
 }
 
 type PostHandler struct {
-	PostRepo  PostRepositoryInterface
-	UserRepo  UserRepositoryInterface
-	Sessions  session.SessionManagerInterface
-	SessionDB *sql.DB
+	PostRepo      PostRepositoryInterface
+	UserRepo      UserRepositoryInterface
+	Sessions      session.SessionManagerInterface
+	SessionDB     *sql.DB
+	Search        SearchIndexInterface
+	Profiles      ProfileRepositoryInterface
+	Comments      CommentRepositoryInterface
+	Saved         SavedRepositoryInterface
+	Notifications NotificationRepositoryInterface
+	Events        EventHubInterface
+	// Deleter deletes posts for DeletePost.
+	Deleter *PostDeleter
+	// Emails are checked for RequireVerifiedEmail.
+	Emails EmailRepositoryInterface
+	// RequireVerifiedEmail lets only users with a verified address post and
+	// comment.
+	RequireVerifiedEmail bool
+	Logger               *zap.SugaredLogger
 }
 
 func (h *PostHandler) GetAllPosts(w http.ResponseWriter, r *http.Request) {
-	elems, err := h.PostRepo.GetAllPosts()
+	filter, ok := parseQuery(w, r)
+	if !ok {
+		return
+	}
+	var elems []*items.Post
+	var err error
+	if filter != nil {
+		elems, err = h.PostRepo.GetPostsByFilter(r.Context(), filter)
+	} else {
+		elems, err = h.PostRepo.GetAllPosts(r.Context())
+	}
 	if err != nil {
 		http.Error(w, `DB error`, http.StatusInternalServerError)
 		return
 	}
+	markSaved(r, h.Sessions, h.Saved, elems...)
 
 	respJSON, err := json.Marshal(elems)
 	if err != nil {
@@ -56,16 +93,18 @@ func (h *PostHandler) GetAllPosts(w http.ResponseWriter, r *http.Request) {
 
 func (h *PostHandler) GetPostByID(w http.ResponseWriter, r *http.Request) {
 	id, ok := mux.Vars(r)["POST_ID"]
-	if !ok || !bson.IsObjectIdHex(id) {
+	uid, err := primitive.ObjectIDFromHex(id)
+	if !ok || err != nil {
 		http.Error(w, `Can't get post`, http.StatusInternalServerError)
 		return
 	}
-	elem, err := h.PostRepo.GetPostByID(bson.ObjectIdHex(id))
+	elem, err := h.PostRepo.GetPostByID(r.Context(), uid)
 	if err != nil {
 		http.Error(w, `DB error`, http.StatusInternalServerError)
 		return
 	}
 	elem.Views++
+	markSaved(r, h.Sessions, h.Saved, elem)
 	respJSON, err := json.Marshal(elem)
 	if err != nil {
 		http.Error(w, `json marshalling error`, http.StatusInternalServerError)
@@ -80,11 +119,26 @@ func (h *PostHandler) GetPostsByCategory(w http.ResponseWriter, r *http.Request)
 		http.Error(w, `Can't get category`, http.StatusInternalServerError)
 		return
 	}
-	elems, err := h.PostRepo.GetPostsByCategory(category)
+	filter, ok := parseQuery(w, r)
+	if !ok {
+		return
+	}
+	var elems []*items.Post
+	var err error
+	switch {
+	case filter == nil:
+		elems, err = h.PostRepo.GetPostsByCategory(r.Context(), category)
+	case filter.Category != "" && filter.Category != category:
+		elems = []*items.Post{}
+	default:
+		filter.Category = category
+		elems, err = h.PostRepo.GetPostsByFilter(r.Context(), filter)
+	}
 	if err != nil {
 		http.Error(w, `DB error`, http.StatusInternalServerError)
 		return
 	}
+	markSaved(r, h.Sessions, h.Saved, elems...)
 
 	respJSON, err := json.Marshal(elems)
 	if err != nil {
@@ -107,11 +161,14 @@ func (h *PostHandler) AddPost(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	user, err := h.UserRepo.GetUserByID(sess.UserID)
+	user, err := h.UserRepo.GetUserByID(r.Context(), sess.UserID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if h.RequireVerifiedEmail && !emailVerified(w, r, h.Emails, user.ID) {
+		return
+	}
 	post.Author = user
 	post.Comments = make([]*items.Comment, 0)
 	post.Created = time.Now().UTC()
@@ -124,11 +181,14 @@ func (h *PostHandler) AddPost(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 	post.Score = 1
-	_, err = h.PostRepo.AddPost(&post)
+	_, err = h.PostRepo.AddPost(r.Context(), &post)
 	if err != nil {
 		http.Error(w, `Can't add post`, http.StatusInternalServerError)
 		return
 	}
+	h.reindex(r, &post)
+	metrics.PostsCreated.Inc()
+	h.addStats(r, user.ID, items.ProfileStats{Posts: 1, PostKarma: post.Score})
 	respJSON, err := json.Marshal(post)
 	if err != nil {
 		http.Error(w, `Can't marshal post`, http.StatusInternalServerError)
@@ -139,11 +199,11 @@ func (h *PostHandler) AddPost(w http.ResponseWriter, r *http.Request) {
 
 func (h *PostHandler) PostComment(w http.ResponseWriter, r *http.Request) {
 	id, ok := mux.Vars(r)["POST_ID"]
-	if !ok || !bson.IsObjectIdHex(id) {
+	uid, err := primitive.ObjectIDFromHex(id)
+	if !ok || err != nil {
 		http.Error(w, `Can't get post`, http.StatusInternalServerError)
 		return
 	}
-	uid := bson.ObjectIdHex(id)
 	message := map[string]string{}
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&message); err != nil {
@@ -161,7 +221,7 @@ func (h *PostHandler) PostComment(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusUnauthorized)
 		return
 	}
-	user, err := h.UserRepo.GetUserByID(sess.UserID)
+	user, err := h.UserRepo.GetUserByID(r.Context(), sess.UserID)
 	if err != nil {
 		http.Error(w, `Can't get user`, http.StatusInternalServerError)
 		return
@@ -170,6 +230,9 @@ func (h *PostHandler) PostComment(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `Can't get user`, http.StatusBadRequest)
 		return
 	}
+	if h.RequireVerifiedEmail && !emailVerified(w, r, h.Emails, user.ID) {
+		return
+	}
 
 	comment := items.Comment{
 		Created: time.Now().UTC(),
@@ -177,7 +240,7 @@ func (h *PostHandler) PostComment(w http.ResponseWriter, r *http.Request) {
 		Body:    message["comment"],
 	}
 
-	post, err := h.PostRepo.GetPostByID(uid)
+	post, err := h.PostRepo.GetPostByID(r.Context(), uid)
 	if err != nil {
 		http.Error(w, `Can't get post`, http.StatusInternalServerError)
 		return
@@ -187,14 +250,36 @@ func (h *PostHandler) PostComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.PostRepo.PostComment(post, &comment)
-	if errors.Is(err, mgo.ErrNotFound) {
+	_, err = h.PostRepo.PostComment(r.Context(), post, &comment)
+	if errors.Is(err, items.ErrPostNotFound) {
 		http.Error(w, `Post not found`, http.StatusNoContent)
 		return
 	} else if err != nil {
 		http.Error(w, `Can't post comment`, http.StatusInternalServerError)
 		return
 	}
+	h.reindex(r, post)
+	h.addStats(r, user.ID, items.ProfileStats{Comments: 1})
+	if h.Comments != nil {
+		if err := h.Comments.AddComment(r.Context(), post, &comment); err != nil {
+			logger(r, h.Logger).Warnw("can't save comment to history", "comment", comment.ID.Hex(), "err", err)
+		}
+	}
+	if h.Notifications != nil && post.Author != nil && post.Author.ID != user.ID {
+		err = h.Notifications.Add(r.Context(), post.Author.ID, &items.Notification{
+			Type:      items.NotificationComment,
+			PostID:    post.ID,
+			PostTitle: post.Title,
+			CommentID: comment.ID,
+			Author:    user,
+			Body:      comment.Body,
+			Created:   comment.Created,
+		})
+		if err != nil {
+			logger(r, h.Logger).Warnw("can't notify post author", "comment", comment.ID.Hex(), "err", err)
+		}
+	}
+	h.publish(r, events.Event{Type: events.TypeComment, PostID: post.ID, Post: post, Comment: &comment})
 
 	respJSON, err := json.Marshal(post)
 	if err != nil {
@@ -206,17 +291,17 @@ func (h *PostHandler) PostComment(w http.ResponseWriter, r *http.Request) {
 
 func (h *PostHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 	postid, ok := mux.Vars(r)["POST_ID"]
-	if !ok || !bson.IsObjectIdHex(postid) {
+	postuid, err := primitive.ObjectIDFromHex(postid)
+	if !ok || err != nil {
 		http.Error(w, `Can't get POST_ID`, http.StatusInternalServerError)
 		return
 	}
-	postuid := bson.ObjectIdHex(postid)
 	commentid, ok := mux.Vars(r)["COMMENT_ID"]
-	if !ok || !bson.IsObjectIdHex(commentid) {
+	commentuid, err := primitive.ObjectIDFromHex(commentid)
+	if !ok || err != nil {
 		http.Error(w, `Can't get COMMENT_ID`, http.StatusInternalServerError)
 		return
 	}
-	commentuid := bson.ObjectIdHex(commentid)
 	sess, err := h.Sessions.Check(r)
 	if err != nil {
 		http.Error(w, `Can't get session`, http.StatusInternalServerError)
@@ -226,7 +311,7 @@ func (h *PostHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusUnauthorized)
 		return
 	}
-	post, err := h.PostRepo.GetPostByID(postuid)
+	post, err := h.PostRepo.GetPostByID(r.Context(), postuid)
 	if err != nil {
 		http.Error(w, `Can't get post`, http.StatusInternalServerError)
 		return
@@ -235,11 +320,24 @@ func (h *PostHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `Can't get post`, http.StatusBadRequest)
 		return
 	}
-	err = h.PostRepo.DeleteComment(post, commentuid, sess.UserID)
+	err = h.PostRepo.DeleteComment(r.Context(), post, commentuid, sess.UserID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	h.reindex(r, post)
+	h.addStats(r, sess.UserID, items.ProfileStats{Comments: -1})
+	if h.Comments != nil {
+		if err := h.Comments.DeleteComment(r.Context(), commentuid); err != nil {
+			logger(r, h.Logger).Warnw("can't delete comment from history", "comment", commentid, "err", err)
+		}
+	}
+	if h.Notifications != nil {
+		if err := h.Notifications.DeleteByComment(r.Context(), commentuid); err != nil {
+			logger(r, h.Logger).Warnw("can't delete comment notifications", "comment", commentid, "err", err)
+		}
+	}
+	h.publish(r, events.Event{Type: events.TypeCommentDeleted, PostID: post.ID, Post: post, CommentID: &commentuid})
 
 	respJSON, err := json.Marshal(post)
 	if err != nil {
@@ -251,11 +349,11 @@ func (h *PostHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 
 func (h *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 	postid, ok := mux.Vars(r)["POST_ID"]
-	if !ok || !bson.IsObjectIdHex(postid) {
+	postuid, err := primitive.ObjectIDFromHex(postid)
+	if !ok || err != nil {
 		http.Error(w, `Can't get POST_ID`, http.StatusInternalServerError)
 		return
 	}
-	postuid := bson.ObjectIdHex(postid)
 	sess, err := h.Sessions.Check(r)
 	if err != nil {
 		http.Error(w, `Can't get session`, http.StatusInternalServerError)
@@ -265,7 +363,7 @@ func (h *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusUnauthorized)
 		return
 	}
-	user, err := h.UserRepo.GetUserByID(sess.UserID)
+	user, err := h.UserRepo.GetUserByID(r.Context(), sess.UserID)
 	if err != nil {
 		http.Error(w, `Can't get user`, http.StatusInternalServerError)
 		return
@@ -274,7 +372,7 @@ func (h *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `Can't get user`, http.StatusBadRequest)
 		return
 	}
-	err = h.PostRepo.DeletePost(postuid, user)
+	err = h.Deleter.Delete(r, postuid, user)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -283,13 +381,64 @@ func (h *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`{"message":"success"}`))
 }
 
+// PostDeleter deletes posts with everything that refers to them. Both
+// PostHandler and AccountHandler delete posts through it.
+type PostDeleter struct {
+	PostRepo      PostRepositoryInterface
+	Search        SearchIndexInterface
+	Profiles      ProfileRepositoryInterface
+	Comments      CommentRepositoryInterface
+	Saved         SavedRepositoryInterface
+	Notifications NotificationRepositoryInterface
+	Events        EventHubInterface
+	Logger        *zap.SugaredLogger
+}
+
+// Delete deletes the post of the user. Only deleting the post itself can
+// fail, the rest is cleaned up as far as it goes and failures are logged.
+func (d *PostDeleter) Delete(r *http.Request, postuid primitive.ObjectID, user *items.User) error {
+	err := d.PostRepo.DeletePost(r.Context(), postuid, user)
+	if err != nil {
+		return err
+	}
+	if d.Search != nil {
+		d.Search.Remove(r.Context(), postuid)
+	}
+	if d.Profiles != nil {
+		if err := d.Profiles.AddStats(r.Context(), user.ID, items.ProfileStats{Posts: -1}); err != nil {
+			logger(r, d.Logger).Warnw("can't update profile stats", "user", user.ID, "err", err)
+		}
+	}
+	if d.Comments != nil {
+		if err := d.Comments.DeletePostComments(r.Context(), postuid); err != nil {
+			logger(r, d.Logger).Warnw("can't delete post comments from history", "post", postuid.Hex(), "err", err)
+		}
+	}
+	if d.Saved != nil {
+		if err := d.Saved.DeleteByPost(r.Context(), postuid); err != nil {
+			logger(r, d.Logger).Warnw("can't unsave deleted post", "post", postuid.Hex(), "err", err)
+		}
+	}
+	if d.Notifications != nil {
+		if err := d.Notifications.DeleteByPost(r.Context(), postuid); err != nil {
+			logger(r, d.Logger).Warnw("can't delete post notifications", "post", postuid.Hex(), "err", err)
+		}
+	}
+	if d.Events != nil {
+		if err := d.Events.Publish(events.Event{Type: events.TypePostDeleted, PostID: postuid}); err != nil {
+			logger(r, d.Logger).Warnw("can't publish post event", "post", postuid.Hex(), "type", events.TypePostDeleted, "err", err)
+		}
+	}
+	return nil
+}
+
 func (h *PostHandler) Vote(w http.ResponseWriter, r *http.Request) {
 	postid, ok := mux.Vars(r)["POST_ID"]
-	if !ok || !bson.IsObjectIdHex(postid) {
+	postuid, err := primitive.ObjectIDFromHex(postid)
+	if !ok || err != nil {
 		http.Error(w, `Can't get POST_ID`, http.StatusInternalServerError)
 		return
 	}
-	postuid := bson.ObjectIdHex(postid)
 	votestring, ok := mux.Vars(r)["VOTE"]
 	if !ok {
 		http.Error(w, `Can't get VOTE`, http.StatusInternalServerError)
@@ -302,7 +451,7 @@ func (h *PostHandler) Vote(w http.ResponseWriter, r *http.Request) {
 	case "downvote":
 		vote = -1
 	}
-	post, err := h.PostRepo.GetPostByID(postuid)
+	post, err := h.PostRepo.GetPostByID(r.Context(), postuid)
 	if err != nil {
 		http.Error(w, `Can't get post`, http.StatusInternalServerError)
 		return
@@ -317,16 +466,28 @@ func (h *PostHandler) Vote(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusUnauthorized)
 		return
 	}
-	err = h.PostRepo.DeleteUserFromVoteTry(post, sess.UserID)
+	oldVote := 0
+	for _, v := range post.Votes {
+		if v.User == sess.UserID {
+			oldVote = v.Vote
+		}
+	}
+	err = h.PostRepo.DeleteUserFromVoteTry(r.Context(), post, sess.UserID)
 	if err != nil {
 		http.Error(w, `Can't delete vote from post`, http.StatusInternalServerError)
 		return
 	}
-	err = h.PostRepo.Vote(post, sess.UserID, vote)
+	err = h.PostRepo.Vote(r.Context(), post, sess.UserID, vote)
 	if err != nil {
 		http.Error(w, `Can't vote`, http.StatusInternalServerError)
 		return
 	}
+	h.reindex(r, post)
+	metrics.VotesCast.Inc(voteLabel(vote))
+	if vote != oldVote && post.Author != nil {
+		h.addStats(r, post.Author.ID, items.ProfileStats{PostKarma: vote - oldVote})
+	}
+	h.publish(r, events.Event{Type: events.TypeVote, PostID: post.ID, Post: post})
 	respJSON, err := json.Marshal(post)
 	if err != nil {
 		http.Error(w, `json marshalling error`, http.StatusInternalServerError)
@@ -334,3 +495,105 @@ func (h *PostHandler) Vote(w http.ResponseWriter, r *http.Request) {
 	}
 	w.Write(respJSON)
 }
+
+// VoteComment counts towards the comment karma of the comment's author.
+func (h *PostHandler) VoteComment(w http.ResponseWriter, r *http.Request) {
+	postid, ok := mux.Vars(r)["POST_ID"]
+	postuid, err := primitive.ObjectIDFromHex(postid)
+	if !ok || err != nil {
+		http.Error(w, `Can't get POST_ID`, http.StatusInternalServerError)
+		return
+	}
+	commentid, ok := mux.Vars(r)["COMMENT_ID"]
+	commentuid, err := primitive.ObjectIDFromHex(commentid)
+	if !ok || err != nil {
+		http.Error(w, `Can't get COMMENT_ID`, http.StatusInternalServerError)
+		return
+	}
+	votestring, ok := mux.Vars(r)["VOTE"]
+	if !ok {
+		http.Error(w, `Can't get VOTE`, http.StatusInternalServerError)
+		return
+	}
+	vote := 0
+	switch votestring {
+	case "upvote":
+		vote = 1
+	case "downvote":
+		vote = -1
+	}
+	post, err := h.PostRepo.GetPostByID(r.Context(), postuid)
+	if err != nil {
+		http.Error(w, `Can't get post`, http.StatusInternalServerError)
+		return
+	}
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		http.Error(w, `Can't get session`, http.StatusInternalServerError)
+		return
+	}
+	if sess == nil {
+		http.Redirect(w, r, "/", http.StatusUnauthorized)
+		return
+	}
+	var comment *items.Comment
+	for _, c := range post.Comments {
+		if c.ID == commentuid {
+			comment = c
+		}
+	}
+	if comment == nil {
+		http.Error(w, items.ErrCommentNotFound.Error(), http.StatusBadRequest)
+		return
+	}
+	oldVote := 0
+	for _, v := range comment.Votes {
+		if v.User == sess.UserID {
+			oldVote = v.Vote
+		}
+	}
+	err = h.PostRepo.VoteComment(r.Context(), post, commentuid, sess.UserID, vote)
+	if err != nil {
+		http.Error(w, `Can't vote`, http.StatusInternalServerError)
+		return
+	}
+	metrics.VotesCast.Inc(voteLabel(vote))
+	if vote != oldVote && comment.Author != nil {
+		h.addStats(r, comment.Author.ID, items.ProfileStats{CommentKarma: vote - oldVote})
+	}
+	h.publish(r, events.Event{Type: events.TypeVote, PostID: post.ID, Post: post, CommentID: &commentuid})
+	respJSON, err := json.Marshal(post)
+	if err != nil {
+		http.Error(w, `json marshalling error`, http.StatusInternalServerError)
+		return
+	}
+	w.Write(respJSON)
+}
+
+func (h *PostHandler) reindex(r *http.Request, post *items.Post) {
+	if h.Search != nil {
+		h.Search.Index(r.Context(), post)
+	}
+}
+
+// addStats keeps profile counters in sync. The post itself is already saved
+// at this point, so a failure is only logged.
+func (h *PostHandler) addStats(r *http.Request, userID int, delta items.ProfileStats) {
+	if h.Profiles == nil {
+		return
+	}
+	if err := h.Profiles.AddStats(r.Context(), userID, delta); err != nil {
+		logger(r, h.Logger).Warnw("can't update profile stats", "user", userID, "err", err)
+	}
+}
+
+func voteLabel(vote int) string {
+	switch vote {
+	case 1:
+		return "up"
+	case -1:
+		return "down"
+	}
+	return "unvote"
+}
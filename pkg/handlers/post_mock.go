@@ -6,10 +6,13 @@ package handlers
 
 import (
 	items "asperitas-clone/pkg/items"
+	query "asperitas-clone/pkg/query"
+	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
-	bson "gopkg.in/mgo.v2/bson"
+	primitive "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // MockPostRepositoryInterface is a mock of PostRepositoryInterface interface.
@@ -36,147 +39,263 @@ func (m *MockPostRepositoryInterface) EXPECT() *MockPostRepositoryInterfaceMockR
 }
 
 // AddPost mocks base method.
-func (m *MockPostRepositoryInterface) AddPost(arg0 *items.Post) (bson.ObjectId, error) {
+func (m *MockPostRepositoryInterface) AddPost(arg0 context.Context, arg1 *items.Post) (primitive.ObjectID, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddPost", arg0)
-	ret0, _ := ret[0].(bson.ObjectId)
+	ret := m.ctrl.Call(m, "AddPost", arg0, arg1)
+	ret0, _ := ret[0].(primitive.ObjectID)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AddPost indicates an expected call of AddPost.
-func (mr *MockPostRepositoryInterfaceMockRecorder) AddPost(arg0 interface{}) *gomock.Call {
+func (mr *MockPostRepositoryInterfaceMockRecorder) AddPost(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddPost", reflect.TypeOf((*MockPostRepositoryInterface)(nil).AddPost), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddPost", reflect.TypeOf((*MockPostRepositoryInterface)(nil).AddPost), arg0, arg1)
+}
+
+// AnonymizeAuthor mocks base method.
+func (m *MockPostRepositoryInterface) AnonymizeAuthor(arg0 context.Context, arg1 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AnonymizeAuthor", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AnonymizeAuthor indicates an expected call of AnonymizeAuthor.
+func (mr *MockPostRepositoryInterfaceMockRecorder) AnonymizeAuthor(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AnonymizeAuthor", reflect.TypeOf((*MockPostRepositoryInterface)(nil).AnonymizeAuthor), arg0, arg1)
+}
+
+// DeleteAuthorComments mocks base method.
+func (m *MockPostRepositoryInterface) DeleteAuthorComments(arg0 context.Context, arg1 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAuthorComments", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAuthorComments indicates an expected call of DeleteAuthorComments.
+func (mr *MockPostRepositoryInterfaceMockRecorder) DeleteAuthorComments(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAuthorComments", reflect.TypeOf((*MockPostRepositoryInterface)(nil).DeleteAuthorComments), arg0, arg1)
 }
 
 // DeleteComment mocks base method.
-func (m *MockPostRepositoryInterface) DeleteComment(arg0 *items.Post, arg1 bson.ObjectId, arg2 int) error {
+func (m *MockPostRepositoryInterface) DeleteComment(arg0 context.Context, arg1 *items.Post, arg2 primitive.ObjectID, arg3 int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteComment", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "DeleteComment", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteComment indicates an expected call of DeleteComment.
-func (mr *MockPostRepositoryInterfaceMockRecorder) DeleteComment(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockPostRepositoryInterfaceMockRecorder) DeleteComment(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteComment", reflect.TypeOf((*MockPostRepositoryInterface)(nil).DeleteComment), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteComment", reflect.TypeOf((*MockPostRepositoryInterface)(nil).DeleteComment), arg0, arg1, arg2, arg3)
 }
 
 // DeletePost mocks base method.
-func (m *MockPostRepositoryInterface) DeletePost(arg0 bson.ObjectId, arg1 *items.User) error {
+func (m *MockPostRepositoryInterface) DeletePost(arg0 context.Context, arg1 primitive.ObjectID, arg2 *items.User) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeletePost", arg0, arg1)
+	ret := m.ctrl.Call(m, "DeletePost", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeletePost indicates an expected call of DeletePost.
-func (mr *MockPostRepositoryInterfaceMockRecorder) DeletePost(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockPostRepositoryInterfaceMockRecorder) DeletePost(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePost", reflect.TypeOf((*MockPostRepositoryInterface)(nil).DeletePost), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePost", reflect.TypeOf((*MockPostRepositoryInterface)(nil).DeletePost), arg0, arg1, arg2)
 }
 
 // DeleteUserFromVoteTry mocks base method.
-func (m *MockPostRepositoryInterface) DeleteUserFromVoteTry(arg0 *items.Post, arg1 int) error {
+func (m *MockPostRepositoryInterface) DeleteUserFromVoteTry(arg0 context.Context, arg1 *items.Post, arg2 int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteUserFromVoteTry", arg0, arg1)
+	ret := m.ctrl.Call(m, "DeleteUserFromVoteTry", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteUserFromVoteTry indicates an expected call of DeleteUserFromVoteTry.
-func (mr *MockPostRepositoryInterfaceMockRecorder) DeleteUserFromVoteTry(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockPostRepositoryInterfaceMockRecorder) DeleteUserFromVoteTry(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserFromVoteTry", reflect.TypeOf((*MockPostRepositoryInterface)(nil).DeleteUserFromVoteTry), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserFromVoteTry", reflect.TypeOf((*MockPostRepositoryInterface)(nil).DeleteUserFromVoteTry), arg0, arg1, arg2)
 }
 
 // GetAllPosts mocks base method.
-func (m *MockPostRepositoryInterface) GetAllPosts() ([]*items.Post, error) {
+func (m *MockPostRepositoryInterface) GetAllPosts(arg0 context.Context) ([]*items.Post, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllPosts")
+	ret := m.ctrl.Call(m, "GetAllPosts", arg0)
 	ret0, _ := ret[0].([]*items.Post)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAllPosts indicates an expected call of GetAllPosts.
-func (mr *MockPostRepositoryInterfaceMockRecorder) GetAllPosts() *gomock.Call {
+func (mr *MockPostRepositoryInterfaceMockRecorder) GetAllPosts(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllPosts", reflect.TypeOf((*MockPostRepositoryInterface)(nil).GetAllPosts))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllPosts", reflect.TypeOf((*MockPostRepositoryInterface)(nil).GetAllPosts), arg0)
 }
 
 // GetPostByID mocks base method.
-func (m *MockPostRepositoryInterface) GetPostByID(arg0 bson.ObjectId) (*items.Post, error) {
+func (m *MockPostRepositoryInterface) GetPostByID(arg0 context.Context, arg1 primitive.ObjectID) (*items.Post, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPostByID", arg0)
+	ret := m.ctrl.Call(m, "GetPostByID", arg0, arg1)
 	ret0, _ := ret[0].(*items.Post)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetPostByID indicates an expected call of GetPostByID.
-func (mr *MockPostRepositoryInterfaceMockRecorder) GetPostByID(arg0 interface{}) *gomock.Call {
+func (mr *MockPostRepositoryInterfaceMockRecorder) GetPostByID(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostByID", reflect.TypeOf((*MockPostRepositoryInterface)(nil).GetPostByID), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostByID", reflect.TypeOf((*MockPostRepositoryInterface)(nil).GetPostByID), arg0, arg1)
 }
 
 // GetPostsByCategory mocks base method.
-func (m *MockPostRepositoryInterface) GetPostsByCategory(arg0 string) ([]*items.Post, error) {
+func (m *MockPostRepositoryInterface) GetPostsByCategory(arg0 context.Context, arg1 string) ([]*items.Post, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPostsByCategory", arg0)
+	ret := m.ctrl.Call(m, "GetPostsByCategory", arg0, arg1)
 	ret0, _ := ret[0].([]*items.Post)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetPostsByCategory indicates an expected call of GetPostsByCategory.
-func (mr *MockPostRepositoryInterfaceMockRecorder) GetPostsByCategory(arg0 interface{}) *gomock.Call {
+func (mr *MockPostRepositoryInterfaceMockRecorder) GetPostsByCategory(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostsByCategory", reflect.TypeOf((*MockPostRepositoryInterface)(nil).GetPostsByCategory), arg0, arg1)
+}
+
+// GetPostsByCommenter mocks base method.
+func (m *MockPostRepositoryInterface) GetPostsByCommenter(arg0 context.Context, arg1 int) ([]*items.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPostsByCommenter", arg0, arg1)
+	ret0, _ := ret[0].([]*items.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPostsByCommenter indicates an expected call of GetPostsByCommenter.
+func (mr *MockPostRepositoryInterfaceMockRecorder) GetPostsByCommenter(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostsByCommenter", reflect.TypeOf((*MockPostRepositoryInterface)(nil).GetPostsByCommenter), arg0, arg1)
+}
+
+// GetPostsByFilter mocks base method.
+func (m *MockPostRepositoryInterface) GetPostsByFilter(arg0 context.Context, arg1 *query.Query) ([]*items.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPostsByFilter", arg0, arg1)
+	ret0, _ := ret[0].([]*items.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPostsByFilter indicates an expected call of GetPostsByFilter.
+func (mr *MockPostRepositoryInterfaceMockRecorder) GetPostsByFilter(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostsByCategory", reflect.TypeOf((*MockPostRepositoryInterface)(nil).GetPostsByCategory), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostsByFilter", reflect.TypeOf((*MockPostRepositoryInterface)(nil).GetPostsByFilter), arg0, arg1)
+}
+
+// GetPostsByIDs mocks base method.
+func (m *MockPostRepositoryInterface) GetPostsByIDs(arg0 context.Context, arg1 []primitive.ObjectID) ([]*items.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPostsByIDs", arg0, arg1)
+	ret0, _ := ret[0].([]*items.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPostsByIDs indicates an expected call of GetPostsByIDs.
+func (mr *MockPostRepositoryInterfaceMockRecorder) GetPostsByIDs(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostsByIDs", reflect.TypeOf((*MockPostRepositoryInterface)(nil).GetPostsByIDs), arg0, arg1)
 }
 
 // GetPostsByUsername mocks base method.
-func (m *MockPostRepositoryInterface) GetPostsByUsername(arg0 string) ([]*items.Post, error) {
+func (m *MockPostRepositoryInterface) GetPostsByUsername(arg0 context.Context, arg1 string) ([]*items.Post, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPostsByUsername", arg0)
+	ret := m.ctrl.Call(m, "GetPostsByUsername", arg0, arg1)
 	ret0, _ := ret[0].([]*items.Post)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetPostsByUsername indicates an expected call of GetPostsByUsername.
-func (mr *MockPostRepositoryInterfaceMockRecorder) GetPostsByUsername(arg0 interface{}) *gomock.Call {
+func (mr *MockPostRepositoryInterfaceMockRecorder) GetPostsByUsername(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostsByUsername", reflect.TypeOf((*MockPostRepositoryInterface)(nil).GetPostsByUsername), arg0, arg1)
+}
+
+// GetRecentPosts mocks base method.
+func (m *MockPostRepositoryInterface) GetRecentPosts(arg0 context.Context, arg1 []string, arg2 time.Time, arg3 int) ([]*items.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRecentPosts", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]*items.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRecentPosts indicates an expected call of GetRecentPosts.
+func (mr *MockPostRepositoryInterfaceMockRecorder) GetRecentPosts(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostsByUsername", reflect.TypeOf((*MockPostRepositoryInterface)(nil).GetPostsByUsername), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRecentPosts", reflect.TypeOf((*MockPostRepositoryInterface)(nil).GetRecentPosts), arg0, arg1, arg2, arg3)
 }
 
 // PostComment mocks base method.
-func (m *MockPostRepositoryInterface) PostComment(arg0 *items.Post, arg1 *items.Comment) (bson.ObjectId, error) {
+func (m *MockPostRepositoryInterface) PostComment(arg0 context.Context, arg1 *items.Post, arg2 *items.Comment) (primitive.ObjectID, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "PostComment", arg0, arg1)
-	ret0, _ := ret[0].(bson.ObjectId)
+	ret := m.ctrl.Call(m, "PostComment", arg0, arg1, arg2)
+	ret0, _ := ret[0].(primitive.ObjectID)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // PostComment indicates an expected call of PostComment.
-func (mr *MockPostRepositoryInterfaceMockRecorder) PostComment(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockPostRepositoryInterfaceMockRecorder) PostComment(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PostComment", reflect.TypeOf((*MockPostRepositoryInterface)(nil).PostComment), arg0, arg1, arg2)
+}
+
+// RenameAuthor mocks base method.
+func (m *MockPostRepositoryInterface) RenameAuthor(arg0 context.Context, arg1 int, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenameAuthor", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RenameAuthor indicates an expected call of RenameAuthor.
+func (mr *MockPostRepositoryInterfaceMockRecorder) RenameAuthor(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PostComment", reflect.TypeOf((*MockPostRepositoryInterface)(nil).PostComment), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenameAuthor", reflect.TypeOf((*MockPostRepositoryInterface)(nil).RenameAuthor), arg0, arg1, arg2)
 }
 
 // Vote mocks base method.
-func (m *MockPostRepositoryInterface) Vote(arg0 *items.Post, arg1, arg2 int) error {
+func (m *MockPostRepositoryInterface) Vote(arg0 context.Context, arg1 *items.Post, arg2, arg3 int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Vote", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "Vote", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Vote indicates an expected call of Vote.
-func (mr *MockPostRepositoryInterfaceMockRecorder) Vote(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockPostRepositoryInterfaceMockRecorder) Vote(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Vote", reflect.TypeOf((*MockPostRepositoryInterface)(nil).Vote), arg0, arg1, arg2, arg3)
+}
+
+// VoteComment mocks base method.
+func (m *MockPostRepositoryInterface) VoteComment(arg0 context.Context, arg1 *items.Post, arg2 primitive.ObjectID, arg3, arg4 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VoteComment", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VoteComment indicates an expected call of VoteComment.
+func (mr *MockPostRepositoryInterfaceMockRecorder) VoteComment(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Vote", reflect.TypeOf((*MockPostRepositoryInterface)(nil).Vote), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VoteComment", reflect.TypeOf((*MockPostRepositoryInterface)(nil).VoteComment), arg0, arg1, arg2, arg3, arg4)
 }
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/session"
+
+	"github.com/gorilla/mux"
+)
+
+const maxBioLength = 500
+
+// mockgen -source="profile.go" -destination="profile_mock.go" -package=handlers ProfileRepositoryInterface
+
+type ProfileRepositoryInterface interface {
+	GetProfile(context.Context, string) (*items.Profile, error)
+	CreateProfile(context.Context, int, time.Time) error
+	UpdateProfile(context.Context, int, string, string) error
+	AddStats(context.Context, int, items.ProfileStats) error
+}
+
+type ProfileHandler struct {
+	Profiles ProfileRepositoryInterface
+	UserRepo UserRepositoryInterface
+	Sessions session.SessionManagerInterface
+}
+
+func (h *ProfileHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	username, ok := mux.Vars(r)["USERNAME"]
+	if !ok {
+		http.Error(w, `Can't get USERNAME`, http.StatusInternalServerError)
+		return
+	}
+	profile, err := h.Profiles.GetProfile(r.Context(), username)
+	if err != nil {
+		http.Error(w, `Can't get profile`, http.StatusInternalServerError)
+		return
+	}
+	if profile == nil {
+		jsonError(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	respJSON, err := json.Marshal(profile)
+	if err != nil {
+		http.Error(w, `json marshalling error`, http.StatusInternalServerError)
+		return
+	}
+	w.Write(respJSON)
+}
+
+type profileUpdate struct {
+	Bio       string `json:"bio"`
+	AvatarURL string `json:"avatarUrl"`
+}
+
+func (h *ProfileHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	username, ok := mux.Vars(r)["USERNAME"]
+	if !ok {
+		http.Error(w, `Can't get USERNAME`, http.StatusInternalServerError)
+		return
+	}
+	update := profileUpdate{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&update); err != nil {
+		http.Error(w, `Can't decode`, http.StatusInternalServerError)
+		return
+	}
+	r.Body.Close()
+
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		http.Error(w, `Can't get session`, http.StatusInternalServerError)
+		return
+	}
+	if sess == nil {
+		http.Redirect(w, r, "/", http.StatusUnauthorized)
+		return
+	}
+	user, err := h.UserRepo.GetUserByID(r.Context(), sess.UserID)
+	if err != nil {
+		http.Error(w, `Can't get user`, http.StatusInternalServerError)
+		return
+	}
+	if user == nil || user.Username != username {
+		jsonError(w, items.ErrPermissionDenied.Error(), http.StatusForbidden)
+		return
+	}
+
+	errs := []items.MessageAuthError{}
+	if utf8.RuneCountInString(update.Bio) > maxBioLength {
+		errs = append(errs, items.MessageAuthError{
+			Location: "body",
+			Param:    "bio",
+			Value:    update.Bio,
+			Msg:      "is too long",
+		})
+	}
+	if update.AvatarURL != "" {
+		u, err := url.Parse(update.AvatarURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, items.MessageAuthError{
+				Location: "body",
+				Param:    "avatarUrl",
+				Value:    update.AvatarURL,
+				Msg:      "is invalid",
+			})
+		}
+	}
+	if len(errs) != 0 {
+		resp, err := json.Marshal(items.ErrorList{Errors: errs})
+		if err != nil {
+			http.Error(w, `Can't marshal errors`, http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, string(resp), http.StatusUnprocessableEntity)
+		return
+	}
+
+	err = h.Profiles.UpdateProfile(r.Context(), user.ID, update.Bio, update.AvatarURL)
+	if err != nil {
+		http.Error(w, `Can't update profile`, http.StatusInternalServerError)
+		return
+	}
+	h.GetProfile(w, r)
+}
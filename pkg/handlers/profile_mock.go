@@ -0,0 +1,94 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: profile.go
+
+// Package handlers is a generated GoMock package.
+package handlers
+
+import (
+	items "asperitas-clone/pkg/items"
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockProfileRepositoryInterface is a mock of ProfileRepositoryInterface interface.
+type MockProfileRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockProfileRepositoryInterfaceMockRecorder
+}
+
+// MockProfileRepositoryInterfaceMockRecorder is the mock recorder for MockProfileRepositoryInterface.
+type MockProfileRepositoryInterfaceMockRecorder struct {
+	mock *MockProfileRepositoryInterface
+}
+
+// NewMockProfileRepositoryInterface creates a new mock instance.
+func NewMockProfileRepositoryInterface(ctrl *gomock.Controller) *MockProfileRepositoryInterface {
+	mock := &MockProfileRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockProfileRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockProfileRepositoryInterface) EXPECT() *MockProfileRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// AddStats mocks base method.
+func (m *MockProfileRepositoryInterface) AddStats(arg0 context.Context, arg1 int, arg2 items.ProfileStats) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddStats", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddStats indicates an expected call of AddStats.
+func (mr *MockProfileRepositoryInterfaceMockRecorder) AddStats(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddStats", reflect.TypeOf((*MockProfileRepositoryInterface)(nil).AddStats), arg0, arg1, arg2)
+}
+
+// CreateProfile mocks base method.
+func (m *MockProfileRepositoryInterface) CreateProfile(arg0 context.Context, arg1 int, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateProfile", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateProfile indicates an expected call of CreateProfile.
+func (mr *MockProfileRepositoryInterfaceMockRecorder) CreateProfile(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateProfile", reflect.TypeOf((*MockProfileRepositoryInterface)(nil).CreateProfile), arg0, arg1, arg2)
+}
+
+// GetProfile mocks base method.
+func (m *MockProfileRepositoryInterface) GetProfile(arg0 context.Context, arg1 string) (*items.Profile, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProfile", arg0, arg1)
+	ret0, _ := ret[0].(*items.Profile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProfile indicates an expected call of GetProfile.
+func (mr *MockProfileRepositoryInterfaceMockRecorder) GetProfile(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfile", reflect.TypeOf((*MockProfileRepositoryInterface)(nil).GetProfile), arg0, arg1)
+}
+
+// UpdateProfile mocks base method.
+func (m *MockProfileRepositoryInterface) UpdateProfile(arg0 context.Context, arg1 int, arg2, arg3 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateProfile", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateProfile indicates an expected call of UpdateProfile.
+func (mr *MockProfileRepositoryInterfaceMockRecorder) UpdateProfile(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProfile", reflect.TypeOf((*MockProfileRepositoryInterface)(nil).UpdateProfile), arg0, arg1, arg2, arg3)
+}
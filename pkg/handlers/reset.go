@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"asperitas-clone/pkg/credentials"
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/mail"
+	"asperitas-clone/pkg/session"
+
+	"go.uber.org/zap"
+)
+
+// mockgen -source="reset.go" -destination="reset_mock.go" -package=handlers ResetRepositoryInterface,MailerInterface
+
+type ResetRepositoryInterface interface {
+	Create(context.Context, int) (string, error)
+	Check(context.Context, string) (int, error)
+	Consume(context.Context, string) (int, error)
+}
+
+type MailerInterface interface {
+	Send(context.Context, *mail.Message) error
+}
+
+// ResetHandler lets users who forgot their password set a new one through a
+// link sent to their email.
+type ResetHandler struct {
+	UserRepo UserRepositoryInterface
+	Resets   ResetRepositoryInterface
+	Mailer   MailerInterface
+	Sessions session.SessionManagerInterface
+	// Lockout, if set, is lifted for the user after a reset.
+	Lockout LoginGuardInterface
+	Policy  *credentials.Policy
+	// Emails, if set, lets a user get one reset mail per ResendInterval.
+	Emails         EmailRepositoryInterface
+	ResendInterval time.Duration
+	// BaseURL is where the site is reachable, links in mails point there.
+	BaseURL string
+	TTL     time.Duration
+	Logger  *zap.SugaredLogger
+	// mails are reset mails still being sent.
+	mails sync.WaitGroup
+}
+
+// resetMailTimeout bounds the work of a reset mail, it runs after the
+// request is answered.
+const resetMailTimeout = 30 * time.Second
+
+type resetRequest struct {
+	Email string `json:"email"`
+}
+
+type resetConfirmation struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+const resetRequested = `{"message":"if the address belongs to an account, a reset link was sent to it"}`
+
+// RequestReset mails a reset link. The answer is the same whether the
+// address is known or not, and the mail goes out after it, so neither the
+// answer nor its timing tells who is registered.
+func (h *ResetHandler) RequestReset(w http.ResponseWriter, r *http.Request) {
+	req := resetRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `Can't decode`, http.StatusInternalServerError)
+		return
+	}
+	user, err := h.UserRepo.GetUserByEmail(r.Context(), req.Email)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	// an unverified address may belong to someone else
+	if user == nil || !user.EmailVerified {
+		w.Write([]byte(resetRequested))
+		return
+	}
+	h.mails.Add(1)
+	go h.sendReset(logger(r, h.Logger), user)
+	w.Write([]byte(resetRequested))
+}
+
+// Wait returns once the reset mails being sent are out.
+func (h *ResetHandler) Wait() {
+	h.mails.Wait()
+}
+
+func (h *ResetHandler) resendInterval() time.Duration {
+	if h.ResendInterval <= 0 {
+		return DefaultResendInterval
+	}
+	return h.ResendInterval
+}
+
+// sendReset creates a token for the user and mails the link, at most once
+// per ResendInterval. The request is answered already, errors are only
+// logged.
+func (h *ResetHandler) sendReset(log *zap.SugaredLogger, user *items.User) {
+	defer h.mails.Done()
+	ctx, cancel := context.WithTimeout(context.Background(), resetMailTimeout)
+	defer cancel()
+	if h.Emails != nil {
+		ok, err := h.Emails.MarkResetSent(ctx, user.ID, h.resendInterval())
+		if err != nil {
+			log.Errorw("can't send reset mail", "user", user.ID, "err", err)
+			return
+		}
+		if !ok {
+			log.Infow("reset mail was sent recently", "user", user.ID)
+			return
+		}
+	}
+	token, err := h.Resets.Create(ctx, user.ID)
+	if err != nil {
+		log.Errorw("can't create reset token", "user", user.ID, "err", err)
+		return
+	}
+	err = h.Mailer.Send(ctx, h.resetMail(user, token))
+	if err != nil {
+		log.Errorw("can't send reset mail", "user", user.ID, "err", err)
+		return
+	}
+	log.Infow("reset mail sent", "user", user.ID)
+}
+
+func (h *ResetHandler) resetMail(user *items.User, token string) *mail.Message {
+	ttl := h.TTL
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	link := h.BaseURL + "/reset-password?token=" + url.QueryEscape(token)
+	return &mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"someone asked to reset the password of your account. To choose a new one, open\n\n"+
+			"%s\n\n"+
+			"The link works once and expires in %s. If it wasn't you, ignore this mail, your password stays the same.\n",
+			user.Username, link, ttl),
+	}
+}
+
+// ConfirmReset sets the new password and ends every session of the user.
+func (h *ResetHandler) ConfirmReset(w http.ResponseWriter, r *http.Request) {
+	confirmation := resetConfirmation{}
+	if err := json.NewDecoder(r.Body).Decode(&confirmation); err != nil {
+		http.Error(w, `Can't decode`, http.StatusInternalServerError)
+		return
+	}
+	// the token is only checked here, so a password the policy rejects
+	// doesn't use it up
+	userID, err := h.Resets.Check(r.Context(), confirmation.Token)
+	if errors.Is(err, items.ErrBadResetToken) {
+		badResetToken(w)
+		return
+	} else if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	user, err := h.UserRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		badResetToken(w)
+		return
+	}
+	if h.Policy != nil {
+		if errs := h.Policy.CheckPassword("password", user.Username, confirmation.Password); len(errs) != 0 {
+			writeErrors(w, errs)
+			return
+		}
+	}
+	_, err = h.Resets.Consume(r.Context(), confirmation.Token)
+	if errors.Is(err, items.ErrBadResetToken) {
+		badResetToken(w)
+		return
+	} else if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	err = h.UserRepo.ChangePassword(r.Context(), user.ID, confirmation.Password)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	err = h.Sessions.DestroyOthers(r.Context(), user.ID, "")
+	if err != nil {
+		jsonError(w, "can't end sessions", http.StatusInternalServerError)
+		return
+	}
+	if h.Lockout != nil {
+		if err := h.Lockout.Reset(r.Context(), user.Username); err != nil {
+			logger(r, h.Logger).Warnw("can't reset failed logins", "user", user.ID, "err", err)
+		}
+	}
+	logger(r, h.Logger).Infow("password reset", "user", user.ID)
+	w.Write([]byte(`{"message":"success"}`))
+}
+
+func badResetToken(w http.ResponseWriter) {
+	writeErrors(w, []items.MessageAuthError{{
+		Location: "body",
+		Param:    "token",
+		Msg:      "is invalid or expired",
+	}})
+}
@@ -0,0 +1,118 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: reset.go
+
+// Package handlers is a generated GoMock package.
+package handlers
+
+import (
+	mail "asperitas-clone/pkg/mail"
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockResetRepositoryInterface is a mock of ResetRepositoryInterface interface.
+type MockResetRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockResetRepositoryInterfaceMockRecorder
+}
+
+// MockResetRepositoryInterfaceMockRecorder is the mock recorder for MockResetRepositoryInterface.
+type MockResetRepositoryInterfaceMockRecorder struct {
+	mock *MockResetRepositoryInterface
+}
+
+// NewMockResetRepositoryInterface creates a new mock instance.
+func NewMockResetRepositoryInterface(ctrl *gomock.Controller) *MockResetRepositoryInterface {
+	mock := &MockResetRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockResetRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockResetRepositoryInterface) EXPECT() *MockResetRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Check mocks base method.
+func (m *MockResetRepositoryInterface) Check(arg0 context.Context, arg1 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Check", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Check indicates an expected call of Check.
+func (mr *MockResetRepositoryInterfaceMockRecorder) Check(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Check", reflect.TypeOf((*MockResetRepositoryInterface)(nil).Check), arg0, arg1)
+}
+
+// Consume mocks base method.
+func (m *MockResetRepositoryInterface) Consume(arg0 context.Context, arg1 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Consume", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Consume indicates an expected call of Consume.
+func (mr *MockResetRepositoryInterfaceMockRecorder) Consume(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Consume", reflect.TypeOf((*MockResetRepositoryInterface)(nil).Consume), arg0, arg1)
+}
+
+// Create mocks base method.
+func (m *MockResetRepositoryInterface) Create(arg0 context.Context, arg1 int) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockResetRepositoryInterfaceMockRecorder) Create(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockResetRepositoryInterface)(nil).Create), arg0, arg1)
+}
+
+// MockMailerInterface is a mock of MailerInterface interface.
+type MockMailerInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockMailerInterfaceMockRecorder
+}
+
+// MockMailerInterfaceMockRecorder is the mock recorder for MockMailerInterface.
+type MockMailerInterfaceMockRecorder struct {
+	mock *MockMailerInterface
+}
+
+// NewMockMailerInterface creates a new mock instance.
+func NewMockMailerInterface(ctrl *gomock.Controller) *MockMailerInterface {
+	mock := &MockMailerInterface{ctrl: ctrl}
+	mock.recorder = &MockMailerInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMailerInterface) EXPECT() *MockMailerInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Send mocks base method.
+func (m *MockMailerInterface) Send(arg0 context.Context, arg1 *mail.Message) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Send", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Send indicates an expected call of Send.
+func (mr *MockMailerInterfaceMockRecorder) Send(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockMailerInterface)(nil).Send), arg0, arg1)
+}
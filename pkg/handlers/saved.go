@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/session"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mockgen -source="saved.go" -destination="saved_mock.go" -package=handlers SavedRepositoryInterface
+
+type SavedRepositoryInterface interface {
+	Save(context.Context, int, primitive.ObjectID) error
+	Unsave(context.Context, int, primitive.ObjectID) error
+	DeleteByPost(context.Context, primitive.ObjectID) error
+	GetSaved(context.Context, int, int, int) ([]primitive.ObjectID, error)
+	FilterSaved(context.Context, int, []primitive.ObjectID) ([]primitive.ObjectID, error)
+}
+
+func (h *PostHandler) Save(w http.ResponseWriter, r *http.Request) {
+	h.setSaved(w, r, true)
+}
+
+func (h *PostHandler) Unsave(w http.ResponseWriter, r *http.Request) {
+	h.setSaved(w, r, false)
+}
+
+func (h *PostHandler) setSaved(w http.ResponseWriter, r *http.Request, saved bool) {
+	postid, ok := mux.Vars(r)["POST_ID"]
+	postuid, err := primitive.ObjectIDFromHex(postid)
+	if !ok || err != nil {
+		http.Error(w, `Can't get POST_ID`, http.StatusInternalServerError)
+		return
+	}
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		http.Error(w, `Can't get session`, http.StatusInternalServerError)
+		return
+	}
+	if sess == nil {
+		http.Redirect(w, r, "/", http.StatusUnauthorized)
+		return
+	}
+	post, err := h.PostRepo.GetPostByID(r.Context(), postuid)
+	if errors.Is(err, items.ErrPostNotFound) {
+		jsonError(w, "post not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, `Can't get post`, http.StatusInternalServerError)
+		return
+	}
+	if saved {
+		err = h.Saved.Save(r.Context(), sess.UserID, postuid)
+	} else {
+		err = h.Saved.Unsave(r.Context(), sess.UserID, postuid)
+	}
+	if err != nil {
+		http.Error(w, `Can't save post`, http.StatusInternalServerError)
+		return
+	}
+	post.Saved = saved
+
+	respJSON, err := json.Marshal(post)
+	if err != nil {
+		http.Error(w, `json marshalling error`, http.StatusInternalServerError)
+		return
+	}
+	w.Write(respJSON)
+}
+
+func (h *PostHandler) GetSaved(w http.ResponseWriter, r *http.Request) {
+	offset, limit, err := parsePage(r)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sess, err := h.Sessions.Check(r)
+	if err != nil {
+		http.Error(w, `Can't get session`, http.StatusInternalServerError)
+		return
+	}
+	if sess == nil {
+		http.Redirect(w, r, "/", http.StatusUnauthorized)
+		return
+	}
+	ids, err := h.Saved.GetSaved(r.Context(), sess.UserID, offset, limit)
+	if err != nil {
+		http.Error(w, `Can't get saved posts`, http.StatusInternalServerError)
+		return
+	}
+	elems, err := h.PostRepo.GetPostsByIDs(r.Context(), ids)
+	if err != nil {
+		http.Error(w, `DB error`, http.StatusInternalServerError)
+		return
+	}
+	for _, elem := range elems {
+		elem.Saved = true
+	}
+
+	respJSON, err := json.Marshal(elems)
+	if err != nil {
+		http.Error(w, `json marshalling error`, http.StatusInternalServerError)
+		return
+	}
+	w.Write(respJSON)
+}
+
+// markSaved sets the saved flag on posts for a logged in user. Anonymous
+// requests and lookup errors leave the flags unset.
+func markSaved(r *http.Request, sessions session.SessionManagerInterface, saved SavedRepositoryInterface, posts ...*items.Post) {
+	if saved == nil || len(posts) == 0 {
+		return
+	}
+	sess, err := sessions.Check(r)
+	if err != nil || sess == nil {
+		return
+	}
+	ids := make([]primitive.ObjectID, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+	savedIDs, err := saved.FilterSaved(r.Context(), sess.UserID, ids)
+	if err != nil {
+		return
+	}
+	isSaved := make(map[primitive.ObjectID]bool, len(savedIDs))
+	for _, id := range savedIDs {
+		isSaved[id] = true
+	}
+	for _, post := range posts {
+		post.Saved = isSaved[post.ID]
+	}
+}
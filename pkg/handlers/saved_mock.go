@@ -0,0 +1,108 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: saved.go
+
+// Package handlers is a generated GoMock package.
+package handlers
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	primitive "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MockSavedRepositoryInterface is a mock of SavedRepositoryInterface interface.
+type MockSavedRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockSavedRepositoryInterfaceMockRecorder
+}
+
+// MockSavedRepositoryInterfaceMockRecorder is the mock recorder for MockSavedRepositoryInterface.
+type MockSavedRepositoryInterfaceMockRecorder struct {
+	mock *MockSavedRepositoryInterface
+}
+
+// NewMockSavedRepositoryInterface creates a new mock instance.
+func NewMockSavedRepositoryInterface(ctrl *gomock.Controller) *MockSavedRepositoryInterface {
+	mock := &MockSavedRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockSavedRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSavedRepositoryInterface) EXPECT() *MockSavedRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// DeleteByPost mocks base method.
+func (m *MockSavedRepositoryInterface) DeleteByPost(arg0 context.Context, arg1 primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteByPost", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteByPost indicates an expected call of DeleteByPost.
+func (mr *MockSavedRepositoryInterfaceMockRecorder) DeleteByPost(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteByPost", reflect.TypeOf((*MockSavedRepositoryInterface)(nil).DeleteByPost), arg0, arg1)
+}
+
+// FilterSaved mocks base method.
+func (m *MockSavedRepositoryInterface) FilterSaved(arg0 context.Context, arg1 int, arg2 []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FilterSaved", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]primitive.ObjectID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FilterSaved indicates an expected call of FilterSaved.
+func (mr *MockSavedRepositoryInterfaceMockRecorder) FilterSaved(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FilterSaved", reflect.TypeOf((*MockSavedRepositoryInterface)(nil).FilterSaved), arg0, arg1, arg2)
+}
+
+// GetSaved mocks base method.
+func (m *MockSavedRepositoryInterface) GetSaved(arg0 context.Context, arg1, arg2, arg3 int) ([]primitive.ObjectID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSaved", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]primitive.ObjectID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSaved indicates an expected call of GetSaved.
+func (mr *MockSavedRepositoryInterfaceMockRecorder) GetSaved(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSaved", reflect.TypeOf((*MockSavedRepositoryInterface)(nil).GetSaved), arg0, arg1, arg2, arg3)
+}
+
+// Save mocks base method.
+func (m *MockSavedRepositoryInterface) Save(arg0 context.Context, arg1 int, arg2 primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockSavedRepositoryInterfaceMockRecorder) Save(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockSavedRepositoryInterface)(nil).Save), arg0, arg1, arg2)
+}
+
+// Unsave mocks base method.
+func (m *MockSavedRepositoryInterface) Unsave(arg0 context.Context, arg1 int, arg2 primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unsave", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unsave indicates an expected call of Unsave.
+func (mr *MockSavedRepositoryInterfaceMockRecorder) Unsave(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unsave", reflect.TypeOf((*MockSavedRepositoryInterface)(nil).Unsave), arg0, arg1, arg2)
+}
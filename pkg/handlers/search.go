@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/query"
+	"asperitas-clone/pkg/search"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mockgen -source="search.go" -destination="search_mock.go" -package=handlers SearchIndexInterface
+
+type SearchIndexInterface interface {
+	Index(context.Context, *items.Post)
+	Remove(context.Context, primitive.ObjectID)
+	Search(context.Context, *search.Query) (*search.Result, error)
+}
+
+type SearchHandler struct {
+	Index SearchIndexInterface
+}
+
+func (h *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	parsed, ok := parseQuery(w, r)
+	if !ok {
+		return
+	}
+	q := &search.Query{}
+	if parsed != nil {
+		q.Query = *parsed
+	}
+	params := r.URL.Query()
+	if category := params.Get("category"); category != "" {
+		q.Category = category
+	}
+	if author := params.Get("author"); author != "" {
+		q.Author = author
+	}
+	if postType := params.Get("type"); postType != "" {
+		q.Type = postType
+	}
+	var err error
+	if from := params.Get("from"); from != "" {
+		if q.After, err = query.ParseDate(from); err != nil {
+			jsonError(w, "bad from date", http.StatusBadRequest)
+			return
+		}
+	}
+	if to := params.Get("to"); to != "" {
+		if q.Before, err = query.ParseDate(to); err != nil {
+			jsonError(w, "bad to date", http.StatusBadRequest)
+			return
+		}
+	}
+	if q.Offset, q.Limit, err = parsePage(r); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.Index.Search(r.Context(), q)
+	if err != nil {
+		http.Error(w, `Search error`, http.StatusInternalServerError)
+		return
+	}
+	respJSON, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, `json marshalling error`, http.StatusInternalServerError)
+		return
+	}
+	w.Write(respJSON)
+}
+
+// parseQuery parses the structured "q" parameter. It returns nil when the
+// parameter is absent and answers 422 itself when the query is malformed.
+func parseQuery(w http.ResponseWriter, r *http.Request) (*query.Query, bool) {
+	raw := r.URL.Query().Get("q")
+	if raw == "" {
+		return nil, true
+	}
+	parsed, err := query.Parse(raw)
+	if err != nil {
+		msg := items.MessageAuthError{
+			Location: "query",
+			Param:    "q",
+			Value:    raw,
+			Msg:      err.Error(),
+		}
+		resp, err := json.Marshal(
+			items.ErrorList{
+				Errors: []items.MessageAuthError{msg},
+			})
+		if err != nil {
+			http.Error(w, `Can't marshal errors`, http.StatusInternalServerError)
+			return nil, false
+		}
+		http.Error(w, string(resp), http.StatusUnprocessableEntity)
+		return nil, false
+	}
+	return parsed, true
+}
+
+var (
+	errBadOffset = errors.New("bad offset")
+	errBadLimit  = errors.New("bad limit")
+)
+
+// parsePage reads offset and limit parameters, the limit defaults to
+// search.DefaultLimit and is capped at search.MaxLimit.
+func parsePage(r *http.Request) (int, int, error) {
+	offset, limit := 0, 0
+	var err error
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, errBadOffset
+		}
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return 0, 0, errBadLimit
+		}
+	}
+	if limit == 0 {
+		limit = search.DefaultLimit
+	} else if limit > search.MaxLimit {
+		limit = search.MaxLimit
+	}
+	return offset, limit, nil
+}
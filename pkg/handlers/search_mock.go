@@ -0,0 +1,77 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: search.go
+
+// Package handlers is a generated GoMock package.
+package handlers
+
+import (
+	items "asperitas-clone/pkg/items"
+	search "asperitas-clone/pkg/search"
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	primitive "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MockSearchIndexInterface is a mock of SearchIndexInterface interface.
+type MockSearchIndexInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockSearchIndexInterfaceMockRecorder
+}
+
+// MockSearchIndexInterfaceMockRecorder is the mock recorder for MockSearchIndexInterface.
+type MockSearchIndexInterfaceMockRecorder struct {
+	mock *MockSearchIndexInterface
+}
+
+// NewMockSearchIndexInterface creates a new mock instance.
+func NewMockSearchIndexInterface(ctrl *gomock.Controller) *MockSearchIndexInterface {
+	mock := &MockSearchIndexInterface{ctrl: ctrl}
+	mock.recorder = &MockSearchIndexInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSearchIndexInterface) EXPECT() *MockSearchIndexInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Index mocks base method.
+func (m *MockSearchIndexInterface) Index(arg0 context.Context, arg1 *items.Post) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Index", arg0, arg1)
+}
+
+// Index indicates an expected call of Index.
+func (mr *MockSearchIndexInterfaceMockRecorder) Index(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Index", reflect.TypeOf((*MockSearchIndexInterface)(nil).Index), arg0, arg1)
+}
+
+// Remove mocks base method.
+func (m *MockSearchIndexInterface) Remove(arg0 context.Context, arg1 primitive.ObjectID) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Remove", arg0, arg1)
+}
+
+// Remove indicates an expected call of Remove.
+func (mr *MockSearchIndexInterfaceMockRecorder) Remove(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockSearchIndexInterface)(nil).Remove), arg0, arg1)
+}
+
+// Search mocks base method.
+func (m *MockSearchIndexInterface) Search(arg0 context.Context, arg1 *search.Query) (*search.Result, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", arg0, arg1)
+	ret0, _ := ret[0].(*search.Result)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Search indicates an expected call of Search.
+func (mr *MockSearchIndexInterfaceMockRecorder) Search(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockSearchIndexInterface)(nil).Search), arg0, arg1)
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/metrics"
+	"asperitas-clone/pkg/session"
+	"asperitas-clone/pkg/totp"
+
+	"go.uber.org/zap"
+)
+
+// mockgen -source="twofactor.go" -destination="twofactor_mock.go" -package=handlers TwoFactorRepositoryInterface
+
+type TwoFactorRepositoryInterface interface {
+	Get(context.Context, int) (*items.TwoFactor, error)
+	Begin(context.Context, int, string) error
+	Enable(context.Context, int, []string) error
+	Disable(context.Context, int) error
+	UseStep(context.Context, int, int64) (bool, error)
+	UseRecoveryCode(context.Context, int, string) (bool, error)
+	CreateChallenge(context.Context, int) (string, error)
+	CheckChallenge(context.Context, string) (int, error)
+	FailChallenge(context.Context, string) error
+	ConsumeChallenge(context.Context, string) error
+}
+
+const DefaultTOTPIssuer = "asperitas-clone"
+
+// TwoFactorHandler lets users protect their login with codes of an
+// authenticator app.
+type TwoFactorHandler struct {
+	UserRepo  UserRepositoryInterface
+	TwoFactor TwoFactorRepositoryInterface
+	Sessions  session.SessionManagerInterface
+	// Issuer names the site in authenticator apps.
+	Issuer string
+	Logger *zap.SugaredLogger
+}
+
+type twoFactorInfo struct {
+	Enabled       bool `json:"enabled"`
+	RecoveryCodes int  `json:"recoveryCodes"`
+}
+
+type twoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	// URI is for a QR code, apps scan it.
+	URI string `json:"uri"`
+}
+
+type twoFactorCode struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type recoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// checkSecondFactor accepts a code of the app or an unused recovery code,
+// either works once.
+func checkSecondFactor(ctx context.Context, repo TwoFactorRepositoryInterface, userID int, secret, code string) (bool, error) {
+	if step, ok := totp.Validate(secret, strings.Replace(code, " ", "", -1), time.Now()); ok {
+		return repo.UseStep(ctx, userID, step)
+	}
+	return repo.UseRecoveryCode(ctx, userID, code)
+}
+
+// twoFactorEnabled reports whether the user has to give a code after the
+// first login step, never without a repo.
+func twoFactorEnabled(ctx context.Context, repo TwoFactorRepositoryInterface, userID int) (bool, error) {
+	if repo == nil {
+		return false, nil
+	}
+	tf, err := repo.Get(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return tf != nil && tf.Enabled, nil
+}
+
+// askSecondFactor answers the first login step with a challenge instead of
+// a session, the client sends it to LoginTwoFactor with a code.
+func askSecondFactor(w http.ResponseWriter, r *http.Request, repo TwoFactorRepositoryInterface, user *items.User) {
+	challenge, err := repo.CreateChallenge(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	metrics.Logins.Inc("second_factor")
+	resp, err := json.Marshal(twoFactorChallenge{TwoFactorRequired: true, Challenge: challenge})
+	if err != nil {
+		http.Error(w, `Can't marshal challenge`, http.StatusInternalServerError)
+		return
+	}
+	w.Write(resp)
+}
+
+func wrongCode(w http.ResponseWriter) {
+	writeErrors(w, []items.MessageAuthError{{
+		Location: "body",
+		Param:    "code",
+		Msg:      "is wrong",
+	}})
+}
+
+// GetTwoFactor shows whether the logged in user has 2FA on.
+func (h *TwoFactorHandler) GetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	_, user, ok := currentUser(w, r, h.Sessions, h.UserRepo)
+	if !ok {
+		return
+	}
+	tf, err := h.TwoFactor.Get(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	info := twoFactorInfo{}
+	if tf != nil && tf.Enabled {
+		info = twoFactorInfo{Enabled: true, RecoveryCodes: tf.RecoveryCodes}
+	}
+	resp, err := json.Marshal(info)
+	if err != nil {
+		http.Error(w, `Can't marshal 2FA`, http.StatusInternalServerError)
+		return
+	}
+	w.Write(resp)
+}
+
+// BeginTwoFactor creates a key for the app. It does nothing until
+// EnableTwoFactor gets a code made with it.
+func (h *TwoFactorHandler) BeginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	req := twoFactorCode{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `Can't decode`, http.StatusInternalServerError)
+		return
+	}
+	_, user, ok := currentUser(w, r, h.Sessions, h.UserRepo)
+	if !ok {
+		return
+	}
+	if !checkPassword(w, r, h.UserRepo, user, "password", req.Password) {
+		return
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		http.Error(w, `Can't create key`, http.StatusInternalServerError)
+		return
+	}
+	err = h.TwoFactor.Begin(r.Context(), user.ID, secret)
+	if errors.Is(err, items.ErrTwoFactorEnabled) {
+		jsonError(w, "two-factor authentication is enabled already", http.StatusConflict)
+		return
+	} else if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	issuer := h.Issuer
+	if issuer == "" {
+		issuer = DefaultTOTPIssuer
+	}
+	resp, err := json.Marshal(twoFactorEnrollment{Secret: secret, URI: totp.URI(issuer, user.Username, secret)})
+	if err != nil {
+		http.Error(w, `Can't marshal key`, http.StatusInternalServerError)
+		return
+	}
+	w.Write(resp)
+}
+
+// EnableTwoFactor turns 2FA on once the app made a right code and answers
+// with recovery codes, they are shown this once. Other sessions end, they
+// were started with the password alone.
+func (h *TwoFactorHandler) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	req := twoFactorCode{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `Can't decode`, http.StatusInternalServerError)
+		return
+	}
+	sess, user, ok := currentUser(w, r, h.Sessions, h.UserRepo)
+	if !ok {
+		return
+	}
+	tf, err := h.TwoFactor.Get(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	if tf == nil || tf.Enabled {
+		jsonError(w, "there is no key to enable", http.StatusConflict)
+		return
+	}
+	step, ok := totp.Validate(tf.Secret, strings.Replace(req.Code, " ", "", -1), time.Now())
+	if !ok {
+		wrongCode(w)
+		return
+	}
+	if _, err := h.TwoFactor.UseStep(r.Context(), user.ID, step); err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	codes, err := totp.NewRecoveryCodes(totp.RecoveryCodes)
+	if err != nil {
+		http.Error(w, `Can't create recovery codes`, http.StatusInternalServerError)
+		return
+	}
+	err = h.TwoFactor.Enable(r.Context(), user.ID, codes)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	err = h.Sessions.DestroyOthers(r.Context(), user.ID, sess.ID)
+	if err != nil {
+		logger(r, h.Logger).Warnw("can't end other sessions", "user", user.ID, "err", err)
+	}
+	logger(r, h.Logger).Infow("2fa enabled", "user", user.ID)
+	resp, err := json.Marshal(recoveryCodes{RecoveryCodes: codes})
+	if err != nil {
+		http.Error(w, `Can't marshal recovery codes`, http.StatusInternalServerError)
+		return
+	}
+	w.Write(resp)
+}
+
+// DisableTwoFactor turns 2FA off, it takes the password and a code.
+func (h *TwoFactorHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	req := twoFactorCode{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `Can't decode`, http.StatusInternalServerError)
+		return
+	}
+	_, user, ok := currentUser(w, r, h.Sessions, h.UserRepo)
+	if !ok {
+		return
+	}
+	if !checkPassword(w, r, h.UserRepo, user, "password", req.Password) {
+		return
+	}
+	tf, err := h.TwoFactor.Get(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	if tf == nil || !tf.Enabled {
+		jsonError(w, "two-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+	ok, err = checkSecondFactor(r.Context(), h.TwoFactor, user.ID, tf.Secret, req.Code)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		wrongCode(w)
+		return
+	}
+	if err := h.TwoFactor.Disable(r.Context(), user.ID); err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	logger(r, h.Logger).Infow("2fa disabled", "user", user.ID)
+	w.Write([]byte(`{"message":"success"}`))
+}
@@ -0,0 +1,181 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: twofactor.go
+
+// Package handlers is a generated GoMock package.
+package handlers
+
+import (
+	items "asperitas-clone/pkg/items"
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockTwoFactorRepositoryInterface is a mock of TwoFactorRepositoryInterface interface.
+type MockTwoFactorRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockTwoFactorRepositoryInterfaceMockRecorder
+}
+
+// MockTwoFactorRepositoryInterfaceMockRecorder is the mock recorder for MockTwoFactorRepositoryInterface.
+type MockTwoFactorRepositoryInterfaceMockRecorder struct {
+	mock *MockTwoFactorRepositoryInterface
+}
+
+// NewMockTwoFactorRepositoryInterface creates a new mock instance.
+func NewMockTwoFactorRepositoryInterface(ctrl *gomock.Controller) *MockTwoFactorRepositoryInterface {
+	mock := &MockTwoFactorRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockTwoFactorRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTwoFactorRepositoryInterface) EXPECT() *MockTwoFactorRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Begin mocks base method.
+func (m *MockTwoFactorRepositoryInterface) Begin(arg0 context.Context, arg1 int, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Begin", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Begin indicates an expected call of Begin.
+func (mr *MockTwoFactorRepositoryInterfaceMockRecorder) Begin(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Begin", reflect.TypeOf((*MockTwoFactorRepositoryInterface)(nil).Begin), arg0, arg1, arg2)
+}
+
+// CheckChallenge mocks base method.
+func (m *MockTwoFactorRepositoryInterface) CheckChallenge(arg0 context.Context, arg1 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckChallenge", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CheckChallenge indicates an expected call of CheckChallenge.
+func (mr *MockTwoFactorRepositoryInterfaceMockRecorder) CheckChallenge(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckChallenge", reflect.TypeOf((*MockTwoFactorRepositoryInterface)(nil).CheckChallenge), arg0, arg1)
+}
+
+// ConsumeChallenge mocks base method.
+func (m *MockTwoFactorRepositoryInterface) ConsumeChallenge(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeChallenge", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConsumeChallenge indicates an expected call of ConsumeChallenge.
+func (mr *MockTwoFactorRepositoryInterfaceMockRecorder) ConsumeChallenge(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeChallenge", reflect.TypeOf((*MockTwoFactorRepositoryInterface)(nil).ConsumeChallenge), arg0, arg1)
+}
+
+// CreateChallenge mocks base method.
+func (m *MockTwoFactorRepositoryInterface) CreateChallenge(arg0 context.Context, arg1 int) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateChallenge", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateChallenge indicates an expected call of CreateChallenge.
+func (mr *MockTwoFactorRepositoryInterfaceMockRecorder) CreateChallenge(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateChallenge", reflect.TypeOf((*MockTwoFactorRepositoryInterface)(nil).CreateChallenge), arg0, arg1)
+}
+
+// Disable mocks base method.
+func (m *MockTwoFactorRepositoryInterface) Disable(arg0 context.Context, arg1 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Disable", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Disable indicates an expected call of Disable.
+func (mr *MockTwoFactorRepositoryInterfaceMockRecorder) Disable(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Disable", reflect.TypeOf((*MockTwoFactorRepositoryInterface)(nil).Disable), arg0, arg1)
+}
+
+// Enable mocks base method.
+func (m *MockTwoFactorRepositoryInterface) Enable(arg0 context.Context, arg1 int, arg2 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Enable", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Enable indicates an expected call of Enable.
+func (mr *MockTwoFactorRepositoryInterfaceMockRecorder) Enable(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Enable", reflect.TypeOf((*MockTwoFactorRepositoryInterface)(nil).Enable), arg0, arg1, arg2)
+}
+
+// FailChallenge mocks base method.
+func (m *MockTwoFactorRepositoryInterface) FailChallenge(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FailChallenge", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FailChallenge indicates an expected call of FailChallenge.
+func (mr *MockTwoFactorRepositoryInterfaceMockRecorder) FailChallenge(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FailChallenge", reflect.TypeOf((*MockTwoFactorRepositoryInterface)(nil).FailChallenge), arg0, arg1)
+}
+
+// Get mocks base method.
+func (m *MockTwoFactorRepositoryInterface) Get(arg0 context.Context, arg1 int) (*items.TwoFactor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", arg0, arg1)
+	ret0, _ := ret[0].(*items.TwoFactor)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockTwoFactorRepositoryInterfaceMockRecorder) Get(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockTwoFactorRepositoryInterface)(nil).Get), arg0, arg1)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockTwoFactorRepositoryInterface) UseRecoveryCode(arg0 context.Context, arg1 int, arg2 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockTwoFactorRepositoryInterfaceMockRecorder) UseRecoveryCode(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockTwoFactorRepositoryInterface)(nil).UseRecoveryCode), arg0, arg1, arg2)
+}
+
+// UseStep mocks base method.
+func (m *MockTwoFactorRepositoryInterface) UseStep(arg0 context.Context, arg1 int, arg2 int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseStep", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseStep indicates an expected call of UseStep.
+func (mr *MockTwoFactorRepositoryInterfaceMockRecorder) UseStep(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseStep", reflect.TypeOf((*MockTwoFactorRepositoryInterface)(nil).UseStep), arg0, arg1, arg2)
+}
@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
+	"time"
 
+	"asperitas-clone/pkg/credentials"
 	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/logging"
+	"asperitas-clone/pkg/metrics"
 	"asperitas-clone/pkg/session"
 
 	jwt "github.com/golang-jwt/jwt/v4"
@@ -22,17 +27,32 @@ var (
 // mockgen -source="user.go" -destination="user_mock.go" -package=handlers UserRepositoryInterface
 
 type UserRepositoryInterface interface {
-	GetUserByID(int) (*items.User, error)
-	GetUserByUsername(string) (*items.User, error)
-	AddUser(*items.User) (int, error)
-	Authorize(string, string) (*items.User, error)
+	GetUserByID(context.Context, int) (*items.User, error)
+	GetUserByUsername(context.Context, string) (*items.User, error)
+	GetUserByEmail(context.Context, string) (*items.User, error)
+	AddUser(context.Context, *items.User) (int, error)
+	Authorize(context.Context, string, string) (*items.User, error)
+	ChangeUsername(context.Context, int, string) error
+	ChangePassword(context.Context, int, string) error
+	DeleteUser(context.Context, int, bool) error
 }
 
 type UserHandler struct {
 	PostRepo PostRepositoryInterface
 	UserRepo UserRepositoryInterface
 	Sessions session.SessionManagerInterface
-	Logger   *zap.SugaredLogger
+	Profiles ProfileRepositoryInterface
+	Comments CommentRepositoryInterface
+	Saved    SavedRepositoryInterface
+	Lockout  LoginGuardInterface
+	// TwoFactor, if set, asks users who enabled it for a code after the
+	// password.
+	TwoFactor TwoFactorRepositoryInterface
+	// Verification, if set, mails new users a link to verify their email.
+	Verification *EmailHandler
+	// Policy checks credentials of new users, nil accepts any.
+	Policy *credentials.Policy
+	Logger *zap.SugaredLogger
 }
 
 func createToken(username string, userID int) ([]byte, error) {
@@ -56,9 +76,34 @@ func createToken(username string, userID int) ([]byte, error) {
 	return respJSON, nil
 }
 
+// usernameErrors are the AddUser errors reported back to the form.
+var usernameErrors = map[error]string{
+	items.ErrUserAlreadyExists: "already exists",
+	items.ErrUsernameReserved:  "is reserved",
+	items.ErrBadUsername:       "has invalid characters",
+}
+
+// emailErrors are the AddUser errors about the email.
+var emailErrors = map[error]string{
+	items.ErrEmailTaken: "is already used",
+	items.ErrBadEmail:   "is not a valid address",
+}
+
+type twoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	Challenge         string `json:"challenge"`
+}
+
+type twoFactorLogin struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
 type privateUser struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// Email is optional, it is needed to reset a forgotten password.
+	Email string `json:"email"`
 }
 
 func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -69,23 +114,30 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	r.Body.Close()
-	user := items.User{Username: puser.Username, Password: puser.Password}
-	userID, err := h.UserRepo.AddUser(&user)
-	if errors.Is(err, items.ErrUserAlreadyExists) {
-		msg := items.MessageAuthError{
+	if h.Policy != nil {
+		if errs := h.Policy.Check(puser.Username, puser.Password); len(errs) != 0 {
+			writeErrors(w, errs)
+			return
+		}
+	}
+	user := items.User{Username: puser.Username, Password: puser.Password, Email: puser.Email}
+	userID, err := h.UserRepo.AddUser(r.Context(), &user)
+	if msg, ok := usernameErrors[err]; ok {
+		writeErrors(w, []items.MessageAuthError{{
 			Location: "body",
 			Param:    "username",
 			Value:    user.Username,
-			Msg:      "already exists",
-		}
-		resp, err := json.Marshal(
-			items.ErrorList{
-				Errors: []items.MessageAuthError{msg},
-			})
-		if err != nil {
-			http.Error(w, `Can't marshal errors`, http.StatusInternalServerError)
-		}
-		http.Error(w, string(resp), 422)
+			Msg:      msg,
+		}})
+		return
+	}
+	if msg, ok := emailErrors[err]; ok {
+		writeErrors(w, []items.MessageAuthError{{
+			Location: "body",
+			Param:    "email",
+			Value:    puser.Email,
+			Msg:      msg,
+		}})
 		return
 	}
 	if err != nil {
@@ -93,18 +145,32 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if h.Profiles != nil {
+		err = h.Profiles.CreateProfile(r.Context(), userID, time.Now().UTC())
+		if err != nil {
+			logger(r, h.Logger).Warnw("can't create profile", "user", userID, "err", err)
+		}
+	}
+
+	if h.Verification != nil && user.Email != "" {
+		user.ID = userID
+		if err := h.Verification.sendVerification(r, &user, user.Email); err != nil {
+			logger(r, h.Logger).Errorw("can't send verification mail", "user", userID, "err", err)
+		}
+	}
+
 	token, err := createToken(user.Username, userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 
-	sess, err := h.Sessions.Create(w, userID)
+	sess, err := h.Sessions.Create(r.Context(), w, userID)
 	if err != nil {
 		http.Error(w, `Can't create session`, http.StatusInternalServerError)
 		return
 	}
 
-	h.Logger.Infof("Created session for %v", sess.UserID)
+	logger(r, h.Logger).Infof("Created session for %v", sess.UserID)
 	w.Write(token)
 }
 
@@ -116,28 +182,129 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	r.Body.Close()
-	user, err := h.UserRepo.Authorize(pu.Username, pu.Password)
-	if err == items.ErrNoUser {
-		jsonError(w, "user not found", http.StatusUnauthorized)
+	ip := remoteIP(r)
+	if h.loginLocked(w, r, pu.Username, ip) {
+		return
+	}
+	user, err := h.UserRepo.Authorize(r.Context(), pu.Username, pu.Password)
+	if err == items.ErrNoUser || err == items.ErrBadPass {
+		// the same answer for both, so logins can't be used to find out
+		// which usernames exist
+		h.loginFailed(r, pu.Username, ip)
+		metrics.Logins.Inc("failure")
+		jsonError(w, "invalid username or password", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	enabled, err := twoFactorEnabled(r.Context(), h.TwoFactor, user.ID)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	// failed logins are only forgiven after the code, or the password
+	// would reset the count of wrong codes
+	if enabled {
+		askSecondFactor(w, r, h.TwoFactor, user)
+		return
+	}
+	h.loginSucceeded(r, pu.Username)
+	metrics.Logins.Inc("success")
+	h.startSession(w, r, user)
+}
+
+// LoginTwoFactor is the second login step of users with 2FA, it takes the
+// challenge Login answered with and a code of the app or a recovery code.
+// Wrong codes count as failed logins.
+func (h *UserHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	req := twoFactorLogin{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `Can't decode`, http.StatusInternalServerError)
 		return
-	} else if err == items.ErrBadPass {
-		jsonError(w, "invalid password", http.StatusUnauthorized)
+	}
+	userID, err := h.TwoFactor.CheckChallenge(r.Context(), req.Challenge)
+	if errors.Is(err, items.ErrBadChallenge) {
+		jsonError(w, "login expired, log in again", http.StatusUnauthorized)
 		return
 	} else if err != nil {
 		jsonError(w, "error in DB", http.StatusInternalServerError)
 		return
 	}
+	user, err := h.UserRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	tf, err := h.TwoFactor.Get(r.Context(), userID)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	if user == nil || tf == nil || !tf.Enabled {
+		jsonError(w, "login expired, log in again", http.StatusUnauthorized)
+		return
+	}
+	ip := remoteIP(r)
+	if h.loginLocked(w, r, user.Username, ip) {
+		return
+	}
+	ok, err := checkSecondFactor(r.Context(), h.TwoFactor, user.ID, tf.Secret, req.Code)
+	if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		if err := h.TwoFactor.FailChallenge(r.Context(), req.Challenge); err != nil {
+			logger(r, h.Logger).Warnw("can't record wrong code", "user", user.ID, "err", err)
+		}
+		h.loginFailed(r, user.Username, ip)
+		metrics.Logins.Inc("failure")
+		jsonError(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+	err = h.TwoFactor.ConsumeChallenge(r.Context(), req.Challenge)
+	if errors.Is(err, items.ErrBadChallenge) {
+		jsonError(w, "login expired, log in again", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		jsonError(w, "error in DB", http.StatusInternalServerError)
+		return
+	}
+	h.loginSucceeded(r, user.Username)
+	metrics.Logins.Inc("success")
+	h.startSession(w, r, user)
+}
+
+// startSession answers a successful login with a token and a session.
+func (h *UserHandler) startSession(w http.ResponseWriter, r *http.Request, user *items.User) {
 	token, err := createToken(user.Username, user.ID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	sess, err := h.Sessions.Create(w, user.ID)
+	sess, err := h.Sessions.Create(r.Context(), w, user.ID)
 	if err != nil {
 		http.Error(w, `Can't create session`, http.StatusInternalServerError)
 		return
 	}
 	w.Write(token)
-	h.Logger.Infof("Created session for %v", sess.UserID)
+	logger(r, h.Logger).Infof("Created session for %v", sess.UserID)
+}
+
+// logger returns the logger of the request, it carries the request ID.
+func logger(r *http.Request, fallback *zap.SugaredLogger) *zap.SugaredLogger {
+	return logging.FromContext(r.Context(), fallback)
+}
+
+// writeErrors answers 422 with the errors of a form.
+func writeErrors(w http.ResponseWriter, errs []items.MessageAuthError) {
+	resp, err := json.Marshal(items.ErrorList{Errors: errs})
+	if err != nil {
+		http.Error(w, `Can't marshal errors`, http.StatusInternalServerError)
+		return
+	}
+	http.Error(w, string(resp), http.StatusUnprocessableEntity)
 }
 
 func jsonError(w http.ResponseWriter, msg string, status int) {
@@ -153,11 +320,26 @@ func (h *UserHandler) GetPosts(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `Can't get USERNAME`, http.StatusInternalServerError)
 		return
 	}
-	elems, err := h.PostRepo.GetPostsByUsername(username)
+	filter, ok := parseQuery(w, r)
+	if !ok {
+		return
+	}
+	var elems []*items.Post
+	var err error
+	switch {
+	case filter == nil:
+		elems, err = h.PostRepo.GetPostsByUsername(r.Context(), username)
+	case filter.Author != "" && filter.Author != username:
+		elems = []*items.Post{}
+	default:
+		filter.Author = username
+		elems, err = h.PostRepo.GetPostsByFilter(r.Context(), filter)
+	}
 	if err != nil {
 		http.Error(w, `Can't get posts`, http.StatusInternalServerError)
 		return
 	}
+	markSaved(r, h.Sessions, h.Saved, elems...)
 
 	respJSON, err := json.Marshal(elems)
 	if err != nil {
@@ -1,23 +1,38 @@
 package handlers
 
 import (
+	"asperitas-clone/pkg/credentials"
+	"asperitas-clone/pkg/emailtoken"
+	"asperitas-clone/pkg/events"
 	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/logging"
+	"asperitas-clone/pkg/mail"
+	"asperitas-clone/pkg/oidc"
+	"asperitas-clone/pkg/oidc/oidctest"
 	"asperitas-clone/pkg/post_repo"
+	"asperitas-clone/pkg/query"
+	"asperitas-clone/pkg/search"
 	"asperitas-clone/pkg/session"
+	"asperitas-clone/pkg/totp"
 	"asperitas-clone/pkg/user_repo"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.uber.org/zap"
-	"gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 // (in directory handlers:)
@@ -78,7 +93,7 @@ func TestUserHandlerGetPosts(t *testing.T) {
 	}
 	posts := []*items.Post{
 		{
-			ID:       "0",
+			ID:       primitive.NewObjectID(),
 			Author:   user,
 			Category: "funny",
 			Title:    "abacaba",
@@ -88,7 +103,7 @@ func TestUserHandlerGetPosts(t *testing.T) {
 	}
 
 	// Good request
-	postSt.EXPECT().GetPostsByUsername(user.Username).Return(posts, nil)
+	postSt.EXPECT().GetPostsByUsername(gomock.Any(), user.Username).Return(posts, nil)
 	r := httptest.NewRequest("GET", "/api/user/admin", nil)
 	r = mux.SetURLVars(r, map[string]string{"USERNAME": "admin"})
 	w := httptest.NewRecorder()
@@ -115,7 +130,7 @@ func TestUserHandlerGetPosts(t *testing.T) {
 	}
 
 	// DB error
-	postSt.EXPECT().GetPostsByUsername(user.Username).Return(nil, ErrDB)
+	postSt.EXPECT().GetPostsByUsername(gomock.Any(), user.Username).Return(nil, ErrDB)
 	r = httptest.NewRequest("GET", "/api/user/admin", nil)
 	r = mux.SetURLVars(r, map[string]string{"USERNAME": "admin"})
 	w = httptest.NewRecorder()
@@ -144,8 +159,8 @@ func TestUserHandlerRegister(t *testing.T) {
 	}
 
 	// Good request
-	userSt.EXPECT().AddUser(user).Return(1, nil)
-	managerSt.EXPECT().Create(gomock.Any(), 1).Return(&session.Session{}, nil)
+	userSt.EXPECT().AddUser(gomock.Any(), user).Return(1, nil)
+	managerSt.EXPECT().Create(gomock.Any(), gomock.Any(), 1).Return(&session.Session{}, nil)
 	bodyString := fmt.Sprintf(`{"username":"%s","password":"%s"}`, user.Username, user.Password)
 	body := strings.NewReader(bodyString)
 	r := httptest.NewRequest("POST", "/api/register", body)
@@ -168,7 +183,7 @@ func TestUserHandlerRegister(t *testing.T) {
 	}
 
 	// User already exists
-	userSt.EXPECT().AddUser(user).Return(0, items.ErrUserAlreadyExists)
+	userSt.EXPECT().AddUser(gomock.Any(), user).Return(0, items.ErrUserAlreadyExists)
 	bodyString = fmt.Sprintf(`{"username":"%s","password":"%s"}`, user.Username, user.Password)
 	body = strings.NewReader(bodyString)
 	r = httptest.NewRequest("POST", "/api/register", body)
@@ -180,8 +195,86 @@ func TestUserHandlerRegister(t *testing.T) {
 		return
 	}
 
+	// Reserved username
+	userSt.EXPECT().AddUser(gomock.Any(), user).Return(0, items.ErrUsernameReserved)
+	bodyString = fmt.Sprintf(`{"username":"%s","password":"%s"}`, user.Username, user.Password)
+	body = strings.NewReader(bodyString)
+	r = httptest.NewRequest("POST", "/api/register", body)
+	w = httptest.NewRecorder()
+	userService.Register(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	}
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(respBody), "is reserved") {
+		t.Errorf("expected reserved message, got %s", respBody)
+		return
+	}
+
+	// Credentials break the policy
+	userService.Policy = credentials.DefaultPolicy()
+	body = strings.NewReader(`{"username":"a b","password":"qwerty"}`)
+	r = httptest.NewRequest("POST", "/api/register", body)
+	w = httptest.NewRecorder()
+	userService.Register(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	}
+	errList := items.ErrorList{}
+	json.NewDecoder(resp.Body).Decode(&errList)
+	if len(errList.Errors) != 3 {
+		t.Errorf("expected 3 errors, got %v", errList.Errors)
+		return
+	}
+	userService.Policy = nil
+
+	// Email is already used
+	withEmail := &items.User{Username: "admin", Password: "adminadmin", Email: "admin@example.com"}
+	userSt.EXPECT().AddUser(gomock.Any(), withEmail).Return(0, items.ErrEmailTaken)
+	body = strings.NewReader(`{"username":"admin","password":"adminadmin","email":"admin@example.com"}`)
+	r = httptest.NewRequest("POST", "/api/register", body)
+	w = httptest.NewRecorder()
+	userService.Register(w, r)
+	resp = w.Result()
+	respBody, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	} else if !strings.Contains(string(respBody), `"param":"email"`) {
+		t.Errorf("unexpected body: %s", respBody)
+		return
+	}
+
+	// Registered with an email, a verification mail goes out
+	emailSt := NewMockEmailRepositoryInterface(ctrl)
+	mailerSt := NewMockMailerInterface(ctrl)
+	userService.Verification = &EmailHandler{
+		Emails: emailSt,
+		Mailer: mailerSt,
+		Signer: &emailtoken.Signer{Key: []byte("key")},
+		Logger: zap.NewNop().Sugar(),
+	}
+	userSt.EXPECT().AddUser(gomock.Any(), withEmail).Return(2, nil)
+	emailSt.EXPECT().MarkVerificationSent(gomock.Any(), 2, DefaultResendInterval).Return(true, nil)
+	mailerSt.EXPECT().Send(gomock.Any(), gomock.Any()).Return(nil)
+	managerSt.EXPECT().Create(gomock.Any(), gomock.Any(), 2).Return(&session.Session{}, nil)
+	body = strings.NewReader(`{"username":"admin","password":"adminadmin","email":"admin@example.com"}`)
+	r = httptest.NewRequest("POST", "/api/register", body)
+	w = httptest.NewRecorder()
+	userService.Register(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+	userService.Verification = nil
+
 	// Can't add user
-	userSt.EXPECT().AddUser(user).Return(0, ErrDB)
+	userSt.EXPECT().AddUser(gomock.Any(), user).Return(0, ErrDB)
 	bodyString = fmt.Sprintf(`{"username":"%s","password":"%s"}`, user.Username, user.Password)
 	body = strings.NewReader(bodyString)
 	r = httptest.NewRequest("POST", "/api/register", body)
@@ -194,8 +287,8 @@ func TestUserHandlerRegister(t *testing.T) {
 	}
 
 	// Can't create sessions
-	userSt.EXPECT().AddUser(user).Return(1, nil)
-	managerSt.EXPECT().Create(gomock.Any(), 1).Return(nil, ErrDB)
+	userSt.EXPECT().AddUser(gomock.Any(), user).Return(1, nil)
+	managerSt.EXPECT().Create(gomock.Any(), gomock.Any(), 1).Return(nil, ErrDB)
 	bodyString = fmt.Sprintf(`{"username":"%s","password":"%s"}`, user.Username, user.Password)
 	body = strings.NewReader(bodyString)
 	r = httptest.NewRequest("POST", "/api/register", body)
@@ -226,8 +319,8 @@ func TestUserHandlerLogin(t *testing.T) {
 	}
 
 	// Good request
-	userSt.EXPECT().Authorize(user.Username, user.Password).Return(user, nil)
-	managerSt.EXPECT().Create(gomock.Any(), user.ID).Return(&session.Session{}, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), user.Username, user.Password).Return(user, nil)
+	managerSt.EXPECT().Create(gomock.Any(), gomock.Any(), user.ID).Return(&session.Session{}, nil)
 	bodyString := fmt.Sprintf(`{"username":"%s","password":"%s"}`, user.Username, user.Password)
 	body := strings.NewReader(bodyString)
 	r := httptest.NewRequest("POST", "/api/login", body)
@@ -250,7 +343,7 @@ func TestUserHandlerLogin(t *testing.T) {
 	}
 
 	// No user
-	userSt.EXPECT().Authorize(user.Username, user.Password).Return(nil, items.ErrNoUser)
+	userSt.EXPECT().Authorize(gomock.Any(), user.Username, user.Password).Return(nil, items.ErrNoUser)
 	bodyString = fmt.Sprintf(`{"username":"%s","password":"%s"}`, user.Username, user.Password)
 	body = strings.NewReader(bodyString)
 	r = httptest.NewRequest("POST", "/api/login", body)
@@ -263,7 +356,7 @@ func TestUserHandlerLogin(t *testing.T) {
 	}
 
 	// Wrong password
-	userSt.EXPECT().Authorize(user.Username, user.Password).Return(nil, items.ErrBadPass)
+	userSt.EXPECT().Authorize(gomock.Any(), user.Username, user.Password).Return(nil, items.ErrBadPass)
 	bodyString = fmt.Sprintf(`{"username":"%s","password":"%s"}`, user.Username, user.Password)
 	body = strings.NewReader(bodyString)
 	r = httptest.NewRequest("POST", "/api/login", body)
@@ -276,7 +369,7 @@ func TestUserHandlerLogin(t *testing.T) {
 	}
 
 	// User db error
-	userSt.EXPECT().Authorize(user.Username, user.Password).Return(nil, ErrDB)
+	userSt.EXPECT().Authorize(gomock.Any(), user.Username, user.Password).Return(nil, ErrDB)
 	bodyString = fmt.Sprintf(`{"username":"%s","password":"%s"}`, user.Username, user.Password)
 	body = strings.NewReader(bodyString)
 	r = httptest.NewRequest("POST", "/api/login", body)
@@ -289,8 +382,8 @@ func TestUserHandlerLogin(t *testing.T) {
 	}
 
 	// Session db error
-	userSt.EXPECT().Authorize(user.Username, user.Password).Return(user, nil)
-	managerSt.EXPECT().Create(gomock.Any(), user.ID).Return(&session.Session{}, ErrDB)
+	userSt.EXPECT().Authorize(gomock.Any(), user.Username, user.Password).Return(user, nil)
+	managerSt.EXPECT().Create(gomock.Any(), gomock.Any(), user.ID).Return(&session.Session{}, ErrDB)
 	bodyString = fmt.Sprintf(`{"username":"%s","password":"%s"}`, user.Username, user.Password)
 	body = strings.NewReader(bodyString)
 	r = httptest.NewRequest("POST", "/api/login", body)
@@ -319,7 +412,7 @@ func TestPostHandlerGetAllPosts(t *testing.T) {
 	}
 	posts := []*items.Post{
 		{
-			ID:       "0",
+			ID:       primitive.NewObjectID(),
 			Author:   user,
 			Category: "funny",
 			Title:    "abacaba",
@@ -329,7 +422,7 @@ func TestPostHandlerGetAllPosts(t *testing.T) {
 	}
 
 	//Good request
-	postSt.EXPECT().GetAllPosts().Return(posts, nil)
+	postSt.EXPECT().GetAllPosts(gomock.Any()).Return(posts, nil)
 	r := httptest.NewRequest("GET", "/api/posts", nil)
 	w := httptest.NewRecorder()
 	postService.GetAllPosts(w, r)
@@ -345,7 +438,7 @@ func TestPostHandlerGetAllPosts(t *testing.T) {
 	}
 
 	//DB error
-	postSt.EXPECT().GetAllPosts().Return(nil, ErrDB)
+	postSt.EXPECT().GetAllPosts(gomock.Any()).Return(nil, ErrDB)
 	r = httptest.NewRequest("GET", "/api/posts", nil)
 	w = httptest.NewRecorder()
 	postService.GetAllPosts(w, r)
@@ -372,7 +465,7 @@ func TestPostHandlerGetPostByID(t *testing.T) {
 	}
 	posts := []*items.Post{
 		{
-			ID:       bson.NewObjectId(),
+			ID:       primitive.NewObjectID(),
 			Author:   user,
 			Category: "funny",
 			Title:    "abacaba",
@@ -383,7 +476,7 @@ func TestPostHandlerGetPostByID(t *testing.T) {
 
 	//Good request
 	oldViews := posts[0].Views
-	postSt.EXPECT().GetPostByID(posts[0].ID).Return(posts[0], nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), posts[0].ID).Return(posts[0], nil)
 	url := "/api/post/" + posts[0].ID.Hex()
 	r := httptest.NewRequest("GET", url, nil)
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": posts[0].ID.Hex()})
@@ -421,7 +514,7 @@ func TestPostHandlerGetPostByID(t *testing.T) {
 	}
 
 	// DB error
-	postSt.EXPECT().GetPostByID(posts[0].ID).Return(posts[0], ErrDB)
+	postSt.EXPECT().GetPostByID(gomock.Any(), posts[0].ID).Return(posts[0], ErrDB)
 	url = "/api/post/" + posts[0].ID.Hex()
 	r = httptest.NewRequest("GET", url, nil)
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": posts[0].ID.Hex()})
@@ -450,7 +543,7 @@ func TestPostHandlerGetPostsByCategory(t *testing.T) {
 	}
 	posts := []*items.Post{
 		{
-			ID:       bson.NewObjectId(),
+			ID:       primitive.NewObjectID(),
 			Author:   user,
 			Category: "funny",
 			Title:    "abacaba",
@@ -460,7 +553,7 @@ func TestPostHandlerGetPostsByCategory(t *testing.T) {
 	}
 
 	//Good request
-	postSt.EXPECT().GetPostsByCategory(posts[0].Category).Return(posts, nil)
+	postSt.EXPECT().GetPostsByCategory(gomock.Any(), posts[0].Category).Return(posts, nil)
 	url := "/api/posts/" + posts[0].Category
 	r := httptest.NewRequest("GET", url, nil)
 	r = mux.SetURLVars(r, map[string]string{"CATEGORY_NAME": posts[0].Category})
@@ -488,8 +581,53 @@ func TestPostHandlerGetPostsByCategory(t *testing.T) {
 		return
 	}
 
+	// Structured query
+	postSt.EXPECT().GetPostsByFilter(gomock.Any(), &query.Query{Terms: []string{"abacaba"}, Category: posts[0].Category}).Return(posts, nil)
+	url = "/api/posts/" + posts[0].Category + "?q=abacaba"
+	r = httptest.NewRequest("GET", url, nil)
+	r = mux.SetURLVars(r, map[string]string{"CATEGORY_NAME": posts[0].Category})
+	w = httptest.NewRecorder()
+	postService.GetPostsByCategory(w, r)
+	resp = w.Result()
+	body, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if string(body) != string(bodyTrue) {
+		t.Errorf("expected %s\ngot %s", string(bodyTrue), string(body))
+		return
+	}
+
+	// Structured query with another category
+	url = "/api/posts/" + posts[0].Category + "?q=category:music"
+	r = httptest.NewRequest("GET", url, nil)
+	r = mux.SetURLVars(r, map[string]string{"CATEGORY_NAME": posts[0].Category})
+	w = httptest.NewRecorder()
+	postService.GetPostsByCategory(w, r)
+	resp = w.Result()
+	body, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if string(body) != "[]" {
+		t.Errorf("expected []\ngot %s", string(body))
+		return
+	}
+
+	// Bad structured query
+	url = "/api/posts/" + posts[0].Category + "?q=score:high"
+	r = httptest.NewRequest("GET", url, nil)
+	r = mux.SetURLVars(r, map[string]string{"CATEGORY_NAME": posts[0].Category})
+	w = httptest.NewRecorder()
+	postService.GetPostsByCategory(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	}
+
 	// DB error
-	postSt.EXPECT().GetPostsByCategory(posts[0].Category).Return(nil, ErrDB)
+	postSt.EXPECT().GetPostsByCategory(gomock.Any(), posts[0].Category).Return(nil, ErrDB)
 	url = "/api/posts/" + posts[0].Category
 	r = httptest.NewRequest("GET", url, nil)
 	r = mux.SetURLVars(r, map[string]string{"CATEGORY_NAME": posts[0].Category})
@@ -533,8 +671,8 @@ func TestPostHandlerAddPost(t *testing.T) {
 	r := httptest.NewRequest("POST", url, bodyInp)
 	w := httptest.NewRecorder()
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	userSt.EXPECT().GetUserByID(user.ID).Return(user, nil)
-	postSt.EXPECT().AddPost(CustomPostMatcher{post}).Return(post.ID, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	postSt.EXPECT().AddPost(gomock.Any(), CustomPostMatcher{post}).Return(post.ID, nil)
 	postService.AddPost(w, r)
 	resp := w.Result()
 	if resp.StatusCode != 201 {
@@ -571,7 +709,7 @@ func TestPostHandlerAddPost(t *testing.T) {
 	r = httptest.NewRequest("POST", url, bodyInp)
 	w = httptest.NewRecorder()
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	userSt.EXPECT().GetUserByID(user.ID).Return(nil, ErrDB)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(nil, ErrDB)
 	postService.AddPost(w, r)
 	resp = w.Result()
 	if resp.StatusCode != 500 {
@@ -585,8 +723,8 @@ func TestPostHandlerAddPost(t *testing.T) {
 	r = httptest.NewRequest("POST", url, bodyInp)
 	w = httptest.NewRecorder()
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	userSt.EXPECT().GetUserByID(user.ID).Return(user, nil)
-	postSt.EXPECT().AddPost(CustomPostMatcher{post}).Return(post.ID, ErrDB)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	postSt.EXPECT().AddPost(gomock.Any(), CustomPostMatcher{post}).Return(post.ID, ErrDB)
 	postService.AddPost(w, r)
 	resp = w.Result()
 	if resp.StatusCode != 500 {
@@ -613,12 +751,12 @@ func TestPostHandlerPostComment(t *testing.T) {
 		Password: "adminadmin",
 	}
 	comment := &items.Comment{
-		ID:     bson.NewObjectId(),
+		ID:     primitive.NewObjectID(),
 		Author: user,
 		Body:   "comment",
 	}
 	post := &items.Post{
-		ID:       bson.NewObjectId(),
+		ID:       primitive.NewObjectID(),
 		Category: "funny",
 		Title:    "abacaba",
 		Type:     "text",
@@ -633,9 +771,9 @@ func TestPostHandlerPostComment(t *testing.T) {
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex()})
 	w := httptest.NewRecorder()
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	userSt.EXPECT().GetUserByID(user.ID).Return(user, nil)
-	postSt.EXPECT().GetPostByID(post.ID).Return(post, nil)
-	postSt.EXPECT().PostComment(post, CustomCommentMatcher{comment}).Return(comment.ID, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
+	postSt.EXPECT().PostComment(gomock.Any(), post, CustomCommentMatcher{comment}).Return(comment.ID, nil)
 	postService.PostComment(w, r)
 	resp := w.Result()
 	if resp.StatusCode != 200 {
@@ -705,7 +843,7 @@ func TestPostHandlerPostComment(t *testing.T) {
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex()})
 	w = httptest.NewRecorder()
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	userSt.EXPECT().GetUserByID(user.ID).Return(nil, ErrDB)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(nil, ErrDB)
 	postService.PostComment(w, r)
 	resp = w.Result()
 	if resp.StatusCode != 500 {
@@ -721,7 +859,7 @@ func TestPostHandlerPostComment(t *testing.T) {
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex()})
 	w = httptest.NewRecorder()
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	userSt.EXPECT().GetUserByID(user.ID).Return(nil, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(nil, nil)
 	postService.PostComment(w, r)
 	resp = w.Result()
 	if resp.StatusCode != 400 {
@@ -737,8 +875,8 @@ func TestPostHandlerPostComment(t *testing.T) {
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex()})
 	w = httptest.NewRecorder()
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	userSt.EXPECT().GetUserByID(user.ID).Return(user, nil)
-	postSt.EXPECT().GetPostByID(post.ID).Return(nil, ErrDB)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(nil, ErrDB)
 	postService.PostComment(w, r)
 	resp = w.Result()
 	if resp.StatusCode != 500 {
@@ -754,8 +892,8 @@ func TestPostHandlerPostComment(t *testing.T) {
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex()})
 	w = httptest.NewRecorder()
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	userSt.EXPECT().GetUserByID(user.ID).Return(user, nil)
-	postSt.EXPECT().GetPostByID(post.ID).Return(nil, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(nil, nil)
 	postService.PostComment(w, r)
 	resp = w.Result()
 	if resp.StatusCode != 400 {
@@ -771,9 +909,9 @@ func TestPostHandlerPostComment(t *testing.T) {
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex()})
 	w = httptest.NewRecorder()
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	userSt.EXPECT().GetUserByID(user.ID).Return(user, nil)
-	postSt.EXPECT().GetPostByID(post.ID).Return(post, nil)
-	postSt.EXPECT().PostComment(post, CustomCommentMatcher{comment}).Return(comment.ID, mgo.ErrNotFound)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
+	postSt.EXPECT().PostComment(gomock.Any(), post, CustomCommentMatcher{comment}).Return(comment.ID, items.ErrPostNotFound)
 	postService.PostComment(w, r)
 	resp = w.Result()
 	if resp.StatusCode != 204 {
@@ -789,9 +927,9 @@ func TestPostHandlerPostComment(t *testing.T) {
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex()})
 	w = httptest.NewRecorder()
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	userSt.EXPECT().GetUserByID(user.ID).Return(user, nil)
-	postSt.EXPECT().GetPostByID(post.ID).Return(post, nil)
-	postSt.EXPECT().PostComment(post, CustomCommentMatcher{comment}).Return(comment.ID, ErrDB)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
+	postSt.EXPECT().PostComment(gomock.Any(), post, CustomCommentMatcher{comment}).Return(comment.ID, ErrDB)
 	postService.PostComment(w, r)
 	resp = w.Result()
 	if resp.StatusCode != 500 {
@@ -818,12 +956,12 @@ func TestPostHandlerDeleteComment(t *testing.T) {
 		Password: "adminadmin",
 	}
 	comment := &items.Comment{
-		ID:     bson.NewObjectId(),
+		ID:     primitive.NewObjectID(),
 		Author: user,
 		Body:   "comment",
 	}
 	post := &items.Post{
-		ID:       bson.NewObjectId(),
+		ID:       primitive.NewObjectID(),
 		Author:   user,
 		Category: "funny",
 		Title:    "abacaba",
@@ -839,9 +977,9 @@ func TestPostHandlerDeleteComment(t *testing.T) {
 	r := httptest.NewRequest("DELETE", url, nil)
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex(), "COMMENT_ID": comment.ID.Hex()})
 	w := httptest.NewRecorder()
-	postSt.EXPECT().GetPostByID(post.ID).Return(post, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	postSt.EXPECT().DeleteComment(post, comment.ID, user.ID).Return(nil)
+	postSt.EXPECT().DeleteComment(gomock.Any(), post, comment.ID, user.ID).Return(nil)
 	postService.DeleteComment(w, r)
 	resp := w.Result()
 	if resp.StatusCode != 200 {
@@ -905,7 +1043,7 @@ func TestPostHandlerDeleteComment(t *testing.T) {
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex(), "COMMENT_ID": comment.ID.Hex()})
 	w = httptest.NewRecorder()
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	postSt.EXPECT().GetPostByID(post.ID).Return(nil, ErrDB)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(nil, ErrDB)
 	postService.DeleteComment(w, r)
 	resp = w.Result()
 	if resp.StatusCode != 500 {
@@ -919,7 +1057,7 @@ func TestPostHandlerDeleteComment(t *testing.T) {
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex(), "COMMENT_ID": comment.ID.Hex()})
 	w = httptest.NewRecorder()
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	postSt.EXPECT().GetPostByID(post.ID).Return(nil, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(nil, nil)
 	postService.DeleteComment(w, r)
 	resp = w.Result()
 	if resp.StatusCode != 400 {
@@ -933,8 +1071,8 @@ func TestPostHandlerDeleteComment(t *testing.T) {
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex(), "COMMENT_ID": comment.ID.Hex()})
 	w = httptest.NewRecorder()
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	postSt.EXPECT().GetPostByID(post.ID).Return(post, nil)
-	postSt.EXPECT().DeleteComment(post, comment.ID, user.ID).Return(ErrDB)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
+	postSt.EXPECT().DeleteComment(gomock.Any(), post, comment.ID, user.ID).Return(ErrDB)
 	postService.DeleteComment(w, r)
 	resp = w.Result()
 	if resp.StatusCode != 400 {
@@ -954,6 +1092,7 @@ func TestPostHandlerDeletePost(t *testing.T) {
 		UserRepo:  userSt,
 		Sessions:  managerSt,
 		SessionDB: nil,
+		Deleter:   &PostDeleter{PostRepo: postSt},
 	}
 	user := &items.User{
 		ID:       1,
@@ -961,7 +1100,7 @@ func TestPostHandlerDeletePost(t *testing.T) {
 		Password: "adminadmin",
 	}
 	post := &items.Post{
-		ID:       bson.NewObjectId(),
+		ID:       primitive.NewObjectID(),
 		Author:   user,
 		Category: "funny",
 		Title:    "abacaba",
@@ -975,8 +1114,8 @@ func TestPostHandlerDeletePost(t *testing.T) {
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex()})
 	w := httptest.NewRecorder()
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	userSt.EXPECT().GetUserByID(user.ID).Return(user, nil)
-	postSt.EXPECT().DeletePost(post.ID, user).Return(nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	postSt.EXPECT().DeletePost(gomock.Any(), post.ID, user).Return(nil)
 	postService.DeletePost(w, r)
 	resp := w.Result()
 	if resp.StatusCode != 200 {
@@ -1028,7 +1167,7 @@ func TestPostHandlerDeletePost(t *testing.T) {
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex()})
 	w = httptest.NewRecorder()
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	userSt.EXPECT().GetUserByID(user.ID).Return(nil, ErrDB)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(nil, ErrDB)
 	postService.DeletePost(w, r)
 	resp = w.Result()
 	if resp.StatusCode != 500 {
@@ -1042,7 +1181,7 @@ func TestPostHandlerDeletePost(t *testing.T) {
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex()})
 	w = httptest.NewRecorder()
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	userSt.EXPECT().GetUserByID(user.ID).Return(nil, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(nil, nil)
 	postService.DeletePost(w, r)
 	resp = w.Result()
 	if resp.StatusCode != 400 {
@@ -1056,8 +1195,8 @@ func TestPostHandlerDeletePost(t *testing.T) {
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex()})
 	w = httptest.NewRecorder()
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	userSt.EXPECT().GetUserByID(user.ID).Return(user, nil)
-	postSt.EXPECT().DeletePost(post.ID, user).Return(ErrDB)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	postSt.EXPECT().DeletePost(gomock.Any(), post.ID, user).Return(ErrDB)
 	postService.DeletePost(w, r)
 	resp = w.Result()
 	if resp.StatusCode != 400 {
@@ -1066,6 +1205,57 @@ func TestPostHandlerDeletePost(t *testing.T) {
 	}
 }
 
+func TestPostHandlerDeletePostUnsaves(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	postSt := NewMockPostRepositoryInterface(ctrl)
+	userSt := NewMockUserRepositoryInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	savedSt := NewMockSavedRepositoryInterface(ctrl)
+	postService := &PostHandler{
+		PostRepo: postSt,
+		UserRepo: userSt,
+		Sessions: managerSt,
+		Deleter: &PostDeleter{
+			PostRepo: postSt,
+			Saved:    savedSt,
+			Logger:   zap.NewNop().Sugar(),
+		},
+	}
+	user := &items.User{ID: 1, Username: "admin"}
+	postID := primitive.NewObjectID()
+
+	//Saved rows go with the post
+	r := httptest.NewRequest("DELETE", "/api/post/"+postID.Hex(), nil)
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": postID.Hex()})
+	w := httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	postSt.EXPECT().DeletePost(gomock.Any(), postID, user).Return(nil)
+	savedSt.EXPECT().DeleteByPost(gomock.Any(), postID).Return(nil)
+	postService.DeletePost(w, r)
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Saved DB error doesn't fail the deletion
+	r = httptest.NewRequest("DELETE", "/api/post/"+postID.Hex(), nil)
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": postID.Hex()})
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	postSt.EXPECT().DeletePost(gomock.Any(), postID, user).Return(nil)
+	savedSt.EXPECT().DeleteByPost(gomock.Any(), postID).Return(ErrDB)
+	postService.DeletePost(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+}
+
 func TestPostHandlerVote(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -1084,7 +1274,7 @@ func TestPostHandlerVote(t *testing.T) {
 		Password: "adminadmin",
 	}
 	post := &items.Post{
-		ID:       bson.NewObjectId(),
+		ID:       primitive.NewObjectID(),
 		Author:   user,
 		Category: "funny",
 		Title:    "abacaba",
@@ -1103,10 +1293,10 @@ func TestPostHandlerVote(t *testing.T) {
 	r := httptest.NewRequest("GET", url, nil)
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex(), "VOTE": "downvote"})
 	w := httptest.NewRecorder()
-	postSt.EXPECT().GetPostByID(post.ID).Return(post, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	postSt.EXPECT().DeleteUserFromVoteTry(post, user.ID).Return(nil)
-	postSt.EXPECT().Vote(post, user.ID, -1).Return(nil)
+	postSt.EXPECT().DeleteUserFromVoteTry(gomock.Any(), post, user.ID).Return(nil)
+	postSt.EXPECT().Vote(gomock.Any(), post, user.ID, -1).Return(nil)
 	postService.Vote(w, r)
 	resp := w.Result()
 	if resp.StatusCode != 200 {
@@ -1143,7 +1333,7 @@ func TestPostHandlerVote(t *testing.T) {
 	r = httptest.NewRequest("GET", url, nil)
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex(), "VOTE": "upvote"})
 	w = httptest.NewRecorder()
-	postSt.EXPECT().GetPostByID(post.ID).Return(nil, ErrDB)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(nil, ErrDB)
 	postService.Vote(w, r)
 	resp = w.Result()
 	if resp.StatusCode != 500 {
@@ -1156,7 +1346,7 @@ func TestPostHandlerVote(t *testing.T) {
 	r = httptest.NewRequest("GET", url, nil)
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex(), "VOTE": "upvote"})
 	w = httptest.NewRecorder()
-	postSt.EXPECT().GetPostByID(post.ID).Return(post, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
 	managerSt.EXPECT().Check(r).Return(nil, ErrDB)
 	postService.Vote(w, r)
 	resp = w.Result()
@@ -1170,7 +1360,7 @@ func TestPostHandlerVote(t *testing.T) {
 	r = httptest.NewRequest("GET", url, nil)
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex(), "VOTE": "upvote"})
 	w = httptest.NewRecorder()
-	postSt.EXPECT().GetPostByID(post.ID).Return(post, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
 	managerSt.EXPECT().Check(r).Return(nil, nil)
 	postService.Vote(w, r)
 	resp = w.Result()
@@ -1184,9 +1374,9 @@ func TestPostHandlerVote(t *testing.T) {
 	r = httptest.NewRequest("GET", url, nil)
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex(), "VOTE": "upvote"})
 	w = httptest.NewRecorder()
-	postSt.EXPECT().GetPostByID(post.ID).Return(post, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	postSt.EXPECT().DeleteUserFromVoteTry(post, user.ID).Return(ErrDB)
+	postSt.EXPECT().DeleteUserFromVoteTry(gomock.Any(), post, user.ID).Return(ErrDB)
 	postService.Vote(w, r)
 	resp = w.Result()
 	if resp.StatusCode != 500 {
@@ -1199,10 +1389,10 @@ func TestPostHandlerVote(t *testing.T) {
 	r = httptest.NewRequest("GET", url, nil)
 	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex(), "VOTE": "upvote"})
 	w = httptest.NewRecorder()
-	postSt.EXPECT().GetPostByID(post.ID).Return(post, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
 	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
-	postSt.EXPECT().DeleteUserFromVoteTry(post, user.ID).Return(nil)
-	postSt.EXPECT().Vote(post, user.ID, 1).Return(ErrDB)
+	postSt.EXPECT().DeleteUserFromVoteTry(gomock.Any(), post, user.ID).Return(nil)
+	postSt.EXPECT().Vote(gomock.Any(), post, user.ID, 1).Return(ErrDB)
 	postService.Vote(w, r)
 	resp = w.Result()
 	if resp.StatusCode != 500 {
@@ -1210,3 +1400,2589 @@ func TestPostHandlerVote(t *testing.T) {
 		return
 	}
 }
+
+func TestSearchHandlerSearch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	searchSt := NewMockSearchIndexInterface(ctrl)
+	searchService := &SearchHandler{
+		Index: searchSt,
+	}
+	result := &search.Result{
+		Total: 1,
+		Posts: []*items.Post{
+			{
+				ID:       primitive.NewObjectID(),
+				Category: "music",
+				Title:    "abacaba",
+				Type:     "text",
+			},
+		},
+	}
+
+	//Good request
+	from, _ := time.Parse("2006-01-02", "2022-01-01")
+	searchSt.EXPECT().Search(gomock.Any(), &search.Query{
+		Query: query.Query{
+			Terms:    []string{"abacaba"},
+			Phrases:  []string{"exact phrase"},
+			Category: "music",
+			Author:   "admin",
+			After:    from,
+		},
+		Offset: 10,
+		Limit:  5,
+	}).Return(result, nil)
+	r := httptest.NewRequest("GET", "/api/search?q=abacaba+author:admin+%22exact+phrase%22&category=music&from=2022-01-01&offset=10&limit=5", nil)
+	w := httptest.NewRecorder()
+	searchService.Search(w, r)
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	bodyTrue, _ := json.Marshal(result)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if string(body) != string(bodyTrue) {
+		t.Errorf("expected %s\ngot %s", string(bodyTrue), string(body))
+		return
+	}
+
+	//Bad query
+	r = httptest.NewRequest("GET", "/api/search?q=foo:bar", nil)
+	w = httptest.NewRecorder()
+	searchService.Search(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	}
+
+	//Bad date
+	r = httptest.NewRequest("GET", "/api/search?q=abacaba&to=yesterday", nil)
+	w = httptest.NewRecorder()
+	searchService.Search(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected code 400, got %d", resp.StatusCode)
+		return
+	}
+
+	//Bad limit
+	r = httptest.NewRequest("GET", "/api/search?q=abacaba&limit=-1", nil)
+	w = httptest.NewRecorder()
+	searchService.Search(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected code 400, got %d", resp.StatusCode)
+		return
+	}
+
+	//Index error
+	searchSt.EXPECT().Search(gomock.Any(), gomock.Any()).Return(nil, ErrDB)
+	r = httptest.NewRequest("GET", "/api/search?q=abacaba", nil)
+	w = httptest.NewRecorder()
+	searchService.Search(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestProfileHandlerGetProfile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	profileSt := NewMockProfileRepositoryInterface(ctrl)
+	profileService := &ProfileHandler{
+		Profiles: profileSt,
+	}
+	profile := &items.Profile{
+		ID:       1,
+		Username: "admin",
+		Bio:      "hello",
+		ProfileStats: items.ProfileStats{
+			PostKarma: 10,
+			Posts:     2,
+		},
+	}
+
+	//Good request
+	profileSt.EXPECT().GetProfile(gomock.Any(), "admin").Return(profile, nil)
+	r := httptest.NewRequest("GET", "/api/user/admin/profile", nil)
+	r = mux.SetURLVars(r, map[string]string{"USERNAME": "admin"})
+	w := httptest.NewRecorder()
+	profileService.GetProfile(w, r)
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	bodyTrue, _ := json.Marshal(profile)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if string(body) != string(bodyTrue) {
+		t.Errorf("expected %s\ngot %s", string(bodyTrue), string(body))
+		return
+	}
+
+	//No user
+	profileSt.EXPECT().GetProfile(gomock.Any(), "nobody").Return(nil, nil)
+	r = httptest.NewRequest("GET", "/api/user/nobody/profile", nil)
+	r = mux.SetURLVars(r, map[string]string{"USERNAME": "nobody"})
+	w = httptest.NewRecorder()
+	profileService.GetProfile(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected code 404, got %d", resp.StatusCode)
+		return
+	}
+
+	//DB error
+	profileSt.EXPECT().GetProfile(gomock.Any(), "admin").Return(nil, ErrDB)
+	r = httptest.NewRequest("GET", "/api/user/admin/profile", nil)
+	r = mux.SetURLVars(r, map[string]string{"USERNAME": "admin"})
+	w = httptest.NewRecorder()
+	profileService.GetProfile(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestProfileHandlerUpdateProfile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	profileSt := NewMockProfileRepositoryInterface(ctrl)
+	userSt := NewMockUserRepositoryInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	profileService := &ProfileHandler{
+		Profiles: profileSt,
+		UserRepo: userSt,
+		Sessions: managerSt,
+	}
+	user := &items.User{
+		ID:       1,
+		Username: "admin",
+	}
+
+	//Good request
+	body := strings.NewReader(`{"bio":"hello","avatarUrl":"https://example.com/a.png"}`)
+	r := httptest.NewRequest("PUT", "/api/user/admin/profile", body)
+	r = mux.SetURLVars(r, map[string]string{"USERNAME": "admin"})
+	w := httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	profileSt.EXPECT().UpdateProfile(gomock.Any(), user.ID, "hello", "https://example.com/a.png").Return(nil)
+	profileSt.EXPECT().GetProfile(gomock.Any(), "admin").Return(&items.Profile{ID: 1, Username: "admin"}, nil)
+	profileService.UpdateProfile(w, r)
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Someone else's profile
+	body = strings.NewReader(`{"bio":"hello"}`)
+	r = httptest.NewRequest("PUT", "/api/user/guest/profile", body)
+	r = mux.SetURLVars(r, map[string]string{"USERNAME": "guest"})
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	profileService.UpdateProfile(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 403 {
+		t.Errorf("expected code 403, got %d", resp.StatusCode)
+		return
+	}
+
+	//Bad avatar
+	body = strings.NewReader(`{"bio":"hello","avatarUrl":"javascript:alert(1)"}`)
+	r = httptest.NewRequest("PUT", "/api/user/admin/profile", body)
+	r = mux.SetURLVars(r, map[string]string{"USERNAME": "admin"})
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: user.ID}, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	profileService.UpdateProfile(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	}
+
+	//No session
+	body = strings.NewReader(`{"bio":"hello"}`)
+	r = httptest.NewRequest("PUT", "/api/user/admin/profile", body)
+	r = mux.SetURLVars(r, map[string]string{"USERNAME": "admin"})
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(nil, nil)
+	profileService.UpdateProfile(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 401 {
+		t.Errorf("expected code 401, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestPostHandlerVoteKarma(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	postSt := NewMockPostRepositoryInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	profileSt := NewMockProfileRepositoryInterface(ctrl)
+	postService := &PostHandler{
+		PostRepo: postSt,
+		Sessions: managerSt,
+		Profiles: profileSt,
+		Logger:   zap.NewNop().Sugar(),
+	}
+	author := &items.User{ID: 1, Username: "admin"}
+	post := &items.Post{
+		ID:     primitive.NewObjectID(),
+		Author: author,
+		Votes: []items.Vote{
+			{User: author.ID, Vote: 1},
+			{User: 2, Vote: 1},
+		},
+	}
+
+	//Upvote turned into downvote
+	r := httptest.NewRequest("GET", "/api/post/"+post.ID.Hex()+"/downvote", nil)
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex(), "VOTE": "downvote"})
+	w := httptest.NewRecorder()
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "2", UserID: 2}, nil)
+	postSt.EXPECT().DeleteUserFromVoteTry(gomock.Any(), post, 2).Return(nil)
+	postSt.EXPECT().Vote(gomock.Any(), post, 2, -1).Return(nil)
+	profileSt.EXPECT().AddStats(gomock.Any(), author.ID, items.ProfileStats{PostKarma: -2}).Return(nil)
+	postService.Vote(w, r)
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Same vote again changes nothing
+	post.Votes = []items.Vote{{User: 2, Vote: 1}}
+	r = httptest.NewRequest("GET", "/api/post/"+post.ID.Hex()+"/upvote", nil)
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex(), "VOTE": "upvote"})
+	w = httptest.NewRecorder()
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "2", UserID: 2}, nil)
+	postSt.EXPECT().DeleteUserFromVoteTry(gomock.Any(), post, 2).Return(nil)
+	postSt.EXPECT().Vote(gomock.Any(), post, 2, 1).Return(nil)
+	postService.Vote(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Profile error doesn't fail the vote
+	post.Votes = nil
+	r = httptest.NewRequest("GET", "/api/post/"+post.ID.Hex()+"/upvote", nil)
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex(), "VOTE": "upvote"})
+	w = httptest.NewRecorder()
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "2", UserID: 2}, nil)
+	postSt.EXPECT().DeleteUserFromVoteTry(gomock.Any(), post, 2).Return(nil)
+	postSt.EXPECT().Vote(gomock.Any(), post, 2, 1).Return(nil)
+	profileSt.EXPECT().AddStats(gomock.Any(), author.ID, items.ProfileStats{PostKarma: 1}).Return(ErrDB)
+	postService.Vote(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestPostHandlerVoteComment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	postSt := NewMockPostRepositoryInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	profileSt := NewMockProfileRepositoryInterface(ctrl)
+	postService := &PostHandler{
+		PostRepo: postSt,
+		Sessions: managerSt,
+		Profiles: profileSt,
+		Logger:   zap.NewNop().Sugar(),
+	}
+	author := &items.User{ID: 1, Username: "admin"}
+	comment := &items.Comment{
+		ID:     primitive.NewObjectID(),
+		Author: author,
+		Votes:  []items.Vote{{User: 2, Vote: 1}},
+		Score:  1,
+	}
+	post := &items.Post{
+		ID:       primitive.NewObjectID(),
+		Author:   &items.User{ID: 3, Username: "guest"},
+		Comments: []*items.Comment{comment},
+	}
+	vars := func(vote string) map[string]string {
+		return map[string]string{"POST_ID": post.ID.Hex(), "COMMENT_ID": comment.ID.Hex(), "VOTE": vote}
+	}
+
+	//Upvote turned into downvote
+	r := httptest.NewRequest("GET", "/api/post/"+post.ID.Hex()+"/"+comment.ID.Hex()+"/downvote", nil)
+	r = mux.SetURLVars(r, vars("downvote"))
+	w := httptest.NewRecorder()
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "2", UserID: 2}, nil)
+	postSt.EXPECT().VoteComment(gomock.Any(), post, comment.ID, 2, -1).Return(nil)
+	profileSt.EXPECT().AddStats(gomock.Any(), author.ID, items.ProfileStats{CommentKarma: -2}).Return(nil)
+	postService.VoteComment(w, r)
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Same vote again changes nothing
+	r = httptest.NewRequest("GET", "/api/post/"+post.ID.Hex()+"/"+comment.ID.Hex()+"/upvote", nil)
+	r = mux.SetURLVars(r, vars("upvote"))
+	w = httptest.NewRecorder()
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "2", UserID: 2}, nil)
+	postSt.EXPECT().VoteComment(gomock.Any(), post, comment.ID, 2, 1).Return(nil)
+	postService.VoteComment(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Wrong COMMENT_ID
+	r = httptest.NewRequest("GET", "/api/post/"+post.ID.Hex()+"/-1/upvote", nil)
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex(), "COMMENT_ID": "-1", "VOTE": "upvote"})
+	w = httptest.NewRecorder()
+	postService.VoteComment(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+
+	//No such comment
+	other := primitive.NewObjectID()
+	r = httptest.NewRequest("GET", "/api/post/"+post.ID.Hex()+"/"+other.Hex()+"/upvote", nil)
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex(), "COMMENT_ID": other.Hex(), "VOTE": "upvote"})
+	w = httptest.NewRecorder()
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "2", UserID: 2}, nil)
+	postService.VoteComment(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected code 400, got %d", resp.StatusCode)
+		return
+	}
+
+	//Post DB error (VoteComment)
+	r = httptest.NewRequest("GET", "/api/post/"+post.ID.Hex()+"/"+comment.ID.Hex()+"/upvote", nil)
+	r = mux.SetURLVars(r, vars("upvote"))
+	w = httptest.NewRecorder()
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "2", UserID: 2}, nil)
+	postSt.EXPECT().VoteComment(gomock.Any(), post, comment.ID, 2, 1).Return(ErrDB)
+	postService.VoteComment(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestUserHandlerGetComments(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	commentSt := NewMockCommentRepositoryInterface(ctrl)
+	userService := &UserHandler{
+		Comments: commentSt,
+		Logger:   zap.NewNop().Sugar(),
+	}
+	comments := []*items.UserComment{
+		{
+			ID:        primitive.NewObjectID(),
+			Body:      "abacaba",
+			PostID:    primitive.NewObjectID(),
+			PostTitle: "title",
+		},
+	}
+
+	//Good request
+	commentSt.EXPECT().GetCommentsByUsername(gomock.Any(), "admin", 5, 10).Return(comments, nil)
+	r := httptest.NewRequest("GET", "/api/user/admin/comments?offset=5&limit=10", nil)
+	r = mux.SetURLVars(r, map[string]string{"USERNAME": "admin"})
+	w := httptest.NewRecorder()
+	userService.GetComments(w, r)
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	bodyTrue, _ := json.Marshal(comments)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if string(body) != string(bodyTrue) {
+		t.Errorf("expected %s\ngot %s", string(bodyTrue), string(body))
+		return
+	}
+
+	//Default page
+	commentSt.EXPECT().GetCommentsByUsername(gomock.Any(), "admin", 0, search.DefaultLimit).Return(comments, nil)
+	r = httptest.NewRequest("GET", "/api/user/admin/comments", nil)
+	r = mux.SetURLVars(r, map[string]string{"USERNAME": "admin"})
+	w = httptest.NewRecorder()
+	userService.GetComments(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Bad offset
+	r = httptest.NewRequest("GET", "/api/user/admin/comments?offset=abc", nil)
+	r = mux.SetURLVars(r, map[string]string{"USERNAME": "admin"})
+	w = httptest.NewRecorder()
+	userService.GetComments(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected code 400, got %d", resp.StatusCode)
+		return
+	}
+
+	//DB error
+	commentSt.EXPECT().GetCommentsByUsername(gomock.Any(), "admin", 0, search.DefaultLimit).Return(nil, ErrDB)
+	r = httptest.NewRequest("GET", "/api/user/admin/comments", nil)
+	r = mux.SetURLVars(r, map[string]string{"USERNAME": "admin"})
+	w = httptest.NewRecorder()
+	userService.GetComments(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestPostHandlerSave(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	postSt := NewMockPostRepositoryInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	savedSt := NewMockSavedRepositoryInterface(ctrl)
+	postService := &PostHandler{
+		PostRepo: postSt,
+		Sessions: managerSt,
+		Saved:    savedSt,
+	}
+	post := &items.Post{
+		ID:    primitive.NewObjectID(),
+		Title: "abacaba",
+	}
+
+	//Save
+	r := httptest.NewRequest("PUT", "/api/post/"+post.ID.Hex()+"/save", nil)
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex()})
+	w := httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: 1}, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
+	savedSt.EXPECT().Save(gomock.Any(), 1, post.ID).Return(nil)
+	postService.Save(w, r)
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if !strings.Contains(string(body), `"saved":true`) {
+		t.Errorf("expected saved post, got %s", string(body))
+		return
+	}
+
+	//Unsave
+	r = httptest.NewRequest("DELETE", "/api/post/"+post.ID.Hex()+"/save", nil)
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex()})
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: 1}, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
+	savedSt.EXPECT().Unsave(gomock.Any(), 1, post.ID).Return(nil)
+	postService.Unsave(w, r)
+	resp = w.Result()
+	body, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if strings.Contains(string(body), `"saved"`) {
+		t.Errorf("expected unsaved post, got %s", string(body))
+		return
+	}
+
+	//No post
+	r = httptest.NewRequest("PUT", "/api/post/"+post.ID.Hex()+"/save", nil)
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex()})
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: 1}, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(nil, items.ErrPostNotFound)
+	postService.Save(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected code 404, got %d", resp.StatusCode)
+		return
+	}
+
+	//DB error
+	r = httptest.NewRequest("PUT", "/api/post/"+post.ID.Hex()+"/save", nil)
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex()})
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: 1}, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
+	savedSt.EXPECT().Save(gomock.Any(), 1, post.ID).Return(ErrDB)
+	postService.Save(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestPostHandlerGetSaved(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	postSt := NewMockPostRepositoryInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	savedSt := NewMockSavedRepositoryInterface(ctrl)
+	postService := &PostHandler{
+		PostRepo: postSt,
+		Sessions: managerSt,
+		Saved:    savedSt,
+	}
+	posts := []*items.Post{
+		{ID: primitive.NewObjectID(), Title: "first"},
+		{ID: primitive.NewObjectID(), Title: "second"},
+	}
+	ids := []primitive.ObjectID{posts[0].ID, posts[1].ID}
+
+	//Good request
+	r := httptest.NewRequest("GET", "/api/user/me/saved?limit=2", nil)
+	w := httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: 1}, nil)
+	savedSt.EXPECT().GetSaved(gomock.Any(), 1, 0, 2).Return(ids, nil)
+	postSt.EXPECT().GetPostsByIDs(gomock.Any(), ids).Return(posts, nil)
+	postService.GetSaved(w, r)
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if strings.Count(string(body), `"saved":true`) != 2 {
+		t.Errorf("expected saved posts, got %s", string(body))
+		return
+	}
+
+	//Saved flag in listings
+	r = httptest.NewRequest("GET", "/api/posts", nil)
+	w = httptest.NewRecorder()
+	postSt.EXPECT().GetAllPosts(gomock.Any()).Return(posts, nil)
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: 1}, nil)
+	savedSt.EXPECT().FilterSaved(gomock.Any(), 1, ids).Return(ids[1:], nil)
+	postService.GetAllPosts(w, r)
+	resp = w.Result()
+	body, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if strings.Count(string(body), `"saved":true`) != 1 || posts[0].Saved || !posts[1].Saved {
+		t.Errorf("expected one saved post, got %s", string(body))
+		return
+	}
+
+	//Anonymous listing
+	r = httptest.NewRequest("GET", "/api/posts", nil)
+	w = httptest.NewRecorder()
+	posts[1].Saved = false
+	postSt.EXPECT().GetAllPosts(gomock.Any()).Return(posts, nil)
+	managerSt.EXPECT().Check(r).Return(nil, session.ErrNoAuth)
+	postService.GetAllPosts(w, r)
+	resp = w.Result()
+	body, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if strings.Contains(string(body), `"saved"`) {
+		t.Errorf("expected no saved posts, got %s", string(body))
+		return
+	}
+
+	//No session
+	r = httptest.NewRequest("GET", "/api/user/me/saved", nil)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(nil, nil)
+	postService.GetSaved(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 401 {
+		t.Errorf("expected code 401, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestFeedHandlerGetFeed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	postSt := NewMockPostRepositoryInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	subscriptionSt := NewMockSubscriptionRepositoryInterface(ctrl)
+	feedService := &FeedHandler{
+		PostRepo:      postSt,
+		Subscriptions: subscriptionSt,
+		Sessions:      managerSt,
+	}
+	now := time.Now()
+	music := []*items.Post{
+		{ID: primitive.NewObjectID(), Category: "music", Title: "old but popular", Score: 100, Created: now.Add(-48 * time.Hour)},
+		{ID: primitive.NewObjectID(), Category: "music", Title: "old", Score: 1, Created: now.Add(-72 * time.Hour)},
+	}
+	news := []*items.Post{
+		{ID: primitive.NewObjectID(), Category: "news", Title: "fresh", Score: 1, Created: now},
+	}
+
+	//Subscribed categories are ranked by hotness
+	r := httptest.NewRequest("GET", "/api/feed?limit=2", nil)
+	w := httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: 1}, nil)
+	subscriptionSt.EXPECT().GetSubscriptions(gomock.Any(), 1).Return([]string{"music", "news"}, nil)
+	postSt.EXPECT().GetRecentPosts(gomock.Any(), []string{"music", "news"}, gomock.Any(), DefaultFeedCandidates).
+		Return([]*items.Post{news[0], music[0], music[1]}, nil)
+	feedService.GetFeed(w, r)
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	bodyTrue, _ := json.Marshal([]*items.Post{news[0], music[0]})
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if string(body) != string(bodyTrue) {
+		t.Errorf("expected %s\ngot %s", string(bodyTrue), string(body))
+		return
+	}
+
+	//Logged out users get all categories, older posts fill up a quiet window
+	r = httptest.NewRequest("GET", "/api/feed?offset=1&limit=1", nil)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(nil, session.ErrNoAuth)
+	postSt.EXPECT().GetRecentPosts(gomock.Any(), nil, gomock.Any(), DefaultFeedCandidates).Return(news, nil)
+	postSt.EXPECT().GetRecentPosts(gomock.Any(), nil, time.Time{}, DefaultFeedCandidates).
+		Return([]*items.Post{news[0], music[0], music[1]}, nil)
+	feedService.GetFeed(w, r)
+	resp = w.Result()
+	body, _ = ioutil.ReadAll(resp.Body)
+	bodyTrue, _ = json.Marshal([]*items.Post{music[0]})
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if string(body) != string(bodyTrue) {
+		t.Errorf("expected %s\ngot %s", string(bodyTrue), string(body))
+		return
+	}
+
+	//Users without subscriptions get default categories, no more than
+	//MaxCandidates posts are ranked
+	feedService.DefaultCategories = []string{"news"}
+	feedService.MaxCandidates = 1
+	r = httptest.NewRequest("GET", "/api/feed", nil)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: 1}, nil)
+	subscriptionSt.EXPECT().GetSubscriptions(gomock.Any(), 1).Return([]string{}, nil)
+	postSt.EXPECT().GetRecentPosts(gomock.Any(), []string{"news"}, gomock.Any(), 1).Return(news, nil)
+	feedService.GetFeed(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//DB error
+	r = httptest.NewRequest("GET", "/api/feed", nil)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(nil, session.ErrNoAuth)
+	postSt.EXPECT().GetRecentPosts(gomock.Any(), []string{"news"}, gomock.Any(), 1).Return(nil, ErrDB)
+	feedService.GetFeed(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestFeedHandlerSubscribe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	subscriptionSt := NewMockSubscriptionRepositoryInterface(ctrl)
+	feedService := &FeedHandler{
+		Subscriptions: subscriptionSt,
+		Sessions:      managerSt,
+	}
+
+	//Subscribe
+	r := httptest.NewRequest("PUT", "/api/subscriptions/music", nil)
+	r = mux.SetURLVars(r, map[string]string{"CATEGORY_NAME": "music"})
+	w := httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: 1}, nil).Times(2)
+	subscriptionSt.EXPECT().Subscribe(gomock.Any(), 1, "music").Return(nil)
+	subscriptionSt.EXPECT().GetSubscriptions(gomock.Any(), 1).Return([]string{"music"}, nil)
+	feedService.Subscribe(w, r)
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if string(body) != `["music"]` {
+		t.Errorf("expected [\"music\"]\ngot %s", string(body))
+		return
+	}
+
+	//Unknown category
+	r = httptest.NewRequest("PUT", "/api/subscriptions/cats", nil)
+	r = mux.SetURLVars(r, map[string]string{"CATEGORY_NAME": "cats"})
+	w = httptest.NewRecorder()
+	feedService.Subscribe(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected code 404, got %d", resp.StatusCode)
+		return
+	}
+
+	//DB error
+	r = httptest.NewRequest("DELETE", "/api/subscriptions/music", nil)
+	r = mux.SetURLVars(r, map[string]string{"CATEGORY_NAME": "music"})
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: 1}, nil)
+	subscriptionSt.EXPECT().Unsubscribe(gomock.Any(), 1, "music").Return(ErrDB)
+	feedService.Unsubscribe(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+}
+
+type CustomNotificationMatcher struct {
+	check *items.Notification
+}
+
+func (nm CustomNotificationMatcher) Matches(x interface{}) bool {
+	n, ok := x.(*items.Notification)
+	if !ok {
+		return false
+	}
+	return nm.check.Type == n.Type && nm.check.PostID == n.PostID && nm.check.Body == n.Body && nm.check.Author.ID == n.Author.ID
+}
+func (nm CustomNotificationMatcher) String() string {
+	return "*items.Notification"
+}
+
+func TestPostHandlerPostCommentNotification(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	postSt := NewMockPostRepositoryInterface(ctrl)
+	userSt := NewMockUserRepositoryInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	notificationSt := NewMockNotificationRepositoryInterface(ctrl)
+	postService := &PostHandler{
+		PostRepo:      postSt,
+		UserRepo:      userSt,
+		Sessions:      managerSt,
+		Notifications: notificationSt,
+		Logger:        zap.NewNop().Sugar(),
+	}
+	author := &items.User{ID: 1, Username: "admin"}
+	commenter := &items.User{ID: 2, Username: "guest"}
+	post := &items.Post{
+		ID:     primitive.NewObjectID(),
+		Author: author,
+		Title:  "abacaba",
+	}
+
+	//Comment on someone else's post notifies the author
+	r := httptest.NewRequest("POST", "/api/post/"+post.ID.Hex(), strings.NewReader(`{"comment":"hello"}`))
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex()})
+	w := httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "2", UserID: commenter.ID}, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), commenter.ID).Return(commenter, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
+	postSt.EXPECT().PostComment(gomock.Any(), post, gomock.Any()).Return(primitive.NewObjectID(), nil)
+	notificationSt.EXPECT().Add(gomock.Any(), author.ID, CustomNotificationMatcher{&items.Notification{
+		Type:   items.NotificationComment,
+		PostID: post.ID,
+		Author: commenter,
+		Body:   "hello",
+	}}).Return(nil)
+	postService.PostComment(w, r)
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Comment on own post doesn't
+	r = httptest.NewRequest("POST", "/api/post/"+post.ID.Hex(), strings.NewReader(`{"comment":"hello"}`))
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex()})
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: author.ID}, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), author.ID).Return(author, nil)
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
+	postSt.EXPECT().PostComment(gomock.Any(), post, gomock.Any()).Return(primitive.NewObjectID(), nil)
+	postService.PostComment(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestNotificationHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	notificationSt := NewMockNotificationRepositoryInterface(ctrl)
+	notificationService := &NotificationHandler{
+		Notifications: notificationSt,
+		Sessions:      managerSt,
+	}
+	notifications := []*items.Notification{
+		{
+			ID:     1,
+			Type:   items.NotificationComment,
+			PostID: primitive.NewObjectID(),
+			Author: &items.User{ID: 2, Username: "guest"},
+			Body:   "hello",
+		},
+	}
+
+	//List
+	r := httptest.NewRequest("GET", "/api/notifications?unread=true", nil)
+	w := httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: 1}, nil)
+	notificationSt.EXPECT().CountUnread(gomock.Any(), 1).Return(1, nil)
+	notificationSt.EXPECT().GetNotifications(gomock.Any(), 1, true, 0, search.DefaultLimit).Return(notifications, nil)
+	notificationService.GetNotifications(w, r)
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	bodyTrue, _ := json.Marshal(notificationList{Unread: 1, Notifications: notifications})
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if string(body) != string(bodyTrue) {
+		t.Errorf("expected %s\ngot %s", string(bodyTrue), string(body))
+		return
+	}
+
+	//Mark read
+	r = httptest.NewRequest("POST", "/api/notifications/1/read", nil)
+	r = mux.SetURLVars(r, map[string]string{"NOTIFICATION_ID": "1"})
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: 1}, nil).Times(2)
+	notificationSt.EXPECT().MarkRead(gomock.Any(), 1, 1).Return(nil)
+	notificationSt.EXPECT().CountUnread(gomock.Any(), 1).Return(0, nil)
+	notificationService.MarkRead(w, r)
+	resp = w.Result()
+	body, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if string(body) != `{"unread":0}` {
+		t.Errorf("expected {\"unread\":0}\ngot %s", string(body))
+		return
+	}
+
+	//Someone else's notification
+	r = httptest.NewRequest("POST", "/api/notifications/7/read", nil)
+	r = mux.SetURLVars(r, map[string]string{"NOTIFICATION_ID": "7"})
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: 1}, nil)
+	notificationSt.EXPECT().MarkRead(gomock.Any(), 1, 7).Return(items.ErrNotificationNotFound)
+	notificationService.MarkRead(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected code 404, got %d", resp.StatusCode)
+		return
+	}
+
+	//Mark all read
+	r = httptest.NewRequest("POST", "/api/notifications/read", nil)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "1", UserID: 1}, nil)
+	notificationSt.EXPECT().MarkAllRead(gomock.Any(), 1).Return(ErrDB)
+	notificationService.MarkAllRead(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestEventHandlerStream(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	postSt := NewMockPostRepositoryInterface(ctrl)
+	hubSt := NewMockEventHubInterface(ctrl)
+	eventService := &EventHandler{
+		Hub:      hubSt,
+		PostRepo: postSt,
+	}
+	postID := primitive.NewObjectID()
+
+	//Bad post id
+	r := httptest.NewRequest("GET", "/api/post/bad/events", nil)
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": "bad"})
+	w := httptest.NewRecorder()
+	eventService.Stream(w, r)
+	resp := w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+
+	//Post not found
+	r = httptest.NewRequest("GET", "/api/post/"+postID.Hex()+"/events", nil)
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": postID.Hex()})
+	w = httptest.NewRecorder()
+	postSt.EXPECT().GetPostByID(gomock.Any(), postID).Return(nil, items.ErrPostNotFound)
+	eventService.Stream(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected code 404, got %d", resp.StatusCode)
+		return
+	}
+
+	//Events are streamed until the channel is closed
+	r = httptest.NewRequest("GET", "/api/post/"+postID.Hex()+"/events", nil)
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": postID.Hex()})
+	w = httptest.NewRecorder()
+	stream := make(chan events.Event, 2)
+	stream <- events.Event{Type: events.TypeVote, PostID: postID, Post: &items.Post{ID: postID, Score: 2}}
+	stream <- events.Event{Type: events.TypePostDeleted, PostID: postID}
+	close(stream)
+	cancelled := false
+	postSt.EXPECT().GetPostByID(gomock.Any(), postID).Return(&items.Post{ID: postID}, nil)
+	hubSt.EXPECT().Subscribe(postID).Return((<-chan events.Event)(stream), func() { cancelled = true })
+	eventService.Stream(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("unexpected content type %q", resp.Header.Get("Content-Type"))
+		return
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "event: vote\ndata: {") || !strings.Contains(string(body), "event: post_deleted\n") {
+		t.Errorf("unexpected body %q", body)
+		return
+	}
+	if !cancelled {
+		t.Errorf("expected subscription to be cancelled")
+		return
+	}
+}
+
+func TestPostHandlerVoteEvent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	postSt := NewMockPostRepositoryInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	hubSt := NewMockEventHubInterface(ctrl)
+	postService := &PostHandler{
+		PostRepo: postSt,
+		Sessions: managerSt,
+		Events:   hubSt,
+		Logger:   zap.NewNop().Sugar(),
+	}
+	post := &items.Post{ID: primitive.NewObjectID()}
+
+	//Publish error doesn't fail the vote
+	r := httptest.NewRequest("GET", "/api/post/"+post.ID.Hex()+"/upvote", nil)
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": post.ID.Hex(), "VOTE": "upvote"})
+	w := httptest.NewRecorder()
+	postSt.EXPECT().GetPostByID(gomock.Any(), post.ID).Return(post, nil)
+	managerSt.EXPECT().Check(r).Return(&session.Session{ID: "2", UserID: 2}, nil)
+	postSt.EXPECT().DeleteUserFromVoteTry(gomock.Any(), post, 2).Return(nil)
+	postSt.EXPECT().Vote(gomock.Any(), post, 2, 1).Return(nil)
+	hubSt.EXPECT().Publish(events.Event{Type: events.TypeVote, PostID: post.ID, Post: post}).Return(ErrDB)
+	postService.Vote(w, r)
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestUserHandlerLoginLockout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	userSt := NewMockUserRepositoryInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	lockoutSt := NewMockLoginGuardInterface(ctrl)
+	userService := &UserHandler{
+		UserRepo: userSt,
+		Sessions: managerSt,
+		Lockout:  lockoutSt,
+		Logger:   zap.NewNop().Sugar(),
+	}
+	user := &items.User{
+		ID:       1,
+		Username: "admin",
+		Password: "adminadmin",
+	}
+	bodyString := fmt.Sprintf(`{"username":"%s","password":"%s"}`, user.Username, user.Password)
+	ip := "192.0.2.1"
+
+	//Unknown user and wrong password get the same answer
+	for _, authErr := range []error{items.ErrNoUser, items.ErrBadPass} {
+		lockoutSt.EXPECT().Check(gomock.Any(), user.Username, ip).Return(time.Duration(0), nil)
+		userSt.EXPECT().Authorize(gomock.Any(), user.Username, user.Password).Return(nil, authErr)
+		lockoutSt.EXPECT().Fail(gomock.Any(), user.Username, ip).Return(nil)
+		r := httptest.NewRequest("POST", "/api/login", strings.NewReader(bodyString))
+		w := httptest.NewRecorder()
+		userService.Login(w, r)
+		resp := w.Result()
+		if resp.StatusCode != 401 {
+			t.Errorf("expected code 401, got %d", resp.StatusCode)
+			return
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if !strings.Contains(string(body), "invalid username or password") {
+			t.Errorf("unexpected body %s", body)
+			return
+		}
+	}
+
+	//Usernames go to the lockout as typed, it normalizes them itself
+	for _, username := range []string{"Admin", "ADMIN"} {
+		lockoutSt.EXPECT().Check(gomock.Any(), username, ip).Return(time.Duration(0), nil)
+		userSt.EXPECT().Authorize(gomock.Any(), username, "wrong").Return(nil, items.ErrBadPass)
+		lockoutSt.EXPECT().Fail(gomock.Any(), username, ip).Return(nil)
+		r := httptest.NewRequest("POST", "/api/login", strings.NewReader(fmt.Sprintf(`{"username":"%s","password":"wrong"}`, username)))
+		w := httptest.NewRecorder()
+		userService.Login(w, r)
+		resp := w.Result()
+		if resp.StatusCode != 401 {
+			t.Errorf("expected code 401, got %d", resp.StatusCode)
+			return
+		}
+	}
+
+	//Locked
+	lockoutSt.EXPECT().Check(gomock.Any(), user.Username, ip).Return(90*time.Second+time.Millisecond, nil)
+	r := httptest.NewRequest("POST", "/api/login", strings.NewReader(bodyString))
+	w := httptest.NewRecorder()
+	userService.Login(w, r)
+	resp := w.Result()
+	if resp.StatusCode != 429 {
+		t.Errorf("expected code 429, got %d", resp.StatusCode)
+		return
+	}
+	if resp.Header.Get("Retry-After") != "91" {
+		t.Errorf("expected Retry-After 91, got %q", resp.Header.Get("Retry-After"))
+		return
+	}
+
+	//Lockout db error
+	lockoutSt.EXPECT().Check(gomock.Any(), user.Username, ip).Return(time.Duration(0), ErrDB)
+	r = httptest.NewRequest("POST", "/api/login", strings.NewReader(bodyString))
+	w = httptest.NewRecorder()
+	userService.Login(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+
+	//Success resets failures, errors are only logged
+	lockoutSt.EXPECT().Check(gomock.Any(), user.Username, ip).Return(time.Duration(0), nil)
+	userSt.EXPECT().Authorize(gomock.Any(), user.Username, user.Password).Return(user, nil)
+	lockoutSt.EXPECT().Reset(gomock.Any(), user.Username).Return(ErrDB)
+	managerSt.EXPECT().Create(gomock.Any(), gomock.Any(), user.ID).Return(&session.Session{}, nil)
+	r = httptest.NewRequest("POST", "/api/login", strings.NewReader(bodyString))
+	w = httptest.NewRecorder()
+	userService.Login(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	healthy := func(context.Context) error { return nil }
+	hanging := func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}
+	healthService := &HealthHandler{
+		Timeout: 50 * time.Millisecond,
+		Checks: []HealthCheck{
+			{Name: "mysql", Check: healthy},
+			{Name: "mongo", Check: healthy},
+		},
+	}
+
+	//Live
+	w := httptest.NewRecorder()
+	healthService.Live(w, httptest.NewRequest("GET", "/healthz", nil))
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//All dependencies up
+	w = httptest.NewRecorder()
+	healthService.Ready(w, httptest.NewRequest("GET", "/readyz", nil))
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//One dependency down, the other one hangs
+	healthService.Checks[0].Check = func(context.Context) error { return ErrDB }
+	healthService.Checks[1].Check = hanging
+	w = httptest.NewRecorder()
+	healthService.Ready(w, httptest.NewRequest("GET", "/readyz", nil))
+	resp = w.Result()
+	if resp.StatusCode != 503 {
+		t.Errorf("expected code 503, got %d", resp.StatusCode)
+		return
+	}
+	status := healthStatus{}
+	json.NewDecoder(resp.Body).Decode(&status)
+	if status.Checks["mysql"].Error != ErrDB.Error() || status.Checks["mongo"].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("unexpected status %+v", status)
+		return
+	}
+
+	//Shutting down
+	healthService.Checks = nil
+	healthService.Shutdown()
+	w = httptest.NewRecorder()
+	healthService.Ready(w, httptest.NewRequest("GET", "/readyz", nil))
+	resp = w.Result()
+	if resp.StatusCode != 503 {
+		t.Errorf("expected code 503, got %d", resp.StatusCode)
+		return
+	}
+	w = httptest.NewRecorder()
+	healthService.Live(w, httptest.NewRequest("GET", "/healthz", nil))
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestAccountHandlerChangePassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	userSt := NewMockUserRepositoryInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	service := &AccountHandler{
+		UserRepo: userSt,
+		Sessions: managerSt,
+		Policy:   credentials.DefaultPolicy(),
+		Logger:   zap.NewNop().Sugar(),
+	}
+	user := &items.User{
+		ID:       1,
+		Username: "admin",
+	}
+	sess := &session.Session{ID: "1", UserID: user.ID}
+
+	//Good request
+	body := strings.NewReader(`{"currentPassword":"old password","newPassword":"correct horse battery"}`)
+	r := httptest.NewRequest("PUT", "/api/user/me/password", body)
+	w := httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "old password").Return(user, nil)
+	userSt.EXPECT().ChangePassword(gomock.Any(), user.ID, "correct horse battery").Return(nil)
+	managerSt.EXPECT().DestroyOthers(gomock.Any(), user.ID, "1").Return(nil)
+	service.ChangePassword(w, r)
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Wrong current password
+	body = strings.NewReader(`{"currentPassword":"wrong","newPassword":"correct horse battery"}`)
+	r = httptest.NewRequest("PUT", "/api/user/me/password", body)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "wrong").Return(nil, items.ErrBadPass)
+	service.ChangePassword(w, r)
+	resp = w.Result()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	} else if !strings.Contains(string(respBody), `"param":"currentPassword"`) {
+		t.Errorf("unexpected body: %s", respBody)
+		return
+	}
+
+	//New password breaks the policy
+	body = strings.NewReader(`{"currentPassword":"old password","newPassword":"short"}`)
+	r = httptest.NewRequest("PUT", "/api/user/me/password", body)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "old password").Return(user, nil)
+	service.ChangePassword(w, r)
+	resp = w.Result()
+	respBody, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	} else if !strings.Contains(string(respBody), `"param":"newPassword"`) {
+		t.Errorf("unexpected body: %s", respBody)
+		return
+	}
+
+	//Other sessions can't be ended
+	body = strings.NewReader(`{"currentPassword":"old password","newPassword":"correct horse battery"}`)
+	r = httptest.NewRequest("PUT", "/api/user/me/password", body)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "old password").Return(user, nil)
+	userSt.EXPECT().ChangePassword(gomock.Any(), user.ID, "correct horse battery").Return(nil)
+	managerSt.EXPECT().DestroyOthers(gomock.Any(), user.ID, "1").Return(ErrDB)
+	service.ChangePassword(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+
+	//No session
+	body = strings.NewReader(`{"currentPassword":"old password","newPassword":"correct horse battery"}`)
+	r = httptest.NewRequest("PUT", "/api/user/me/password", body)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(nil, nil)
+	service.ChangePassword(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 401 {
+		t.Errorf("expected code 401, got %d", resp.StatusCode)
+		return
+	}
+
+	//No body
+	r = httptest.NewRequest("PUT", "/api/user/me/password", nil)
+	w = httptest.NewRecorder()
+	service.ChangePassword(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestAccountHandlerChangeUsername(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	userSt := NewMockUserRepositoryInterface(ctrl)
+	postSt := NewMockPostRepositoryInterface(ctrl)
+	searchSt := NewMockSearchIndexInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	service := &AccountHandler{
+		UserRepo: userSt,
+		PostRepo: postSt,
+		Sessions: managerSt,
+		Search:   searchSt,
+		Policy:   credentials.DefaultPolicy(),
+		Logger:   zap.NewNop().Sugar(),
+	}
+	user := &items.User{
+		ID:       1,
+		Username: "admin",
+	}
+	sess := &session.Session{ID: "1", UserID: user.ID}
+	renamed := &items.Post{ID: primitive.NewObjectID(), Author: &items.User{ID: 1, Username: "rené"}}
+	commented := &items.Post{
+		ID:       primitive.NewObjectID(),
+		Author:   &items.User{ID: 2, Username: "guest"},
+		Comments: []*items.Comment{{Author: &items.User{ID: 1, Username: "rené"}, Body: "hi"}},
+	}
+
+	//Good request
+	body := strings.NewReader(`{"username":"rené"}`)
+	r := httptest.NewRequest("PUT", "/api/user/me/username", body)
+	w := httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().ChangeUsername(gomock.Any(), user.ID, "rené").Return(nil)
+	postSt.EXPECT().RenameAuthor(gomock.Any(), user.ID, "rené").Return(nil)
+	postSt.EXPECT().GetPostsByUsername(gomock.Any(), "rené").Return([]*items.Post{renamed}, nil)
+	searchSt.EXPECT().Index(gomock.Any(), renamed)
+	postSt.EXPECT().GetPostsByCommenter(gomock.Any(), user.ID).Return([]*items.Post{commented}, nil)
+	searchSt.EXPECT().Index(gomock.Any(), commented)
+	service.ChangeUsername(w, r)
+	resp := w.Result()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if !strings.Contains(string(respBody), `"token"`) {
+		t.Errorf("expected a new token, got %s", respBody)
+		return
+	}
+
+	//Taken
+	body = strings.NewReader(`{"username":"Guest"}`)
+	r = httptest.NewRequest("PUT", "/api/user/me/username", body)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().ChangeUsername(gomock.Any(), user.ID, "Guest").Return(items.ErrUserAlreadyExists)
+	service.ChangeUsername(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	}
+
+	//Breaks the policy
+	body = strings.NewReader(`{"username":"a b"}`)
+	r = httptest.NewRequest("PUT", "/api/user/me/username", body)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	service.ChangeUsername(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	}
+
+	//Posts can't be renamed
+	body = strings.NewReader(`{"username":"rené"}`)
+	r = httptest.NewRequest("PUT", "/api/user/me/username", body)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().ChangeUsername(gomock.Any(), user.ID, "rené").Return(nil)
+	postSt.EXPECT().RenameAuthor(gomock.Any(), user.ID, "rené").Return(ErrDB)
+	service.ChangeUsername(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestAccountHandlerDeleteAccount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	userSt := NewMockUserRepositoryInterface(ctrl)
+	postSt := NewMockPostRepositoryInterface(ctrl)
+	searchSt := NewMockSearchIndexInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	service := &AccountHandler{
+		UserRepo: userSt,
+		PostRepo: postSt,
+		Sessions: managerSt,
+		Search:   searchSt,
+		Deleter: &PostDeleter{
+			PostRepo: postSt,
+			Search:   searchSt,
+			Logger:   zap.NewNop().Sugar(),
+		},
+		Logger: zap.NewNop().Sugar(),
+	}
+	user := &items.User{
+		ID:       1,
+		Username: "admin",
+	}
+	sess := &session.Session{ID: "1", UserID: user.ID}
+	post := &items.Post{ID: primitive.NewObjectID(), Author: user}
+	commented := &items.Post{ID: primitive.NewObjectID(), Author: &items.User{ID: 2, Username: "guest"}}
+
+	//Anonymize
+	body := strings.NewReader(`{"password":"password","content":"anonymize"}`)
+	r := httptest.NewRequest("DELETE", "/api/user/me", body)
+	w := httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "password").Return(user, nil)
+	postSt.EXPECT().GetPostsByUsername(gomock.Any(), "admin").Return([]*items.Post{post}, nil)
+	postSt.EXPECT().GetPostsByCommenter(gomock.Any(), user.ID).Return([]*items.Post{commented}, nil)
+	postSt.EXPECT().AnonymizeAuthor(gomock.Any(), user.ID).Return(nil)
+	searchSt.EXPECT().Index(gomock.Any(), post).Do(func(_ context.Context, indexed *items.Post) {
+		if indexed.Author.Username != items.DeletedUsername {
+			t.Errorf("expected anonymized author, got %v", indexed.Author.Username)
+		}
+	})
+	postSt.EXPECT().GetPostsByIDs(gomock.Any(), []primitive.ObjectID{commented.ID}).Return([]*items.Post{commented}, nil)
+	searchSt.EXPECT().Index(gomock.Any(), commented)
+	userSt.EXPECT().DeleteUser(gomock.Any(), user.ID, false).Return(nil)
+	service.DeleteAccount(w, r)
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+	cookies := resp.Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("expected the session cookie to expire, got %v", cookies)
+		return
+	}
+
+	//Remove
+	body = strings.NewReader(`{"password":"password","content":"remove"}`)
+	r = httptest.NewRequest("DELETE", "/api/user/me", body)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "password").Return(user, nil)
+	postSt.EXPECT().GetPostsByUsername(gomock.Any(), "admin").Return([]*items.Post{post}, nil)
+	postSt.EXPECT().GetPostsByCommenter(gomock.Any(), user.ID).Return([]*items.Post{post, commented}, nil)
+	postSt.EXPECT().DeletePost(gomock.Any(), post.ID, user).Return(nil)
+	searchSt.EXPECT().Remove(gomock.Any(), post.ID)
+	postSt.EXPECT().DeleteAuthorComments(gomock.Any(), user.ID).Return(nil)
+	// the deleted post is gone, the other one is indexed without the comments
+	postSt.EXPECT().GetPostsByIDs(gomock.Any(), []primitive.ObjectID{post.ID, commented.ID}).Return([]*items.Post{commented}, nil)
+	searchSt.EXPECT().Index(gomock.Any(), commented)
+	userSt.EXPECT().DeleteUser(gomock.Any(), user.ID, true).Return(nil)
+	service.DeleteAccount(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Bad content option
+	body = strings.NewReader(`{"password":"password","content":"keep"}`)
+	r = httptest.NewRequest("DELETE", "/api/user/me", body)
+	w = httptest.NewRecorder()
+	service.DeleteAccount(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	}
+
+	//Wrong password
+	body = strings.NewReader(`{"password":"wrong","content":"remove"}`)
+	r = httptest.NewRequest("DELETE", "/api/user/me", body)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "wrong").Return(nil, items.ErrBadPass)
+	service.DeleteAccount(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	}
+
+	//Content can't be anonymized, the account stays
+	body = strings.NewReader(`{"password":"password","content":"anonymize"}`)
+	r = httptest.NewRequest("DELETE", "/api/user/me", body)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "password").Return(user, nil)
+	postSt.EXPECT().GetPostsByUsername(gomock.Any(), "admin").Return(nil, nil)
+	postSt.EXPECT().GetPostsByCommenter(gomock.Any(), user.ID).Return(nil, nil)
+	postSt.EXPECT().AnonymizeAuthor(gomock.Any(), user.ID).Return(ErrDB)
+	service.DeleteAccount(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestResetHandlerRequestReset(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	userSt := NewMockUserRepositoryInterface(ctrl)
+	resetSt := NewMockResetRepositoryInterface(ctrl)
+	mailerSt := NewMockMailerInterface(ctrl)
+	emailSt := NewMockEmailRepositoryInterface(ctrl)
+	service := &ResetHandler{
+		UserRepo: userSt,
+		Resets:   resetSt,
+		Mailer:   mailerSt,
+		Emails:   emailSt,
+		BaseURL:  "https://example.com",
+		Logger:   zap.NewNop().Sugar(),
+	}
+	user := &items.User{ID: 1, Username: "admin", Email: "admin@example.com", EmailVerified: true}
+
+	//Known address
+	body := strings.NewReader(`{"email":"Admin@Example.com"}`)
+	r := httptest.NewRequest("POST", "/api/password-reset", body)
+	w := httptest.NewRecorder()
+	userSt.EXPECT().GetUserByEmail(gomock.Any(), "Admin@Example.com").Return(user, nil)
+	emailSt.EXPECT().MarkResetSent(gomock.Any(), user.ID, DefaultResendInterval).Return(true, nil)
+	resetSt.EXPECT().Create(gomock.Any(), user.ID).Return("tok-en", nil)
+	mailerSt.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, msg *mail.Message) error {
+		if msg.To != "admin@example.com" || !strings.Contains(msg.Body, "https://example.com/reset-password?token=tok-en\n") {
+			t.Errorf("unexpected mail: %v", msg)
+		}
+		return nil
+	})
+	service.RequestReset(w, r)
+	service.Wait()
+	resp := w.Result()
+	known, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Unknown address gets the same answer
+	body = strings.NewReader(`{"email":"nobody@example.com"}`)
+	r = httptest.NewRequest("POST", "/api/password-reset", body)
+	w = httptest.NewRecorder()
+	userSt.EXPECT().GetUserByEmail(gomock.Any(), "nobody@example.com").Return(nil, nil)
+	service.RequestReset(w, r)
+	resp = w.Result()
+	unknown, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if string(known) != string(unknown) {
+		t.Errorf("answers differ: %s and %s", known, unknown)
+		return
+	}
+
+	//Unverified address gets no mail
+	body = strings.NewReader(`{"email":"guest@example.com"}`)
+	r = httptest.NewRequest("POST", "/api/password-reset", body)
+	w = httptest.NewRecorder()
+	userSt.EXPECT().GetUserByEmail(gomock.Any(), "guest@example.com").Return(&items.User{ID: 2, Username: "guest", Email: "guest@example.com"}, nil)
+	service.RequestReset(w, r)
+	resp = w.Result()
+	unverified, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if string(known) != string(unverified) {
+		t.Errorf("answers differ: %s and %s", known, unverified)
+		return
+	}
+
+	//Mail can't be sent, the answer stays the same
+	body = strings.NewReader(`{"email":"admin@example.com"}`)
+	r = httptest.NewRequest("POST", "/api/password-reset", body)
+	w = httptest.NewRecorder()
+	userSt.EXPECT().GetUserByEmail(gomock.Any(), "admin@example.com").Return(user, nil)
+	emailSt.EXPECT().MarkResetSent(gomock.Any(), user.ID, DefaultResendInterval).Return(true, nil)
+	resetSt.EXPECT().Create(gomock.Any(), user.ID).Return("token", nil)
+	mailerSt.EXPECT().Send(gomock.Any(), gomock.Any()).Return(ErrDB)
+	service.RequestReset(w, r)
+	service.Wait()
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Token can't be created, the answer stays the same
+	body = strings.NewReader(`{"email":"admin@example.com"}`)
+	r = httptest.NewRequest("POST", "/api/password-reset", body)
+	w = httptest.NewRecorder()
+	userSt.EXPECT().GetUserByEmail(gomock.Any(), "admin@example.com").Return(user, nil)
+	emailSt.EXPECT().MarkResetSent(gomock.Any(), user.ID, DefaultResendInterval).Return(true, nil)
+	resetSt.EXPECT().Create(gomock.Any(), user.ID).Return("", ErrDB)
+	service.RequestReset(w, r)
+	service.Wait()
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Mail was sent recently, no new token
+	body = strings.NewReader(`{"email":"admin@example.com"}`)
+	r = httptest.NewRequest("POST", "/api/password-reset", body)
+	w = httptest.NewRecorder()
+	userSt.EXPECT().GetUserByEmail(gomock.Any(), "admin@example.com").Return(user, nil)
+	emailSt.EXPECT().MarkResetSent(gomock.Any(), user.ID, DefaultResendInterval).Return(false, nil)
+	service.RequestReset(w, r)
+	service.Wait()
+	resp = w.Result()
+	throttled, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if string(known) != string(throttled) {
+		t.Errorf("answers differ: %s and %s", known, throttled)
+		return
+	}
+
+	//DB error
+	body = strings.NewReader(`{"email":"admin@example.com"}`)
+	r = httptest.NewRequest("POST", "/api/password-reset", body)
+	w = httptest.NewRecorder()
+	userSt.EXPECT().GetUserByEmail(gomock.Any(), "admin@example.com").Return(nil, ErrDB)
+	service.RequestReset(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestResetHandlerConfirmReset(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	userSt := NewMockUserRepositoryInterface(ctrl)
+	resetSt := NewMockResetRepositoryInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	lockoutSt := NewMockLoginGuardInterface(ctrl)
+	service := &ResetHandler{
+		UserRepo: userSt,
+		Resets:   resetSt,
+		Sessions: managerSt,
+		Lockout:  lockoutSt,
+		Policy:   credentials.DefaultPolicy(),
+		Logger:   zap.NewNop().Sugar(),
+	}
+	user := &items.User{ID: 1, Username: "admin"}
+
+	//Good request, every session ends
+	body := strings.NewReader(`{"token":"token","password":"correct horse battery"}`)
+	r := httptest.NewRequest("POST", "/api/password-reset/confirm", body)
+	w := httptest.NewRecorder()
+	resetSt.EXPECT().Check(gomock.Any(), "token").Return(user.ID, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	resetSt.EXPECT().Consume(gomock.Any(), "token").Return(user.ID, nil)
+	userSt.EXPECT().ChangePassword(gomock.Any(), user.ID, "correct horse battery").Return(nil)
+	managerSt.EXPECT().DestroyOthers(gomock.Any(), user.ID, "").Return(nil)
+	lockoutSt.EXPECT().Reset(gomock.Any(), "admin").Return(nil)
+	service.ConfirmReset(w, r)
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Bad or used token
+	body = strings.NewReader(`{"token":"token","password":"correct horse battery"}`)
+	r = httptest.NewRequest("POST", "/api/password-reset/confirm", body)
+	w = httptest.NewRecorder()
+	resetSt.EXPECT().Check(gomock.Any(), "token").Return(0, items.ErrBadResetToken)
+	service.ConfirmReset(w, r)
+	resp = w.Result()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	} else if !strings.Contains(string(respBody), `"param":"token"`) {
+		t.Errorf("unexpected body: %s", respBody)
+		return
+	}
+
+	//Weak password doesn't use the token up
+	body = strings.NewReader(`{"token":"token","password":"admin"}`)
+	r = httptest.NewRequest("POST", "/api/password-reset/confirm", body)
+	w = httptest.NewRecorder()
+	resetSt.EXPECT().Check(gomock.Any(), "token").Return(user.ID, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	service.ConfirmReset(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	}
+
+	//Token used up by a concurrent request
+	body = strings.NewReader(`{"token":"token","password":"correct horse battery"}`)
+	r = httptest.NewRequest("POST", "/api/password-reset/confirm", body)
+	w = httptest.NewRecorder()
+	resetSt.EXPECT().Check(gomock.Any(), "token").Return(user.ID, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	resetSt.EXPECT().Consume(gomock.Any(), "token").Return(0, items.ErrBadResetToken)
+	service.ConfirmReset(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	}
+
+	//Sessions can't be ended
+	body = strings.NewReader(`{"token":"token","password":"correct horse battery"}`)
+	r = httptest.NewRequest("POST", "/api/password-reset/confirm", body)
+	w = httptest.NewRecorder()
+	resetSt.EXPECT().Check(gomock.Any(), "token").Return(user.ID, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	resetSt.EXPECT().Consume(gomock.Any(), "token").Return(user.ID, nil)
+	userSt.EXPECT().ChangePassword(gomock.Any(), user.ID, "correct horse battery").Return(nil)
+	managerSt.EXPECT().DestroyOthers(gomock.Any(), user.ID, "").Return(ErrDB)
+	service.ConfirmReset(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestEmailHandlerChangeEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	userSt := NewMockUserRepositoryInterface(ctrl)
+	emailSt := NewMockEmailRepositoryInterface(ctrl)
+	mailerSt := NewMockMailerInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	signer := &emailtoken.Signer{Key: []byte("key")}
+	service := &EmailHandler{
+		UserRepo: userSt,
+		Emails:   emailSt,
+		Sessions: managerSt,
+		Mailer:   mailerSt,
+		Signer:   signer,
+		BaseURL:  "https://example.com",
+		Logger:   zap.NewNop().Sugar(),
+	}
+	user := &items.User{ID: 1, Username: "admin"}
+	sess := &session.Session{ID: "1", UserID: user.ID}
+
+	//Good request, a signed link goes to the new address
+	body := strings.NewReader(`{"email":"Admin@Example.com","password":"password"}`)
+	r := httptest.NewRequest("PUT", "/api/user/me/email", body)
+	w := httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "password").Return(user, nil)
+	emailSt.EXPECT().SetEmail(gomock.Any(), user.ID, "Admin@Example.com").Return(nil)
+	emailSt.EXPECT().GetEmail(gomock.Any(), user.ID).Return("admin@example.com", false, nil)
+	emailSt.EXPECT().MarkVerificationSent(gomock.Any(), user.ID, DefaultResendInterval).Return(true, nil)
+	mailerSt.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, msg *mail.Message) error {
+		link := regexp.MustCompile(`https://example.com/verify-email\?token=(\S+)`).FindStringSubmatch(msg.Body)
+		if msg.To != "admin@example.com" || link == nil {
+			t.Errorf("unexpected mail: %v", msg)
+			return nil
+		}
+		token, _ := url.QueryUnescape(link[1])
+		userID, email, err := signer.Verify(token)
+		if err != nil || userID != user.ID || email != "admin@example.com" {
+			t.Errorf("unexpected token: %v %v %v", userID, email, err)
+		}
+		return nil
+	})
+	service.ChangeEmail(w, r)
+	resp := w.Result()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if string(respBody) != `{"email":"admin@example.com","verified":false}` {
+		t.Errorf("unexpected body: %s", respBody)
+		return
+	}
+
+	//Changed again right away, the throttle holds for the new address
+	body = strings.NewReader(`{"email":"other@example.com","password":"password"}`)
+	r = httptest.NewRequest("PUT", "/api/user/me/email", body)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "password").Return(user, nil)
+	emailSt.EXPECT().SetEmail(gomock.Any(), user.ID, "other@example.com").Return(nil)
+	emailSt.EXPECT().GetEmail(gomock.Any(), user.ID).Return("other@example.com", false, nil)
+	emailSt.EXPECT().MarkVerificationSent(gomock.Any(), user.ID, DefaultResendInterval).Return(false, nil)
+	service.ChangeEmail(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Taken
+	body = strings.NewReader(`{"email":"guest@example.com","password":"password"}`)
+	r = httptest.NewRequest("PUT", "/api/user/me/email", body)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "password").Return(user, nil)
+	emailSt.EXPECT().SetEmail(gomock.Any(), user.ID, "guest@example.com").Return(items.ErrEmailTaken)
+	service.ChangeEmail(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	}
+
+	//Wrong password
+	body = strings.NewReader(`{"email":"guest@example.com","password":"wrong"}`)
+	r = httptest.NewRequest("PUT", "/api/user/me/email", body)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "wrong").Return(nil, items.ErrBadPass)
+	service.ChangeEmail(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	}
+
+	//Removed, no mail
+	body = strings.NewReader(`{"email":"","password":"password"}`)
+	r = httptest.NewRequest("PUT", "/api/user/me/email", body)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "password").Return(user, nil)
+	emailSt.EXPECT().SetEmail(gomock.Any(), user.ID, "").Return(nil)
+	emailSt.EXPECT().GetEmail(gomock.Any(), user.ID).Return("", false, nil)
+	service.ChangeEmail(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestEmailHandlerResendVerification(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	userSt := NewMockUserRepositoryInterface(ctrl)
+	emailSt := NewMockEmailRepositoryInterface(ctrl)
+	mailerSt := NewMockMailerInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	service := &EmailHandler{
+		UserRepo:       userSt,
+		Emails:         emailSt,
+		Sessions:       managerSt,
+		Mailer:         mailerSt,
+		Signer:         &emailtoken.Signer{Key: []byte("key")},
+		ResendInterval: time.Minute,
+		Logger:         zap.NewNop().Sugar(),
+	}
+	user := &items.User{ID: 1, Username: "admin"}
+	sess := &session.Session{ID: "1", UserID: user.ID}
+
+	//Good request
+	r := httptest.NewRequest("POST", "/api/user/me/email/verify", nil)
+	w := httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	emailSt.EXPECT().GetEmail(gomock.Any(), user.ID).Return("admin@example.com", false, nil)
+	emailSt.EXPECT().MarkVerificationSent(gomock.Any(), user.ID, time.Minute).Return(true, nil)
+	mailerSt.EXPECT().Send(gomock.Any(), gomock.Any()).Return(nil)
+	service.ResendVerification(w, r)
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Too soon
+	r = httptest.NewRequest("POST", "/api/user/me/email/verify", nil)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	emailSt.EXPECT().GetEmail(gomock.Any(), user.ID).Return("admin@example.com", false, nil)
+	emailSt.EXPECT().MarkVerificationSent(gomock.Any(), user.ID, time.Minute).Return(false, nil)
+	service.ResendVerification(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 429 {
+		t.Errorf("expected code 429, got %d", resp.StatusCode)
+		return
+	} else if resp.Header.Get("Retry-After") != "60" {
+		t.Errorf("expected Retry-After 60, got %q", resp.Header.Get("Retry-After"))
+		return
+	}
+
+	//Already verified
+	r = httptest.NewRequest("POST", "/api/user/me/email/verify", nil)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	emailSt.EXPECT().GetEmail(gomock.Any(), user.ID).Return("admin@example.com", true, nil)
+	service.ResendVerification(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 409 {
+		t.Errorf("expected code 409, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestEmailHandlerVerifyEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	emailSt := NewMockEmailRepositoryInterface(ctrl)
+	signer := &emailtoken.Signer{Key: []byte("key")}
+	service := &EmailHandler{
+		Emails: emailSt,
+		Signer: signer,
+		Logger: zap.NewNop().Sugar(),
+	}
+
+	//Good request
+	body := strings.NewReader(fmt.Sprintf(`{"token":"%s"}`, signer.Sign(1, "admin@example.com")))
+	r := httptest.NewRequest("POST", "/api/verify-email", body)
+	w := httptest.NewRecorder()
+	emailSt.EXPECT().GetEmail(gomock.Any(), 1).Return("admin@example.com", false, nil)
+	emailSt.EXPECT().VerifyEmail(gomock.Any(), 1, "admin@example.com").Return(nil)
+	service.VerifyEmail(w, r)
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Address changed since
+	body = strings.NewReader(fmt.Sprintf(`{"token":"%s"}`, signer.Sign(1, "old@example.com")))
+	r = httptest.NewRequest("POST", "/api/verify-email", body)
+	w = httptest.NewRecorder()
+	emailSt.EXPECT().GetEmail(gomock.Any(), 1).Return("admin@example.com", false, nil)
+	service.VerifyEmail(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	}
+
+	//Forged
+	forged := &emailtoken.Signer{Key: []byte("other key")}
+	body = strings.NewReader(fmt.Sprintf(`{"token":"%s"}`, forged.Sign(1, "admin@example.com")))
+	r = httptest.NewRequest("POST", "/api/verify-email", body)
+	w = httptest.NewRecorder()
+	service.VerifyEmail(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestPostHandlerRequireVerifiedEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	userSt := NewMockUserRepositoryInterface(ctrl)
+	emailSt := NewMockEmailRepositoryInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	service := &PostHandler{
+		UserRepo:             userSt,
+		Sessions:             managerSt,
+		Emails:               emailSt,
+		RequireVerifiedEmail: true,
+		Logger:               zap.NewNop().Sugar(),
+	}
+	user := &items.User{ID: 1, Username: "admin"}
+	sess := &session.Session{ID: "1", UserID: user.ID}
+
+	//Post
+	body := strings.NewReader(`{"category":"music","type":"text","title":"title","text":"text"}`)
+	r := httptest.NewRequest("POST", "/api/posts", body)
+	w := httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	emailSt.EXPECT().GetEmail(gomock.Any(), user.ID).Return("admin@example.com", false, nil)
+	service.AddPost(w, r)
+	resp := w.Result()
+	if resp.StatusCode != 403 {
+		t.Errorf("expected code 403, got %d", resp.StatusCode)
+		return
+	}
+
+	//Comment
+	postID := primitive.NewObjectID()
+	body = strings.NewReader(`{"comment":"hello"}`)
+	r = httptest.NewRequest("POST", "/api/post/"+postID.Hex(), body)
+	r = mux.SetURLVars(r, map[string]string{"POST_ID": postID.Hex()})
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	emailSt.EXPECT().GetEmail(gomock.Any(), user.ID).Return("", false, nil)
+	service.PostComment(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 403 {
+		t.Errorf("expected code 403, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestOIDCHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	userSt := NewMockUserRepositoryInterface(ctrl)
+	identitySt := NewMockIdentityRepositoryInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	provider := oidctest.NewServer("client", "secret")
+	defer provider.Close()
+	service := &OIDCHandler{
+		Providers: map[string]*oidc.Provider{
+			"corp": oidc.New(oidc.Config{
+				Name:         "corp",
+				Issuer:       provider.URL,
+				ClientID:     "client",
+				ClientSecret: "secret",
+				RedirectURL:  "http://localhost/api/oidc/corp/callback",
+			}),
+		},
+		Identities: identitySt,
+		UserRepo:   userSt,
+		Sessions:   managerSt,
+		Policy:     credentials.DefaultPolicy(),
+		Logger:     zap.NewNop().Sugar(),
+	}
+	provider.SetUser(oidctest.User{Subject: "42", Email: "alice@corp.example", EmailVerified: true, PreferredUsername: "alice"})
+	// login goes through the provider and returns the request it sends the
+	// browser back with
+	login := func() *http.Request {
+		r := httptest.NewRequest("GET", "/api/oidc/corp/login", nil)
+		r = mux.SetURLVars(r, map[string]string{"PROVIDER": "corp"})
+		w := httptest.NewRecorder()
+		service.Login(w, r)
+		resp := w.Result()
+		if resp.StatusCode != 302 || len(resp.Cookies()) != 1 {
+			t.Fatalf("expected a redirect with a cookie, got %d", resp.StatusCode)
+		}
+		callback, err := provider.Login(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatalf("unexpected err: %s", err)
+		}
+		r = httptest.NewRequest("GET", callback.RequestURI(), nil)
+		r.AddCookie(resp.Cookies()[0])
+		return mux.SetURLVars(r, map[string]string{"PROVIDER": "corp"})
+	}
+
+	//New identity creates a user
+	r := login()
+	w := httptest.NewRecorder()
+	identitySt.EXPECT().GetUserID(gomock.Any(), "corp", "42").Return(0, nil)
+	managerSt.EXPECT().Check(gomock.Any()).Return(nil, nil)
+	userSt.EXPECT().AddUser(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, user *items.User) (int, error) {
+		if user.Username != "alice" || len(user.Password) < 32 {
+			t.Errorf("unexpected user: %v", user)
+		}
+		return 0, items.ErrUserAlreadyExists
+	})
+	userSt.EXPECT().AddUser(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, user *items.User) (int, error) {
+		if user.Username != "alice2" {
+			t.Errorf("unexpected username: %s", user.Username)
+		}
+		return 5, nil
+	})
+	identitySt.EXPECT().Link(gomock.Any(), "corp", "42", 5).Return(nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), 5).Return(&items.User{ID: 5, Username: "alice2"}, nil)
+	managerSt.EXPECT().Create(gomock.Any(), gomock.Any(), 5).Return(&session.Session{UserID: 5}, nil)
+	service.Callback(w, r)
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d: %s", resp.StatusCode, body)
+		return
+	}
+	if !strings.Contains(string(body), `localStorage.setItem("token", "ey`) || !strings.Contains(string(body), `location.replace("/")`) {
+		t.Errorf("token is not handed over: %s", body)
+		return
+	}
+
+	//Known identity logs its user in
+	r = login()
+	w = httptest.NewRecorder()
+	identitySt.EXPECT().GetUserID(gomock.Any(), "corp", "42").Return(5, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), 5).Return(&items.User{ID: 5, Username: "alice2"}, nil)
+	managerSt.EXPECT().Create(gomock.Any(), gomock.Any(), 5).Return(&session.Session{UserID: 5}, nil)
+	service.Callback(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//User with 2FA gets a challenge instead of a session
+	twoFactorSt := NewMockTwoFactorRepositoryInterface(ctrl)
+	service.TwoFactor = twoFactorSt
+	r = login()
+	w = httptest.NewRecorder()
+	identitySt.EXPECT().GetUserID(gomock.Any(), "corp", "42").Return(5, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), 5).Return(&items.User{ID: 5, Username: "alice2"}, nil)
+	twoFactorSt.EXPECT().Get(gomock.Any(), 5).Return(&items.TwoFactor{Enabled: true}, nil)
+	twoFactorSt.EXPECT().CreateChallenge(gomock.Any(), 5).Return("challenge", nil)
+	service.Callback(w, r)
+	resp = w.Result()
+	body, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+	if string(body) != `{"twoFactorRequired":true,"challenge":"challenge"}` {
+		t.Errorf("expected a challenge, got %s", body)
+		return
+	}
+
+	//User without 2FA logs in with the provider alone
+	r = login()
+	w = httptest.NewRecorder()
+	identitySt.EXPECT().GetUserID(gomock.Any(), "corp", "42").Return(5, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), 5).Return(&items.User{ID: 5, Username: "alice2"}, nil)
+	twoFactorSt.EXPECT().Get(gomock.Any(), 5).Return(nil, nil)
+	managerSt.EXPECT().Create(gomock.Any(), gomock.Any(), 5).Return(&session.Session{UserID: 5}, nil)
+	service.Callback(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+	service.TwoFactor = nil
+
+	//Logged in user links the identity
+	r = login()
+	w = httptest.NewRecorder()
+	identitySt.EXPECT().GetUserID(gomock.Any(), "corp", "42").Return(0, nil)
+	managerSt.EXPECT().Check(gomock.Any()).Return(&session.Session{UserID: 1}, nil)
+	identitySt.EXPECT().Link(gomock.Any(), "corp", "42", 1).Return(nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), 1).Return(&items.User{ID: 1, Username: "admin"}, nil)
+	managerSt.EXPECT().Create(gomock.Any(), gomock.Any(), 1).Return(&session.Session{UserID: 1}, nil)
+	service.Callback(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Identity was linked by someone else meanwhile
+	r = login()
+	w = httptest.NewRecorder()
+	identitySt.EXPECT().GetUserID(gomock.Any(), "corp", "42").Return(0, nil)
+	managerSt.EXPECT().Check(gomock.Any()).Return(&session.Session{UserID: 1}, nil)
+	identitySt.EXPECT().Link(gomock.Any(), "corp", "42", 1).Return(items.ErrIdentityLinked)
+	service.Callback(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 409 {
+		t.Errorf("expected code 409, got %d", resp.StatusCode)
+		return
+	}
+
+	//State doesn't match the cookie
+	r = login()
+	query := r.URL.Query()
+	query.Set("state", "forged")
+	r.URL.RawQuery = query.Encode()
+	w = httptest.NewRecorder()
+	service.Callback(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected code 400, got %d", resp.StatusCode)
+		return
+	}
+
+	//No cookie
+	r = httptest.NewRequest("GET", "/api/oidc/corp/callback?code=x&state=y", nil)
+	r = mux.SetURLVars(r, map[string]string{"PROVIDER": "corp"})
+	w = httptest.NewRecorder()
+	service.Callback(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected code 400, got %d", resp.StatusCode)
+		return
+	}
+
+	//Code used twice
+	r = login()
+	w = httptest.NewRecorder()
+	identitySt.EXPECT().GetUserID(gomock.Any(), "corp", "42").Return(5, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), 5).Return(&items.User{ID: 5, Username: "alice2"}, nil)
+	managerSt.EXPECT().Create(gomock.Any(), gomock.Any(), 5).Return(&session.Session{UserID: 5}, nil)
+	service.Callback(httptest.NewRecorder(), r)
+	service.Callback(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 401 {
+		t.Errorf("expected code 401, got %d", resp.StatusCode)
+		return
+	}
+
+	//DB error
+	r = login()
+	w = httptest.NewRecorder()
+	identitySt.EXPECT().GetUserID(gomock.Any(), "corp", "42").Return(0, ErrDB)
+	service.Callback(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+
+	//Unknown provider
+	r = httptest.NewRequest("GET", "/api/oidc/other/login", nil)
+	r = mux.SetURLVars(r, map[string]string{"PROVIDER": "other"})
+	w = httptest.NewRecorder()
+	service.Login(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected code 404, got %d", resp.StatusCode)
+		return
+	}
+
+	//Providers
+	r = httptest.NewRequest("GET", "/api/oidc/providers", nil)
+	w = httptest.NewRecorder()
+	service.GetProviders(w, r)
+	resp = w.Result()
+	body, _ = ioutil.ReadAll(resp.Body)
+	if string(body) != `["corp"]` {
+		t.Errorf("unexpected providers: %s", body)
+		return
+	}
+}
+
+func TestOIDCHandlerUsername(t *testing.T) {
+	service := &OIDCHandler{Policy: credentials.DefaultPolicy()}
+	cases := []struct {
+		claims oidc.Claims
+		want   string
+	}{
+		{oidc.Claims{PreferredUsername: "alice", Email: "bob@example.com"}, "alice"},
+		{oidc.Claims{PreferredUsername: "a b", Email: "bob@example.com"}, "bob"},
+		{oidc.Claims{Email: "@example.com"}, "user"},
+		{oidc.Claims{PreferredUsername: strings.Repeat("x", 40)}, strings.Repeat("x", 30)},
+	}
+	for _, c := range cases {
+		if have := service.baseUsername(&c.claims); have != c.want {
+			t.Errorf("results not match, want %q, have %q", c.want, have)
+			return
+		}
+	}
+}
+
+func TestUserHandlerLoginTwoFactor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	userSt := NewMockUserRepositoryInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	lockoutSt := NewMockLoginGuardInterface(ctrl)
+	twoFactorSt := NewMockTwoFactorRepositoryInterface(ctrl)
+	userService := &UserHandler{
+		UserRepo:  userSt,
+		Sessions:  managerSt,
+		Lockout:   lockoutSt,
+		TwoFactor: twoFactorSt,
+		Logger:    zap.NewNop().Sugar(),
+	}
+	user := &items.User{ID: 1, Username: "admin"}
+	secret, _ := totp.NewSecret()
+	tf := &items.TwoFactor{Secret: secret, Enabled: true, RecoveryCodes: 10}
+	ip := "192.0.2.1"
+
+	//Password alone asks for a code, failed logins are not forgiven yet
+	r := httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"username":"admin","password":"adminadmin"}`))
+	w := httptest.NewRecorder()
+	lockoutSt.EXPECT().Check(gomock.Any(), "admin", ip).Return(time.Duration(0), nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "adminadmin").Return(user, nil)
+	twoFactorSt.EXPECT().Get(gomock.Any(), user.ID).Return(tf, nil)
+	twoFactorSt.EXPECT().CreateChallenge(gomock.Any(), user.ID).Return("challenge", nil)
+	userService.Login(w, r)
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if string(body) != `{"twoFactorRequired":true,"challenge":"challenge"}` {
+		t.Errorf("unexpected body: %s", body)
+		return
+	}
+
+	//Users without 2FA log in with the password
+	r = httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"username":"admin","password":"adminadmin"}`))
+	w = httptest.NewRecorder()
+	lockoutSt.EXPECT().Check(gomock.Any(), "admin", ip).Return(time.Duration(0), nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "adminadmin").Return(user, nil)
+	twoFactorSt.EXPECT().Get(gomock.Any(), user.ID).Return(&items.TwoFactor{Secret: secret}, nil)
+	lockoutSt.EXPECT().Reset(gomock.Any(), "admin").Return(nil)
+	managerSt.EXPECT().Create(gomock.Any(), gomock.Any(), user.ID).Return(&session.Session{UserID: user.ID}, nil)
+	userService.Login(w, r)
+	resp = w.Result()
+	body, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || !strings.Contains(string(body), `"token"`) {
+		t.Errorf("expected a token, got %d: %s", resp.StatusCode, body)
+		return
+	}
+
+	//Right code
+	code, _ := totp.Code(secret, time.Now())
+	r = httptest.NewRequest("POST", "/api/login/2fa", strings.NewReader(`{"challenge":"challenge","code":"`+code+`"}`))
+	w = httptest.NewRecorder()
+	twoFactorSt.EXPECT().CheckChallenge(gomock.Any(), "challenge").Return(user.ID, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	twoFactorSt.EXPECT().Get(gomock.Any(), user.ID).Return(tf, nil)
+	lockoutSt.EXPECT().Check(gomock.Any(), "admin", ip).Return(time.Duration(0), nil)
+	twoFactorSt.EXPECT().UseStep(gomock.Any(), user.ID, gomock.Any()).Return(true, nil)
+	twoFactorSt.EXPECT().ConsumeChallenge(gomock.Any(), "challenge").Return(nil)
+	lockoutSt.EXPECT().Reset(gomock.Any(), "admin").Return(nil)
+	managerSt.EXPECT().Create(gomock.Any(), gomock.Any(), user.ID).Return(&session.Session{UserID: user.ID}, nil)
+	userService.LoginTwoFactor(w, r)
+	resp = w.Result()
+	body, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || !strings.Contains(string(body), `"token"`) {
+		t.Errorf("expected a token, got %d: %s", resp.StatusCode, body)
+		return
+	}
+
+	//Recovery code
+	r = httptest.NewRequest("POST", "/api/login/2fa", strings.NewReader(`{"challenge":"challenge","code":"abcde-fghij"}`))
+	w = httptest.NewRecorder()
+	twoFactorSt.EXPECT().CheckChallenge(gomock.Any(), "challenge").Return(user.ID, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	twoFactorSt.EXPECT().Get(gomock.Any(), user.ID).Return(tf, nil)
+	lockoutSt.EXPECT().Check(gomock.Any(), "admin", ip).Return(time.Duration(0), nil)
+	twoFactorSt.EXPECT().UseRecoveryCode(gomock.Any(), user.ID, "abcde-fghij").Return(true, nil)
+	twoFactorSt.EXPECT().ConsumeChallenge(gomock.Any(), "challenge").Return(nil)
+	lockoutSt.EXPECT().Reset(gomock.Any(), "admin").Return(nil)
+	managerSt.EXPECT().Create(gomock.Any(), gomock.Any(), user.ID).Return(&session.Session{UserID: user.ID}, nil)
+	userService.LoginTwoFactor(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//Wrong code counts as a failed login
+	r = httptest.NewRequest("POST", "/api/login/2fa", strings.NewReader(`{"challenge":"challenge","code":"abcde-fghij"}`))
+	w = httptest.NewRecorder()
+	twoFactorSt.EXPECT().CheckChallenge(gomock.Any(), "challenge").Return(user.ID, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	twoFactorSt.EXPECT().Get(gomock.Any(), user.ID).Return(tf, nil)
+	lockoutSt.EXPECT().Check(gomock.Any(), "admin", ip).Return(time.Duration(0), nil)
+	twoFactorSt.EXPECT().UseRecoveryCode(gomock.Any(), user.ID, "abcde-fghij").Return(false, nil)
+	twoFactorSt.EXPECT().FailChallenge(gomock.Any(), "challenge").Return(nil)
+	lockoutSt.EXPECT().Fail(gomock.Any(), "admin", ip).Return(nil)
+	userService.LoginTwoFactor(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 401 {
+		t.Errorf("expected code 401, got %d", resp.StatusCode)
+		return
+	}
+
+	//Locked
+	r = httptest.NewRequest("POST", "/api/login/2fa", strings.NewReader(`{"challenge":"challenge","code":"123456"}`))
+	w = httptest.NewRecorder()
+	twoFactorSt.EXPECT().CheckChallenge(gomock.Any(), "challenge").Return(user.ID, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	twoFactorSt.EXPECT().Get(gomock.Any(), user.ID).Return(tf, nil)
+	lockoutSt.EXPECT().Check(gomock.Any(), "admin", ip).Return(time.Minute, nil)
+	userService.LoginTwoFactor(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 429 {
+		t.Errorf("expected code 429, got %d", resp.StatusCode)
+		return
+	}
+
+	//Expired challenge
+	r = httptest.NewRequest("POST", "/api/login/2fa", strings.NewReader(`{"challenge":"old","code":"123456"}`))
+	w = httptest.NewRecorder()
+	twoFactorSt.EXPECT().CheckChallenge(gomock.Any(), "old").Return(0, items.ErrBadChallenge)
+	userService.LoginTwoFactor(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 401 {
+		t.Errorf("expected code 401, got %d", resp.StatusCode)
+		return
+	}
+
+	//DB error
+	r = httptest.NewRequest("POST", "/api/login/2fa", strings.NewReader(`{"challenge":"challenge","code":"123456"}`))
+	w = httptest.NewRecorder()
+	twoFactorSt.EXPECT().CheckChallenge(gomock.Any(), "challenge").Return(0, ErrDB)
+	userService.LoginTwoFactor(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+
+	//No body
+	r = httptest.NewRequest("POST", "/api/login/2fa", nil)
+	w = httptest.NewRecorder()
+	userService.LoginTwoFactor(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestTwoFactorHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	userSt := NewMockUserRepositoryInterface(ctrl)
+	managerSt := session.NewMockSessionManagerInterface(ctrl)
+	twoFactorSt := NewMockTwoFactorRepositoryInterface(ctrl)
+	service := &TwoFactorHandler{
+		UserRepo:  userSt,
+		TwoFactor: twoFactorSt,
+		Sessions:  managerSt,
+		Issuer:    "Asperitas",
+		Logger:    zap.NewNop().Sugar(),
+	}
+	user := &items.User{ID: 1, Username: "admin"}
+	sess := &session.Session{ID: "1", UserID: user.ID}
+
+	//Begin enrollment
+	r := httptest.NewRequest("POST", "/api/user/me/2fa", strings.NewReader(`{"password":"adminadmin"}`))
+	w := httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "adminadmin").Return(user, nil)
+	var secret string
+	twoFactorSt.EXPECT().Begin(gomock.Any(), user.ID, gomock.Any()).DoAndReturn(func(ctx context.Context, userID int, s string) error {
+		secret = s
+		return nil
+	})
+	service.BeginTwoFactor(w, r)
+	resp := w.Result()
+	enrollment := twoFactorEnrollment{}
+	json.NewDecoder(resp.Body).Decode(&enrollment)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if enrollment.Secret != secret || !strings.HasPrefix(enrollment.URI, "otpauth://totp/Asperitas:admin?") {
+		t.Errorf("unexpected enrollment: %v", enrollment)
+		return
+	}
+
+	//Enabled already
+	r = httptest.NewRequest("POST", "/api/user/me/2fa", strings.NewReader(`{"password":"adminadmin"}`))
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "adminadmin").Return(user, nil)
+	twoFactorSt.EXPECT().Begin(gomock.Any(), user.ID, gomock.Any()).Return(items.ErrTwoFactorEnabled)
+	service.BeginTwoFactor(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 409 {
+		t.Errorf("expected code 409, got %d", resp.StatusCode)
+		return
+	}
+
+	//Wrong code doesn't enable
+	r = httptest.NewRequest("POST", "/api/user/me/2fa/enable", strings.NewReader(`{"code":"abcdef"}`))
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	twoFactorSt.EXPECT().Get(gomock.Any(), user.ID).Return(&items.TwoFactor{Secret: secret}, nil)
+	service.EnableTwoFactor(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	}
+
+	//Right code enables and ends other sessions
+	code, _ := totp.Code(secret, time.Now())
+	r = httptest.NewRequest("POST", "/api/user/me/2fa/enable", strings.NewReader(`{"code":"`+code+`"}`))
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	twoFactorSt.EXPECT().Get(gomock.Any(), user.ID).Return(&items.TwoFactor{Secret: secret}, nil)
+	twoFactorSt.EXPECT().UseStep(gomock.Any(), user.ID, gomock.Any()).Return(true, nil)
+	var stored []string
+	twoFactorSt.EXPECT().Enable(gomock.Any(), user.ID, gomock.Any()).DoAndReturn(func(ctx context.Context, userID int, codes []string) error {
+		stored = codes
+		return nil
+	})
+	managerSt.EXPECT().DestroyOthers(gomock.Any(), user.ID, "1").Return(nil)
+	service.EnableTwoFactor(w, r)
+	resp = w.Result()
+	codes := recoveryCodes{}
+	json.NewDecoder(resp.Body).Decode(&codes)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	} else if len(codes.RecoveryCodes) != totp.RecoveryCodes || fmt.Sprint(codes.RecoveryCodes) != fmt.Sprint(stored) {
+		t.Errorf("unexpected recovery codes: %v", codes.RecoveryCodes)
+		return
+	}
+
+	//Status
+	r = httptest.NewRequest("GET", "/api/user/me/2fa", nil)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	twoFactorSt.EXPECT().Get(gomock.Any(), user.ID).Return(&items.TwoFactor{Secret: secret, Enabled: true, RecoveryCodes: 9}, nil)
+	service.GetTwoFactor(w, r)
+	resp = w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != `{"enabled":true,"recoveryCodes":9}` {
+		t.Errorf("unexpected body: %s", body)
+		return
+	}
+
+	//Disable needs a code too
+	r = httptest.NewRequest("DELETE", "/api/user/me/2fa", strings.NewReader(`{"password":"adminadmin","code":"abcde-fghij"}`))
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "adminadmin").Return(user, nil)
+	twoFactorSt.EXPECT().Get(gomock.Any(), user.ID).Return(&items.TwoFactor{Secret: secret, Enabled: true}, nil)
+	twoFactorSt.EXPECT().UseRecoveryCode(gomock.Any(), user.ID, "abcde-fghij").Return(false, nil)
+	service.DisableTwoFactor(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected code 422, got %d", resp.StatusCode)
+		return
+	}
+
+	//Disable
+	r = httptest.NewRequest("DELETE", "/api/user/me/2fa", strings.NewReader(`{"password":"adminadmin","code":"abcde-fghij"}`))
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "adminadmin").Return(user, nil)
+	twoFactorSt.EXPECT().Get(gomock.Any(), user.ID).Return(&items.TwoFactor{Secret: secret, Enabled: true}, nil)
+	twoFactorSt.EXPECT().UseRecoveryCode(gomock.Any(), user.ID, "abcde-fghij").Return(true, nil)
+	twoFactorSt.EXPECT().Disable(gomock.Any(), user.ID).Return(nil)
+	service.DisableTwoFactor(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+
+	//DB error
+	r = httptest.NewRequest("GET", "/api/user/me/2fa", nil)
+	w = httptest.NewRecorder()
+	managerSt.EXPECT().Check(r).Return(sess, nil)
+	userSt.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(user, nil)
+	twoFactorSt.EXPECT().Get(gomock.Any(), user.ID).Return(nil, ErrDB)
+	service.GetTwoFactor(w, r)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected code 500, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestInstrumentedRepoLogs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	userSt := NewMockUserRepositoryInterface(ctrl)
+	repo := InstrumentedUserRepo{Repo: userSt}
+	core, logs := observer.New(zap.InfoLevel)
+	ctx := logging.WithLogger(context.Background(), zap.New(core).Sugar().With("request_id", "abc"))
+
+	//Failed call is logged with the request
+	userSt.EXPECT().GetUserByID(gomock.Any(), 1).Return(nil, ErrDB)
+	repo.GetUserByID(ctx, 1)
+	if logs.Len() != 1 {
+		t.Errorf("expected 1 log entry, got %d", logs.Len())
+		return
+	}
+	fields := logs.All()[0].ContextMap()
+	if fields["request_id"] != "abc" || fields["repo"] != "user" || fields["method"] != "GetUserByID" {
+		t.Errorf("unexpected fields %v", fields)
+		return
+	}
+
+	//Wrong password is no error of the repository
+	userSt.EXPECT().Authorize(gomock.Any(), "admin", "wrong").Return(nil, items.ErrBadPass)
+	repo.Authorize(ctx, "admin", "wrong")
+	if logs.Len() != 1 {
+		t.Errorf("expected no new log entry, got %d", logs.Len())
+		return
+	}
+}
@@ -6,6 +6,7 @@ package handlers
 
 import (
 	items "asperitas-clone/pkg/items"
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -35,61 +36,118 @@ func (m *MockUserRepositoryInterface) EXPECT() *MockUserRepositoryInterfaceMockR
 }
 
 // AddUser mocks base method.
-func (m *MockUserRepositoryInterface) AddUser(arg0 *items.User) (int, error) {
+func (m *MockUserRepositoryInterface) AddUser(arg0 context.Context, arg1 *items.User) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddUser", arg0)
+	ret := m.ctrl.Call(m, "AddUser", arg0, arg1)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AddUser indicates an expected call of AddUser.
-func (mr *MockUserRepositoryInterfaceMockRecorder) AddUser(arg0 interface{}) *gomock.Call {
+func (mr *MockUserRepositoryInterfaceMockRecorder) AddUser(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUser", reflect.TypeOf((*MockUserRepositoryInterface)(nil).AddUser), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUser", reflect.TypeOf((*MockUserRepositoryInterface)(nil).AddUser), arg0, arg1)
 }
 
 // Authorize mocks base method.
-func (m *MockUserRepositoryInterface) Authorize(arg0, arg1 string) (*items.User, error) {
+func (m *MockUserRepositoryInterface) Authorize(arg0 context.Context, arg1, arg2 string) (*items.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Authorize", arg0, arg1)
+	ret := m.ctrl.Call(m, "Authorize", arg0, arg1, arg2)
 	ret0, _ := ret[0].(*items.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Authorize indicates an expected call of Authorize.
-func (mr *MockUserRepositoryInterfaceMockRecorder) Authorize(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockUserRepositoryInterfaceMockRecorder) Authorize(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Authorize", reflect.TypeOf((*MockUserRepositoryInterface)(nil).Authorize), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Authorize", reflect.TypeOf((*MockUserRepositoryInterface)(nil).Authorize), arg0, arg1, arg2)
+}
+
+// ChangePassword mocks base method.
+func (m *MockUserRepositoryInterface) ChangePassword(arg0 context.Context, arg1 int, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangePassword", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangePassword indicates an expected call of ChangePassword.
+func (mr *MockUserRepositoryInterfaceMockRecorder) ChangePassword(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangePassword", reflect.TypeOf((*MockUserRepositoryInterface)(nil).ChangePassword), arg0, arg1, arg2)
+}
+
+// ChangeUsername mocks base method.
+func (m *MockUserRepositoryInterface) ChangeUsername(arg0 context.Context, arg1 int, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangeUsername", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangeUsername indicates an expected call of ChangeUsername.
+func (mr *MockUserRepositoryInterfaceMockRecorder) ChangeUsername(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeUsername", reflect.TypeOf((*MockUserRepositoryInterface)(nil).ChangeUsername), arg0, arg1, arg2)
+}
+
+// DeleteUser mocks base method.
+func (m *MockUserRepositoryInterface) DeleteUser(arg0 context.Context, arg1 int, arg2 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockUserRepositoryInterfaceMockRecorder) DeleteUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockUserRepositoryInterface)(nil).DeleteUser), arg0, arg1, arg2)
+}
+
+// GetUserByEmail mocks base method.
+func (m *MockUserRepositoryInterface) GetUserByEmail(arg0 context.Context, arg1 string) (*items.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByEmail", arg0, arg1)
+	ret0, _ := ret[0].(*items.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByEmail indicates an expected call of GetUserByEmail.
+func (mr *MockUserRepositoryInterfaceMockRecorder) GetUserByEmail(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockUserRepositoryInterface)(nil).GetUserByEmail), arg0, arg1)
 }
 
 // GetUserByID mocks base method.
-func (m *MockUserRepositoryInterface) GetUserByID(arg0 int) (*items.User, error) {
+func (m *MockUserRepositoryInterface) GetUserByID(arg0 context.Context, arg1 int) (*items.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserByID", arg0)
+	ret := m.ctrl.Call(m, "GetUserByID", arg0, arg1)
 	ret0, _ := ret[0].(*items.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUserByID indicates an expected call of GetUserByID.
-func (mr *MockUserRepositoryInterfaceMockRecorder) GetUserByID(arg0 interface{}) *gomock.Call {
+func (mr *MockUserRepositoryInterfaceMockRecorder) GetUserByID(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockUserRepositoryInterface)(nil).GetUserByID), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockUserRepositoryInterface)(nil).GetUserByID), arg0, arg1)
 }
 
 // GetUserByUsername mocks base method.
-func (m *MockUserRepositoryInterface) GetUserByUsername(arg0 string) (*items.User, error) {
+func (m *MockUserRepositoryInterface) GetUserByUsername(arg0 context.Context, arg1 string) (*items.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserByUsername", arg0)
+	ret := m.ctrl.Call(m, "GetUserByUsername", arg0, arg1)
 	ret0, _ := ret[0].(*items.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUserByUsername indicates an expected call of GetUserByUsername.
-func (mr *MockUserRepositoryInterfaceMockRecorder) GetUserByUsername(arg0 interface{}) *gomock.Call {
+func (mr *MockUserRepositoryInterfaceMockRecorder) GetUserByUsername(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByUsername", reflect.TypeOf((*MockUserRepositoryInterface)(nil).GetUserByUsername), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByUsername", reflect.TypeOf((*MockUserRepositoryInterface)(nil).GetUserByUsername), arg0, arg1)
 }
@@ -0,0 +1,57 @@
+package identity_repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"asperitas-clone/pkg/items"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// errDuplicateKey is returned by MySQL when a unique key is violated.
+const errDuplicateKey = 1062
+
+// IdentityRepo links users to their accounts at identity providers.
+type IdentityRepo struct {
+	IdentityDB *sql.DB
+}
+
+// GetUserID returns the user linked to the subject of the provider, 0 if
+// there is none.
+func (repo *IdentityRepo) GetUserID(ctx context.Context, provider, subject string) (int, error) {
+	var userID int
+	row := repo.IdentityDB.QueryRowContext(
+		ctx,
+		"SELECT userid FROM identities WHERE provider = ? AND subject = ?",
+		provider,
+		subject,
+	)
+	err := row.Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// Link returns items.ErrIdentityLinked if the subject belongs to a user
+// already.
+func (repo *IdentityRepo) Link(ctx context.Context, provider, subject string, userID int) error {
+	_, err := repo.IdentityDB.ExecContext(
+		ctx,
+		"INSERT INTO `identities` (`provider`, `subject`, `userid`, `created`) VALUES (?, ?, ?, ?)",
+		provider,
+		subject,
+		userID,
+		time.Now().UTC(),
+	)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateKey {
+		return items.ErrIdentityLinked
+	}
+	return err
+}
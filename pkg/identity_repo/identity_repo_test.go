@@ -0,0 +1,110 @@
+package identity_repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"asperitas-clone/pkg/items"
+
+	"github.com/go-sql-driver/mysql"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var (
+	ErrDB = errors.New("DB_ERROR")
+)
+
+func TestGetUserID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &IdentityRepo{IdentityDB: db}
+
+	// Good query
+	mock.
+		ExpectQuery("SELECT userid FROM identities WHERE").
+		WithArgs("corp", "42").
+		WillReturnRows(sqlmock.NewRows([]string{"userid"}).AddRow(7))
+	userID, err := repo.GetUserID(context.Background(), "corp", "42")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	} else if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+	if userID != 7 {
+		t.Errorf("expected user 7, got %d", userID)
+		return
+	}
+
+	// Unknown identity
+	mock.
+		ExpectQuery("SELECT userid FROM identities WHERE").
+		WithArgs("corp", "43").
+		WillReturnRows(sqlmock.NewRows([]string{"userid"}))
+	userID, err = repo.GetUserID(context.Background(), "corp", "43")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if userID != 0 {
+		t.Errorf("expected no user, got %d", userID)
+		return
+	}
+
+	// DB error
+	mock.
+		ExpectQuery("SELECT userid FROM identities WHERE").
+		WithArgs("corp", "42").
+		WillReturnError(ErrDB)
+	if _, err := repo.GetUserID(context.Background(), "corp", "42"); err != ErrDB {
+		t.Errorf("expected ErrDB, got %v", err)
+		return
+	}
+}
+
+func TestLink(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &IdentityRepo{IdentityDB: db}
+
+	// Good query
+	mock.
+		ExpectExec("INSERT INTO `identities`").
+		WithArgs("corp", "42", 7, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.Link(context.Background(), "corp", "42", 7); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	} else if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+
+	// Linked already
+	mock.
+		ExpectExec("INSERT INTO `identities`").
+		WithArgs("corp", "42", 8, sqlmock.AnyArg()).
+		WillReturnError(&mysql.MySQLError{Number: errDuplicateKey, Message: "Duplicate entry 'corp-42' for key 'PRIMARY'"})
+	if err := repo.Link(context.Background(), "corp", "42", 8); err != items.ErrIdentityLinked {
+		t.Errorf("expected ErrIdentityLinked, got %v", err)
+		return
+	}
+
+	// DB error
+	mock.
+		ExpectExec("INSERT INTO `identities`").
+		WithArgs("corp", "42", 7, sqlmock.AnyArg()).
+		WillReturnError(ErrDB)
+	if err := repo.Link(context.Background(), "corp", "42", 7); err != ErrDB {
+		t.Errorf("expected ErrDB, got %v", err)
+		return
+	}
+}
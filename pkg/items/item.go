@@ -4,23 +4,24 @@ import (
 	"errors"
 	"time"
 
-	"gopkg.in/mgo.v2/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Post struct {
-	ID               bson.ObjectId `json:"id"`
-	Author           *User         `json:"author"`
-	Category         string        `json:"category"`
-	Comments         []*Comment    `json:"comments"`
-	Created          time.Time     `json:"created"`
-	Score            int           `json:"score"`
-	Title            string        `json:"title"`
-	Type             string        `json:"type"`
-	Text             string        `json:"text,omitempty"`
-	URL              string        `json:"url,omitempty"`
-	UpvotePercentage int           `json:"upvotePercentage"`
-	Views            int           `json:"views"`
-	Votes            []Vote        `json:"votes"`
+	ID               primitive.ObjectID `json:"id"`
+	Author           *User              `json:"author"`
+	Category         string             `json:"category"`
+	Comments         []*Comment         `json:"comments"`
+	Created          time.Time          `json:"created"`
+	Score            int                `json:"score"`
+	Title            string             `json:"title"`
+	Type             string             `json:"type"`
+	Text             string             `json:"text,omitempty"`
+	URL              string             `json:"url,omitempty"`
+	UpvotePercentage int                `json:"upvotePercentage"`
+	Views            int                `json:"views"`
+	Votes            []Vote             `json:"votes"`
+	Saved            bool               `json:"saved,omitempty" bson:"-"`
 }
 
 type Vote struct {
@@ -29,24 +30,103 @@ type Vote struct {
 }
 
 type Comment struct {
-	ID      bson.ObjectId `json:"id"`
-	Created time.Time     `json:"created"`
-	Author  *User         `json:"author"`
-	Body    string        `json:"body"`
+	ID      primitive.ObjectID `json:"id"`
+	Created time.Time          `json:"created"`
+	Author  *User              `json:"author"`
+	Body    string             `json:"body"`
+	Score   int                `json:"score"`
+	Votes   []Vote             `json:"votes"`
+}
+
+// UserComment is a comment together with the post it belongs to, as shown
+// in a user's comment history.
+type UserComment struct {
+	ID        primitive.ObjectID `json:"id"`
+	Created   time.Time          `json:"created"`
+	Body      string             `json:"body"`
+	PostID    primitive.ObjectID `json:"postId"`
+	PostTitle string             `json:"postTitle"`
+}
+
+const (
+	NotificationComment = "comment"
+)
+
+// Notification tells a user that Author did something with their content.
+type Notification struct {
+	ID        int                `json:"id"`
+	Type      string             `json:"type"`
+	PostID    primitive.ObjectID `json:"postId"`
+	PostTitle string             `json:"postTitle"`
+	CommentID primitive.ObjectID `json:"commentId"`
+	Author    *User              `json:"author"`
+	Body      string             `json:"body"`
+	Created   time.Time          `json:"created"`
+	Read      bool               `json:"read"`
 }
 
 type User struct {
 	Username string `json:"username"`
 	ID       int    `json:"id"`
 	Password string `json:"-"`
+	// Email is optional and never copied into posts.
+	Email         string `json:"-" bson:"-"`
+	EmailVerified bool   `json:"-" bson:"-"`
+}
+
+// TwoFactor is the TOTP setup of a user.
+type TwoFactor struct {
+	Secret  string
+	Enabled bool
+	// RecoveryCodes is how many unused recovery codes are left.
+	RecoveryCodes int
 }
 
+// DeletedUsername stands in for the author of content whose account is gone.
+const DeletedUsername = "[deleted]"
+
+func DeletedUser() *User {
+	return &User{Username: DeletedUsername}
+}
+
+type Profile struct {
+	ID         int        `json:"id"`
+	Username   string     `json:"username"`
+	Registered *time.Time `json:"registered,omitempty"`
+	Bio        string     `json:"bio"`
+	AvatarURL  string     `json:"avatarUrl"`
+	ProfileStats
+}
+
+// ProfileStats holds the counters kept incrementally for every user. Post
+// karma is the sum of votes the user's posts have received, comment karma the
+// same for their comments, deleted ones included in both.
+type ProfileStats struct {
+	PostKarma    int `json:"postKarma"`
+	CommentKarma int `json:"commentKarma"`
+	Posts        int `json:"posts"`
+	Comments     int `json:"comments"`
+}
+
+// Categories are the post categories known to the frontend.
+var Categories = []string{"music", "funny", "videos", "programming", "news", "fashion"}
+
 var (
-	ErrNoUser            = errors.New("No user found")
-	ErrBadPass           = errors.New("Invalid password")
-	ErrUserAlreadyExists = errors.New("Username already exists")
-	ErrPermissionDenied  = errors.New("Permission denied")
-	ErrCommentNotFound   = errors.New("Comment is not found")
+	ErrNoUser               = errors.New("No user found")
+	ErrBadPass              = errors.New("Invalid password")
+	ErrUserAlreadyExists    = errors.New("Username already exists")
+	ErrUsernameReserved     = errors.New("Username is reserved")
+	ErrBadUsername          = errors.New("Username has invalid characters")
+	ErrEmailTaken           = errors.New("Email is already used")
+	ErrBadEmail             = errors.New("Email is not a valid address")
+	ErrBadResetToken        = errors.New("Reset token is invalid or expired")
+	ErrIdentityLinked       = errors.New("Identity is linked to another user")
+	ErrTwoFactorEnabled     = errors.New("Two-factor authentication is enabled already")
+	ErrBadChallenge         = errors.New("Login challenge is invalid or expired")
+	ErrPermissionDenied     = errors.New("Permission denied")
+	ErrPostNotFound         = errors.New("Post is not found")
+	ErrCommentNotFound      = errors.New("Comment is not found")
+	ErrNotificationNotFound = errors.New("Notification is not found")
 )
 
 type MessageAuthError struct {
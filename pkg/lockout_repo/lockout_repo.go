@@ -0,0 +1,172 @@
+package lockout_repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"asperitas-clone/pkg/user_repo"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+const (
+	DefaultUserThreshold = 5
+	DefaultIPThreshold   = 20
+	DefaultBaseLock      = time.Minute
+	DefaultMaxLock       = time.Hour
+	DefaultWindow        = 24 * time.Hour
+	maxKeyLength         = 255
+)
+
+// LockoutRepo counts failed logins per username and per client address.
+// Once a counter reaches its threshold the key is locked, and every further
+// failure doubles the lock time up to MaxLock. Counters are forgotten after
+// Window without failures.
+type LockoutRepo struct {
+	LockoutDB     *sql.DB
+	UserThreshold int
+	IPThreshold   int
+	BaseLock      time.Duration
+	MaxLock       time.Duration
+	Window        time.Duration
+}
+
+// userKey counts a user under the normalized username, whatever case the
+// attempts were typed in.
+func userKey(username string) string {
+	if normalized, err := user_repo.NormalizeUsername(username); err == nil {
+		username = normalized
+	}
+	key := []rune("user:" + username)
+	if len(key) > maxKeyLength {
+		key = key[:maxKeyLength]
+	}
+	return string(key)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns how long logins of the username or from the address are
+// still locked, zero if they are not.
+func (repo *LockoutRepo) Check(ctx context.Context, username, ip string) (time.Duration, error) {
+	var lockedUntil sql.NullTime
+	row := repo.LockoutDB.QueryRowContext(
+		ctx,
+		"SELECT MAX(locked_until) FROM login_failures WHERE `key` IN (?, ?)",
+		userKey(username),
+		ipKey(ip),
+	)
+	err := row.Scan(&lockedUntil)
+	if err != nil {
+		return 0, err
+	}
+	if !lockedUntil.Valid {
+		return 0, nil
+	}
+	wait := time.Until(lockedUntil.Time)
+	if wait < 0 {
+		return 0, nil
+	}
+	return wait, nil
+}
+
+func (repo *LockoutRepo) Fail(ctx context.Context, username, ip string) error {
+	now := time.Now().UTC()
+	err := repo.fail(ctx, userKey(username), orDefault(repo.UserThreshold, DefaultUserThreshold), now)
+	if err != nil {
+		return err
+	}
+	return repo.fail(ctx, ipKey(ip), orDefault(repo.IPThreshold, DefaultIPThreshold), now)
+}
+
+func (repo *LockoutRepo) fail(ctx context.Context, key string, threshold int, now time.Time) error {
+	tx, err := repo.LockoutDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var failures int
+	var lastFailure time.Time
+	row := tx.QueryRowContext(ctx, "SELECT failures, last_failure FROM login_failures WHERE `key` = ? FOR UPDATE", key)
+	err = row.Scan(&failures, &lastFailure)
+	if errors.Is(err, sql.ErrNoRows) {
+		failures = 0
+	} else if err != nil {
+		tx.Rollback()
+		return err
+	} else if now.Sub(lastFailure) > repo.window() {
+		failures = 0
+	}
+	failures++
+
+	var lockedUntil sql.NullTime
+	if failures >= threshold {
+		lockedUntil = sql.NullTime{Time: now.Add(repo.lockFor(failures - threshold)), Valid: true}
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO `login_failures` (`key`, `failures`, `last_failure`, `locked_until`) VALUES (?, ?, ?, ?) "+
+			"ON DUPLICATE KEY UPDATE `failures` = VALUES(`failures`), `last_failure` = VALUES(`last_failure`), "+
+			"`locked_until` = VALUES(`locked_until`)",
+		key,
+		failures,
+		now,
+		lockedUntil,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Reset forgets failed logins of the username. It is called after a
+// successful login and to unlock an account by hand. Counters of addresses
+// are left alone, so one valid account can't be used to keep guessing
+// others from the same address.
+func (repo *LockoutRepo) Reset(ctx context.Context, username string) error {
+	_, err := repo.LockoutDB.ExecContext(ctx, "DELETE FROM `login_failures` WHERE `key` = ?", userKey(username))
+	return err
+}
+
+// ResetIP unlocks logins from the address.
+func (repo *LockoutRepo) ResetIP(ctx context.Context, ip string) error {
+	_, err := repo.LockoutDB.ExecContext(ctx, "DELETE FROM `login_failures` WHERE `key` = ?", ipKey(ip))
+	return err
+}
+
+func (repo *LockoutRepo) lockFor(extraFailures int) time.Duration {
+	base := repo.BaseLock
+	if base <= 0 {
+		base = DefaultBaseLock
+	}
+	max := repo.MaxLock
+	if max <= 0 {
+		max = DefaultMaxLock
+	}
+	lock := base
+	for i := 0; i < extraFailures && lock < max; i++ {
+		lock *= 2
+	}
+	if lock > max {
+		lock = max
+	}
+	return lock
+}
+
+func (repo *LockoutRepo) window() time.Duration {
+	if repo.Window <= 0 {
+		return DefaultWindow
+	}
+	return repo.Window
+}
+
+func orDefault(value, def int) int {
+	if value <= 0 {
+		return def
+	}
+	return value
+}
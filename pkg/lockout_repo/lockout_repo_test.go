@@ -0,0 +1,238 @@
+package lockout_repo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var (
+	ErrDB = errors.New("DB_ERROR")
+)
+
+func TestCheck(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &LockoutRepo{LockoutDB: db}
+
+	// Locked
+	mock.
+		ExpectQuery("SELECT MAX\\(locked_until\\) FROM login_failures").
+		WithArgs("user:admin", "ip:10.0.0.1").
+		WillReturnRows(sqlmock.NewRows([]string{"locked_until"}).AddRow(time.Now().Add(time.Minute)))
+	wait, err := repo.Check(context.Background(), "admin", "10.0.0.1")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if wait <= 0 || wait > time.Minute {
+		t.Errorf("expected wait up to a minute, got %v", wait)
+		return
+	}
+
+	// Not locked
+	mock.
+		ExpectQuery("SELECT MAX\\(locked_until\\) FROM login_failures").
+		WithArgs("user:admin", "ip:10.0.0.1").
+		WillReturnRows(sqlmock.NewRows([]string{"locked_until"}).AddRow(nil))
+	wait, err = repo.Check(context.Background(), "admin", "10.0.0.1")
+	if err != nil || wait != 0 {
+		t.Errorf("expected no lock, got %v %v", wait, err)
+		return
+	}
+
+	// Lock expired
+	mock.
+		ExpectQuery("SELECT MAX\\(locked_until\\) FROM login_failures").
+		WithArgs("user:admin", "ip:10.0.0.1").
+		WillReturnRows(sqlmock.NewRows([]string{"locked_until"}).AddRow(time.Now().Add(-time.Minute)))
+	wait, err = repo.Check(context.Background(), "admin", "10.0.0.1")
+	if err != nil || wait != 0 {
+		t.Errorf("expected no lock, got %v %v", wait, err)
+		return
+	}
+
+	// DB error
+	mock.
+		ExpectQuery("SELECT MAX\\(locked_until\\) FROM login_failures").
+		WithArgs("user:admin", "ip:10.0.0.1").
+		WillReturnError(ErrDB)
+	_, err = repo.Check(context.Background(), "admin", "10.0.0.1")
+	if err == nil {
+		t.Errorf("expected error, got nil")
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+type lockedFor struct {
+	lock time.Duration
+}
+
+// Match checks that the lock ends lock after now, give or take a second.
+func (l lockedFor) Match(v driver.Value) bool {
+	if l.lock == 0 {
+		return v == nil
+	}
+	lockedUntil, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+	diff := time.Until(lockedUntil) - l.lock
+	return diff < time.Second && diff > -time.Second
+}
+
+func TestFail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &LockoutRepo{LockoutDB: db, UserThreshold: 3, IPThreshold: 10}
+	columns := []string{"failures", "last_failure"}
+
+	// Third failure of the user locks it, first failure of the address doesn't
+	mock.ExpectBegin()
+	mock.
+		ExpectQuery("SELECT failures, last_failure FROM login_failures").
+		WithArgs("user:admin").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(2, time.Now().Add(-time.Minute)))
+	mock.
+		ExpectExec("INSERT INTO `login_failures`").
+		WithArgs("user:admin", 3, sqlmock.AnyArg(), lockedFor{time.Minute}).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.
+		ExpectQuery("SELECT failures, last_failure FROM login_failures").
+		WithArgs("ip:10.0.0.1").
+		WillReturnError(sql.ErrNoRows)
+	mock.
+		ExpectExec("INSERT INTO `login_failures`").
+		WithArgs("ip:10.0.0.1", 1, sqlmock.AnyArg(), lockedFor{0}).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	err = repo.Fail(context.Background(), "admin", "10.0.0.1")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+
+	// Every further failure doubles the lock
+	mock.ExpectBegin()
+	mock.
+		ExpectQuery("SELECT failures, last_failure FROM login_failures").
+		WithArgs("user:admin").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(4, time.Now().Add(-time.Minute)))
+	mock.
+		ExpectExec("INSERT INTO `login_failures`").
+		WithArgs("user:admin", 5, sqlmock.AnyArg(), lockedFor{4 * time.Minute}).
+		WillReturnError(ErrDB)
+	mock.ExpectRollback()
+	err = repo.Fail(context.Background(), "admin", "10.0.0.1")
+	if err == nil {
+		t.Errorf("expected error, got nil")
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+
+	// Old failures are forgotten
+	mock.ExpectBegin()
+	mock.
+		ExpectQuery("SELECT failures, last_failure FROM login_failures").
+		WithArgs("user:admin").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(4, time.Now().Add(-48*time.Hour)))
+	mock.
+		ExpectExec("INSERT INTO `login_failures`").
+		WithArgs("user:admin", 1, sqlmock.AnyArg(), lockedFor{0}).
+		WillReturnError(ErrDB)
+	mock.ExpectRollback()
+	err = repo.Fail(context.Background(), "admin", "10.0.0.1")
+	if err == nil {
+		t.Errorf("expected error, got nil")
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestLockFor(t *testing.T) {
+	repo := &LockoutRepo{}
+	if lock := repo.lockFor(0); lock != time.Minute {
+		t.Errorf("expected 1m, got %v", lock)
+		return
+	}
+	if lock := repo.lockFor(3); lock != 8*time.Minute {
+		t.Errorf("expected 8m, got %v", lock)
+		return
+	}
+	if lock := repo.lockFor(100); lock != time.Hour {
+		t.Errorf("expected 1h, got %v", lock)
+		return
+	}
+}
+
+func TestReset(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &LockoutRepo{LockoutDB: db}
+
+	mock.
+		ExpectExec("DELETE FROM `login_failures`").
+		WithArgs("user:admin").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectExec("DELETE FROM `login_failures`").
+		WithArgs("ip:10.0.0.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.Reset(context.Background(), "admin"); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if err := repo.ResetIP(context.Background(), "10.0.0.1"); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestUserKey(t *testing.T) {
+	for _, username := range []string{"admin", "Admin", "ADMIN", "ａｄｍｉｎ"} {
+		if key := userKey(username); key != "user:admin" {
+			t.Errorf("expected user:admin for %q, got %q", username, key)
+			return
+		}
+	}
+	// names that don't normalize are kept as they are
+	if key := userKey("a b"); key != "user:a b" {
+		t.Errorf("expected %q, got %q", "user:a b", key)
+		return
+	}
+}
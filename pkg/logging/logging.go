@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+type ctxKey int
+
+const (
+	loggerKey ctxKey = iota
+	requestIDKey
+	userKey
+)
+
+// WithLogger returns a context carrying a logger for the current request.
+func WithLogger(ctx context.Context, logger *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the request logger, or fallback when ctx has none.
+func FromContext(ctx context.Context, fallback *zap.SugaredLogger) *zap.SugaredLogger {
+	if logger, ok := ctx.Value(loggerKey).(*zap.SugaredLogger); ok && logger != nil {
+		return logger
+	}
+	if fallback != nil {
+		return fallback
+	}
+	return zap.NewNop().Sugar()
+}
+
+// With adds fields to the request logger, if there is one.
+func With(ctx context.Context, args ...interface{}) context.Context {
+	if logger, ok := ctx.Value(loggerKey).(*zap.SugaredLogger); ok && logger != nil {
+		return WithLogger(ctx, logger.With(args...))
+	}
+	return ctx
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// User is filled in by whoever authenticates the request. The access log
+// creates it before the request is authenticated and reads it afterwards,
+// when the context holding the session is already gone.
+type User struct {
+	mu sync.Mutex
+	id int
+	ok bool
+}
+
+// WithUser returns the User of the request, creating it if ctx has none.
+func WithUser(ctx context.Context) (context.Context, *User) {
+	if user, ok := ctx.Value(userKey).(*User); ok {
+		return ctx, user
+	}
+	user := &User{}
+	return context.WithValue(ctx, userKey, user), user
+}
+
+// SetUser records the authenticated user of the request, if the request is
+// being logged.
+func SetUser(ctx context.Context, userID int) {
+	if user, ok := ctx.Value(userKey).(*User); ok {
+		user.mu.Lock()
+		user.id, user.ok = userID, true
+		user.mu.Unlock()
+	}
+}
+
+func (u *User) ID() (int, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.id, u.ok
+}
@@ -0,0 +1,72 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Bytes formats the message as RFC 5322 with the given sender.
+func (m *Message) Bytes(from string, date time.Time) []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "From: %s\r\n", from)
+	fmt.Fprintf(buf, "To: %s\r\n", m.To)
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.Write(bytes.ReplaceAll([]byte(m.Body), []byte("\n"), []byte("\r\n")))
+	return buf.Bytes()
+}
+
+// SMTPMailer sends through a mail server, Auth may be nil for servers that
+// don't require it.
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+// Send doesn't watch ctx, net/smtp can't be cancelled.
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{msg.To}, msg.Bytes(m.From, time.Now()))
+}
+
+// OutboxMailer writes every message to a .eml file in Dir instead of
+// sending it, to try flows that send mail without a mail server.
+type OutboxMailer struct {
+	Dir  string
+	From string
+	seq  uint64
+}
+
+func (m *OutboxMailer) Send(ctx context.Context, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%d-%d.eml", now.UnixNano(), atomic.AddUint64(&m.seq, 1))
+	return ioutil.WriteFile(filepath.Join(m.Dir, name), msg.Bytes(m.From, now), 0600)
+}
@@ -0,0 +1,65 @@
+package mail
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageBytes(t *testing.T) {
+	msg := &Message{To: "bob@example.com", Subject: "Привет", Body: "line 1\nline 2\n"}
+	have := string(msg.Bytes("noreply@example.com", time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)))
+	for _, want := range []string{
+		"From: noreply@example.com\r\n",
+		"To: bob@example.com\r\n",
+		"Subject: =?utf-8?q?",
+		"Date: Sat, 01 May 2021 12:00:00 +0000\r\n",
+		"\r\n\r\nline 1\r\nline 2\r\n",
+	} {
+		if !strings.Contains(have, want) {
+			t.Errorf("expected %q in message:\n%s", want, have)
+			return
+		}
+	}
+}
+
+func TestOutboxMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	mailer := &OutboxMailer{Dir: dir, From: "noreply@example.com"}
+	for i := 0; i < 2; i++ {
+		err := mailer.Send(context.Background(), &Message{To: "bob@example.com", Subject: "Hi", Body: "hello"})
+		if err != nil {
+			t.Errorf("unexpected err: %s", err)
+			return
+		}
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if len(files) != 2 {
+		t.Errorf("expected 2 messages, got %d", len(files))
+		return
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if !strings.Contains(string(data), "To: bob@example.com") || !strings.HasSuffix(string(data), "hello") {
+		t.Errorf("unexpected message:\n%s", data)
+		return
+	}
+
+	// Cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := mailer.Send(ctx, &Message{To: "bob@example.com"}); err == nil {
+		t.Errorf("expected error, got nil")
+		return
+	}
+}
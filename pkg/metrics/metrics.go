@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Default is the registry served on /metrics.
+var Default = NewRegistry()
+
+var (
+	HTTPRequests = Default.NewCounterVec(
+		"http_requests_total",
+		"HTTP requests by route template, method and status code.",
+		"route", "method", "code",
+	)
+	HTTPDuration = Default.NewHistogramVec(
+		"http_request_duration_seconds",
+		"HTTP request latency by route template and method.",
+		DefBuckets,
+		"route", "method",
+	)
+	Panics = Default.NewCounterVec(
+		"http_panics_total",
+		"Panics recovered while serving requests.",
+	)
+	HTTPInFlight = Default.NewGaugeVec(
+		"http_requests_in_flight",
+		"HTTP requests being served.",
+	)
+
+	RepoDuration = Default.NewHistogramVec(
+		"repo_call_duration_seconds",
+		"Repository call latency by repository and method.",
+		DefBuckets,
+		"repo", "method",
+	)
+	RepoErrors = Default.NewCounterVec(
+		"repo_call_errors_total",
+		"Failed repository calls by repository and method.",
+		"repo", "method",
+	)
+
+	PostsCreated = Default.NewCounterVec(
+		"posts_created_total",
+		"Posts created.",
+	)
+	VotesCast = Default.NewCounterVec(
+		"votes_cast_total",
+		"Votes cast by direction.",
+		"vote",
+	)
+	Logins = Default.NewCounterVec(
+		"logins_total",
+		"Login attempts by result.",
+		"result",
+	)
+)
+
+// ObserveRepo records a repository call that started at start.
+func ObserveRepo(repo, method string, start time.Time, err error) {
+	RepoDuration.Observe(time.Since(start).Seconds(), repo, method)
+	if err != nil {
+		RepoErrors.Inc(repo, method)
+	}
+}
+
+// RegisterDBStats exposes connection pool stats of db under the given name
+// prefix, e.g. "mysql".
+func RegisterDBStats(reg *Registry, prefix string, db *sql.DB) {
+	stat := func(f func(sql.DBStats) float64) func() float64 {
+		return func() float64 {
+			return f(db.Stats())
+		}
+	}
+	reg.NewGaugeFunc(prefix+"_open_connections", "Established connections, both in use and idle.",
+		stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	reg.NewGaugeFunc(prefix+"_in_use_connections", "Connections currently in use.",
+		stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	reg.NewGaugeFunc(prefix+"_idle_connections", "Idle connections.",
+		stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	reg.NewGaugeFunc(prefix+"_max_open_connections", "Maximum number of open connections.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	reg.NewCounterFunc(prefix+"_wait_count_total", "Connections waited for.",
+		stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	reg.NewCounterFunc(prefix+"_wait_duration_seconds_total", "Time spent waiting for connections.",
+		stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+}
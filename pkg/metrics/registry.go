@@ -0,0 +1,268 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are latency buckets in seconds, the same as the Prometheus
+// client uses by default.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	write(*bytes.Buffer)
+}
+
+// Registry holds metrics and serves them in the Prometheus text format.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (reg *Registry) register(c collector) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.collectors = append(reg.collectors, c)
+}
+
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reg.mu.Lock()
+	collectors := append([]collector(nil), reg.collectors...)
+	reg.mu.Unlock()
+	buf := &bytes.Buffer{}
+	for _, c := range collectors {
+		c.write(buf)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// vec keeps one value per combination of label values.
+type vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// histograms only
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newVec(name, help, kind string, labels []string) vec {
+	return vec{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+}
+
+// get must be called with mu held.
+func (v *vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted must be called with mu held.
+func (v *vec) sorted() []*series {
+	all := make([]*series, 0, len(v.series))
+	for _, s := range v.series {
+		all = append(all, s)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return strings.Join(all[i].labelValues, "\xff") < strings.Join(all[j].labelValues, "\xff")
+	})
+	return all
+}
+
+func (v *vec) header(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.kind)
+}
+
+type CounterVec struct {
+	vec
+}
+
+func (reg *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, "counter", labels)}
+	reg.register(c)
+	return c
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(labelValues).value += delta
+}
+
+func (c *CounterVec) write(buf *bytes.Buffer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(buf)
+	for _, s := range c.sorted() {
+		fmt.Fprintf(buf, "%s%s %s\n", c.name, labelString(c.labels, s.labelValues, "", ""), formatFloat(s.value))
+	}
+}
+
+type GaugeVec struct {
+	vec
+}
+
+func (reg *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(name, help, "gauge", labels)}
+	reg.register(g)
+	return g
+}
+
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.get(labelValues).value += delta
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.get(labelValues).value = value
+}
+
+func (g *GaugeVec) write(buf *bytes.Buffer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.header(buf)
+	for _, s := range g.sorted() {
+		fmt.Fprintf(buf, "%s%s %s\n", g.name, labelString(g.labels, s.labelValues, "", ""), formatFloat(s.value))
+	}
+}
+
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+func (reg *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{newVec(name, help, "histogram", labels), buckets}
+	reg.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(labelValues)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	for i, upper := range h.buckets {
+		if value <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (h *HistogramVec) write(buf *bytes.Buffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(buf)
+	for _, s := range h.sorted() {
+		for i, upper := range h.buckets {
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", h.name, labelString(h.labels, s.labelValues, "le", formatFloat(upper)), s.counts[i])
+		}
+		fmt.Fprintf(buf, "%s_bucket%s %d\n", h.name, labelString(h.labels, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(buf, "%s_sum%s %s\n", h.name, labelString(h.labels, s.labelValues, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(buf, "%s_count%s %d\n", h.name, labelString(h.labels, s.labelValues, "", ""), s.count)
+	}
+}
+
+// GaugeFunc reads its value when metrics are scraped.
+type GaugeFunc struct {
+	name  string
+	help  string
+	kind  string
+	value func() float64
+}
+
+func (reg *Registry) NewGaugeFunc(name, help string, value func() float64) {
+	reg.register(&GaugeFunc{name: name, help: help, kind: "gauge", value: value})
+}
+
+// NewCounterFunc is like NewGaugeFunc for values that only grow.
+func (reg *Registry) NewCounterFunc(name, help string, value func() float64) {
+	reg.register(&GaugeFunc{name: name, help: help, kind: "counter", value: value})
+}
+
+func (g *GaugeFunc) write(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", g.name, escapeHelp(g.help), g.name, g.kind)
+	fmt.Fprintf(buf, "%s %s\n", g.name, formatFloat(g.value()))
+}
+
+func labelString(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(reg *Registry) string {
+	w := httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	return string(body)
+}
+
+func TestRegistry(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.NewCounterVec("requests_total", "Requests.", "route", "code")
+	inFlight := reg.NewGaugeVec("in_flight", "In flight.")
+	latency := reg.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	reg.NewGaugeFunc("answer", "The answer.", func() float64 { return 42 })
+
+	requests.Inc("/api/posts", "200")
+	requests.Inc("/api/posts", "200")
+	requests.Inc(`/api/"quoted"`, "500")
+	inFlight.Add(1)
+	inFlight.Add(1)
+	inFlight.Add(-1)
+	latency.Observe(0.05, "/api/posts")
+	latency.Observe(0.5, "/api/posts")
+	latency.Observe(5, "/api/posts")
+
+	expected := []string{
+		"# HELP requests_total Requests.\n# TYPE requests_total counter\n",
+		`requests_total{route="/api/\"quoted\"",code="500"} 1` + "\n" +
+			`requests_total{route="/api/posts",code="200"} 2` + "\n",
+		"# TYPE in_flight gauge\nin_flight 1\n",
+		"# TYPE latency_seconds histogram\n" +
+			`latency_seconds_bucket{route="/api/posts",le="0.1"} 1` + "\n" +
+			`latency_seconds_bucket{route="/api/posts",le="1"} 2` + "\n" +
+			`latency_seconds_bucket{route="/api/posts",le="+Inf"} 3` + "\n" +
+			`latency_seconds_sum{route="/api/posts"} 5.55` + "\n" +
+			`latency_seconds_count{route="/api/posts"} 3` + "\n",
+		"# TYPE answer gauge\nanswer 42\n",
+	}
+	body := scrape(reg)
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Errorf("expected %q in\n%s", e, body)
+			return
+		}
+	}
+}
+
+func TestWrongLabelCount(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.NewCounterVec("requests_total", "Requests.", "route")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic")
+		}
+	}()
+	requests.Inc()
+}
@@ -1,25 +1,127 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
+	"asperitas-clone/pkg/logging"
+
 	"go.uber.org/zap"
 )
 
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	FormatJSON     = "json"
+	FormatCommon   = "common"
+	FormatCombined = "combined"
+
+	maxRequestIDLength = 128
+)
+
 type ReqLogger struct {
 	Logger *zap.SugaredLogger
+	// Format is FormatJSON (the default), FormatCommon or FormatCombined.
+	// The Apache formats are written to Output.
+	Format string
+	Output io.Writer
 }
 
+// AccessLog tags the request with a request ID, puts a logger carrying it
+// into the context and logs the request once it is served. It has to run
+// before the other middleware to see their responses.
 func (req ReqLogger) AccessLog(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		next.ServeHTTP(w, r)
-		req.Logger.Infow("New request",
-			"method", r.Method,
-			"remote_addr", r.RemoteAddr,
-			"url", r.URL.Path,
-			"time", time.Since(start),
-		)
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ctx := logging.WithRequestID(r.Context(), requestID)
+		ctx = logging.WithLogger(ctx, req.Logger.With("request_id", requestID))
+		ctx, user := logging.WithUser(ctx)
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		userID, authenticated := user.ID()
+		switch req.Format {
+		case FormatCommon, FormatCombined:
+			req.writeApache(r, rec, userID, authenticated, start)
+		default:
+			fields := []interface{}{
+				"request_id", requestID,
+				"method", r.Method,
+				"remote_addr", r.RemoteAddr,
+				"url", r.URL.Path,
+				"status", rec.Status(),
+				"bytes", rec.bytes,
+				"user_agent", r.UserAgent(),
+				"time", time.Since(start),
+			}
+			if authenticated {
+				fields = append(fields, "user", userID)
+			}
+			req.Logger.Infow("New request", fields...)
+		}
 	})
 }
+
+func (req ReqLogger) writeApache(r *http.Request, rec *statusRecorder, userID int, authenticated bool, start time.Time) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	user := "-"
+	if authenticated {
+		user = strconv.Itoa(userID)
+	}
+	size := "-"
+	if rec.bytes > 0 {
+		size = strconv.Itoa(rec.bytes)
+	}
+	line := fmt.Sprintf("%s - %s [%s] %q %d %s",
+		host,
+		user,
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method+" "+r.RequestURI+" "+r.Proto,
+		rec.Status(),
+		size,
+	)
+	if req.Format == FormatCombined {
+		line += fmt.Sprintf(" %q %q", r.Referer(), r.UserAgent())
+	}
+	fmt.Fprintln(req.Output, line)
+}
+
+// validRequestID accepts IDs set by a proxy in front of us as long as they
+// can't break the log line.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
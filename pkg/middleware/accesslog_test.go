@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"asperitas-clone/pkg/logging"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAccessLogJSON(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	reqlog := ReqLogger{Logger: zap.New(core).Sugar()}
+	var handlerRequestID string
+	handler := reqlog.AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlerRequestID = logging.RequestID(r.Context())
+		logging.SetUser(r.Context(), 7)
+		logging.FromContext(r.Context(), nil).Infow("from handler")
+		http.Error(w, "nope", http.StatusTeapot)
+	}))
+
+	// Incoming request ID is kept
+	r := httptest.NewRequest("GET", "/api/posts", nil)
+	r.Header.Set(RequestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Header().Get(RequestIDHeader) != "abc-123" || handlerRequestID != "abc-123" {
+		t.Errorf("expected request ID to be kept, got %q", w.Header().Get(RequestIDHeader))
+		return
+	}
+	entries := logs.AllUntimed()
+	if len(entries) != 2 {
+		t.Errorf("expected 2 log entries, got %d", len(entries))
+		return
+	}
+	if entries[0].ContextMap()["request_id"] != "abc-123" {
+		t.Errorf("expected handler log to carry request ID, got %v", entries[0].ContextMap())
+		return
+	}
+	fields := entries[1].ContextMap()
+	if fields["status"] != int64(http.StatusTeapot) || fields["user"] != int64(7) || fields["bytes"] != int64(5) {
+		t.Errorf("unexpected access log fields %v", fields)
+		return
+	}
+
+	// Bad request IDs are replaced
+	r = httptest.NewRequest("GET", "/api/posts", nil)
+	r.Header.Set(RequestIDHeader, "bad id\n")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if id := w.Header().Get(RequestIDHeader); len(id) != 32 || id != handlerRequestID {
+		t.Errorf("expected generated request ID, got %q", id)
+		return
+	}
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	out := &bytes.Buffer{}
+	reqlog := ReqLogger{Logger: zap.NewNop().Sugar(), Format: FormatCombined, Output: out}
+	handler := reqlog.AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+
+	r := httptest.NewRequest("GET", "/api/posts?q=go", nil)
+	r.Header.Set("User-Agent", "test-agent")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	line := out.String()
+	if !strings.HasPrefix(line, "192.0.2.1 - - [") ||
+		!strings.HasSuffix(line, `] "GET /api/posts?q=go HTTP/1.1" 200 5 "" "test-agent"`+"\n") {
+		t.Errorf("unexpected log line %q", line)
+		return
+	}
+}
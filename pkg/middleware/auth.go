@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 
+	"asperitas-clone/pkg/logging"
 	"asperitas-clone/pkg/session"
 
 	"github.com/gorilla/mux"
@@ -15,7 +16,7 @@ type ReqTemplate struct {
 }
 
 type AuthService struct {
-	SessionManager *session.SessionManager
+	SessionManager session.SessionManagerInterface
 	NeedAuth       []ReqTemplate
 }
 
@@ -48,7 +49,9 @@ func (auth AuthService) Auth(next http.Handler) http.Handler {
 						http.Redirect(w, r, "/", http.StatusUnauthorized)
 						return
 					}
+					logging.SetUser(r.Context(), sess.UserID)
 					ctx := context.WithValue(r.Context(), session.SessionKey, sess)
+					ctx = logging.With(ctx, "user", sess.UserID)
 					next.ServeHTTP(w, r.WithContext(ctx))
 					return
 				}
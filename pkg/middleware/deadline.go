@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// TimeoutPolicy overrides the deadline of a route, a zero Timeout leaves the
+// route without one.
+type TimeoutPolicy struct {
+	Method  string
+	Reg     string
+	Timeout time.Duration
+}
+
+type Deadlines struct {
+	Default  time.Duration
+	Policies []TimeoutPolicy
+}
+
+// Deadline puts a deadline into the request context, so the repositories
+// give up on a slow database instead of holding the request. A disconnected
+// client cancels the context already.
+func (d Deadlines) Deadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout := d.timeout(r)
+		if timeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (d Deadlines) timeout(r *http.Request) time.Duration {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return d.Default
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return d.Default
+	}
+	for _, policy := range d.Policies {
+		if policy.Method == r.Method && policy.Reg == template {
+			return policy.Timeout
+		}
+	}
+	return d.Default
+}
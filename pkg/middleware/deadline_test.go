@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestDeadlines(t *testing.T) {
+	deadlines := Deadlines{
+		Default: time.Second,
+		Policies: []TimeoutPolicy{
+			{Method: "GET", Reg: "/api/post/{POST_ID}/events"},
+			{Method: "GET", Reg: "/api/search", Timeout: time.Minute},
+		},
+	}
+	var remaining time.Duration
+	var hasDeadline bool
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var deadline time.Time
+		deadline, hasDeadline = r.Context().Deadline()
+		remaining = time.Until(deadline)
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/api/posts", handler).Methods("GET")
+	r.HandleFunc("/api/post/{POST_ID}/events", handler).Methods("GET")
+	r.HandleFunc("/api/search", handler).Methods("GET")
+	r.Use(deadlines.Deadline)
+
+	// Default deadline
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/posts", nil))
+	if !hasDeadline || remaining > time.Second {
+		t.Errorf("expected default deadline, got %v %v", hasDeadline, remaining)
+		return
+	}
+
+	// Overridden deadline
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/search", nil))
+	if !hasDeadline || remaining <= time.Second {
+		t.Errorf("expected route deadline, got %v %v", hasDeadline, remaining)
+		return
+	}
+
+	// Streams have no deadline
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/post/1/events", nil))
+	if hasDeadline {
+		t.Errorf("expected no deadline, got %v", remaining)
+		return
+	}
+}
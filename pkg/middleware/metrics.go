@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"asperitas-clone/pkg/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// Metrics counts requests and their latency by route template, so that
+// paths with ids don't make a series each.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		metrics.HTTPInFlight.Add(1)
+		defer metrics.HTTPInFlight.Add(-1)
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		metrics.HTTPDuration.Observe(time.Since(start).Seconds(), route, r.Method)
+		metrics.HTTPRequests.Inc(route, r.Method, strconv.Itoa(rec.Status()))
+	})
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"asperitas-clone/pkg/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMetrics(t *testing.T) {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/post/{POST_ID}", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	}).Methods("GET")
+	r.Use(Metrics)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/post/5f1b", nil))
+	if w.Code != 404 {
+		t.Errorf("expected code 404, got %d", w.Code)
+		return
+	}
+
+	w = httptest.NewRecorder()
+	metrics.Default.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	expected := `http_requests_total{route="/api/post/{POST_ID}",method="GET",code="404"} 1`
+	if !strings.Contains(string(body), expected) {
+		t.Errorf("expected %q in\n%s", expected, body)
+		return
+	}
+	if !strings.Contains(string(body), "http_requests_in_flight 0\n") {
+		t.Errorf("expected no requests in flight in\n%s", body)
+		return
+	}
+}
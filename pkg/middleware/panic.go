@@ -1,18 +1,65 @@
 package middleware
 
 import (
-	"fmt"
+	"encoding/json"
 	"net/http"
+	"runtime/debug"
+
+	"asperitas-clone/pkg/logging"
+	"asperitas-clone/pkg/metrics"
+
+	"go.uber.org/zap"
 )
 
-func Panic(next http.Handler) http.Handler {
+type PanicRecovery struct {
+	Logger *zap.SugaredLogger
+}
+
+// Recover turns panics into 500 responses and logs them with the stack.
+// It wraps the whole router rather than being added with Use, because mux
+// runs Use middleware inside the router and only for matched routes, and a
+// panic in another middleware has to be caught too.
+func (p PanicRecovery) Recover(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, user := logging.WithUser(r.Context())
+		rec := &statusRecorder{ResponseWriter: w}
 		defer func() {
-			if err := recover(); err != nil {
-				fmt.Println("recovered", err)
-				http.Error(w, "Internal server error", 500)
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				// the server aborts the response without logging
+				panic(err)
+			}
+			metrics.Panics.Inc()
+			fields := []interface{}{
+				"panic", err,
+				"method", r.Method,
+				"url", r.URL.Path,
+				"remote_addr", r.RemoteAddr,
+				"stack", string(debug.Stack()),
+			}
+			// AccessLog has set it on the response by now
+			if requestID := w.Header().Get(RequestIDHeader); requestID != "" {
+				fields = append(fields, "request_id", requestID)
+			}
+			if userID, ok := user.ID(); ok {
+				fields = append(fields, "user", userID)
+			}
+			p.Logger.Errorw("recovered from panic", fields...)
+
+			if rec.status != 0 {
+				// too late to change the response
+				return
 			}
+			resp, _ := json.Marshal(map[string]interface{}{
+				"message": "internal server error",
+			})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(resp)
 		}()
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(rec, r.WithContext(ctx))
 	})
 }
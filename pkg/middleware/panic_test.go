@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"asperitas-clone/pkg/logging"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestPanicRecovery(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	logger := zap.New(core).Sugar()
+	recovery := PanicRecovery{Logger: logger}
+	reqlog := ReqLogger{Logger: zap.NewNop().Sugar()}
+	handler := recovery.Recover(reqlog.AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.SetUser(r.Context(), 3)
+		panic("boom")
+	})))
+
+	r := httptest.NewRequest("GET", "/api/posts", nil)
+	r.Header.Set(RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != 500 {
+		t.Errorf("expected code 500, got %d", w.Code)
+		return
+	}
+	if strings.TrimSpace(w.Body.String()) != `{"message":"internal server error"}` {
+		t.Errorf("unexpected body %q", w.Body.String())
+		return
+	}
+	entries := logs.FilterMessage("recovered from panic").AllUntimed()
+	if len(entries) != 1 {
+		t.Errorf("expected panic to be logged once, got %d", len(entries))
+		return
+	}
+	fields := entries[0].ContextMap()
+	if fields["request_id"] != "req-1" || fields["user"] != int64(3) || !strings.Contains(fields["stack"].(string), "panic_test.go") {
+		t.Errorf("unexpected fields %v", fields)
+		return
+	}
+
+	// Panic after the response has started
+	handler = recovery.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("late")
+	}))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/posts", nil))
+	if w.Code != http.StatusAccepted || w.Body.Len() != 0 {
+		t.Errorf("expected response to be left alone, got %d %q", w.Code, w.Body.String())
+		return
+	}
+
+	// ErrAbortHandler is passed on to the server
+	handler = recovery.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if recover() != http.ErrAbortHandler {
+			t.Errorf("expected ErrAbortHandler to be re-panicked")
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/posts", nil))
+}
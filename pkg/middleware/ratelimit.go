@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"asperitas-clone/pkg/session"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// Limit is a token bucket: Burst requests at once, refilled at Rate requests
+// per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute is a limit of n requests a minute with bursts of up to burst.
+func PerMinute(n, burst int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+type RatePolicy struct {
+	Method string
+	Reg    string
+	Limit  Limit
+}
+
+// RateStore keeps the buckets. Take spends a token of the bucket under key
+// and reports how long to wait for the next one when the bucket is empty.
+type RateStore interface {
+	Take(key string, limit Limit, now time.Time) (ok bool, retryAfter time.Duration, err error)
+}
+
+type RateLimiter struct {
+	Store    RateStore
+	Policies []RatePolicy
+	Logger   *zap.SugaredLogger
+}
+
+// Limit throttles the routes that have a policy. Requests are counted per
+// user when the session was put into the context by AuthService, and per
+// client IP otherwise, so it has to run after Auth.
+func (rl RateLimiter) Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, policy := range rl.Policies {
+			if policy.Method != r.Method || policy.Reg != template {
+				continue
+			}
+			key := policy.Method + " " + policy.Reg + " " + clientKey(r)
+			ok, retryAfter, err := rl.Store.Take(key, policy.Limit, time.Now())
+			if err != nil {
+				// a broken store must not take the site down with it
+				rl.Logger.Warnw("rate limit store error", "key", key, "err", err)
+				break
+			}
+			if !ok {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				if seconds < 1 {
+					seconds = 1
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				resp, _ := json.Marshal(map[string]interface{}{
+					"message": "too many requests",
+				})
+				http.Error(w, string(resp), http.StatusTooManyRequests)
+				return
+			}
+			break
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func clientKey(r *http.Request) string {
+	if sess, ok := r.Context().Value(session.SessionKey).(*session.Session); ok && sess != nil {
+		return "user:" + strconv.Itoa(sess.UserID)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// MemoryRateStore keeps buckets of a single process. Buckets that have been
+// refilled completely are dropped once in a while to bound memory.
+type MemoryRateStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+const sweepInterval = time.Minute
+
+func NewMemoryRateStore() *MemoryRateStore {
+	return &MemoryRateStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *MemoryRateStore) Take(key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		s.sweep(now)
+	}
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.limit = limit
+	b.tokens = refill(b, now)
+	b.updated = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	if limit.Rate <= 0 {
+		return false, time.Hour, nil
+	}
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	return false, wait, nil
+}
+
+// sweep must be called with mu held.
+func (s *MemoryRateStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if refill(b, now) >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+func refill(b *bucket, now time.Time) float64 {
+	tokens := b.tokens + now.Sub(b.updated).Seconds()*b.limit.Rate
+	return math.Min(tokens, float64(b.limit.Burst))
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"asperitas-clone/pkg/session"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+func TestMemoryRateStore(t *testing.T) {
+	store := NewMemoryRateStore()
+	limit := Limit{Rate: 1, Burst: 2}
+	now := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	// Burst is allowed at once
+	for i := 0; i < 2; i++ {
+		ok, _, err := store.Take("a", limit, now)
+		if err != nil || !ok {
+			t.Errorf("expected request %d to pass", i)
+			return
+		}
+	}
+	ok, retryAfter, _ := store.Take("a", limit, now)
+	if ok || retryAfter != time.Second {
+		t.Errorf("expected rejection with 1s retry, got %v %v", ok, retryAfter)
+		return
+	}
+	// Other keys have their own buckets
+	if ok, _, _ := store.Take("b", limit, now); !ok {
+		t.Errorf("expected other key to pass")
+		return
+	}
+	// Tokens are refilled over time
+	if ok, _, _ := store.Take("a", limit, now.Add(time.Second)); !ok {
+		t.Errorf("expected refilled bucket to pass")
+		return
+	}
+	// Idle full buckets are swept
+	store.Take("c", limit, now.Add(time.Hour))
+	if len(store.buckets) != 1 {
+		t.Errorf("expected idle buckets to be swept, got %d", len(store.buckets))
+		return
+	}
+}
+
+type brokenStore struct{}
+
+func (brokenStore) Take(string, Limit, time.Time) (bool, time.Duration, error) {
+	return false, 0, errors.New("store is down")
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := RateLimiter{
+		Store:  NewMemoryRateStore(),
+		Logger: zap.NewNop().Sugar(),
+		Policies: []RatePolicy{
+			{Method: "POST", Reg: `/api/posts`, Limit: PerMinute(1, 1)},
+		},
+	}
+	r := mux.NewRouter()
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r.HandleFunc("/api/posts", ok).Methods("POST", "GET")
+	r.Use(limiter.Limit)
+
+	do := func(method string, sess *session.Session, addr string) *http.Response {
+		req := httptest.NewRequest(method, "/api/posts", nil)
+		req.RemoteAddr = addr
+		if sess != nil {
+			req = req.WithContext(context.WithValue(req.Context(), session.SessionKey, sess))
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	// Limited per IP
+	if resp := do("POST", nil, "10.0.0.1:1234"); resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+	resp := do("POST", nil, "10.0.0.1:4321")
+	if resp.StatusCode != 429 {
+		t.Errorf("expected code 429, got %d", resp.StatusCode)
+		return
+	}
+	if resp.Header.Get("Retry-After") != "60" {
+		t.Errorf("expected Retry-After 60, got %q", resp.Header.Get("Retry-After"))
+		return
+	}
+	// Routes without a policy are not limited
+	if resp := do("GET", nil, "10.0.0.1:1234"); resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+	// Logged in users are limited per user, not per IP
+	if resp := do("POST", &session.Session{UserID: 1}, "10.0.0.1:1234"); resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+	if resp := do("POST", &session.Session{UserID: 1}, "10.0.0.2:1234"); resp.StatusCode != 429 {
+		t.Errorf("expected code 429, got %d", resp.StatusCode)
+		return
+	}
+
+	// Store errors let requests through
+	limiter.Store = brokenStore{}
+	r = mux.NewRouter()
+	r.HandleFunc("/api/posts", ok).Methods("POST")
+	r.Use(limiter.Limit)
+	if resp := do("POST", nil, "10.0.0.1:1234"); resp.StatusCode != 200 {
+		t.Errorf("expected code 200, got %d", resp.StatusCode)
+		return
+	}
+}
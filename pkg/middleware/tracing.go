@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"asperitas-clone/pkg/logging"
+	"asperitas-clone/pkg/tracing"
+
+	"github.com/gorilla/mux"
+)
+
+// Tracing starts a span for every request, continuing the trace of the
+// caller when it sends traceparent.
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		ctx := tracing.Extract(r.Context(), r.Header)
+		ctx, span := tracing.Start(ctx, "HTTP "+r.Method+" "+route)
+		if span == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer span.End()
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.target", r.URL.RequestURI())
+		if requestID := logging.RequestID(ctx); requestID != "" {
+			span.SetAttribute("request_id", requestID)
+		}
+		ctx = logging.With(ctx, "trace_id", span.Context().TraceID.String())
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		span.SetAttribute("http.status_code", rec.Status())
+		if rec.Status() >= http.StatusInternalServerError {
+			span.RecordError(fmt.Errorf("HTTP %d", rec.Status()))
+		}
+	})
+}
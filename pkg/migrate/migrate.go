@@ -0,0 +1,174 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrOutdated       = errors.New("database schema is out of date")
+	ErrUnknownVersion = errors.New("unknown schema version")
+	ErrNoMongo        = errors.New("migration needs mongo")
+)
+
+// errNoSuchTable is returned by MySQL for a missing table.
+const errNoSuchTable = 1146
+
+// Migration moves the schema from Version-1 to Version. Up and Down are
+// MySQL statements run in order, MongoUp and MongoDown change the posts
+// database.
+type Migration struct {
+	Version   int
+	Name      string
+	Up        []string
+	Down      []string
+	MongoUp   func(context.Context, *mongo.Database) error
+	MongoDown func(context.Context, *mongo.Database) error
+}
+
+// Migrator applies Migrations, ordered by version, and records every applied
+// one in the schema_version table.
+type Migrator struct {
+	DB         *sql.DB
+	Mongo      *mongo.Database
+	Migrations []Migration
+}
+
+func New(db *sql.DB, mongoDB *mongo.Database) *Migrator {
+	return &Migrator{DB: db, Mongo: mongoDB, Migrations: Migrations}
+}
+
+// Latest is the version the code expects.
+func (m *Migrator) Latest() int {
+	if len(m.Migrations) == 0 {
+		return 0
+	}
+	return m.Migrations[len(m.Migrations)-1].Version
+}
+
+// Version is the version of the database, 0 if it was never migrated.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	version := 0
+	err := m.DB.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errNoSuchTable {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Check returns ErrOutdated if there are migrations left to apply. A newer
+// schema is fine, migrations only add to it while old instances still run.
+func (m *Migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if version < m.Latest() {
+		return fmt.Errorf("%w: version %d, want %d", ErrOutdated, version, m.Latest())
+	}
+	return nil
+}
+
+// Up applies the migrations up to and including target.
+func (m *Migrator) Up(ctx context.Context, target int) error {
+	if err := m.checkTarget(target); err != nil {
+		return err
+	}
+	_, err := m.DB.ExecContext(ctx,
+		"CREATE TABLE IF NOT EXISTS `schema_version` ("+
+			"`version` INT NOT NULL, "+
+			"`name` VARCHAR(255) NOT NULL, "+
+			"`applied` DATETIME(6) NOT NULL, "+
+			"PRIMARY KEY (`version`)"+
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8",
+	)
+	if err != nil {
+		return err
+	}
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	for _, migration := range m.Migrations {
+		if migration.Version <= version || migration.Version > target {
+			continue
+		}
+		err = m.run(ctx, migration.Up, migration.MongoUp)
+		if err != nil {
+			return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		_, err = m.DB.ExecContext(
+			ctx,
+			"INSERT INTO `schema_version` (`version`, `name`, `applied`) VALUES (?, ?, ?)",
+			migration.Version,
+			migration.Name,
+			time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Down reverts the migrations above target.
+func (m *Migrator) Down(ctx context.Context, target int) error {
+	if err := m.checkTarget(target); err != nil {
+		return err
+	}
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	for i := len(m.Migrations) - 1; i >= 0; i-- {
+		migration := m.Migrations[i]
+		if migration.Version > version || migration.Version <= target {
+			continue
+		}
+		err = m.run(ctx, migration.Down, migration.MongoDown)
+		if err != nil {
+			return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		_, err = m.DB.ExecContext(ctx, "DELETE FROM `schema_version` WHERE `version` = ?", migration.Version)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) checkTarget(target int) error {
+	if target == 0 {
+		return nil
+	}
+	for _, migration := range m.Migrations {
+		if migration.Version == target {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %d", ErrUnknownVersion, target)
+}
+
+func (m *Migrator) run(ctx context.Context, statements []string, mongoStep func(context.Context, *mongo.Database) error) error {
+	for _, statement := range statements {
+		if _, err := m.DB.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	if mongoStep == nil {
+		return nil
+	}
+	if m.Mongo == nil {
+		return ErrNoMongo
+	}
+	return mongoStep(ctx, m.Mongo)
+}
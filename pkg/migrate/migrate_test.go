@@ -0,0 +1,181 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var (
+	ErrDB = errors.New("DB_ERROR")
+)
+
+func testMigrations() []Migration {
+	return []Migration{
+		{Version: 1, Name: "a", Up: []string{"CREATE TABLE a"}, Down: []string{"DROP TABLE a"}},
+		{Version: 2, Name: "b", Up: []string{"CREATE TABLE b", "CREATE INDEX b"}, Down: []string{"DROP TABLE b"}},
+		{Version: 3, Name: "c", Up: []string{"CREATE TABLE c"}, Down: []string{"DROP TABLE c"}},
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	last := 0
+	for _, migration := range Migrations {
+		if migration.Version <= last {
+			t.Errorf("migration %d is out of order", migration.Version)
+			return
+		}
+		last = migration.Version
+		if migration.MongoUp == nil && len(migration.Up) == 0 {
+			t.Errorf("migration %d does nothing", migration.Version)
+			return
+		}
+		if len(migration.Up) != 0 && len(migration.Down) == 0 || migration.MongoUp != nil && migration.MongoDown == nil {
+			t.Errorf("migration %d can't be reverted", migration.Version)
+			return
+		}
+	}
+	if len(Migrations[0].Up) != 2 {
+		t.Errorf("expected users and sessions in the first migration, got %v", Migrations[0].Up)
+		return
+	}
+}
+
+func TestUp(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	migrator := &Migrator{DB: db, Migrations: testMigrations()}
+
+	// Good query
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `schema_version`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mock.ExpectExec("CREATE TABLE b").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE INDEX b").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO `schema_version`").
+		WithArgs(2, "b", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	err = migrator.Up(context.Background(), 2)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+
+	// Failed migration is not recorded
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `schema_version`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+	mock.ExpectExec("CREATE TABLE c").WillReturnError(ErrDB)
+	err = migrator.Up(context.Background(), 3)
+	if !errors.Is(err, ErrDB) {
+		t.Errorf("expected ErrDB, got %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+
+	// Unknown version
+	err = migrator.Up(context.Background(), 4)
+	if !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("expected ErrUnknownVersion, got %v", err)
+		return
+	}
+
+	// Mongo step without mongo
+	migrator.Migrations = append(migrator.Migrations, Migration{Version: 4, Name: "d", MongoUp: createIndexes("items", postIndexes)})
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `schema_version`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+	err = migrator.Up(context.Background(), 4)
+	if !errors.Is(err, ErrNoMongo) {
+		t.Errorf("expected ErrNoMongo, got %v", err)
+		return
+	}
+}
+
+func TestDown(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	migrator := &Migrator{DB: db, Migrations: testMigrations()}
+
+	// Good query
+	mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+	mock.ExpectExec("DROP TABLE c").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM `schema_version`").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DROP TABLE b").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM `schema_version`").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	err = migrator.Down(context.Background(), 1)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+
+	// DB error
+	mock.ExpectQuery("SELECT COALESCE").WillReturnError(ErrDB)
+	err = migrator.Down(context.Background(), 0)
+	if !errors.Is(err, ErrDB) {
+		t.Errorf("expected ErrDB, got %v", err)
+		return
+	}
+}
+
+func TestCheck(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	migrator := &Migrator{DB: db, Migrations: testMigrations()}
+
+	// Up to date
+	mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+	err = migrator.Check(context.Background())
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+
+	// Out of date
+	mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+	err = migrator.Check(context.Background())
+	if !errors.Is(err, ErrOutdated) {
+		t.Errorf("expected ErrOutdated, got %v", err)
+		return
+	}
+
+	// Never migrated
+	mock.ExpectQuery("SELECT COALESCE").WillReturnError(&mysql.MySQLError{Number: errNoSuchTable})
+	err = migrator.Check(context.Background())
+	if !errors.Is(err, ErrOutdated) {
+		t.Errorf("expected ErrOutdated, got %v", err)
+		return
+	}
+
+	// DB error
+	mock.ExpectQuery("SELECT COALESCE").WillReturnError(ErrDB)
+	err = migrator.Check(context.Background())
+	if !errors.Is(err, ErrDB) {
+		t.Errorf("expected ErrDB, got %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
@@ -0,0 +1,103 @@
+package migrate
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//go:embed mysql/*.sql
+var mysqlFiles embed.FS
+
+// Migrations of the application. Tables are created with IF NOT EXISTS, so
+// databases set up by the old init script are adopted by running them.
+var Migrations = []Migration{
+	sqlMigration(1, "users_sessions"),
+	sqlMigration(2, "profiles"),
+	sqlMigration(3, "comments"),
+	sqlMigration(4, "saved"),
+	sqlMigration(5, "subscriptions"),
+	sqlMigration(6, "notifications"),
+	sqlMigration(7, "login_failures"),
+	{
+		Version:   8,
+		Name:      "post_indexes",
+		MongoUp:   createIndexes("items", postIndexes),
+		MongoDown: dropIndexes("items", postIndexes),
+	},
+	sqlMigration(9, "unique_usernames"),
+	sqlMigration(10, "password_resets"),
+	sqlMigration(11, "email_verification"),
+	sqlMigration(12, "identities"),
+	sqlMigration(13, "two_factor"),
+}
+
+var postIndexes = []mongo.IndexModel{
+	{
+		Keys:    bson.D{{Key: "id", Value: 1}},
+		Options: options.Index().SetName("posts_id").SetUnique(true),
+	},
+	{
+		Keys:    bson.D{{Key: "category", Value: 1}},
+		Options: options.Index().SetName("posts_category"),
+	},
+	{
+		Keys:    bson.D{{Key: "author.username", Value: 1}},
+		Options: options.Index().SetName("posts_author"),
+	},
+	{
+		Keys:    bson.D{{Key: "created", Value: -1}},
+		Options: options.Index().SetName("posts_created"),
+	},
+}
+
+// sqlMigration reads mysql/<version>_<name>.up.sql and .down.sql.
+func sqlMigration(version int, name string) Migration {
+	prefix := fmt.Sprintf("mysql/%04d_%s", version, name)
+	return Migration{
+		Version: version,
+		Name:    name,
+		Up:      statements(prefix + ".up.sql"),
+		Down:    statements(prefix + ".down.sql"),
+	}
+}
+
+// statements splits a file into statements, the driver runs one at a time.
+func statements(path string) []string {
+	data, err := mysqlFiles.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+	result := []string{}
+	for _, statement := range strings.Split(string(data), ";\n") {
+		statement = strings.TrimSuffix(strings.TrimSpace(statement), ";")
+		if statement != "" {
+			result = append(result, statement)
+		}
+	}
+	return result
+}
+
+func createIndexes(collection string, indexes []mongo.IndexModel) func(context.Context, *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(collection).Indexes().CreateMany(ctx, indexes)
+		return err
+	}
+}
+
+func dropIndexes(collection string, indexes []mongo.IndexModel) func(context.Context, *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, index := range indexes {
+			_, err := db.Collection(collection).Indexes().DropOne(ctx, *index.Options.Name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `profiles` (
+  `userid` INT NOT NULL,
+  `registered` DATETIME NULL,
+  `bio` TEXT NULL,
+  `avatar` TEXT NULL,
+  `post_karma` INT NOT NULL DEFAULT 0,
+  `comment_karma` INT NOT NULL DEFAULT 0,
+  `posts` INT NOT NULL DEFAULT 0,
+  `comments` INT NOT NULL DEFAULT 0,
+  PRIMARY KEY (`userid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `comments` (
+  `id` VARCHAR(24) NOT NULL,
+  `post_id` VARCHAR(24) NOT NULL,
+  `post_title` TEXT NOT NULL,
+  `userid` INT NOT NULL,
+  `body` TEXT NOT NULL,
+  `created` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `comments_user_created` (`userid`, `created`),
+  KEY `comments_post` (`post_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS `saved` (
+  `userid` INT NOT NULL,
+  `post_id` VARCHAR(24) NOT NULL,
+  `created` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`userid`, `post_id`),
+  KEY `saved_user_created` (`userid`, `created`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS `subscriptions` (
+  `userid` INT NOT NULL,
+  `category` VARCHAR(64) NOT NULL,
+  PRIMARY KEY (`userid`, `category`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
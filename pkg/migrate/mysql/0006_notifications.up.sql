@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS `notifications` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `userid` INT NOT NULL,
+  `type` VARCHAR(16) NOT NULL,
+  `post_id` VARCHAR(24) NOT NULL,
+  `post_title` TEXT NOT NULL,
+  `comment_id` VARCHAR(24) NOT NULL,
+  `author_id` INT NOT NULL,
+  `body` TEXT NOT NULL,
+  `created` DATETIME(6) NOT NULL,
+  `is_read` BOOLEAN NOT NULL DEFAULT FALSE,
+  PRIMARY KEY (`id`),
+  KEY `notifications_user` (`userid`, `is_read`),
+  KEY `notifications_created` (`created`),
+  KEY `notifications_comment` (`comment_id`),
+  KEY `notifications_post` (`post_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
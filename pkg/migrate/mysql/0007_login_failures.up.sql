@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS `login_failures` (
+  `key` VARCHAR(255) NOT NULL,
+  `failures` INT NOT NULL,
+  `last_failure` DATETIME(6) NOT NULL,
+  `locked_until` DATETIME(6) NULL,
+  PRIMARY KEY (`key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
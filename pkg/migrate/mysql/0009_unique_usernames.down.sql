@@ -0,0 +1 @@
+ALTER TABLE `users` DROP KEY `users_username_key`, DROP COLUMN `username_key`;
@@ -0,0 +1,9 @@
+ALTER TABLE `users` ADD COLUMN `username_key` VARCHAR(255) CHARACTER SET utf8 COLLATE utf8_bin NULL AFTER `username`;
+
+-- the server folds names with RFC 8265, LOWER is close enough for the
+-- existing ones, duplicates have to be renamed before the key can be added
+UPDATE `users` SET `username_key` = LOWER(TRIM(`username`));
+
+ALTER TABLE `users`
+  MODIFY `username_key` VARCHAR(255) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL,
+  ADD UNIQUE KEY `users_username_key` (`username_key`);
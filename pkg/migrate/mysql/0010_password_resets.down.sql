@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `password_resets`;
+ALTER TABLE `users` DROP KEY `users_email`, DROP COLUMN `reset_sent`, DROP COLUMN `email`;
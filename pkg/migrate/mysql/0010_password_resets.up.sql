@@ -0,0 +1,15 @@
+-- emails are stored normalized, NULL for users without one, reset_sent
+-- throttles password reset mail
+ALTER TABLE `users`
+  ADD COLUMN `email` VARCHAR(255) CHARACTER SET utf8 COLLATE utf8_bin NULL AFTER `password`,
+  ADD COLUMN `reset_sent` DATETIME(6) NULL AFTER `email`,
+  ADD UNIQUE KEY `users_email` (`email`);
+
+-- only a SHA-256 of the token is kept, a leaked table can't reset passwords
+CREATE TABLE IF NOT EXISTS `password_resets` (
+  `token_hash` CHAR(64) NOT NULL,
+  `userid` INT NOT NULL,
+  `expires` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`token_hash`),
+  KEY `password_resets_userid` (`userid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
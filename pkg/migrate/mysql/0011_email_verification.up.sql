@@ -0,0 +1,4 @@
+-- verification_sent throttles verification mail
+ALTER TABLE `users`
+  ADD COLUMN `email_verified` BOOLEAN NOT NULL DEFAULT FALSE AFTER `email`,
+  ADD COLUMN `verification_sent` DATETIME(6) NULL AFTER `email_verified`;
@@ -0,0 +1,10 @@
+-- accounts at external identity providers, by the provider name of the
+-- -oidc-config file and the subject the provider knows the user as
+CREATE TABLE IF NOT EXISTS `identities` (
+  `provider` VARCHAR(64) NOT NULL,
+  `subject` VARCHAR(255) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL,
+  `userid` INT NOT NULL,
+  `created` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`provider`, `subject`),
+  KEY `identities_userid` (`userid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,27 @@
+-- TOTP keys, a key is pending until the user proves their app has it.
+-- last_step is the time step of the last accepted code, a code works once
+CREATE TABLE IF NOT EXISTS `two_factor` (
+  `userid` INT NOT NULL,
+  `secret` VARCHAR(64) NOT NULL,
+  `enabled` BOOLEAN NOT NULL DEFAULT FALSE,
+  `last_step` BIGINT NOT NULL DEFAULT 0,
+  `created` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`userid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- only SHA-256 of the codes is kept, like of password reset tokens
+CREATE TABLE IF NOT EXISTS `recovery_codes` (
+  `userid` INT NOT NULL,
+  `code_hash` CHAR(64) NOT NULL,
+  PRIMARY KEY (`userid`, `code_hash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- logins whose password was right and that wait for the second factor
+CREATE TABLE IF NOT EXISTS `login_challenges` (
+  `token_hash` CHAR(64) NOT NULL,
+  `userid` INT NOT NULL,
+  `expires` DATETIME(6) NOT NULL,
+  `attempts` INT NOT NULL DEFAULT 0,
+  PRIMARY KEY (`token_hash`),
+  KEY `login_challenges_userid` (`userid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,195 @@
+package notification_repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"asperitas-clone/pkg/items"
+
+	_ "github.com/go-sql-driver/mysql"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DefaultMaxPerUser = 200
+	DefaultMaxAge     = 90 * 24 * time.Hour
+	maxBodyLength     = 200
+)
+
+type NotificationRepo struct {
+	NotificationDB *sql.DB
+	// MaxPerUser is how many newest notifications are kept for every user,
+	// see Prune
+	MaxPerUser int
+	// MaxAge is how long notifications are kept, see Prune
+	MaxAge time.Duration
+}
+
+func (repo *NotificationRepo) Add(ctx context.Context, userID int, notification *items.Notification) error {
+	body := []rune(notification.Body)
+	if len(body) > maxBodyLength {
+		body = append(body[:maxBodyLength-1], '…')
+	}
+	result, err := repo.NotificationDB.ExecContext(
+		ctx,
+		"INSERT INTO `notifications` (`userid`, `type`, `post_id`, `post_title`, `comment_id`, `author_id`, `body`, `created`) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		userID,
+		notification.Type,
+		notification.PostID.Hex(),
+		notification.PostTitle,
+		notification.CommentID.Hex(),
+		notification.Author.ID,
+		string(body),
+		notification.Created,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	notification.ID = int(id)
+	return nil
+}
+
+// GetNotifications returns notifications of the user, newest first.
+func (repo *NotificationRepo) GetNotifications(ctx context.Context, userID int, unreadOnly bool, offset, limit int) ([]*items.Notification, error) {
+	rows, err := repo.NotificationDB.QueryContext(
+		ctx,
+		"SELECT n.id, n.type, n.post_id, n.post_title, n.comment_id, n.author_id, COALESCE(u.username, ''), n.body, n.created, n.is_read "+
+			"FROM notifications n LEFT JOIN users u ON u.id = n.author_id "+
+			"WHERE n.userid = ? AND (? = FALSE OR n.is_read = FALSE) ORDER BY n.id DESC LIMIT ? OFFSET ?",
+		userID,
+		unreadOnly,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	notifications := []*items.Notification{}
+	for rows.Next() {
+		var postID, commentID string
+		n := &items.Notification{Author: &items.User{}}
+		err = rows.Scan(&n.ID, &n.Type, &postID, &n.PostTitle, &commentID, &n.Author.ID, &n.Author.Username, &n.Body, &n.Created, &n.Read)
+		if err != nil {
+			return nil, err
+		}
+		if id, err := primitive.ObjectIDFromHex(postID); err == nil {
+			n.PostID = id
+		}
+		if id, err := primitive.ObjectIDFromHex(commentID); err == nil {
+			n.CommentID = id
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (repo *NotificationRepo) CountUnread(ctx context.Context, userID int) (int, error) {
+	var count int
+	row := repo.NotificationDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM notifications WHERE userid = ? AND is_read = FALSE", userID)
+	err := row.Scan(&count)
+	return count, err
+}
+
+// MarkRead returns items.ErrNotificationNotFound if the user has no such
+// notification.
+func (repo *NotificationRepo) MarkRead(ctx context.Context, userID int, id int) error {
+	var exists int
+	row := repo.NotificationDB.QueryRowContext(ctx, "SELECT 1 FROM notifications WHERE id = ? AND userid = ?", id, userID)
+	err := row.Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return items.ErrNotificationNotFound
+	} else if err != nil {
+		return err
+	}
+	_, err = repo.NotificationDB.ExecContext(ctx, "UPDATE `notifications` SET `is_read` = TRUE WHERE `id` = ?", id)
+	return err
+}
+
+func (repo *NotificationRepo) MarkAllRead(ctx context.Context, userID int) error {
+	_, err := repo.NotificationDB.ExecContext(
+		ctx,
+		"UPDATE `notifications` SET `is_read` = TRUE WHERE `userid` = ? AND `is_read` = FALSE",
+		userID,
+	)
+	return err
+}
+
+func (repo *NotificationRepo) DeleteByComment(ctx context.Context, commentID primitive.ObjectID) error {
+	_, err := repo.NotificationDB.ExecContext(ctx, "DELETE FROM `notifications` WHERE `comment_id` = ?", commentID.Hex())
+	return err
+}
+
+func (repo *NotificationRepo) DeleteByPost(ctx context.Context, postID primitive.ObjectID) error {
+	_, err := repo.NotificationDB.ExecContext(ctx, "DELETE FROM `notifications` WHERE `post_id` = ?", postID.Hex())
+	return err
+}
+
+// Prune removes notifications older than MaxAge and all but the newest
+// MaxPerUser of every user. It is run on a timer rather than on every Add.
+func (repo *NotificationRepo) Prune(ctx context.Context) error {
+	maxAge := repo.MaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+	_, err := repo.NotificationDB.ExecContext(
+		ctx,
+		"DELETE FROM `notifications` WHERE `created` < ?",
+		time.Now().UTC().Add(-maxAge),
+	)
+	if err != nil {
+		return err
+	}
+
+	maxPerUser := repo.MaxPerUser
+	if maxPerUser <= 0 {
+		maxPerUser = DefaultMaxPerUser
+	}
+	users, err := repo.usersOver(ctx, maxPerUser)
+	if err != nil {
+		return err
+	}
+	for _, userID := range users {
+		_, err = repo.NotificationDB.ExecContext(
+			ctx,
+			"DELETE FROM `notifications` WHERE `userid` = ? AND `id` NOT IN "+
+				"(SELECT `id` FROM (SELECT `id` FROM `notifications` WHERE `userid` = ? ORDER BY `id` DESC LIMIT ?) AS `newest`)",
+			userID,
+			userID,
+			maxPerUser,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// usersOver returns the users with more than max notifications.
+func (repo *NotificationRepo) usersOver(ctx context.Context, max int) ([]int, error) {
+	rows, err := repo.NotificationDB.QueryContext(
+		ctx,
+		"SELECT userid FROM notifications GROUP BY userid HAVING COUNT(*) > ?",
+		max,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []int{}
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		users = append(users, userID)
+	}
+	return users, rows.Err()
+}
@@ -0,0 +1,147 @@
+package notification_repo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"asperitas-clone/pkg/items"
+
+	_ "github.com/go-sql-driver/mysql"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var (
+	ErrDB = errors.New("DB_ERROR")
+)
+
+func TestAdd(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	n := &items.Notification{
+		Type:      items.NotificationComment,
+		PostID:    primitive.NewObjectID(),
+		PostTitle: "title",
+		CommentID: primitive.NewObjectID(),
+		Author:    &items.User{ID: 2},
+		Body:      strings.Repeat("a", 300),
+		Created:   time.Now(),
+	}
+
+	// Good query, long body is cut
+	mock.
+		ExpectExec("INSERT INTO `notifications`").
+		WithArgs(1, n.Type, n.PostID.Hex(), n.PostTitle, n.CommentID.Hex(), 2, strings.Repeat("a", 199)+"…", n.Created).
+		WillReturnResult(sqlmock.NewResult(5, 1))
+	repo := &NotificationRepo{NotificationDB: db}
+	if err := repo.Add(context.Background(), 1, n); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+	if n.ID != 5 {
+		t.Errorf("results not match, want %v, have %v", 5, n.ID)
+		return
+	}
+
+	// DB error
+	mock.
+		ExpectExec("INSERT INTO `notifications`").
+		WillReturnError(ErrDB)
+	if err := repo.Add(context.Background(), 1, n); !errors.Is(err, ErrDB) {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+}
+
+func TestPrune(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &NotificationRepo{NotificationDB: db, MaxPerUser: 10}
+
+	// Good query, old notifications go and users over the limit are trimmed
+	mock.
+		ExpectExec("DELETE FROM `notifications` WHERE `created` < \\?").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.
+		ExpectQuery("SELECT userid FROM notifications GROUP BY userid HAVING COUNT").
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"userid"}).AddRow(1).AddRow(4))
+	mock.
+		ExpectExec("DELETE FROM `notifications` WHERE `userid` = \\? AND `id` NOT IN").
+		WithArgs(1, 1, 10).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.
+		ExpectExec("DELETE FROM `notifications` WHERE `userid` = \\? AND `id` NOT IN").
+		WithArgs(4, 4, 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.Prune(context.Background()); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+
+	// DB error
+	mock.
+		ExpectExec("DELETE FROM `notifications` WHERE `created` < \\?").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.
+		ExpectQuery("SELECT userid FROM notifications GROUP BY userid HAVING COUNT").
+		WithArgs(10).
+		WillReturnError(ErrDB)
+	if err := repo.Prune(context.Background()); !errors.Is(err, ErrDB) {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestMarkRead(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &NotificationRepo{NotificationDB: db}
+
+	// Good query
+	mock.
+		ExpectQuery("SELECT 1 FROM notifications").
+		WithArgs(5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	mock.
+		ExpectExec("UPDATE `notifications` SET `is_read` = TRUE").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.MarkRead(context.Background(), 1, 5); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+
+	// Someone else's notification
+	mock.
+		ExpectQuery("SELECT 1 FROM notifications").
+		WithArgs(5, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"1"}))
+	if err := repo.MarkRead(context.Background(), 2, 5); !errors.Is(err, items.ErrNotificationNotFound) {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+}
@@ -0,0 +1,318 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"asperitas-clone/pkg/tracing"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrBadIDToken = errors.New("ID token is invalid")
+	ErrUnknownKey = errors.New("ID token is signed with an unknown key")
+)
+
+// Config of one identity provider, as in the -oidc-config file.
+type Config struct {
+	// Name appears in the login URL, /api/oidc/{name}/login.
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"clientId"`
+	ClientSecret string   `json:"clientSecret"`
+	RedirectURL  string   `json:"redirectUrl"`
+	Scopes       []string `json:"scopes"`
+}
+
+// ReadConfig reads a JSON list of providers.
+func ReadConfig(r io.Reader) ([]Config, error) {
+	configs := []Config{}
+	if err := json.NewDecoder(r).Decode(&configs); err != nil {
+		return nil, err
+	}
+	for _, cfg := range configs {
+		if cfg.Name == "" || cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+			return nil, fmt.Errorf("provider %q needs name, issuer, clientId and redirectUrl", cfg.Name)
+		}
+	}
+	return configs, nil
+}
+
+// Claims are what the application takes from an ID token.
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+type idClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider logs users in with the authorization code flow and PKCE. The
+// discovery document and the signing keys are fetched on first use, so the
+// server starts while the provider is down.
+type Provider struct {
+	Config
+	// Client passes the trace of the login on to the provider.
+	Client *http.Client
+
+	mu   sync.Mutex
+	meta *metadata
+	keys map[string]crypto.PublicKey
+}
+
+func New(cfg Config) *Provider {
+	return &Provider{Config: cfg, Client: &http.Client{Transport: &tracing.Transport{}}}
+}
+
+// NewRandom returns a value for state, nonce or a PKCE verifier.
+func NewRandom() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge is the S256 PKCE challenge of verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	meta := &metadata{}
+	err := p.getJSON(ctx, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", meta)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Issuer != p.Issuer {
+		return nil, fmt.Errorf("discovery document is of issuer %q, not %q", meta.Issuer, p.Issuer)
+	}
+	p.meta = meta
+	return meta, nil
+}
+
+// AuthCodeURL is where the browser goes to log in.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	scopes := append([]string{"openid"}, p.Scopes...)
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+// Exchange trades the code from the callback for an ID token and returns
+// its claims once the token is verified.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint: %s: %s", resp.Status, body)
+	}
+	tokens := struct {
+		IDToken string `json:"id_token"`
+	}{}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, err
+	}
+	return p.verify(ctx, meta, tokens.IDToken, nonce)
+}
+
+func (p *Provider) verify(ctx context.Context, meta *metadata, idToken, nonce string) (*Claims, error) {
+	claims := &idClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384"}))
+	_, err := parser.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, meta, kid)
+	})
+	if errors.Is(err, ErrUnknownKey) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadIDToken, err)
+	}
+	switch {
+	case !claims.VerifyIssuer(p.Issuer, true):
+		return nil, fmt.Errorf("%w: issuer is %q", ErrBadIDToken, claims.Issuer)
+	case !claims.VerifyAudience(p.ClientID, true):
+		return nil, fmt.Errorf("%w: audience is %v", ErrBadIDToken, claims.Audience)
+	case claims.ExpiresAt == nil:
+		return nil, fmt.Errorf("%w: no expiry", ErrBadIDToken)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce doesn't match", ErrBadIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrBadIDToken)
+	}
+	return &Claims{
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+	}, nil
+}
+
+// key returns the signing key kid, the key set is fetched again for keys it
+// doesn't know, providers rotate them.
+func (p *Provider) key(ctx context.Context, meta *metadata, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	set := jwks{}
+	if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	p.keys = set.publicKeys()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// publicKeys skips keys it can't read and keys not meant for signatures.
+func (set jwks) publicKeys() map[string]crypto.PublicKey {
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			default:
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	return keys
+}
@@ -0,0 +1,121 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"asperitas-clone/pkg/oidc/oidctest"
+)
+
+func login(t *testing.T, p *Provider, server *oidctest.Server, nonce, verifier string) (string, string) {
+	authURL, err := p.AuthCodeURL(context.Background(), "state", nonce, verifier)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	callback, err := server.Login(authURL)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if callback.Query().Get("state") != "state" {
+		t.Fatalf("state is lost: %v", callback)
+	}
+	return callback.String(), callback.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	server := oidctest.NewServer("client", "secret")
+	defer server.Close()
+	server.SetUser(oidctest.User{Subject: "42", Email: "alice@example.com", EmailVerified: true, PreferredUsername: "alice"})
+	p := New(Config{
+		Name:         "test",
+		Issuer:       server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/api/oidc/test/callback",
+	})
+
+	// Good login
+	verifier, _ := NewRandom()
+	callback, code := login(t, p, server, "nonce", verifier)
+	if !strings.HasPrefix(callback, "http://localhost/api/oidc/test/callback?") {
+		t.Errorf("unexpected callback: %s", callback)
+		return
+	}
+	claims, err := p.Exchange(context.Background(), code, verifier, "nonce")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	want := Claims{Subject: "42", Email: "alice@example.com", EmailVerified: true, PreferredUsername: "alice"}
+	if *claims != want {
+		t.Errorf("results not match, want %v, have %v", want, *claims)
+		return
+	}
+
+	// Codes work once
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce"); err == nil {
+		t.Errorf("expected error, got nil")
+		return
+	}
+
+	// Wrong PKCE verifier
+	_, code = login(t, p, server, "nonce", verifier)
+	if _, err := p.Exchange(context.Background(), code, verifier+"x", "nonce"); err == nil {
+		t.Errorf("expected error, got nil")
+		return
+	}
+
+	// Replayed ID token of another login
+	_, code = login(t, p, server, "other nonce", verifier)
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce"); !errors.Is(err, ErrBadIDToken) {
+		t.Errorf("expected ErrBadIDToken, got %v", err)
+		return
+	}
+
+	// Token meant for another client
+	other := New(Config{Name: "other", Issuer: server.URL, ClientID: "other", RedirectURL: p.RedirectURL})
+	_, code = login(t, p, server, "nonce", verifier)
+	other.ClientSecret = "secret"
+	if _, err := other.Exchange(context.Background(), code, verifier, "nonce"); err == nil {
+		t.Errorf("expected error, got nil")
+		return
+	}
+}
+
+func TestExchangeOtherSigner(t *testing.T) {
+	server := oidctest.NewServer("client", "")
+	defer server.Close()
+	impostor := oidctest.NewServer("client", "")
+	defer impostor.Close()
+	p := New(Config{Name: "test", Issuer: server.URL, ClientID: "client", RedirectURL: "http://localhost/cb"})
+	verifier, _ := NewRandom()
+	login(t, p, server, "nonce", verifier)
+
+	// Keys of the real provider are cached now, point the token endpoint at
+	// a provider with other keys
+	p.meta.TokenEndpoint = impostor.URL + "/token"
+	p.meta.AuthorizationEndpoint = impostor.URL + "/authorize"
+	_, code := login(t, p, impostor, "nonce", verifier)
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce"); err == nil {
+		t.Errorf("expected error, got nil")
+		return
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	configs, err := ReadConfig(strings.NewReader(`[{"name":"corp","issuer":"https://id.example.com","clientId":"app","redirectUrl":"https://example.com/api/oidc/corp/callback","scopes":["email"]}]`))
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if len(configs) != 1 || configs[0].Name != "corp" || configs[0].Scopes[0] != "email" {
+		t.Errorf("unexpected configs: %v", configs)
+		return
+	}
+	if _, err := ReadConfig(strings.NewReader(`[{"name":"corp"}]`)); err == nil {
+		t.Errorf("expected error, got nil")
+		return
+	}
+}
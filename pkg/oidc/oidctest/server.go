@@ -0,0 +1,220 @@
+// Package oidctest is an OpenID provider for tests and local development. It
+// logs every authorization request in as User without asking.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+const keyID = "oidctest"
+
+// User is who the server logs in.
+type User struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+}
+
+type grant struct {
+	redirectURI string
+	nonce       string
+	challenge   string
+	user        User
+}
+
+type Server struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	mu     sync.Mutex
+	user   User
+	codes  map[string]grant
+	key    *rsa.PrivateKey
+	expiry time.Duration
+}
+
+// NewServer starts a provider for the client, an empty secret accepts
+// public clients.
+func NewServer(clientID, clientSecret string) *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	s := &Server{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		codes:        map[string]grant{},
+		key:          key,
+		expiry:       5 * time.Minute,
+		user:         User{Subject: "1", PreferredUsername: "alice"},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/keys", s.keys)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// SetUser changes who logs in next.
+func (s *Server) SetUser(user User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user = user
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.URL,
+		"authorization_endpoint":                s.URL + "/authorize",
+		"token_endpoint":                        s.URL + "/token",
+		"jwks_uri":                              s.URL + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != s.ClientID ||
+		q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	code := randomString()
+	s.mu.Lock()
+	s.codes[code] = grant{
+		redirectURI: q.Get("redirect_uri"),
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		user:        s.user,
+	}
+	s.mu.Unlock()
+	back := redirect.Query()
+	back.Set("code", code)
+	back.Set("state", q.Get("state"))
+	redirect.RawQuery = back.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if s.ClientSecret != "" {
+		id, secret, ok := r.BasicAuth()
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		if !ok || id != s.ClientID || secret != s.ClientSecret {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+	}
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	g, ok := s.codes[code]
+	delete(s.codes, code)
+	s.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || g.redirectURI != r.PostForm.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   s.URL,
+		"sub":   g.user.Subject,
+		"aud":   s.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(s.expiry).Unix(),
+		"nonce": g.nonce,
+	}
+	if g.user.Email != "" {
+		claims["email"] = g.user.Email
+		claims["email_verified"] = g.user.EmailVerified
+	}
+	if g.user.PreferredUsername != "" {
+		claims["preferred_username"] = g.user.PreferredUsername
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(s.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   int(s.expiry.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+func (s *Server) keys(w http.ResponseWriter, r *http.Request) {
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Login plays the browser: it opens the authorization URL and returns the
+// callback URL the provider sends it back to.
+func (s *Server) Login(authURL string) (*url.URL, error) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("authorize: %s", resp.Status)
+	}
+	return resp.Location()
+}
@@ -1,102 +1,278 @@
 package post_repo
 
 import (
-	"asperitas-clone/pkg/items"
+	"context"
+	"errors"
+	"time"
 
-	mgo "gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/query"
 
-	_ "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const DefaultTimeout = 5 * time.Second
+
 type PostRepo struct {
-	PostDB *mgo.Collection
+	PostDB *mongo.Collection
+	// Timeout bounds every call, on top of the deadline of its context
+	Timeout time.Duration
+}
+
+func (repo *PostRepo) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := repo.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
 }
 
-func (repo *PostRepo) GetAllPosts() ([]*items.Post, error) {
+func (repo *PostRepo) find(ctx context.Context, filter interface{}) ([]*items.Post, error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+	cursor, err := repo.PostDB.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
 	posts := []*items.Post{}
-	err := repo.PostDB.Find(bson.M{}).All(&posts)
+	err = cursor.All(ctx, &posts)
 	if err != nil {
 		return nil, err
 	}
 	return posts, nil
 }
 
-func (repo *PostRepo) GetPostsByCategory(category string) ([]*items.Post, error) {
-	posts := []*items.Post{}
-	err := repo.PostDB.Find(bson.M{"category": category}).All(&posts)
+// replace stores the whole post, the handlers always change posts they have
+// just read.
+func (repo *PostRepo) replace(ctx context.Context, post *items.Post) error {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+	result, err := repo.PostDB.ReplaceOne(ctx, bson.M{"id": post.ID}, post)
 	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return items.ErrPostNotFound
+	}
+	return nil
+}
+
+func (repo *PostRepo) GetAllPosts(ctx context.Context) ([]*items.Post, error) {
+	return repo.find(ctx, bson.M{})
+}
+
+func (repo *PostRepo) GetPostsByCategory(ctx context.Context, category string) ([]*items.Post, error) {
+	return repo.find(ctx, bson.M{"category": category})
+}
+
+// GetPostByID returns items.ErrPostNotFound if there is no such post.
+// GetRecentPosts returns at most limit posts of the categories created
+// since then, newest first. No categories mean all of them, a zero since
+// posts of any age.
+func (repo *PostRepo) GetRecentPosts(ctx context.Context, categories []string, since time.Time, limit int) ([]*items.Post, error) {
+	filter := bson.M{}
+	if len(categories) != 0 {
+		filter["category"] = bson.M{"$in": categories}
+	}
+	if !since.IsZero() {
+		filter["created"] = bson.M{"$gte": since}
+	}
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created", Value: -1}}).
+		SetLimit(int64(limit))
+	cursor, err := repo.PostDB.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	posts := []*items.Post{}
+	if err = cursor.All(ctx, &posts); err != nil {
 		return nil, err
 	}
 	return posts, nil
 }
 
-func (repo *PostRepo) GetPostByID(id bson.ObjectId) (*items.Post, error) {
+func (repo *PostRepo) GetPostByID(ctx context.Context, id primitive.ObjectID) (*items.Post, error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
 	post := &items.Post{}
-	err := repo.PostDB.Find(bson.M{"id": id}).One(post)
-	if err != nil {
+	err := repo.PostDB.FindOne(ctx, bson.M{"id": id}).Decode(post)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, items.ErrPostNotFound
+	} else if err != nil {
 		return nil, err
 	}
 	return post, nil
 }
 
-func (repo *PostRepo) AddPost(post *items.Post) (bson.ObjectId, error) {
-	post.ID = bson.NewObjectId()
-	err := repo.PostDB.Insert(post)
+func (repo *PostRepo) AddPost(ctx context.Context, post *items.Post) (primitive.ObjectID, error) {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+	post.ID = primitive.NewObjectID()
+	_, err := repo.PostDB.InsertOne(ctx, post)
+	return post.ID, err
+}
+
+func (repo *PostRepo) PostComment(ctx context.Context, post *items.Post, comment *items.Comment) (primitive.ObjectID, error) {
+	comment.ID = primitive.NewObjectID()
+	post.Comments = append(post.Comments, comment)
+	err := repo.replace(ctx, post)
+	return comment.ID, err
+}
+
+func (repo *PostRepo) DeleteComment(ctx context.Context, post *items.Post, commentid primitive.ObjectID, userid int) error {
+	ind, err := findComment(post, commentid, userid)
 	if err != nil {
-		return post.ID, err
+		return err
 	}
+	post.Comments = append(post.Comments[:ind], post.Comments[ind+1:]...)
+	return repo.replace(ctx, post)
+}
 
-	return post.ID, nil
+func (repo *PostRepo) DeletePost(ctx context.Context, postid primitive.ObjectID, user *items.User) error {
+	post, err := repo.GetPostByID(ctx, postid)
+	if err != nil {
+		return err
+	}
+	if post.Author.ID != user.ID {
+		return items.ErrPermissionDenied
+	}
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+	_, err = repo.PostDB.DeleteOne(ctx, bson.M{"id": postid})
+	return err
 }
 
-func (repo *PostRepo) PostComment(post *items.Post, comment *items.Comment) (bson.ObjectId, error) {
-	comment.ID = bson.NewObjectId()
-	post.Comments = append(post.Comments, comment)
-	err := repo.PostDB.Update(bson.M{"id": post.ID}, post)
-	return comment.ID, err
+func (repo *PostRepo) DeleteUserFromVoteTry(ctx context.Context, post *items.Post, userID int) error {
+	if !removeVote(post, userID) {
+		return nil
+	}
+	return repo.replace(ctx, post)
 }
 
-func (repo *PostRepo) DeleteComment(post *items.Post, commentid bson.ObjectId, userid int) error {
-	for ind, comment := range post.Comments {
+func (repo *PostRepo) Vote(ctx context.Context, post *items.Post, userID int, vote int) error {
+	addVote(post, userID, vote)
+	return repo.replace(ctx, post)
+}
+
+// VoteComment replaces the vote of the user on the comment, a zero vote only
+// takes the old one back.
+func (repo *PostRepo) VoteComment(ctx context.Context, post *items.Post, commentid primitive.ObjectID, userID int, vote int) error {
+	for _, comment := range post.Comments {
 		if comment.ID == commentid {
-			if comment.Author.ID == userid {
-				post.Comments = append(post.Comments[:ind], post.Comments[ind+1:]...)
-				return repo.PostDB.Update(bson.M{"id": post.ID}, post)
-			} else {
-				return items.ErrPermissionDenied
-			}
+			voteComment(comment, userID, vote)
+			return repo.replace(ctx, post)
 		}
 	}
 	return items.ErrCommentNotFound
 }
 
-func (repo *PostRepo) DeletePost(postid bson.ObjectId, user *items.User) error {
-	post, err := repo.GetPostByID(postid)
+func (repo *PostRepo) GetPostsByUsername(ctx context.Context, username string) ([]*items.Post, error) {
+	return repo.find(ctx, bson.M{"author.username": username})
+}
+
+func (repo *PostRepo) GetPostsByFilter(ctx context.Context, q *query.Query) ([]*items.Post, error) {
+	return repo.find(ctx, q.Filter())
+}
+
+// GetPostsByCommenter returns the posts with comments of the user.
+func (repo *PostRepo) GetPostsByCommenter(ctx context.Context, userID int) ([]*items.Post, error) {
+	return repo.find(ctx, bson.M{"comments.author.id": userID})
+}
+
+// GetPostsByIDs returns the posts in the order of ids, skipping missing ones.
+func (repo *PostRepo) GetPostsByIDs(ctx context.Context, ids []primitive.ObjectID) ([]*items.Post, error) {
+	found, err := repo.find(ctx, bson.M{"id": bson.M{"$in": ids}})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if post.Author.ID == user.ID {
-		err = repo.PostDB.Remove(bson.M{"id": postid})
-		if err != nil {
+	byID := make(map[primitive.ObjectID]*items.Post, len(found))
+	for _, post := range found {
+		byID[post.ID] = post
+	}
+	posts := make([]*items.Post, 0, len(found))
+	for _, id := range ids {
+		if post, ok := byID[id]; ok {
+			posts = append(posts, post)
 		}
+	}
+	return posts, nil
+}
+
+// RenameAuthor updates the copies of the user's name in their posts and
+// comments.
+func (repo *PostRepo) RenameAuthor(ctx context.Context, userID int, username string) error {
+	return repo.setAuthor(ctx, userID, ".username", username)
+}
+
+// AnonymizeAuthor replaces the user in their posts and comments with
+// items.DeletedUser.
+func (repo *PostRepo) AnonymizeAuthor(ctx context.Context, userID int) error {
+	return repo.setAuthor(ctx, userID, "", items.DeletedUser())
+}
+
+// DeleteAuthorComments removes every comment of the user.
+func (repo *PostRepo) DeleteAuthorComments(ctx context.Context, userID int) error {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+	_, err := repo.PostDB.UpdateMany(ctx,
+		bson.M{"comments.author.id": userID},
+		bson.M{"$pull": bson.M{"comments": bson.M{"author.id": userID}}},
+	)
+	return err
+}
+
+// setAuthor sets field of the author of posts and comments of the user, an
+// empty field replaces the whole author.
+func (repo *PostRepo) setAuthor(ctx context.Context, userID int, field string, value interface{}) error {
+	ctx, cancel := repo.withTimeout(ctx)
+	defer cancel()
+	_, err := repo.PostDB.UpdateMany(ctx,
+		bson.M{"author.id": userID},
+		bson.M{"$set": bson.M{"author" + field: value}},
+	)
+	if err != nil {
 		return err
 	}
-	return items.ErrPermissionDenied
+	_, err = repo.PostDB.UpdateMany(ctx,
+		bson.M{"comments.author.id": userID},
+		bson.M{"$set": bson.M{"comments.$[c].author" + field: value}},
+		options.Update().SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.M{"c.author.id": userID}},
+		}),
+	)
+	return err
+}
+
+func findComment(post *items.Post, commentid primitive.ObjectID, userid int) (int, error) {
+	for ind, comment := range post.Comments {
+		if comment.ID == commentid {
+			if comment.Author.ID != userid {
+				return 0, items.ErrPermissionDenied
+			}
+			return ind, nil
+		}
+	}
+	return 0, items.ErrCommentNotFound
 }
 
-func (repo *PostRepo) DeleteUserFromVoteTry(post *items.Post, userID int) error {
+// removeVote takes back the vote of the user, it reports whether there was one.
+func removeVote(post *items.Post, userID int) bool {
 	for ind, vote := range post.Votes {
 		if userID == vote.User {
 			post.Score -= vote.Vote
 			post.Votes = append(post.Votes[:ind], post.Votes[ind+1:]...)
-			return repo.PostDB.Update(bson.M{"id": post.ID}, post)
+			return true
 		}
 	}
-	return nil
+	return false
 }
 
-func (repo *PostRepo) Vote(post *items.Post, userID int, vote int) error {
+func addVote(post *items.Post, userID int, vote int) {
 	if vote != 0 {
 		post.Votes = append(post.Votes,
 			items.Vote{
@@ -113,17 +289,19 @@ func (repo *PostRepo) Vote(post *items.Post, userID int, vote int) error {
 	}
 	if len(post.Votes) != 0 {
 		post.UpvotePercentage = 100 * post.UpvotePercentage / len(post.Votes)
-	} else {
-		post.UpvotePercentage = 0
 	}
-	return repo.PostDB.Update(bson.M{"id": post.ID}, post)
 }
 
-func (repo *PostRepo) GetPostsByUsername(username string) ([]*items.Post, error) {
-	posts := []*items.Post{}
-	err := repo.PostDB.Find(bson.M{"author.username": username}).All(&posts)
-	if err != nil {
-		return nil, err
+func voteComment(comment *items.Comment, userID int, vote int) {
+	for ind, v := range comment.Votes {
+		if v.User == userID {
+			comment.Score -= v.Vote
+			comment.Votes = append(comment.Votes[:ind], comment.Votes[ind+1:]...)
+			break
+		}
+	}
+	if vote != 0 {
+		comment.Votes = append(comment.Votes, items.Vote{User: userID, Vote: vote})
+		comment.Score += vote
 	}
-	return posts, nil
 }
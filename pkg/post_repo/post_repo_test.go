@@ -0,0 +1,304 @@
+package post_repo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/query"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestVotes(t *testing.T) {
+	post := &items.Post{ID: primitive.NewObjectID()}
+
+	addVote(post, 1, 1)
+	addVote(post, 2, -1)
+	addVote(post, 3, 1)
+	addVote(post, 4, 1)
+	if post.Score != 2 || post.UpvotePercentage != 75 || len(post.Votes) != 4 {
+		t.Errorf("unexpected votes: score %d, upvotes %d%%, votes %v", post.Score, post.UpvotePercentage, post.Votes)
+		return
+	}
+
+	// Unvote keeps the percentage until the next vote
+	if !removeVote(post, 2) {
+		t.Errorf("expected vote of user 2 to be removed")
+		return
+	}
+	if post.Score != 3 || len(post.Votes) != 3 {
+		t.Errorf("unexpected votes: score %d, votes %v", post.Score, post.Votes)
+		return
+	}
+	addVote(post, 2, 0)
+	if post.Score != 3 || post.UpvotePercentage != 100 || len(post.Votes) != 3 {
+		t.Errorf("unexpected votes: score %d, upvotes %d%%, votes %v", post.Score, post.UpvotePercentage, post.Votes)
+		return
+	}
+
+	// No vote to remove
+	if removeVote(post, 5) {
+		t.Errorf("expected no vote of user 5")
+		return
+	}
+}
+
+func TestCommentVotes(t *testing.T) {
+	comment := &items.Comment{ID: primitive.NewObjectID()}
+
+	voteComment(comment, 1, 1)
+	voteComment(comment, 2, 1)
+	if comment.Score != 2 || len(comment.Votes) != 2 {
+		t.Errorf("unexpected votes: score %d, votes %v", comment.Score, comment.Votes)
+		return
+	}
+
+	// Changed vote replaces the old one
+	voteComment(comment, 2, -1)
+	if comment.Score != 0 || len(comment.Votes) != 2 {
+		t.Errorf("unexpected votes: score %d, votes %v", comment.Score, comment.Votes)
+		return
+	}
+
+	// Unvote
+	voteComment(comment, 1, 0)
+	if comment.Score != -1 || len(comment.Votes) != 1 {
+		t.Errorf("unexpected votes: score %d, votes %v", comment.Score, comment.Votes)
+		return
+	}
+}
+
+func TestFindComment(t *testing.T) {
+	author := &items.User{ID: 1, Username: "admin"}
+	post := &items.Post{
+		Comments: []*items.Comment{
+			{ID: primitive.NewObjectID(), Author: author},
+			{ID: primitive.NewObjectID(), Author: author},
+		},
+	}
+
+	ind, err := findComment(post, post.Comments[1].ID, author.ID)
+	if err != nil || ind != 1 {
+		t.Errorf("unexpected result: %d, %v", ind, err)
+		return
+	}
+
+	// Not the author
+	_, err = findComment(post, post.Comments[0].ID, 2)
+	if err != items.ErrPermissionDenied {
+		t.Errorf("expected ErrPermissionDenied, got %v", err)
+		return
+	}
+
+	// No such comment
+	_, err = findComment(post, primitive.NewObjectID(), author.ID)
+	if err != items.ErrCommentNotFound {
+		t.Errorf("expected ErrCommentNotFound, got %v", err)
+		return
+	}
+}
+
+// testRepo connects to the MongoDB in TEST_MONGO_URI and returns a repo on a
+// fresh collection, the test is skipped when the variable is unset.
+func testRepo(t *testing.T) *PostRepo {
+	uri := os.Getenv("TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGO_URI is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("cant connect to mongo: %s", err)
+	}
+	collection := client.Database("posts_test").Collection(primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		collection.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+	return &PostRepo{PostDB: collection}
+}
+
+func TestPostRepo(t *testing.T) {
+	repo := testRepo(t)
+	ctx := context.Background()
+	admin := &items.User{ID: 1, Username: "admin"}
+	guest := &items.User{ID: 2, Username: "guest"}
+
+	post := &items.Post{
+		Author:   admin,
+		Category: "music",
+		Title:    "abacaba",
+		Type:     "text",
+		Text:     "text",
+		Created:  time.Now().UTC().Truncate(time.Millisecond),
+		Comments: []*items.Comment{},
+		Votes:    []items.Vote{},
+	}
+	id, err := repo.AddPost(ctx, post)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	_, err = repo.AddPost(ctx, &items.Post{Author: guest, Category: "news", Title: "other"})
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+
+	found, err := repo.GetPostByID(ctx, id)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if found.Title != post.Title || !found.Created.Equal(post.Created) || found.Author.Username != "admin" {
+		t.Errorf("results not match, want %v, have %v", post, found)
+		return
+	}
+
+	_, err = repo.GetPostByID(ctx, primitive.NewObjectID())
+	if !errors.Is(err, items.ErrPostNotFound) {
+		t.Errorf("expected ErrPostNotFound, got %v", err)
+		return
+	}
+
+	// Listings
+	posts, err := repo.GetAllPosts(ctx)
+	if err != nil || len(posts) != 2 {
+		t.Errorf("expected 2 posts, got %v, %v", posts, err)
+		return
+	}
+	posts, err = repo.GetPostsByCategory(ctx, "music")
+	if err != nil || len(posts) != 1 || posts[0].ID != id {
+		t.Errorf("expected music post, got %v, %v", posts, err)
+		return
+	}
+	posts, err = repo.GetPostsByUsername(ctx, "guest")
+	if err != nil || len(posts) != 1 || posts[0].Title != "other" {
+		t.Errorf("expected guest post, got %v, %v", posts, err)
+		return
+	}
+	posts, err = repo.GetPostsByFilter(ctx, &query.Query{Terms: []string{"abacaba"}})
+	if err != nil || len(posts) != 1 || posts[0].ID != id {
+		t.Errorf("expected filtered post, got %v, %v", posts, err)
+		return
+	}
+	posts, err = repo.GetPostsByIDs(ctx, []primitive.ObjectID{primitive.NewObjectID(), id})
+	if err != nil || len(posts) != 1 || posts[0].ID != id {
+		t.Errorf("expected post by id, got %v, %v", posts, err)
+		return
+	}
+	posts, err = repo.GetRecentPosts(ctx, nil, time.Now().Add(-time.Hour), 10)
+	if err != nil || len(posts) != 1 || posts[0].ID != id {
+		t.Errorf("expected post of the last hour, got %v, %v", posts, err)
+		return
+	}
+	posts, err = repo.GetRecentPosts(ctx, nil, time.Time{}, 1)
+	if err != nil || len(posts) != 1 || posts[0].ID != id {
+		t.Errorf("expected newest post, got %v, %v", posts, err)
+		return
+	}
+	posts, err = repo.GetRecentPosts(ctx, []string{"news"}, time.Time{}, 10)
+	if err != nil || len(posts) != 1 || posts[0].Title != "other" {
+		t.Errorf("expected recent news post, got %v, %v", posts, err)
+		return
+	}
+
+	// Votes
+	err = repo.Vote(ctx, found, guest.ID, -1)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	found, _ = repo.GetPostByID(ctx, id)
+	if found.Score != -1 || len(found.Votes) != 1 {
+		t.Errorf("vote not stored: %v", found)
+		return
+	}
+	err = repo.DeleteUserFromVoteTry(ctx, found, guest.ID)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	found, _ = repo.GetPostByID(ctx, id)
+	if found.Score != 0 || len(found.Votes) != 0 {
+		t.Errorf("unvote not stored: %v", found)
+		return
+	}
+
+	// Comments
+	commentID, err := repo.PostComment(ctx, found, &items.Comment{Author: guest, Body: "hi"})
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	found, _ = repo.GetPostByID(ctx, id)
+	if len(found.Comments) != 1 || found.Comments[0].ID != commentID {
+		t.Errorf("comment not stored: %v", found.Comments)
+		return
+	}
+	posts, err = repo.GetPostsByCommenter(ctx, guest.ID)
+	if err != nil || len(posts) != 1 || posts[0].ID != id {
+		t.Errorf("expected commented post, got %v, %v", posts, err)
+		return
+	}
+	err = repo.VoteComment(ctx, found, commentID, admin.ID, 1)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	found, _ = repo.GetPostByID(ctx, id)
+	if found.Comments[0].Score != 1 || len(found.Comments[0].Votes) != 1 {
+		t.Errorf("comment vote not stored: %v", found.Comments[0])
+		return
+	}
+	err = repo.VoteComment(ctx, found, primitive.NewObjectID(), admin.ID, 1)
+	if err != items.ErrCommentNotFound {
+		t.Errorf("expected ErrCommentNotFound, got %v", err)
+		return
+	}
+	err = repo.DeleteComment(ctx, found, commentID, admin.ID)
+	if err != items.ErrPermissionDenied {
+		t.Errorf("expected ErrPermissionDenied, got %v", err)
+		return
+	}
+	err = repo.DeleteComment(ctx, found, commentID, guest.ID)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+
+	// Delete
+	err = repo.DeletePost(ctx, id, guest)
+	if err != items.ErrPermissionDenied {
+		t.Errorf("expected ErrPermissionDenied, got %v", err)
+		return
+	}
+	err = repo.DeletePost(ctx, id, admin)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	err = repo.Vote(ctx, found, guest.ID, 1)
+	if !errors.Is(err, items.ErrPostNotFound) {
+		t.Errorf("expected ErrPostNotFound, got %v", err)
+		return
+	}
+}
+
+func TestPostRepoTimeout(t *testing.T) {
+	repo := testRepo(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := repo.GetAllPosts(ctx)
+	if err == nil {
+		t.Errorf("expected error on canceled context")
+		return
+	}
+}
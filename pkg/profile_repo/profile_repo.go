@@ -0,0 +1,91 @@
+package profile_repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"asperitas-clone/pkg/items"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+type ProfileRepo struct {
+	ProfileDB *sql.DB
+}
+
+// GetProfile returns nil if there is no such user. Users registered before
+// profiles existed have no profiles row and get an empty profile.
+func (repo *ProfileRepo) GetProfile(ctx context.Context, username string) (*items.Profile, error) {
+	profile := &items.Profile{}
+	var registered sql.NullTime
+	row := repo.ProfileDB.QueryRowContext(
+		ctx,
+		"SELECT u.id, u.username, p.registered, COALESCE(p.bio, ''), COALESCE(p.avatar, ''), "+
+			"COALESCE(p.post_karma, 0), COALESCE(p.comment_karma, 0), COALESCE(p.posts, 0), COALESCE(p.comments, 0) "+
+			"FROM users u LEFT JOIN profiles p ON p.userid = u.id WHERE u.username = ?",
+		username,
+	)
+	err := row.Scan(
+		&profile.ID,
+		&profile.Username,
+		&registered,
+		&profile.Bio,
+		&profile.AvatarURL,
+		&profile.PostKarma,
+		&profile.CommentKarma,
+		&profile.Posts,
+		&profile.Comments,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if registered.Valid {
+		profile.Registered = &registered.Time
+	}
+	return profile, nil
+}
+
+func (repo *ProfileRepo) CreateProfile(ctx context.Context, userID int, registered time.Time) error {
+	_, err := repo.ProfileDB.ExecContext(
+		ctx,
+		"INSERT INTO `profiles` (`userid`, `registered`) VALUES (?, ?) "+
+			"ON DUPLICATE KEY UPDATE `registered` = VALUES(`registered`)",
+		userID,
+		registered,
+	)
+	return err
+}
+
+func (repo *ProfileRepo) UpdateProfile(ctx context.Context, userID int, bio, avatarURL string) error {
+	_, err := repo.ProfileDB.ExecContext(
+		ctx,
+		"INSERT INTO `profiles` (`userid`, `bio`, `avatar`) VALUES (?, ?, ?) "+
+			"ON DUPLICATE KEY UPDATE `bio` = VALUES(`bio`), `avatar` = VALUES(`avatar`)",
+		userID,
+		bio,
+		avatarURL,
+	)
+	return err
+}
+
+// AddStats adds delta to the counters of the user in a single statement, so
+// concurrent updates never lose increments.
+func (repo *ProfileRepo) AddStats(ctx context.Context, userID int, delta items.ProfileStats) error {
+	_, err := repo.ProfileDB.ExecContext(
+		ctx,
+		"INSERT INTO `profiles` (`userid`, `post_karma`, `comment_karma`, `posts`, `comments`) VALUES (?, ?, ?, ?, ?) "+
+			"ON DUPLICATE KEY UPDATE `post_karma` = `post_karma` + VALUES(`post_karma`), "+
+			"`comment_karma` = `comment_karma` + VALUES(`comment_karma`), "+
+			"`posts` = `posts` + VALUES(`posts`), `comments` = `comments` + VALUES(`comments`)",
+		userID,
+		delta.PostKarma,
+		delta.CommentKarma,
+		delta.Posts,
+		delta.Comments,
+	)
+	return err
+}
@@ -0,0 +1,162 @@
+package profile_repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"asperitas-clone/pkg/items"
+
+	_ "github.com/go-sql-driver/mysql"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var (
+	ErrDB = errors.New("DB_ERROR")
+)
+
+func TestGetProfile(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	registered := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	expect := &items.Profile{
+		ID:         10,
+		Username:   "admin",
+		Registered: &registered,
+		Bio:        "hello",
+		AvatarURL:  "https://example.com/a.png",
+		ProfileStats: items.ProfileStats{
+			PostKarma:    5,
+			CommentKarma: 0,
+			Posts:        2,
+			Comments:     3,
+		},
+	}
+	columns := []string{"id", "username", "registered", "bio", "avatar", "post_karma", "comment_karma", "posts", "comments"}
+
+	// Good query
+	mock.
+		ExpectQuery("SELECT u.id, u.username, p.registered").
+		WithArgs("admin").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(10, "admin", registered, "hello", "https://example.com/a.png", 5, 0, 2, 3))
+	repo := &ProfileRepo{ProfileDB: db}
+	profile, err := repo.GetProfile(context.Background(), "admin")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+	if !reflect.DeepEqual(profile, expect) {
+		t.Errorf("results not match, want %v, have %v", expect, profile)
+		return
+	}
+
+	// User without profiles row
+	mock.
+		ExpectQuery("SELECT u.id, u.username, p.registered").
+		WithArgs("old").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(11, "old", nil, "", "", 0, 0, 0, 0))
+	profile, err = repo.GetProfile(context.Background(), "old")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if profile.Registered != nil || profile.ID != 11 {
+		t.Errorf("unexpected profile: %v", profile)
+		return
+	}
+
+	// No user
+	mock.
+		ExpectQuery("SELECT u.id, u.username, p.registered").
+		WithArgs("nobody").
+		WillReturnError(sql.ErrNoRows)
+	profile, err = repo.GetProfile(context.Background(), "nobody")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if profile != nil {
+		t.Errorf("results not match, want %v, have %v", nil, profile)
+		return
+	}
+
+	// DB error
+	mock.
+		ExpectQuery("SELECT u.id, u.username, p.registered").
+		WithArgs("admin").
+		WillReturnError(ErrDB)
+	_, err = repo.GetProfile(context.Background(), "admin")
+	if !errors.Is(err, ErrDB) {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+}
+
+func TestAddStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	// Good query
+	mock.
+		ExpectExec("INSERT INTO `profiles`").
+		WithArgs(10, -2, 0, 0, 1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	repo := &ProfileRepo{ProfileDB: db}
+	err = repo.AddStats(context.Background(), 10, items.ProfileStats{PostKarma: -2, Comments: 1})
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+
+	// DB error
+	mock.
+		ExpectExec("INSERT INTO `profiles`").
+		WithArgs(10, 1, 0, 1, 0).
+		WillReturnError(ErrDB)
+	err = repo.AddStats(context.Background(), 10, items.ProfileStats{PostKarma: 1, Posts: 1})
+	if !errors.Is(err, ErrDB) {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	mock.
+		ExpectExec("INSERT INTO `profiles`").
+		WithArgs(10, "bio", "https://example.com/a.png").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	repo := &ProfileRepo{ProfileDB: db}
+	err = repo.UpdateProfile(context.Background(), 10, "bio", "https://example.com/a.png")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
@@ -0,0 +1,328 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"asperitas-clone/pkg/items"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Query is a parsed search string such as
+//
+//	author:alice category:music score:>10 type:link before:2026-01-01 "exact phrase" words
+type Query struct {
+	Terms    []string
+	Phrases  []string
+	Author   string
+	Category string
+	Type     string
+	MinScore *int
+	MaxScore *int
+	After    time.Time
+	Before   time.Time
+}
+
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos, e.Msg)
+}
+
+var fields = []string{"author", "category", "type", "score", "before", "after"}
+
+func Parse(input string) (*Query, error) {
+	p := &parser{input: []rune(input), query: &Query{}}
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.input) {
+			return p.query, nil
+		}
+		if err := p.parseItem(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type parser struct {
+	input []rune
+	pos   int
+	query *Query
+	seen  map[string]bool
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *parser) parseItem() error {
+	start := p.pos
+	if p.input[p.pos] == '"' {
+		phrase, err := p.readQuoted()
+		if err != nil {
+			return err
+		}
+		if phrase != "" {
+			p.query.Phrases = append(p.query.Phrases, phrase)
+		}
+		return nil
+	}
+
+	word := p.readWord()
+	colon := strings.IndexRune(word, ':')
+	if colon < 0 {
+		p.query.Terms = append(p.query.Terms, word)
+		return nil
+	}
+	key := strings.ToLower(word[:colon])
+	if !isField(key) {
+		return &ParseError{
+			Pos: start,
+			Msg: fmt.Sprintf("unknown field %q (expected one of %s), quote the word to search for it", key, strings.Join(fields, ", ")),
+		}
+	}
+	value := word[colon+1:]
+	valuePos := start + len([]rune(word[:colon+1]))
+	if value == "" && p.pos < len(p.input) && p.input[p.pos] == '"' {
+		var err error
+		if value, err = p.readQuoted(); err != nil {
+			return err
+		}
+	}
+	if value == "" {
+		return &ParseError{Pos: valuePos, Msg: fmt.Sprintf("empty value for %s", key)}
+	}
+	if key != "score" {
+		if p.seen[key] {
+			return &ParseError{Pos: start, Msg: fmt.Sprintf("%s is given more than once", key)}
+		}
+		if p.seen == nil {
+			p.seen = make(map[string]bool)
+		}
+		p.seen[key] = true
+	}
+	return p.setField(key, value, valuePos)
+}
+
+// readWord reads up to the next space or opening quote.
+func (p *parser) readWord() string {
+	start := p.pos
+	for p.pos < len(p.input) && !unicode.IsSpace(p.input[p.pos]) && p.input[p.pos] != '"' {
+		p.pos++
+	}
+	return string(p.input[start:p.pos])
+}
+
+func (p *parser) readQuoted() (string, error) {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.input) {
+		if p.input[p.pos] == '"' {
+			p.pos++
+			return strings.TrimSpace(string(p.input[start+1 : p.pos-1])), nil
+		}
+		p.pos++
+	}
+	return "", &ParseError{Pos: start, Msg: "unterminated quote"}
+}
+
+func (p *parser) setField(key, value string, pos int) error {
+	switch key {
+	case "author":
+		p.query.Author = value
+	case "category":
+		p.query.Category = value
+	case "type":
+		if value != "text" && value != "link" {
+			return &ParseError{Pos: pos, Msg: fmt.Sprintf("type must be text or link, got %q", value)}
+		}
+		p.query.Type = value
+	case "before", "after":
+		date, err := ParseDate(value)
+		if err != nil {
+			return &ParseError{Pos: pos, Msg: fmt.Sprintf("%s expects a date like 2006-01-02, got %q", key, value)}
+		}
+		if key == "before" {
+			p.query.Before = date
+		} else {
+			p.query.After = date
+		}
+	case "score":
+		return p.setScore(value, pos)
+	}
+	return nil
+}
+
+func (p *parser) setScore(value string, pos int) error {
+	op := ""
+	for _, prefix := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, prefix) {
+			op = prefix
+			break
+		}
+	}
+	n, err := strconv.Atoi(value[len(op):])
+	if err != nil {
+		return &ParseError{Pos: pos, Msg: fmt.Sprintf("score expects a number optionally prefixed with >, >=, <, <= or =, got %q", value)}
+	}
+	switch op {
+	case ">":
+		n++
+		fallthrough
+	case ">=":
+		p.query.MinScore = &n
+	case "<":
+		n--
+		fallthrough
+	case "<=":
+		p.query.MaxScore = &n
+	default:
+		min, max := n, n
+		p.query.MinScore, p.query.MaxScore = &min, &max
+	}
+	return nil
+}
+
+func isField(key string) bool {
+	for _, field := range fields {
+		if key == field {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDate accepts either a plain date or a full RFC 3339 timestamp.
+func ParseDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// MatchFields reports whether post satisfies every condition except the free
+// text terms and phrases.
+func (q *Query) MatchFields(post *items.Post) bool {
+	if q.Author != "" && (post.Author == nil || post.Author.Username != q.Author) {
+		return false
+	}
+	if q.Category != "" && post.Category != q.Category {
+		return false
+	}
+	if q.Type != "" && post.Type != q.Type {
+		return false
+	}
+	if q.MinScore != nil && post.Score < *q.MinScore {
+		return false
+	}
+	if q.MaxScore != nil && post.Score > *q.MaxScore {
+		return false
+	}
+	if !q.After.IsZero() && post.Created.Before(q.After) {
+		return false
+	}
+	if !q.Before.IsZero() && !post.Created.Before(q.Before) {
+		return false
+	}
+	return true
+}
+
+// MatchText reports whether every term and phrase occurs, case-insensitively,
+// in the title, text or one of the comments of post.
+func (q *Query) MatchText(post *items.Post) bool {
+	content := []string{strings.ToLower(post.Title), strings.ToLower(post.Text)}
+	for _, comment := range post.Comments {
+		content = append(content, strings.ToLower(comment.Body))
+	}
+	for _, needle := range append(append([]string{}, q.Terms...), q.Phrases...) {
+		needle = strings.ToLower(needle)
+		found := false
+		for _, c := range content {
+			if strings.Contains(c, needle) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *Query) Match(post *items.Post) bool {
+	return q.MatchFields(post) && q.MatchText(post)
+}
+
+// FieldFilter is the Mongo equivalent of MatchFields.
+func (q *Query) FieldFilter() bson.M {
+	filter := bson.M{}
+	if q.Author != "" {
+		filter["author.username"] = q.Author
+	}
+	if q.Category != "" {
+		filter["category"] = q.Category
+	}
+	if q.Type != "" {
+		filter["type"] = q.Type
+	}
+	score := bson.M{}
+	if q.MinScore != nil {
+		score["$gte"] = *q.MinScore
+	}
+	if q.MaxScore != nil {
+		score["$lte"] = *q.MaxScore
+	}
+	if len(score) != 0 {
+		filter["score"] = score
+	}
+	created := bson.M{}
+	if !q.After.IsZero() {
+		created["$gte"] = q.After
+	}
+	if !q.Before.IsZero() {
+		created["$lt"] = q.Before
+	}
+	if len(created) != 0 {
+		filter["created"] = created
+	}
+	return filter
+}
+
+// TextSearch renders terms and phrases for a Mongo $text query.
+func (q *Query) TextSearch() string {
+	parts := append([]string{}, q.Terms...)
+	for _, phrase := range q.Phrases {
+		parts = append(parts, strconv.Quote(phrase))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Filter is the Mongo equivalent of Match.
+func (q *Query) Filter() bson.M {
+	filter := q.FieldFilter()
+	and := []bson.M{}
+	for _, needle := range append(append([]string{}, q.Terms...), q.Phrases...) {
+		re := primitive.Regex{Pattern: regexp.QuoteMeta(needle), Options: "i"}
+		and = append(and, bson.M{"$or": []bson.M{
+			{"title": re},
+			{"text": re},
+			{"comments.body": re},
+		}})
+	}
+	if len(and) != 0 {
+		filter["$and"] = and
+	}
+	return filter
+}
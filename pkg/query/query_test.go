@@ -0,0 +1,126 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"asperitas-clone/pkg/items"
+)
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestParse(t *testing.T) {
+	before, _ := time.Parse("2006-01-02", "2026-01-01")
+	cases := []struct {
+		input  string
+		expect *Query
+	}{
+		{
+			input: `author:alice category:music score:>10 type:link before:2026-01-01 "exact phrase" golang`,
+			expect: &Query{
+				Terms:    []string{"golang"},
+				Phrases:  []string{"exact phrase"},
+				Author:   "alice",
+				Category: "music",
+				Type:     "link",
+				MinScore: intPtr(11),
+				Before:   before,
+			},
+		},
+		{
+			input: `author:"john doe" score:>=1 score:<5`,
+			expect: &Query{
+				Author:   "john doe",
+				MinScore: intPtr(1),
+				MaxScore: intPtr(4),
+			},
+		},
+		{
+			input: `score:3 CATEGORY:news`,
+			expect: &Query{
+				Category: "news",
+				MinScore: intPtr(3),
+				MaxScore: intPtr(3),
+			},
+		},
+		{
+			input:  "   ",
+			expect: &Query{},
+		},
+	}
+	for _, c := range cases {
+		q, err := Parse(c.input)
+		if err != nil {
+			t.Errorf("%s: unexpected err: %s", c.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(q, c.expect) {
+			t.Errorf("%s: results not match, want %+v, have %+v", c.input, c.expect, q)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		input string
+		pos   int
+	}{
+		{input: `golang foo:bar`, pos: 7},
+		{input: `"unterminated`, pos: 0},
+		{input: `author:`, pos: 7},
+		{input: `score:high`, pos: 6},
+		{input: `type:video`, pos: 5},
+		{input: `before:yesterday`, pos: 7},
+		{input: `author:a author:b`, pos: 9},
+	}
+	for _, c := range cases {
+		_, err := Parse(c.input)
+		perr := &ParseError{}
+		if !errors.As(err, &perr) {
+			t.Errorf("%s: expected parse error, got %v", c.input, err)
+			continue
+		}
+		if perr.Pos != c.pos {
+			t.Errorf("%s: expected error at %d, got %d (%s)", c.input, c.pos, perr.Pos, perr.Msg)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	post := &items.Post{
+		Author:   &items.User{Username: "alice"},
+		Category: "music",
+		Type:     "text",
+		Title:    "Best Albums",
+		Text:     "of the year",
+		Score:    12,
+		Created:  time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+		Comments: []*items.Comment{{Body: "Exact phrase here"}},
+	}
+	cases := []struct {
+		input string
+		match bool
+	}{
+		{input: `author:alice category:music score:>10 before:2026-01-01 "exact phrase" albums`, match: true},
+		{input: `author:bob`, match: false},
+		{input: `score:<10`, match: false},
+		{input: `after:2026-01-01`, match: false},
+		{input: `type:link`, match: false},
+		{input: `"phrase exact"`, match: false},
+		{input: `albums missing`, match: false},
+	}
+	for _, c := range cases {
+		q, err := Parse(c.input)
+		if err != nil {
+			t.Errorf("%s: unexpected err: %s", c.input, err)
+			continue
+		}
+		if q.Match(post) != c.match {
+			t.Errorf("%s: expected match %v", c.input, c.match)
+		}
+	}
+}
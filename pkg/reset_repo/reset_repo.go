@@ -0,0 +1,130 @@
+package reset_repo
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"asperitas-clone/pkg/items"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+const DefaultTTL = time.Hour
+
+// ResetRepo keeps password reset tokens. Only hashes of the tokens are
+// stored, a token is valid for TTL and can be used once. A user has at most
+// one token, asking again replaces it.
+type ResetRepo struct {
+	ResetDB *sql.DB
+	TTL     time.Duration
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (repo *ResetRepo) ttl() time.Duration {
+	if repo.TTL <= 0 {
+		return DefaultTTL
+	}
+	return repo.TTL
+}
+
+// Create returns a new token for the user, it is never stored in clear.
+func (repo *ResetRepo) Create(ctx context.Context, userID int) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	tx, err := repo.ResetDB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "DELETE FROM `password_resets` WHERE `userid` = ?", userID)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO `password_resets` (`token_hash`, `userid`, `expires`) VALUES (?, ?, ?)",
+		hashToken(token),
+		userID,
+		time.Now().UTC().Add(repo.ttl()),
+	)
+	if err != nil {
+		return "", err
+	}
+	return token, tx.Commit()
+}
+
+// Check returns the user of a valid token without using it up, or
+// items.ErrBadResetToken.
+func (repo *ResetRepo) Check(ctx context.Context, token string) (int, error) {
+	var userID int
+	var expires time.Time
+	row := repo.ResetDB.QueryRowContext(
+		ctx,
+		"SELECT userid, expires FROM password_resets WHERE token_hash = ?",
+		hashToken(token),
+	)
+	err := row.Scan(&userID, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, items.ErrBadResetToken
+	} else if err != nil {
+		return 0, err
+	}
+	if time.Now().After(expires) {
+		return 0, items.ErrBadResetToken
+	}
+	return userID, nil
+}
+
+// Consume uses the token up and returns its user. Of concurrent calls with
+// the same token only one succeeds.
+func (repo *ResetRepo) Consume(ctx context.Context, token string) (int, error) {
+	tx, err := repo.ResetDB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var userID int
+	var expires time.Time
+	row := tx.QueryRowContext(
+		ctx,
+		"SELECT userid, expires FROM password_resets WHERE token_hash = ? FOR UPDATE",
+		hashToken(token),
+	)
+	err = row.Scan(&userID, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, items.ErrBadResetToken
+	} else if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM `password_resets` WHERE `userid` = ?", userID)
+	if err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	if time.Now().After(expires) {
+		return 0, items.ErrBadResetToken
+	}
+	return userID, nil
+}
@@ -0,0 +1,191 @@
+package reset_repo
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"asperitas-clone/pkg/items"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var (
+	ErrDB = errors.New("DB_ERROR")
+)
+
+// captured remembers the argument it matched.
+type captured struct {
+	value driver.Value
+}
+
+func (c *captured) Match(v driver.Value) bool {
+	c.value = v
+	return true
+}
+
+// anyTime matches a time within a minute of want.
+type anyTime struct {
+	want time.Time
+}
+
+func (a anyTime) Match(v driver.Value) bool {
+	t, ok := v.(time.Time)
+	return ok && t.Sub(a.want) < time.Minute && a.want.Sub(t) < time.Minute
+}
+
+func TestCreate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &ResetRepo{ResetDB: db, TTL: 30 * time.Minute}
+
+	// Good query, the old token of the user goes away
+	hash := &captured{}
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `password_resets` WHERE `userid` = \\?").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectExec("INSERT INTO `password_resets`").
+		WithArgs(hash, 1, anyTime{time.Now().UTC().Add(30 * time.Minute)}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	token, err := repo.Create(context.Background(), 1)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	} else if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+	if len(token) < 40 {
+		t.Errorf("token is too short: %q", token)
+		return
+	}
+	if hash.value == token || hash.value != hashToken(token) {
+		t.Errorf("expected the hash of the token to be stored, got %v", hash.value)
+		return
+	}
+
+	// DB error
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `password_resets`").WithArgs(1).WillReturnError(ErrDB)
+	mock.ExpectRollback()
+	_, err = repo.Create(context.Background(), 1)
+	if !errors.Is(err, ErrDB) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+}
+
+func TestCheckToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &ResetRepo{ResetDB: db}
+
+	// Valid
+	mock.
+		ExpectQuery("SELECT userid, expires FROM password_resets WHERE token_hash = \\?").
+		WithArgs(hashToken("token")).
+		WillReturnRows(sqlmock.NewRows([]string{"userid", "expires"}).AddRow(1, time.Now().Add(time.Minute)))
+	userID, err := repo.Check(context.Background(), "token")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	} else if userID != 1 {
+		t.Errorf("results not match, want %v, have %v", 1, userID)
+		return
+	}
+
+	// Expired
+	mock.
+		ExpectQuery("SELECT userid, expires FROM password_resets").
+		WithArgs(hashToken("token")).
+		WillReturnRows(sqlmock.NewRows([]string{"userid", "expires"}).AddRow(1, time.Now().Add(-time.Minute)))
+	_, err = repo.Check(context.Background(), "token")
+	if !errors.Is(err, items.ErrBadResetToken) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+
+	// Unknown
+	mock.
+		ExpectQuery("SELECT userid, expires FROM password_resets").
+		WithArgs(hashToken("other")).
+		WillReturnRows(sqlmock.NewRows([]string{"userid", "expires"}))
+	_, err = repo.Check(context.Background(), "other")
+	if !errors.Is(err, items.ErrBadResetToken) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestConsume(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &ResetRepo{ResetDB: db}
+
+	// Good query, every token of the user is used up
+	mock.ExpectBegin()
+	mock.
+		ExpectQuery("SELECT userid, expires FROM password_resets WHERE token_hash = \\? FOR UPDATE").
+		WithArgs(hashToken("token")).
+		WillReturnRows(sqlmock.NewRows([]string{"userid", "expires"}).AddRow(1, time.Now().Add(time.Minute)))
+	mock.ExpectExec("DELETE FROM `password_resets` WHERE `userid` = \\?").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	userID, err := repo.Consume(context.Background(), "token")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	} else if userID != 1 {
+		t.Errorf("results not match, want %v, have %v", 1, userID)
+		return
+	} else if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+
+	// Used already
+	mock.ExpectBegin()
+	mock.
+		ExpectQuery("SELECT userid, expires FROM password_resets").
+		WithArgs(hashToken("token")).
+		WillReturnRows(sqlmock.NewRows([]string{"userid", "expires"}))
+	mock.ExpectRollback()
+	_, err = repo.Consume(context.Background(), "token")
+	if !errors.Is(err, items.ErrBadResetToken) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+
+	// Expired tokens are removed too
+	mock.ExpectBegin()
+	mock.
+		ExpectQuery("SELECT userid, expires FROM password_resets").
+		WithArgs(hashToken("old")).
+		WillReturnRows(sqlmock.NewRows([]string{"userid", "expires"}).AddRow(2, time.Now().Add(-time.Minute)))
+	mock.ExpectExec("DELETE FROM `password_resets`").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	_, err = repo.Consume(context.Background(), "old")
+	if !errors.Is(err, items.ErrBadResetToken) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
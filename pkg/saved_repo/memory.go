@@ -0,0 +1,85 @@
+package saved_repo
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemorySavedRepo keeps saved posts in process memory, they are lost on
+// restart.
+type MemorySavedRepo struct {
+	mu    sync.RWMutex
+	seq   int64
+	saved map[int]map[primitive.ObjectID]int64
+}
+
+func NewMemorySavedRepo() *MemorySavedRepo {
+	return &MemorySavedRepo{
+		saved: make(map[int]map[primitive.ObjectID]int64),
+	}
+}
+
+func (repo *MemorySavedRepo) Save(ctx context.Context, userID int, postID primitive.ObjectID) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if repo.saved[userID] == nil {
+		repo.saved[userID] = make(map[primitive.ObjectID]int64)
+	}
+	if _, ok := repo.saved[userID][postID]; !ok {
+		repo.seq++
+		repo.saved[userID][postID] = repo.seq
+	}
+	return nil
+}
+
+func (repo *MemorySavedRepo) Unsave(ctx context.Context, userID int, postID primitive.ObjectID) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	delete(repo.saved[userID], postID)
+	return nil
+}
+
+func (repo *MemorySavedRepo) DeleteByPost(ctx context.Context, postID primitive.ObjectID) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, saved := range repo.saved {
+		delete(saved, postID)
+	}
+	return nil
+}
+
+func (repo *MemorySavedRepo) GetSaved(ctx context.Context, userID int, offset, limit int) ([]primitive.ObjectID, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	saved := repo.saved[userID]
+	ids := make([]primitive.ObjectID, 0, len(saved))
+	for id := range saved {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return saved[ids[i]] > saved[ids[j]]
+	})
+	if offset > len(ids) {
+		offset = len(ids)
+	}
+	end := offset + limit
+	if end > len(ids) {
+		end = len(ids)
+	}
+	return ids[offset:end], nil
+}
+
+func (repo *MemorySavedRepo) FilterSaved(ctx context.Context, userID int, ids []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	result := []primitive.ObjectID{}
+	for _, id := range ids {
+		if _, ok := repo.saved[userID][id]; ok {
+			result = append(result, id)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,66 @@
+package saved_repo
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemorySavedRepo(t *testing.T) {
+	repo := NewMemorySavedRepo()
+	first, second, third := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	repo.Save(context.Background(), 1, first)
+	repo.Save(context.Background(), 1, second)
+	repo.Save(context.Background(), 1, third)
+	repo.Save(context.Background(), 1, first)
+	repo.Save(context.Background(), 2, second)
+
+	// Newest first, saving twice keeps the original position
+	ids, _ := repo.GetSaved(context.Background(), 1, 0, 10)
+	expect := []primitive.ObjectID{third, second, first}
+	if !reflect.DeepEqual(ids, expect) {
+		t.Errorf("results not match, want %v, have %v", expect, ids)
+		return
+	}
+
+	// Pagination
+	ids, _ = repo.GetSaved(context.Background(), 1, 1, 1)
+	if !reflect.DeepEqual(ids, []primitive.ObjectID{second}) {
+		t.Errorf("results not match, want %v, have %v", []primitive.ObjectID{second}, ids)
+		return
+	}
+	ids, _ = repo.GetSaved(context.Background(), 1, 5, 1)
+	if len(ids) != 0 {
+		t.Errorf("expected empty page, got %v", ids)
+		return
+	}
+
+	// Unsave
+	repo.Unsave(context.Background(), 1, second)
+	ids, _ = repo.FilterSaved(context.Background(), 1, []primitive.ObjectID{first, second, third})
+	if !reflect.DeepEqual(ids, []primitive.ObjectID{first, third}) {
+		t.Errorf("results not match, want %v, have %v", []primitive.ObjectID{first, third}, ids)
+		return
+	}
+	ids, _ = repo.FilterSaved(context.Background(), 2, []primitive.ObjectID{first, second})
+	if !reflect.DeepEqual(ids, []primitive.ObjectID{second}) {
+		t.Errorf("results not match, want %v, have %v", []primitive.ObjectID{second}, ids)
+		return
+	}
+
+	// Deleted post is unsaved for everyone
+	repo.Save(context.Background(), 1, second)
+	repo.DeleteByPost(context.Background(), second)
+	ids, _ = repo.GetSaved(context.Background(), 1, 0, 10)
+	if !reflect.DeepEqual(ids, []primitive.ObjectID{third, first}) {
+		t.Errorf("results not match, want %v, have %v", []primitive.ObjectID{third, first}, ids)
+		return
+	}
+	ids, _ = repo.GetSaved(context.Background(), 2, 0, 10)
+	if len(ids) != 0 {
+		t.Errorf("expected no saved posts, got %v", ids)
+		return
+	}
+}
@@ -0,0 +1,117 @@
+package saved_repo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"asperitas-clone/pkg/logging"
+
+	_ "github.com/go-sql-driver/mysql"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SavedRepo struct {
+	SavedDB *sql.DB
+}
+
+func (repo *SavedRepo) Save(ctx context.Context, userID int, postID primitive.ObjectID) error {
+	_, err := repo.SavedDB.ExecContext(
+		ctx,
+		"INSERT IGNORE INTO `saved` (`userid`, `post_id`, `created`) VALUES (?, ?, ?)",
+		userID,
+		postID.Hex(),
+		time.Now().UTC(),
+	)
+	return err
+}
+
+func (repo *SavedRepo) Unsave(ctx context.Context, userID int, postID primitive.ObjectID) error {
+	_, err := repo.SavedDB.ExecContext(
+		ctx,
+		"DELETE FROM `saved` WHERE `userid` = ? AND `post_id` = ?",
+		userID,
+		postID.Hex(),
+	)
+	return err
+}
+
+// DeleteByPost unsaves the post for every user, so a deleted post doesn't
+// take a place on their saved pages.
+func (repo *SavedRepo) DeleteByPost(ctx context.Context, postID primitive.ObjectID) error {
+	_, err := repo.SavedDB.ExecContext(
+		ctx,
+		"DELETE FROM `saved` WHERE `post_id` = ?",
+		postID.Hex(),
+	)
+	return err
+}
+
+// GetSaved returns ids of posts saved by the user, most recently saved first.
+func (repo *SavedRepo) GetSaved(ctx context.Context, userID int, offset, limit int) ([]primitive.ObjectID, error) {
+	rows, err := repo.SavedDB.QueryContext(
+		ctx,
+		"SELECT post_id FROM saved WHERE userid = ? ORDER BY created DESC LIMIT ? OFFSET ?",
+		userID,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(ctx, rows)
+}
+
+// maxFilterIDs is how many ids FilterSaved puts into one IN list, longer
+// lists are queried in chunks.
+const maxFilterIDs = 100
+
+// FilterSaved returns those of ids that the user has saved.
+func (repo *SavedRepo) FilterSaved(ctx context.Context, userID int, ids []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	saved := []primitive.ObjectID{}
+	for len(ids) > 0 {
+		chunk := ids
+		if len(chunk) > maxFilterIDs {
+			chunk = chunk[:maxFilterIDs]
+		}
+		ids = ids[len(chunk):]
+		args := []interface{}{userID}
+		for _, id := range chunk {
+			args = append(args, id.Hex())
+		}
+		placeholders := strings.Repeat(", ?", len(chunk))[2:]
+		rows, err := repo.SavedDB.QueryContext(
+			ctx,
+			"SELECT post_id FROM saved WHERE userid = ? AND post_id IN ("+placeholders+")",
+			args...,
+		)
+		if err != nil {
+			return nil, err
+		}
+		found, err := scanIDs(ctx, rows)
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, found...)
+	}
+	return saved, nil
+}
+
+func scanIDs(ctx context.Context, rows *sql.Rows) ([]primitive.ObjectID, error) {
+	defer rows.Close()
+	ids := []primitive.ObjectID{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		postID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			logging.FromContext(ctx, nil).Warnw("skipping saved post with a bad id", "id", id)
+			continue
+		}
+		ids = append(ids, postID)
+	}
+	return ids, rows.Err()
+}
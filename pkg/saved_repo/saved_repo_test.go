@@ -0,0 +1,218 @@
+package saved_repo
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+
+	"asperitas-clone/pkg/logging"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var (
+	ErrDB = errors.New("DB_ERROR")
+)
+
+func TestSaveAndUnsave(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &SavedRepo{SavedDB: db}
+	postID := primitive.NewObjectID()
+
+	// Good query
+	mock.
+		ExpectExec("INSERT IGNORE INTO `saved`").
+		WithArgs(1, postID.Hex(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectExec("DELETE FROM `saved` WHERE `userid` = \\? AND `post_id` = \\?").
+		WithArgs(1, postID.Hex()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.Save(context.Background(), 1, postID); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if err := repo.Unsave(context.Background(), 1, postID); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+
+	// DB error
+	mock.
+		ExpectExec("INSERT IGNORE INTO `saved`").
+		WithArgs(1, postID.Hex(), sqlmock.AnyArg()).
+		WillReturnError(ErrDB)
+	if err := repo.Save(context.Background(), 1, postID); !errors.Is(err, ErrDB) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestDeleteByPost(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &SavedRepo{SavedDB: db}
+	postID := primitive.NewObjectID()
+
+	// Good query
+	mock.
+		ExpectExec("DELETE FROM `saved` WHERE `post_id` = \\?").
+		WithArgs(postID.Hex()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	if err := repo.DeleteByPost(context.Background(), postID); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+
+	// DB error
+	mock.
+		ExpectExec("DELETE FROM `saved` WHERE `post_id` = \\?").
+		WithArgs(postID.Hex()).
+		WillReturnError(ErrDB)
+	if err := repo.DeleteByPost(context.Background(), postID); !errors.Is(err, ErrDB) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestGetSaved(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &SavedRepo{SavedDB: db}
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+
+	// Good query, ids that aren't posts are skipped with a warning in the
+	// log of the request
+	core, logs := observer.New(zap.WarnLevel)
+	ctx := logging.WithLogger(context.Background(), zap.New(core).Sugar())
+	mock.
+		ExpectQuery("SELECT post_id FROM saved WHERE userid = \\? ORDER BY created DESC LIMIT \\? OFFSET \\?").
+		WithArgs(1, 10, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"post_id"}).AddRow(second.Hex()).AddRow("broken").AddRow(first.Hex()))
+	ids, err := repo.GetSaved(ctx, 1, 0, 10)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	expect := []primitive.ObjectID{second, first}
+	if !reflect.DeepEqual(ids, expect) {
+		t.Errorf("results not match, want %v, have %v", expect, ids)
+		return
+	}
+	if logs.Len() != 1 || logs.All()[0].ContextMap()["id"] != "broken" {
+		t.Errorf("expected a warning about the bad id, got %v", logs.All())
+		return
+	}
+
+	// DB error
+	mock.
+		ExpectQuery("SELECT post_id FROM saved").
+		WithArgs(1, 10, 0).
+		WillReturnError(ErrDB)
+	if _, err := repo.GetSaved(context.Background(), 1, 0, 10); !errors.Is(err, ErrDB) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestFilterSaved(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &SavedRepo{SavedDB: db}
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+
+	// Good query
+	mock.
+		ExpectQuery("SELECT post_id FROM saved WHERE userid = \\? AND post_id IN \\(\\?, \\?\\)").
+		WithArgs(1, first.Hex(), second.Hex()).
+		WillReturnRows(sqlmock.NewRows([]string{"post_id"}).AddRow(second.Hex()))
+	ids, err := repo.FilterSaved(context.Background(), 1, []primitive.ObjectID{first, second})
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if !reflect.DeepEqual(ids, []primitive.ObjectID{second}) {
+		t.Errorf("results not match, want %v, have %v", []primitive.ObjectID{second}, ids)
+		return
+	}
+
+	// No ids, no query
+	ids, err = repo.FilterSaved(context.Background(), 1, nil)
+	if err != nil || len(ids) != 0 {
+		t.Errorf("expected no ids, got %v %v", ids, err)
+		return
+	}
+
+	// Long lists are split
+	many := make([]primitive.ObjectID, maxFilterIDs+1)
+	args := make([]driver.Value, maxFilterIDs+1)
+	args[0] = 1
+	for i := range many {
+		many[i] = primitive.NewObjectID()
+		if i < maxFilterIDs {
+			args[i+1] = many[i].Hex()
+		}
+	}
+	mock.
+		ExpectQuery("SELECT post_id FROM saved").
+		WithArgs(args...).
+		WillReturnRows(sqlmock.NewRows([]string{"post_id"}).AddRow(many[0].Hex()))
+	mock.
+		ExpectQuery("SELECT post_id FROM saved WHERE userid = \\? AND post_id IN \\(\\?\\)").
+		WithArgs(1, many[maxFilterIDs].Hex()).
+		WillReturnRows(sqlmock.NewRows([]string{"post_id"}).AddRow(many[maxFilterIDs].Hex()))
+	ids, err = repo.FilterSaved(context.Background(), 1, many)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	expect := []primitive.ObjectID{many[0], many[maxFilterIDs]}
+	if !reflect.DeepEqual(ids, expect) {
+		t.Errorf("results not match, want %v, have %v", expect, ids)
+		return
+	}
+
+	// DB error
+	mock.
+		ExpectQuery("SELECT post_id FROM saved").
+		WithArgs(1, first.Hex()).
+		WillReturnError(ErrDB)
+	if _, err := repo.FilterSaved(context.Background(), 1, []primitive.ObjectID{first}); !errors.Is(err, ErrDB) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
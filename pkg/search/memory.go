@@ -0,0 +1,169 @@
+package search
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/query"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	titleWeight   = 3.0
+	textWeight    = 1.0
+	commentWeight = 0.5
+)
+
+type document struct {
+	post  *items.Post
+	terms map[string]float64
+}
+
+// MemoryIndex is an in-process inverted index over post titles, texts and
+// comment bodies.
+type MemoryIndex struct {
+	mu       sync.RWMutex
+	docs     map[primitive.ObjectID]*document
+	postings map[string]map[primitive.ObjectID]float64
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{
+		docs:     make(map[primitive.ObjectID]*document),
+		postings: make(map[string]map[primitive.ObjectID]float64),
+	}
+}
+
+func (idx *MemoryIndex) Rebuild(posts []*items.Post) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.docs = make(map[primitive.ObjectID]*document, len(posts))
+	idx.postings = make(map[string]map[primitive.ObjectID]float64)
+	for _, post := range posts {
+		idx.add(post)
+	}
+}
+
+func (idx *MemoryIndex) Index(ctx context.Context, post *items.Post) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(post.ID)
+	idx.add(post)
+}
+
+func (idx *MemoryIndex) Remove(ctx context.Context, id primitive.ObjectID) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(id)
+}
+
+func (idx *MemoryIndex) add(post *items.Post) {
+	// handlers keep mutating the post they passed in, so keep our own copy
+	stored := *post
+	stored.Comments = append([]*items.Comment(nil), post.Comments...)
+	stored.Votes = append([]items.Vote(nil), post.Votes...)
+
+	terms := make(map[string]float64)
+	for _, term := range Tokenize(post.Title) {
+		terms[term] += titleWeight
+	}
+	for _, term := range Tokenize(post.Text) {
+		terms[term] += textWeight
+	}
+	for _, comment := range post.Comments {
+		for _, term := range Tokenize(comment.Body) {
+			terms[term] += commentWeight
+		}
+	}
+
+	idx.docs[post.ID] = &document{post: &stored, terms: terms}
+	for term, weight := range terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[primitive.ObjectID]float64)
+		}
+		idx.postings[term][post.ID] = weight
+	}
+}
+
+func (idx *MemoryIndex) remove(id primitive.ObjectID) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for term := range doc.terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.docs, id)
+}
+
+type hit struct {
+	post      *items.Post
+	relevance float64
+}
+
+func (idx *MemoryIndex) Search(ctx context.Context, q *Query) (*Result, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	// terms only rank the results, phrases and fields have to match
+	phrases := query.Query{Phrases: q.Phrases}
+	match := func(post *items.Post) bool {
+		return q.MatchFields(post) && phrases.MatchText(post)
+	}
+	hits := []hit{}
+	terms := Tokenize(strings.Join(q.Terms, " "))
+	if len(terms) == 0 {
+		for _, doc := range idx.docs {
+			if match(doc.post) {
+				hits = append(hits, hit{post: doc.post})
+			}
+		}
+	} else {
+		relevance := make(map[primitive.ObjectID]float64)
+		for _, term := range terms {
+			postings := idx.postings[term]
+			if len(postings) == 0 {
+				continue
+			}
+			idf := math.Log(1 + float64(len(idx.docs))/float64(len(postings)))
+			for id, weight := range postings {
+				relevance[id] += weight * idf
+			}
+		}
+		for id, rel := range relevance {
+			post := idx.docs[id].post
+			if match(post) {
+				hits = append(hits, hit{post: post, relevance: rel})
+			}
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].relevance != hits[j].relevance {
+			return hits[i].relevance > hits[j].relevance
+		}
+		if hits[i].post.Score != hits[j].post.Score {
+			return hits[i].post.Score > hits[j].post.Score
+		}
+		return hits[i].post.Created.After(hits[j].post.Created)
+	})
+
+	start, end := q.page(len(hits))
+	result := &Result{
+		Total: len(hits),
+		Posts: make([]*items.Post, 0, end-start),
+	}
+	for _, h := range hits[start:end] {
+		post := *h.post
+		result.Posts = append(result.Posts, &post)
+	}
+	return result, nil
+}
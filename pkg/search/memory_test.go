@@ -0,0 +1,146 @@
+package search
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/query"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testPosts() []*items.Post {
+	admin := &items.User{ID: 1, Username: "admin"}
+	guest := &items.User{ID: 2, Username: "guest"}
+	created := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	return []*items.Post{
+		{
+			ID:       primitive.NewObjectID(),
+			Author:   admin,
+			Category: "music",
+			Title:    "Golang concurrency patterns",
+			Type:     "text",
+			Text:     "channels and goroutines",
+			Created:  created,
+			Score:    5,
+		},
+		{
+			ID:       primitive.NewObjectID(),
+			Author:   guest,
+			Category: "programming",
+			Title:    "Rust vs Go",
+			Type:     "link",
+			URL:      "https://example.com",
+			Created:  created.Add(24 * time.Hour),
+			Score:    1,
+			Comments: []*items.Comment{
+				{ID: primitive.NewObjectID(), Author: admin, Body: "golang wins"},
+			},
+		},
+		{
+			ID:       primitive.NewObjectID(),
+			Author:   guest,
+			Category: "music",
+			Title:    "Best albums",
+			Type:     "text",
+			Text:     "nothing about programming here",
+			Created:  created.Add(48 * time.Hour),
+			Score:    10,
+		},
+	}
+}
+
+func TestMemoryIndexSearch(t *testing.T) {
+	posts := testPosts()
+	idx := NewMemoryIndex()
+	idx.Rebuild(posts)
+	ctx := context.Background()
+
+	// Title match ranks above comment match
+	result, err := idx.Search(ctx, &Query{Query: query.Query{Terms: []string{"golang"}}})
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if result.Total != 2 {
+		t.Errorf("expected 2 results, got %d", result.Total)
+		return
+	}
+	if result.Posts[0].ID != posts[0].ID || result.Posts[1].ID != posts[1].ID {
+		t.Errorf("unexpected order: %v", result.Posts)
+		return
+	}
+
+	// Filters
+	result, _ = idx.Search(ctx, &Query{Query: query.Query{Terms: []string{"golang"}, Author: "guest"}})
+	if result.Total != 1 || result.Posts[0].ID != posts[1].ID {
+		t.Errorf("author filter failed: %v", result.Posts)
+		return
+	}
+	result, _ = idx.Search(ctx, &Query{Query: query.Query{Category: "music", Type: "text"}})
+	if result.Total != 2 || result.Posts[0].ID != posts[2].ID {
+		t.Errorf("category filter failed: %v", result.Posts)
+		return
+	}
+	result, _ = idx.Search(ctx, &Query{Query: query.Query{After: posts[1].Created, Before: posts[2].Created}})
+	if result.Total != 1 || result.Posts[0].ID != posts[1].ID {
+		t.Errorf("date filter failed: %v", result.Posts)
+		return
+	}
+
+	result, _ = idx.Search(ctx, &Query{Query: query.Query{Phrases: []string{"golang wins"}}})
+	if result.Total != 1 || result.Posts[0].ID != posts[1].ID {
+		t.Errorf("phrase filter failed: %v", result.Posts)
+		return
+	}
+
+	// Pagination
+	result, _ = idx.Search(ctx, &Query{Offset: 1, Limit: 1})
+	if result.Total != 3 || len(result.Posts) != 1 || result.Posts[0].ID != posts[0].ID {
+		t.Errorf("pagination failed: %v", result.Posts)
+		return
+	}
+	result, _ = idx.Search(ctx, &Query{Offset: 10})
+	if result.Total != 3 || len(result.Posts) != 0 {
+		t.Errorf("expected empty page, got %v", result.Posts)
+		return
+	}
+}
+
+func TestMemoryIndexUpdates(t *testing.T) {
+	posts := testPosts()
+	idx := NewMemoryIndex()
+	idx.Rebuild(posts)
+	ctx := context.Background()
+
+	// New comment becomes searchable
+	posts[2].Comments = append(posts[2].Comments, &items.Comment{
+		ID:   primitive.NewObjectID(),
+		Body: "jazz",
+	})
+	idx.Index(ctx, posts[2])
+	result, _ := idx.Search(ctx, &Query{Query: query.Query{Terms: []string{"jazz"}}})
+	if result.Total != 1 || result.Posts[0].ID != posts[2].ID {
+		t.Errorf("expected commented post, got %v", result.Posts)
+		return
+	}
+
+	// Deleted comment is no longer searchable
+	posts[1].Comments = nil
+	idx.Index(ctx, posts[1])
+	result, _ = idx.Search(ctx, &Query{Query: query.Query{Terms: []string{"wins"}}})
+	if result.Total != 0 {
+		t.Errorf("expected no results, got %v", result.Posts)
+		return
+	}
+
+	// Removed post is no longer searchable
+	idx.Remove(ctx, posts[0].ID)
+	result, _ = idx.Search(ctx, &Query{Query: query.Query{Terms: []string{"golang"}}})
+	if result.Total != 0 {
+		t.Errorf("expected no results, got %v", result.Posts)
+		return
+	}
+}
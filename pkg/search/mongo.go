@@ -0,0 +1,92 @@
+package search
+
+import (
+	"context"
+	"time"
+
+	"asperitas-clone/pkg/items"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const searchTimeout = 5 * time.Second
+
+// MongoIndex searches the posts collection through a Mongo text index, so
+// the database keeps it up to date and Index/Remove have nothing to do.
+type MongoIndex struct {
+	PostDB *mongo.Collection
+}
+
+func NewMongoIndex(collection *mongo.Collection) (*MongoIndex, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), searchTimeout)
+	defer cancel()
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "title", Value: "text"},
+			{Key: "text", Value: "text"},
+			{Key: "comments.body", Value: "text"},
+		},
+		Options: options.Index().
+			SetName("posts_text").
+			SetWeights(bson.M{
+				"title":         6,
+				"text":          2,
+				"comments.body": 1,
+			}),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoIndex{PostDB: collection}, nil
+}
+
+func (idx *MongoIndex) Index(ctx context.Context, post *items.Post) {}
+
+func (idx *MongoIndex) Remove(ctx context.Context, id primitive.ObjectID) {}
+
+func (idx *MongoIndex) Search(ctx context.Context, q *Query) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, searchTimeout)
+	defer cancel()
+
+	filter := q.FieldFilter()
+	text := q.TextSearch()
+	if text != "" {
+		filter["$text"] = bson.M{"$search": text}
+	}
+
+	count, err := idx.PostDB.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	total := int(count)
+	start, end := q.page(total)
+	if start == end {
+		// a zero limit means no limit to the driver
+		return &Result{Total: total, Posts: []*items.Post{}}, nil
+	}
+
+	opts := options.Find().SetSkip(int64(start)).SetLimit(int64(end - start))
+	if text != "" {
+		opts.SetProjection(bson.M{"textscore": bson.M{"$meta": "textScore"}}).
+			SetSort(bson.D{
+				{Key: "textscore", Value: bson.M{"$meta": "textScore"}},
+				{Key: "score", Value: -1},
+				{Key: "created", Value: -1},
+			})
+	} else {
+		opts.SetSort(bson.D{{Key: "score", Value: -1}, {Key: "created", Value: -1}})
+	}
+
+	cursor, err := idx.PostDB.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	posts := []*items.Post{}
+	if err = cursor.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+	return &Result{Total: total, Posts: posts}, nil
+}
@@ -0,0 +1,54 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/query"
+)
+
+const (
+	DefaultLimit = 25
+	MaxLimit     = 100
+)
+
+type Query struct {
+	query.Query
+	Offset int
+	Limit  int
+}
+
+type Result struct {
+	Total int           `json:"total"`
+	Posts []*items.Post `json:"posts"`
+}
+
+func (q *Query) page(total int) (int, int) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	} else if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	start := q.Offset
+	if start < 0 {
+		start = 0
+	}
+	if start > total {
+		start = total
+	}
+	end := start + limit
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+// Tokenize splits text into lowercase terms on everything that is not a
+// letter or a digit.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -1,27 +1,35 @@
 package session
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"net/http"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
+const cookieName = "sess_id"
+
 // mockgen -source="manager.go" -destination="manager_mock.go" -package=session SessionManagerInterface
 
+// SessionManagerInterface stores sessions, Check runs in the context of the
+// request.
 type SessionManagerInterface interface {
-	Create(http.ResponseWriter, int) (*Session, error)
+	Create(context.Context, http.ResponseWriter, int) (*Session, error)
 	Check(*http.Request) (*Session, error)
+	DestroyOthers(context.Context, int, string) error
 }
 
 type SessionManager struct {
 	SessionDB *sql.DB
 }
 
-func (sm *SessionManager) Create(w http.ResponseWriter, userID int) (*Session, error) {
+func (sm *SessionManager) Create(ctx context.Context, w http.ResponseWriter, userID int) (*Session, error) {
 	sess := NewSession(userID)
-	_, err := sm.SessionDB.Exec(
+	_, err := sm.SessionDB.ExecContext(
+		ctx,
 		"INSERT INTO `sessions` (`id`, `userid`) VALUES (?, ?)",
 		sess.ID,
 		sess.UserID,
@@ -31,7 +39,7 @@ func (sm *SessionManager) Create(w http.ResponseWriter, userID int) (*Session, e
 	}
 
 	cookie := &http.Cookie{
-		Name:    "sess_id",
+		Name:    cookieName,
 		Value:   sess.ID,
 		Path:    "/",
 		Expires: time.Now().Add(90 * 24 * time.Hour),
@@ -40,16 +48,44 @@ func (sm *SessionManager) Create(w http.ResponseWriter, userID int) (*Session, e
 	return sess, nil
 }
 
+// Check returns nil without an error if the session of the cookie doesn't
+// exist any more.
 func (sm *SessionManager) Check(r *http.Request) (*Session, error) {
-	sessionCookie, err := r.Cookie("sess_id")
+	sessionCookie, err := r.Cookie(cookieName)
 	if err == http.ErrNoCookie {
 		return nil, ErrNoAuth
 	}
-	row := sm.SessionDB.QueryRow("SELECT id, userid FROM sessions WHERE id= ?", sessionCookie.Value)
+	row := sm.SessionDB.QueryRowContext(r.Context(), "SELECT id, userid FROM sessions WHERE id= ?", sessionCookie.Value)
 	sess := Session{}
 	err = row.Scan(&sess.ID, &sess.UserID)
-	if err != nil {
+	if errors.Is(err, sql.ErrNoRows) {
+		// the session was ended, e.g. by a password change
+		return nil, nil
+	} else if err != nil {
 		return nil, err
 	}
 	return &sess, nil
 }
+
+// DestroyOthers ends all sessions of the user except keepID, an empty keepID
+// ends all of them.
+func (sm *SessionManager) DestroyOthers(ctx context.Context, userID int, keepID string) error {
+	_, err := sm.SessionDB.ExecContext(
+		ctx,
+		"DELETE FROM `sessions` WHERE `userid` = ? AND `id` <> ?",
+		userID,
+		keepID,
+	)
+	return err
+}
+
+// ExpireCookie makes the browser forget its session.
+func ExpireCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:    cookieName,
+		Value:   "",
+		Path:    "/",
+		Expires: time.Unix(0, 0),
+		MaxAge:  -1,
+	})
+}
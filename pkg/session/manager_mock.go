@@ -5,6 +5,7 @@
 package session
 
 import (
+	context "context"
 	http "net/http"
 	reflect "reflect"
 
@@ -50,16 +51,30 @@ func (mr *MockSessionManagerInterfaceMockRecorder) Check(arg0 interface{}) *gomo
 }
 
 // Create mocks base method.
-func (m *MockSessionManagerInterface) Create(arg0 http.ResponseWriter, arg1 int) (*Session, error) {
+func (m *MockSessionManagerInterface) Create(arg0 context.Context, arg1 http.ResponseWriter, arg2 int) (*Session, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Create", arg0, arg1)
+	ret := m.ctrl.Call(m, "Create", arg0, arg1, arg2)
 	ret0, _ := ret[0].(*Session)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Create indicates an expected call of Create.
-func (mr *MockSessionManagerInterfaceMockRecorder) Create(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockSessionManagerInterfaceMockRecorder) Create(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockSessionManagerInterface)(nil).Create), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockSessionManagerInterface)(nil).Create), arg0, arg1, arg2)
+}
+
+// DestroyOthers mocks base method.
+func (m *MockSessionManagerInterface) DestroyOthers(arg0 context.Context, arg1 int, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DestroyOthers", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DestroyOthers indicates an expected call of DestroyOthers.
+func (mr *MockSessionManagerInterfaceMockRecorder) DestroyOthers(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DestroyOthers", reflect.TypeOf((*MockSessionManagerInterface)(nil).DestroyOthers), arg0, arg1, arg2)
 }
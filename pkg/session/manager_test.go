@@ -0,0 +1,70 @@
+package session
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var (
+	ErrDB = errors.New("DB_ERROR")
+)
+
+func TestCheck(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	sm := &SessionManager{SessionDB: db}
+	newRequest := func() *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: cookieName, Value: "abc"})
+		return r
+	}
+
+	// Good query
+	mock.
+		ExpectQuery("SELECT id, userid FROM sessions WHERE id= \\?").
+		WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "userid"}).AddRow("abc", 1))
+	sess, err := sm.Check(newRequest())
+	if err != nil || sess == nil || sess.ID != "abc" || sess.UserID != 1 {
+		t.Errorf("unexpected session %+v: %v", sess, err)
+		return
+	}
+
+	// Session was ended
+	mock.
+		ExpectQuery("SELECT id, userid FROM sessions").
+		WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "userid"}))
+	sess, err = sm.Check(newRequest())
+	if err != nil || sess != nil {
+		t.Errorf("expected no session, got %+v %v", sess, err)
+		return
+	}
+
+	// DB error
+	mock.
+		ExpectQuery("SELECT id, userid FROM sessions").
+		WithArgs("abc").
+		WillReturnError(ErrDB)
+	if _, err := sm.Check(newRequest()); !errors.Is(err, ErrDB) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+
+	// No cookie
+	if _, err := sm.Check(httptest.NewRequest("GET", "/", nil)); err != ErrNoAuth {
+		t.Errorf("expected ErrNoAuth, got %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
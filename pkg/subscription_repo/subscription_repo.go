@@ -0,0 +1,53 @@
+package subscription_repo
+
+import (
+	"context"
+	"database/sql"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+type SubscriptionRepo struct {
+	SubscriptionDB *sql.DB
+}
+
+func (repo *SubscriptionRepo) Subscribe(ctx context.Context, userID int, category string) error {
+	_, err := repo.SubscriptionDB.ExecContext(
+		ctx,
+		"INSERT IGNORE INTO `subscriptions` (`userid`, `category`) VALUES (?, ?)",
+		userID,
+		category,
+	)
+	return err
+}
+
+func (repo *SubscriptionRepo) Unsubscribe(ctx context.Context, userID int, category string) error {
+	_, err := repo.SubscriptionDB.ExecContext(
+		ctx,
+		"DELETE FROM `subscriptions` WHERE `userid` = ? AND `category` = ?",
+		userID,
+		category,
+	)
+	return err
+}
+
+func (repo *SubscriptionRepo) GetSubscriptions(ctx context.Context, userID int) ([]string, error) {
+	rows, err := repo.SubscriptionDB.QueryContext(
+		ctx,
+		"SELECT category FROM subscriptions WHERE userid = ? ORDER BY category",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	categories := []string{}
+	for rows.Next() {
+		var category string
+		if err := rows.Scan(&category); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
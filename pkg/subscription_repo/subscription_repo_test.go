@@ -0,0 +1,139 @@
+package subscription_repo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var (
+	ErrDB = errors.New("DB_ERROR")
+)
+
+func TestSubscribe(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &SubscriptionRepo{SubscriptionDB: db}
+
+	// Good query
+	mock.
+		ExpectExec("INSERT IGNORE INTO `subscriptions`").
+		WithArgs(1, "music").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.Subscribe(context.Background(), 1, "music"); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+
+	// Subscribed already, nothing changes and it is no error
+	mock.
+		ExpectExec("INSERT IGNORE INTO `subscriptions`").
+		WithArgs(1, "music").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := repo.Subscribe(context.Background(), 1, "music"); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+
+	// DB error
+	mock.
+		ExpectExec("INSERT IGNORE INTO `subscriptions`").
+		WithArgs(1, "music").
+		WillReturnError(ErrDB)
+	if err := repo.Subscribe(context.Background(), 1, "music"); !errors.Is(err, ErrDB) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &SubscriptionRepo{SubscriptionDB: db}
+
+	// Good query
+	mock.
+		ExpectExec("DELETE FROM `subscriptions` WHERE `userid` = \\? AND `category` = \\?").
+		WithArgs(1, "music").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.Unsubscribe(context.Background(), 1, "music"); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+
+	// DB error
+	mock.
+		ExpectExec("DELETE FROM `subscriptions`").
+		WithArgs(1, "music").
+		WillReturnError(ErrDB)
+	if err := repo.Unsubscribe(context.Background(), 1, "music"); !errors.Is(err, ErrDB) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestGetSubscriptions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &SubscriptionRepo{SubscriptionDB: db}
+
+	// Good query
+	mock.
+		ExpectQuery("SELECT category FROM subscriptions WHERE userid = \\? ORDER BY category").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"category"}).AddRow("music").AddRow("news"))
+	categories, err := repo.GetSubscriptions(context.Background(), 1)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if !reflect.DeepEqual(categories, []string{"music", "news"}) {
+		t.Errorf("results not match, want %v, have %v", []string{"music", "news"}, categories)
+		return
+	}
+
+	// No subscriptions
+	mock.
+		ExpectQuery("SELECT category FROM subscriptions").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"category"}))
+	categories, err = repo.GetSubscriptions(context.Background(), 2)
+	if err != nil || categories == nil || len(categories) != 0 {
+		t.Errorf("expected an empty list, got %v %v", categories, err)
+		return
+	}
+
+	// DB error
+	mock.
+		ExpectQuery("SELECT category FROM subscriptions").
+		WithArgs(1).
+		WillReturnError(ErrDB)
+	if _, err := repo.GetSubscriptions(context.Background(), 1); !errors.Is(err, ErrDB) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
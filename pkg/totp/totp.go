@@ -0,0 +1,123 @@
+// Package totp implements time-based one-time passwords (RFC 6238) as
+// authenticator apps make them: HMAC-SHA1, 6 digits, a new code every 30
+// seconds.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30 * time.Second
+	// Skew is how many periods a code may be early or late, clocks of
+	// phones drift.
+	Skew = 1
+	// RecoveryCodes is how many recovery codes a user gets.
+	RecoveryCodes = 10
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret returns a random 160 bit key, base32 encoded as apps take it.
+func NewSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// URI is the otpauth:// link apps add the key from, usually shown as a QR
+// code.
+func URI(issuer, account, secret string) string {
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(Digits)},
+		"period":    {fmt.Sprint(int(Period.Seconds()))},
+	}
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// Step is the number of the period t is in.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+func code(key []byte, step int64, digits int) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	return encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+}
+
+// Code is the code of secret at t.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return code(key, Step(t), Digits), nil
+}
+
+// Validate returns the step code belongs to if it is valid around t. The
+// caller remembers the step, a code must not be accepted twice.
+func Validate(secret, passcode string, t time.Time) (int64, bool) {
+	key, err := decodeSecret(secret)
+	if err != nil || len(passcode) != Digits {
+		return 0, false
+	}
+	now := Step(t)
+	for step := now - Skew; step <= now+Skew; step++ {
+		if subtle.ConstantTimeCompare([]byte(code(key, step, Digits)), []byte(passcode)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// NewRecoveryCodes returns n one-time codes like "k3x9q-7mwpa" for logins
+// without the app.
+func NewRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(encoding.EncodeToString(b))[:10]
+		codes[i] = s[:5] + "-" + s[5:]
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode forgives case, spaces and dashes, codes are typed in
+// by hand.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,127 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA1
+	key := []byte("12345678901234567890")
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, c := range cases {
+		if have := code(key, Step(time.Unix(c.unix, 0)), 8); have != c.want {
+			t.Errorf("results not match at %d, want %s, have %s", c.unix, c.want, have)
+			return
+		}
+	}
+
+	secret := base32.StdEncoding.EncodeToString(key)
+	have, err := Code(secret, time.Unix(59, 0))
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if have != "287082" {
+		t.Errorf("results not match, want 287082, have %s", have)
+		return
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1600000000, 0)
+	current, _ := Code(secret, now)
+
+	// Current code
+	step, ok := Validate(secret, current, now)
+	if !ok || step != Step(now) {
+		t.Errorf("expected step %d, got %d %v", Step(now), step, ok)
+		return
+	}
+
+	// Code of the last period, the clock is a bit late
+	late, _ := Code(secret, now.Add(-Period))
+	if step, ok := Validate(secret, late, now); !ok || step != Step(now)-1 {
+		t.Errorf("expected step %d, got %d %v", Step(now)-1, step, ok)
+		return
+	}
+
+	// Too old
+	old, _ := Code(secret, now.Add(-3*Period))
+	if _, ok := Validate(secret, old, now); ok {
+		t.Errorf("expected old code to be rejected")
+		return
+	}
+
+	// Malformed
+	for _, passcode := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := Validate(secret, passcode, now); ok {
+			t.Errorf("expected %q to be rejected", passcode)
+			return
+		}
+	}
+	if _, ok := Validate("not base32!", current, now); ok {
+		t.Errorf("expected bad secret to be rejected")
+		return
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if _, err := Code(secret, time.Now()); err != nil || len(secret) != 32 {
+		t.Errorf("unexpected secret %q: %v", secret, err)
+		return
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("Asperitas", "bob smith", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Asperitas:bob smith" {
+		t.Errorf("unexpected uri: %s", uri)
+		return
+	}
+	if q := uri.Query(); q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "Asperitas" || q.Get("digits") != "6" {
+		t.Errorf("unexpected query: %s", uri.RawQuery)
+		return
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes(RecoveryCodes)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || seen[code] {
+			t.Errorf("unexpected code: %q", code)
+			return
+		}
+		seen[code] = true
+	}
+	if have := NormalizeRecoveryCode(" K3X9Q-7mwpa"); have != "k3x9q7mwpa" {
+		t.Errorf("results not match, want k3x9q7mwpa, have %s", have)
+		return
+	}
+}
@@ -0,0 +1,267 @@
+package totp_repo
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"asperitas-clone/pkg/items"
+	"asperitas-clone/pkg/totp"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	// DefaultChallengeTTL is how long the second login step may take.
+	DefaultChallengeTTL = 5 * time.Minute
+	// DefaultMaxAttempts is how many wrong codes a login challenge takes.
+	DefaultMaxAttempts = 5
+
+	errDuplicateKey = 1062
+)
+
+// TOTPRepo keeps TOTP keys, recovery codes and logins waiting for their
+// second factor. Recovery codes and challenge tokens are stored hashed.
+type TOTPRepo struct {
+	TOTPDB       *sql.DB
+	ChallengeTTL time.Duration
+	MaxAttempts  int
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (repo *TOTPRepo) challengeTTL() time.Duration {
+	if repo.ChallengeTTL <= 0 {
+		return DefaultChallengeTTL
+	}
+	return repo.ChallengeTTL
+}
+
+func (repo *TOTPRepo) maxAttempts() int {
+	if repo.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return repo.MaxAttempts
+}
+
+// Get returns nil for users without a key.
+func (repo *TOTPRepo) Get(ctx context.Context, userID int) (*items.TwoFactor, error) {
+	tf := &items.TwoFactor{}
+	row := repo.TOTPDB.QueryRowContext(
+		ctx,
+		"SELECT secret, enabled, (SELECT COUNT(*) FROM recovery_codes WHERE userid = ?) FROM two_factor WHERE userid = ?",
+		userID,
+		userID,
+	)
+	err := row.Scan(&tf.Secret, &tf.Enabled, &tf.RecoveryCodes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return tf, nil
+}
+
+// Begin stores a pending key, replacing an older pending one. It returns
+// items.ErrTwoFactorEnabled if the user has an enabled key.
+func (repo *TOTPRepo) Begin(ctx context.Context, userID int, secret string) error {
+	tx, err := repo.TOTPDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "DELETE FROM `two_factor` WHERE `userid` = ? AND NOT `enabled`", userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO `two_factor` (`userid`, `secret`, `enabled`, `last_step`, `created`) VALUES (?, ?, FALSE, 0, ?)",
+		userID,
+		secret,
+		time.Now().UTC(),
+	)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateKey {
+		return items.ErrTwoFactorEnabled
+	} else if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Enable turns the pending key on, the recovery codes replace older ones.
+func (repo *TOTPRepo) Enable(ctx context.Context, userID int, recoveryCodes []string) error {
+	tx, err := repo.TOTPDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "UPDATE `two_factor` SET `enabled` = TRUE WHERE `userid` = ?", userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM `recovery_codes` WHERE `userid` = ?", userID)
+	if err != nil {
+		return err
+	}
+	for _, code := range recoveryCodes {
+		_, err = tx.ExecContext(
+			ctx,
+			"INSERT INTO `recovery_codes` (`userid`, `code_hash`) VALUES (?, ?)",
+			userID,
+			hash(totp.NormalizeRecoveryCode(code)),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Disable removes the key, the recovery codes and pending logins of the
+// user.
+func (repo *TOTPRepo) Disable(ctx context.Context, userID int) error {
+	tx, err := repo.TOTPDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, statement := range []string{
+		"DELETE FROM `two_factor` WHERE `userid` = ?",
+		"DELETE FROM `recovery_codes` WHERE `userid` = ?",
+		"DELETE FROM `login_challenges` WHERE `userid` = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, statement, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UseStep records that the code of step was accepted. It returns false if
+// the code of this or a later step was used already, codes work once.
+func (repo *TOTPRepo) UseStep(ctx context.Context, userID int, step int64) (bool, error) {
+	result, err := repo.TOTPDB.ExecContext(
+		ctx,
+		"UPDATE `two_factor` SET `last_step` = ? WHERE `userid` = ? AND `last_step` < ?",
+		step,
+		userID,
+		step,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// UseRecoveryCode returns true if the code was unused, it is used up then.
+func (repo *TOTPRepo) UseRecoveryCode(ctx context.Context, userID int, code string) (bool, error) {
+	result, err := repo.TOTPDB.ExecContext(
+		ctx,
+		"DELETE FROM `recovery_codes` WHERE `userid` = ? AND `code_hash` = ?",
+		userID,
+		hash(totp.NormalizeRecoveryCode(code)),
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// CreateChallenge returns a token standing for a login of the user whose
+// password was right.
+func (repo *TOTPRepo) CreateChallenge(ctx context.Context, userID int) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = repo.TOTPDB.ExecContext(
+		ctx,
+		"INSERT INTO `login_challenges` (`token_hash`, `userid`, `expires`, `attempts`) VALUES (?, ?, ?, 0)",
+		hash(token),
+		userID,
+		time.Now().UTC().Add(repo.challengeTTL()),
+	)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// CheckChallenge returns the user of the challenge, or items.ErrBadChallenge
+// if it expired or took too many wrong codes.
+func (repo *TOTPRepo) CheckChallenge(ctx context.Context, token string) (int, error) {
+	var userID, attempts int
+	var expires time.Time
+	row := repo.TOTPDB.QueryRowContext(
+		ctx,
+		"SELECT userid, expires, attempts FROM login_challenges WHERE token_hash = ?",
+		hash(token),
+	)
+	err := row.Scan(&userID, &expires, &attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, items.ErrBadChallenge
+	} else if err != nil {
+		return 0, err
+	}
+	if time.Now().After(expires) || attempts >= repo.maxAttempts() {
+		return 0, items.ErrBadChallenge
+	}
+	return userID, nil
+}
+
+// FailChallenge counts a wrong code.
+func (repo *TOTPRepo) FailChallenge(ctx context.Context, token string) error {
+	_, err := repo.TOTPDB.ExecContext(
+		ctx,
+		"UPDATE `login_challenges` SET `attempts` = `attempts` + 1 WHERE `token_hash` = ?",
+		hash(token),
+	)
+	return err
+}
+
+// ConsumeChallenge ends the challenge after the right code. Of concurrent
+// calls only one succeeds, the others get items.ErrBadChallenge.
+func (repo *TOTPRepo) ConsumeChallenge(ctx context.Context, token string) error {
+	result, err := repo.TOTPDB.ExecContext(
+		ctx,
+		"DELETE FROM `login_challenges` WHERE `token_hash` = ?",
+		hash(token),
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected != 1 {
+		return items.ErrBadChallenge
+	}
+	return nil
+}
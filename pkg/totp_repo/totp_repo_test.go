@@ -0,0 +1,289 @@
+package totp_repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"asperitas-clone/pkg/items"
+
+	"github.com/go-sql-driver/mysql"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var (
+	ErrDB = errors.New("DB_ERROR")
+)
+
+func TestGet(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &TOTPRepo{TOTPDB: db}
+
+	// Good query
+	mock.
+		ExpectQuery("SELECT secret, enabled, (.+) FROM two_factor WHERE userid = \\?").
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"secret", "enabled", "codes"}).AddRow("SECRET", true, 9))
+	tf, err := repo.Get(context.Background(), 1)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	want := items.TwoFactor{Secret: "SECRET", Enabled: true, RecoveryCodes: 9}
+	if tf == nil || *tf != want {
+		t.Errorf("results not match, want %v, have %v", want, tf)
+		return
+	}
+
+	// No key
+	mock.
+		ExpectQuery("SELECT secret, enabled").
+		WithArgs(2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"secret", "enabled", "codes"}))
+	tf, err = repo.Get(context.Background(), 2)
+	if err != nil || tf != nil {
+		t.Errorf("expected nil, got %v %v", tf, err)
+		return
+	}
+
+	// DB error
+	mock.ExpectQuery("SELECT secret, enabled").WithArgs(1, 1).WillReturnError(ErrDB)
+	if _, err := repo.Get(context.Background(), 1); err != ErrDB {
+		t.Errorf("expected ErrDB, got %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestBeginAndEnable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &TOTPRepo{TOTPDB: db}
+
+	// Good query, a pending key is replaced
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `two_factor` WHERE `userid` = \\? AND NOT `enabled`").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `two_factor`").WithArgs(1, "SECRET", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := repo.Begin(context.Background(), 1, "SECRET"); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+
+	// Enabled already
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `two_factor`").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.
+		ExpectExec("INSERT INTO `two_factor`").
+		WithArgs(1, "SECRET", sqlmock.AnyArg()).
+		WillReturnError(&mysql.MySQLError{Number: errDuplicateKey, Message: "Duplicate entry '1' for key 'PRIMARY'"})
+	mock.ExpectRollback()
+	if err := repo.Begin(context.Background(), 1, "SECRET"); err != items.ErrTwoFactorEnabled {
+		t.Errorf("expected ErrTwoFactorEnabled, got %v", err)
+		return
+	}
+
+	// Enable stores hashes of the normalized codes
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `two_factor` SET `enabled` = TRUE").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM `recovery_codes`").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO `recovery_codes`").WithArgs(1, hash("abcdefghij")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `recovery_codes`").WithArgs(1, hash("klmnopqrst")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := repo.Enable(context.Background(), 1, []string{"abcde-fghij", "klmno-pqrst"}); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+
+	// DB error
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `two_factor`").WithArgs(1).WillReturnError(ErrDB)
+	mock.ExpectRollback()
+	if err := repo.Enable(context.Background(), 1, nil); err != ErrDB {
+		t.Errorf("expected ErrDB, got %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestDisable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &TOTPRepo{TOTPDB: db}
+
+	// Good query
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `two_factor`").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM `recovery_codes`").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec("DELETE FROM `login_challenges`").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	if err := repo.Disable(context.Background(), 1); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+
+	// DB error
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `two_factor`").WithArgs(1).WillReturnError(ErrDB)
+	mock.ExpectRollback()
+	if err := repo.Disable(context.Background(), 1); err != ErrDB {
+		t.Errorf("expected ErrDB, got %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestUseStepAndRecoveryCode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &TOTPRepo{TOTPDB: db}
+
+	// New step
+	mock.ExpectExec("UPDATE `two_factor` SET `last_step` = \\?").WithArgs(100, 1, 100).WillReturnResult(sqlmock.NewResult(0, 1))
+	ok, err := repo.UseStep(context.Background(), 1, 100)
+	if err != nil || !ok {
+		t.Errorf("expected true, got %v %v", ok, err)
+		return
+	}
+
+	// Replayed step
+	mock.ExpectExec("UPDATE `two_factor` SET `last_step` = \\?").WithArgs(100, 1, 100).WillReturnResult(sqlmock.NewResult(0, 0))
+	ok, err = repo.UseStep(context.Background(), 1, 100)
+	if err != nil || ok {
+		t.Errorf("expected false, got %v %v", ok, err)
+		return
+	}
+
+	// Recovery code works once
+	mock.ExpectExec("DELETE FROM `recovery_codes`").WithArgs(1, hash("abcdefghij")).WillReturnResult(sqlmock.NewResult(0, 1))
+	ok, err = repo.UseRecoveryCode(context.Background(), 1, "ABCDE-FGHIJ")
+	if err != nil || !ok {
+		t.Errorf("expected true, got %v %v", ok, err)
+		return
+	}
+	mock.ExpectExec("DELETE FROM `recovery_codes`").WithArgs(1, hash("abcdefghij")).WillReturnResult(sqlmock.NewResult(0, 0))
+	ok, err = repo.UseRecoveryCode(context.Background(), 1, "abcde-fghij")
+	if err != nil || ok {
+		t.Errorf("expected false, got %v %v", ok, err)
+		return
+	}
+
+	// DB error
+	mock.ExpectExec("UPDATE `two_factor`").WithArgs(100, 1, 100).WillReturnError(ErrDB)
+	if _, err := repo.UseStep(context.Background(), 1, 100); err != ErrDB {
+		t.Errorf("expected ErrDB, got %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestChallenges(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &TOTPRepo{TOTPDB: db, MaxAttempts: 3}
+
+	// Create stores the hash only
+	mock.ExpectExec("INSERT INTO `login_challenges`").WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	token, err := repo.CreateChallenge(context.Background(), 1)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if len(token) < 40 {
+		t.Errorf("token is too short: %q", token)
+		return
+	}
+
+	// Valid
+	mock.
+		ExpectQuery("SELECT userid, expires, attempts FROM login_challenges WHERE token_hash = \\?").
+		WithArgs(hash(token)).
+		WillReturnRows(sqlmock.NewRows([]string{"userid", "expires", "attempts"}).AddRow(1, time.Now().Add(time.Minute), 2))
+	userID, err := repo.CheckChallenge(context.Background(), token)
+	if err != nil || userID != 1 {
+		t.Errorf("expected user 1, got %v %v", userID, err)
+		return
+	}
+
+	// Too many wrong codes
+	mock.
+		ExpectQuery("SELECT userid, expires, attempts FROM login_challenges").
+		WithArgs(hash(token)).
+		WillReturnRows(sqlmock.NewRows([]string{"userid", "expires", "attempts"}).AddRow(1, time.Now().Add(time.Minute), 3))
+	if _, err := repo.CheckChallenge(context.Background(), token); err != items.ErrBadChallenge {
+		t.Errorf("expected ErrBadChallenge, got %v", err)
+		return
+	}
+
+	// Expired
+	mock.
+		ExpectQuery("SELECT userid, expires, attempts FROM login_challenges").
+		WithArgs(hash(token)).
+		WillReturnRows(sqlmock.NewRows([]string{"userid", "expires", "attempts"}).AddRow(1, time.Now().Add(-time.Minute), 0))
+	if _, err := repo.CheckChallenge(context.Background(), token); err != items.ErrBadChallenge {
+		t.Errorf("expected ErrBadChallenge, got %v", err)
+		return
+	}
+
+	// Unknown
+	mock.
+		ExpectQuery("SELECT userid, expires, attempts FROM login_challenges").
+		WithArgs(hash("other")).
+		WillReturnRows(sqlmock.NewRows([]string{"userid", "expires", "attempts"}))
+	if _, err := repo.CheckChallenge(context.Background(), "other"); err != items.ErrBadChallenge {
+		t.Errorf("expected ErrBadChallenge, got %v", err)
+		return
+	}
+
+	// Fail counts
+	mock.ExpectExec("UPDATE `login_challenges` SET `attempts` = `attempts` \\+ 1").WithArgs(hash(token)).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.FailChallenge(context.Background(), token); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+
+	// Consume works once
+	mock.ExpectExec("DELETE FROM `login_challenges` WHERE `token_hash` = \\?").WithArgs(hash(token)).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.ConsumeChallenge(context.Background(), token); err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	mock.ExpectExec("DELETE FROM `login_challenges`").WithArgs(hash(token)).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := repo.ConsumeChallenge(context.Background(), token); err != items.ErrBadChallenge {
+		t.Errorf("expected ErrBadChallenge, got %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// TraceparentHeader is the W3C Trace Context header,
+// see https://www.w3.org/TR/trace-context/
+const TraceparentHeader = "traceparent"
+
+// ParseTraceparent parses a version 00 traceparent value. Later versions are
+// read as far as version 00 goes, as the spec asks.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	sc := SpanContext{}
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || len(version) != 1 {
+		return sc, false
+	}
+	if !decodeHex(parts[1], sc.TraceID[:]) || !decodeHex(parts[2], sc.SpanID[:]) {
+		return sc, false
+	}
+	flags := make([]byte, 1)
+	if !decodeHex(parts[3], flags) {
+		return sc, false
+	}
+	if !sc.TraceID.IsValid() || !sc.SpanID.IsValid() {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, true
+}
+
+func decodeHex(s string, dst []byte) bool {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+func FormatTraceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// Extract remembers the caller's span from the headers, spans started from
+// the returned context continue its trace.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	sc, ok := ParseTraceparent(header.Get(TraceparentHeader))
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+// Inject sets traceparent for an outgoing request made within the span in
+// ctx.
+func Inject(ctx context.Context, header http.Header) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	header.Set(TraceparentHeader, FormatTraceparent(span.Context()))
+}
+
+// Transport makes a client span of every request sent through Base, or
+// http.DefaultTransport, and passes it on in traceparent.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx, span := Start(req.Context(), "http "+req.Method)
+	defer span.End()
+	span.SetAttribute("http.host", req.URL.Host)
+	// a RoundTripper must not change the request it was given
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.status", resp.StatusCode)
+	return resp, nil
+}
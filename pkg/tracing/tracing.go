@@ -0,0 +1,190 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// SpanData is what exporters get once a span ends.
+type SpanData struct {
+	TraceID    string                 `json:"traceId"`
+	SpanID     string                 `json:"spanId"`
+	ParentID   string                 `json:"parentId,omitempty"`
+	Name       string                 `json:"name"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	Duration   float64                `json:"durationMs"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+type Exporter interface {
+	Export(SpanData) error
+}
+
+// Tracer starts spans and hands finished ones to Exporter. A Tracer without
+// an Exporter is disabled and starts no spans.
+type Tracer struct {
+	Exporter Exporter
+	// OnError is called when the exporter fails
+	OnError func(error)
+}
+
+// Default is the tracer used by Start.
+var Default = &Tracer{}
+
+type ctxKey int
+
+const (
+	spanKey ctxKey = iota
+	remoteKey
+)
+
+// Span is a timed operation. All methods are safe to call on a nil Span, so
+// code doesn't have to check whether tracing is enabled.
+type Span struct {
+	tracer  *Tracer
+	context SpanContext
+	parent  SpanID
+
+	mu    sync.Mutex
+	name  string
+	start time.Time
+	attrs map[string]interface{}
+	err   string
+	ended bool
+}
+
+// Start starts a span with the Default tracer.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return Default.Start(ctx, name)
+}
+
+// Start starts a child of the span in ctx, or of the remote span put there by
+// Extract, or a new trace.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if t == nil || t.Exporter == nil {
+		return ctx, nil
+	}
+	span := &Span{
+		tracer: t,
+		name:   name,
+		start:  time.Now(),
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.context.TraceID = parent.context.TraceID
+		span.parent = parent.context.SpanID
+	} else if remote, ok := ctx.Value(remoteKey).(SpanContext); ok {
+		span.context.TraceID = remote.TraceID
+		span.parent = remote.SpanID
+	} else {
+		rand.Read(span.context.TraceID[:])
+	}
+	rand.Read(span.context.SpanID[:])
+	span.context.Sampled = true
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]interface{})
+	}
+	s.attrs[key] = value
+}
+
+// RecordError marks the span as failed, nil errors are ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End finishes the span and exports it. Only the first call has an effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	end := time.Now()
+	data := SpanData{
+		TraceID:    s.context.TraceID.String(),
+		SpanID:     s.context.SpanID.String(),
+		Name:       s.name,
+		Start:      s.start,
+		End:        end,
+		Duration:   float64(end.Sub(s.start)) / float64(time.Millisecond),
+		Attributes: s.attrs,
+		Error:      s.err,
+	}
+	if s.parent.IsValid() {
+		data.ParentID = s.parent.String()
+	}
+	s.mu.Unlock()
+	if err := s.tracer.Exporter.Export(data); err != nil && s.tracer.OnError != nil {
+		s.tracer.OnError(err)
+	}
+}
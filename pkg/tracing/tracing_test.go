@@ -0,0 +1,161 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type recorder struct {
+	spans []SpanData
+}
+
+func (r *recorder) Export(span SpanData) error {
+	r.spans = append(r.spans, span)
+	return nil
+}
+
+func TestSpans(t *testing.T) {
+	rec := &recorder{}
+	tracer := &Tracer{Exporter: rec}
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	child.SetAttribute("db", "mysql")
+	child.RecordError(errors.New("boom"))
+	child.End()
+	child.End()
+	root.End()
+
+	if len(rec.spans) != 2 {
+		t.Errorf("expected 2 spans, got %d", len(rec.spans))
+		return
+	}
+	c, r := rec.spans[0], rec.spans[1]
+	if c.TraceID != r.TraceID || c.ParentID != r.SpanID || r.ParentID != "" {
+		t.Errorf("child not linked to root: %+v %+v", c, r)
+		return
+	}
+	if c.Attributes["db"] != "mysql" || c.Error != "boom" {
+		t.Errorf("unexpected child %+v", c)
+		return
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	ctx, span := (&Tracer{}).Start(context.Background(), "root")
+	if span != nil || SpanFromContext(ctx) != nil {
+		t.Errorf("expected no span from disabled tracer")
+		return
+	}
+	// nil spans are usable
+	span.SetAttribute("a", 1)
+	span.RecordError(errors.New("boom"))
+	span.End()
+}
+
+func TestTraceparent(t *testing.T) {
+	const value = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(value)
+	if !ok || !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("can't parse %q: %+v", value, sc)
+		return
+	}
+	if FormatTraceparent(sc) != value {
+		t.Errorf("expected %q, got %q", value, FormatTraceparent(sc))
+		return
+	}
+	bad := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+	for _, value := range bad {
+		if _, ok := ParseTraceparent(value); ok {
+			t.Errorf("expected %q to be rejected", value)
+			return
+		}
+	}
+	// future versions may have more fields
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); !ok {
+		t.Errorf("expected future version to be accepted")
+		return
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	rec := &recorder{}
+	tracer := &Tracer{Exporter: rec}
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, span := tracer.Start(Extract(context.Background(), header), "server")
+	out := http.Header{}
+	Inject(ctx, out)
+	span.End()
+
+	if rec.spans[0].TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || rec.spans[0].ParentID != "00f067aa0ba902b7" {
+		t.Errorf("remote parent not used: %+v", rec.spans[0])
+		return
+	}
+	expected := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + rec.spans[0].SpanID + "-01"
+	if out.Get(TraceparentHeader) != expected {
+		t.Errorf("expected %q, got %q", expected, out.Get(TraceparentHeader))
+		return
+	}
+}
+
+func TestTransport(t *testing.T) {
+	rec := &recorder{}
+	defer func(tracer *Tracer) { Default = tracer }(Default)
+	Default = &Tracer{Exporter: rec}
+	received := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(TraceparentHeader)
+	}))
+	defer server.Close()
+
+	ctx, root := Start(context.Background(), "root")
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	resp, err := (&http.Client{Transport: &Transport{}}).Do(req)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	resp.Body.Close()
+	root.End()
+
+	if len(rec.spans) != 2 || rec.spans[0].ParentID != rec.spans[1].SpanID {
+		t.Errorf("expected a client span of root, got %+v", rec.spans)
+		return
+	}
+	client := rec.spans[0]
+	if received != "00-"+client.TraceID+"-"+client.SpanID+"-01" {
+		t.Errorf("unexpected traceparent %q", received)
+		return
+	}
+	if client.Attributes["http.status"] != 200 || req.Header.Get(TraceparentHeader) != "" {
+		t.Errorf("unexpected span %+v", client)
+		return
+	}
+}
+
+func TestWriterExporter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tracer := &Tracer{Exporter: NewWriterExporter(buf)}
+	_, span := tracer.Start(context.Background(), "root")
+	span.End()
+	data := SpanData{}
+	if err := json.Unmarshal(buf.Bytes(), &data); err != nil || data.Name != "root" {
+		t.Errorf("unexpected output %q", buf.String())
+		return
+	}
+}
@@ -1,23 +1,77 @@
 package user_repo
 
 import (
+	"context"
 	"crypto/md5"
 	"database/sql"
 	"encoding/hex"
 	"errors"
+	"net/mail"
+	"strings"
+	"time"
 
 	"asperitas-clone/pkg/items"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/text/secure/precis"
 )
 
+const (
+	// errDuplicateKey is returned by MySQL when a unique key is violated.
+	errDuplicateKey = 1062
+	emailKey        = "users_email"
+)
+
+// ReservedUsernames can't be registered, they collide with routes or
+// pretend to speak for the site.
+var ReservedUsernames = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"api":           true,
+	"static":        true,
+	"me":            true,
+	"root":          true,
+	"system":        true,
+	"moderator":     true,
+	"support":       true,
+	"help":          true,
+	"login":         true,
+	"register":      true,
+	"settings":      true,
+	"null":          true,
+	"undefined":     true,
+}
+
 type UserRepo struct {
 	UserDB *sql.DB
 }
 
-func (repo *UserRepo) GetUserByID(id int) (*items.User, error) {
+// NormalizeUsername maps a username to the key it is unique by: width and
+// case are folded and Unicode normalized (RFC 8265), so "Bob", "BOB" and
+// "Ｂｏｂ" are the same user. It returns items.ErrBadUsername for names the
+// profile does not allow.
+func NormalizeUsername(username string) (string, error) {
+	key, err := precis.UsernameCaseMapped.String(username)
+	if err != nil || key == "" {
+		return "", items.ErrBadUsername
+	}
+	return key, nil
+}
+
+// NormalizeEmail accepts a bare address like "bob@example.com" and lower
+// cases it, so an address can only belong to one user.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || len(email) > 255 {
+		return "", items.ErrBadEmail
+	}
+	return strings.ToLower(email), nil
+}
+
+func (repo *UserRepo) GetUserByID(ctx context.Context, id int) (*items.User, error) {
 	user := &items.User{}
-	row := repo.UserDB.QueryRow("SELECT id, username, password FROM users WHERE id= ?", id)
+	row := repo.UserDB.QueryRowContext(ctx, "SELECT id, username, password FROM users WHERE id= ?", id)
 	err := row.Scan(&user.ID, &user.Username, &user.Password)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
@@ -27,10 +81,14 @@ func (repo *UserRepo) GetUserByID(id int) (*items.User, error) {
 	return user, nil
 }
 
-func (repo *UserRepo) GetUserByUsername(username string) (*items.User, error) {
+func (repo *UserRepo) GetUserByUsername(ctx context.Context, username string) (*items.User, error) {
+	key, err := NormalizeUsername(username)
+	if err != nil {
+		return nil, nil
+	}
 	user := &items.User{}
-	row := repo.UserDB.QueryRow("SELECT id, username, password FROM users WHERE username= ?", username)
-	err := row.Scan(&user.ID, &user.Username, &user.Password)
+	row := repo.UserDB.QueryRowContext(ctx, "SELECT id, username, password FROM users WHERE username_key= ?", key)
+	err = row.Scan(&user.ID, &user.Username, &user.Password)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	} else if err != nil {
@@ -39,35 +97,252 @@ func (repo *UserRepo) GetUserByUsername(username string) (*items.User, error) {
 	return user, nil
 }
 
-func (repo *UserRepo) AddUser(user *items.User) (int, error) {
-	var username string
-	user.Password = HashPassword(user.Password)
-	row := repo.UserDB.QueryRow("SELECT username FROM users WHERE username= ?", user.Username)
-	err := row.Scan(&username)
-	if err == nil {
-		return 0, items.ErrUserAlreadyExists
-	} else if !errors.Is(err, sql.ErrNoRows) {
+// GetUserByEmail returns nil if no user has the address.
+func (repo *UserRepo) GetUserByEmail(ctx context.Context, email string) (*items.User, error) {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, nil
+	}
+	user := &items.User{}
+	row := repo.UserDB.QueryRowContext(ctx, "SELECT id, username, password, email, email_verified FROM users WHERE email= ?", email)
+	err = row.Scan(&user.ID, &user.Username, &user.Password, &user.Email, &user.EmailVerified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetEmail returns the address of the user and whether it is verified, an
+// empty one if there is none.
+func (repo *UserRepo) GetEmail(ctx context.Context, id int) (string, bool, error) {
+	var email sql.NullString
+	var verified bool
+	row := repo.UserDB.QueryRowContext(ctx, "SELECT email, email_verified FROM users WHERE id= ?", id)
+	err := row.Scan(&email, &verified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return email.String, verified, nil
+}
+
+// SetEmail replaces the address of the user, the new one is not verified.
+// An empty email removes it. verification_sent is kept, changing the address
+// doesn't get around the resend throttle.
+func (repo *UserRepo) SetEmail(ctx context.Context, id int, email string) error {
+	value := sql.NullString{}
+	if email != "" {
+		normalized, err := NormalizeEmail(email)
+		if err != nil {
+			return err
+		}
+		value = sql.NullString{String: normalized, Valid: true}
+	}
+	_, err := repo.UserDB.ExecContext(
+		ctx,
+		"UPDATE `users` SET `email` = ?, `email_verified` = FALSE WHERE `id` = ?",
+		value,
+		id,
+	)
+	if isDuplicate(err) {
+		return items.ErrEmailTaken
+	}
+	return err
+}
+
+// VerifyEmail marks the address verified if it still is the user's one.
+func (repo *UserRepo) VerifyEmail(ctx context.Context, id int, email string) error {
+	_, err := repo.UserDB.ExecContext(
+		ctx,
+		"UPDATE `users` SET `email_verified` = TRUE WHERE `id` = ? AND `email` = ?",
+		id,
+		email,
+	)
+	return err
+}
+
+// MarkVerificationSent records that a verification mail goes out now. It
+// reports false, and records nothing, if one went out less than interval ago
+// or there is no unverified address, so concurrent requests send one mail.
+func (repo *UserRepo) MarkVerificationSent(ctx context.Context, id int, interval time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	result, err := repo.UserDB.ExecContext(
+		ctx,
+		"UPDATE `users` SET `verification_sent` = ? WHERE `id` = ? AND `email` IS NOT NULL AND NOT `email_verified` "+
+			"AND (`verification_sent` IS NULL OR `verification_sent` <= ?)",
+		now,
+		id,
+		now.Add(-interval),
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// MarkResetSent records that a password reset mail goes out now. It reports
+// false, and records nothing, if one went out less than interval ago.
+func (repo *UserRepo) MarkResetSent(ctx context.Context, id int, interval time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	result, err := repo.UserDB.ExecContext(
+		ctx,
+		"UPDATE `users` SET `reset_sent` = ? WHERE `id` = ? AND (`reset_sent` IS NULL OR `reset_sent` <= ?)",
+		now,
+		id,
+		now.Add(-interval),
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// AddUser relies on the unique username and email keys, so concurrent
+// registrations of the same name can't both succeed. The email is optional.
+func (repo *UserRepo) AddUser(ctx context.Context, user *items.User) (int, error) {
+	key, err := usernameKey(user.Username)
+	if err != nil {
 		return 0, err
 	}
-	result, err := repo.UserDB.Exec(
-		"INSERT INTO `users` (`username`, `password`) VALUES (?, ?)",
+	email := sql.NullString{}
+	if user.Email != "" {
+		user.Email, err = NormalizeEmail(user.Email)
+		if err != nil {
+			return 0, err
+		}
+		email = sql.NullString{String: user.Email, Valid: true}
+	}
+	user.Password = HashPassword(user.Password)
+	result, err := repo.UserDB.ExecContext(
+		ctx,
+		"INSERT INTO `users` (`username`, `username_key`, `password`, `email`) VALUES (?, ?, ?, ?)",
 		user.Username,
+		key,
 		user.Password,
+		email,
 	)
-	if err != nil {
+	if isDuplicate(err) {
+		if duplicateOf(err, emailKey) {
+			return 0, items.ErrEmailTaken
+		}
+		return 0, items.ErrUserAlreadyExists
+	} else if err != nil {
 		return 0, err
 	}
 	id, err := result.LastInsertId()
 	return int(id), err
 }
 
+// ChangeUsername renames the user, the name is checked like in AddUser.
+func (repo *UserRepo) ChangeUsername(ctx context.Context, id int, username string) error {
+	key, err := usernameKey(username)
+	if err != nil {
+		return err
+	}
+	_, err = repo.UserDB.ExecContext(
+		ctx,
+		"UPDATE `users` SET `username` = ?, `username_key` = ? WHERE `id` = ?",
+		username,
+		key,
+		id,
+	)
+	if isDuplicate(err) {
+		return items.ErrUserAlreadyExists
+	}
+	return err
+}
+
+func (repo *UserRepo) ChangePassword(ctx context.Context, id int, password string) error {
+	_, err := repo.UserDB.ExecContext(
+		ctx,
+		"UPDATE `users` SET `password` = ? WHERE `id` = ?",
+		HashPassword(password),
+		id,
+	)
+	return err
+}
+
+// DeleteUser removes the user with everything kept about them in MySQL.
+// Notifications the user caused for others stay unless removeContent is set,
+// they show the author as deleted then.
+func (repo *UserRepo) DeleteUser(ctx context.Context, id int, removeContent bool) error {
+	tx, err := repo.UserDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, "DELETE FROM `users` WHERE `id` = ?", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return items.ErrNoUser
+	}
+	statements := []string{
+		"DELETE FROM `sessions` WHERE `userid` = ?",
+		"DELETE FROM `profiles` WHERE `userid` = ?",
+		"DELETE FROM `comments` WHERE `userid` = ?",
+		"DELETE FROM `saved` WHERE `userid` = ?",
+		"DELETE FROM `subscriptions` WHERE `userid` = ?",
+		"DELETE FROM `notifications` WHERE `userid` = ?",
+		"DELETE FROM `password_resets` WHERE `userid` = ?",
+		"DELETE FROM `identities` WHERE `userid` = ?",
+		"DELETE FROM `two_factor` WHERE `userid` = ?",
+		"DELETE FROM `recovery_codes` WHERE `userid` = ?",
+		"DELETE FROM `login_challenges` WHERE `userid` = ?",
+	}
+	if removeContent {
+		statements = append(statements, "DELETE FROM `notifications` WHERE `author_id` = ?")
+	}
+	for _, statement := range statements {
+		if _, err = tx.ExecContext(ctx, statement, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// usernameKey normalizes a new username and rejects reserved ones.
+func usernameKey(username string) (string, error) {
+	key, err := NormalizeUsername(username)
+	if err != nil {
+		return "", err
+	}
+	if ReservedUsernames[key] {
+		return "", items.ErrUsernameReserved
+	}
+	return key, nil
+}
+
+func isDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateKey
+}
+
+// duplicateOf tells which unique key a duplicate error is about, MySQL only
+// names it at the end of the message: "for key 'users_email'", or
+// "'users.users_email'" since 8.0.
+func duplicateOf(err error, key string) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && strings.HasSuffix(mysqlErr.Message, key+"'")
+}
+
 func HashPassword(password string) string {
 	hashedPassword := md5.Sum([]byte(password))
 	return hex.EncodeToString(hashedPassword[:])
 }
 
-func (repo *UserRepo) Authorize(username, expPass string) (*items.User, error) {
-	u, err := repo.GetUserByUsername(username)
+func (repo *UserRepo) Authorize(ctx context.Context, username, expPass string) (*items.User, error) {
+	u, err := repo.GetUserByUsername(ctx, username)
 	if err != nil {
 		return nil, err
 	}
@@ -1,14 +1,19 @@
 package user_repo
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"asperitas-clone/pkg/items"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
 )
 
@@ -45,7 +50,7 @@ func TestGetUserByID(t *testing.T) {
 		WithArgs(expect[0].ID).
 		WillReturnRows(rows)
 	repo := &UserRepo{UserDB: db}
-	user, err := repo.GetUserByID(expect[0].ID)
+	user, err := repo.GetUserByID(context.Background(), expect[0].ID)
 	if err != nil {
 		t.Errorf("unexpected err: %s", err)
 		return
@@ -64,7 +69,7 @@ func TestGetUserByID(t *testing.T) {
 		ExpectQuery("SELECT id, username, password FROM users WHERE id= ?").
 		WithArgs(9999).
 		WillReturnError(sql.ErrNoRows)
-	user, err = repo.GetUserByID(9999)
+	user, err = repo.GetUserByID(context.Background(), 9999)
 	if err != nil {
 		t.Errorf("unexpected err: %s", err)
 		return
@@ -83,7 +88,7 @@ func TestGetUserByID(t *testing.T) {
 		ExpectQuery("SELECT id, username, password FROM users WHERE id= ?").
 		WithArgs(expect[0].ID).
 		WillReturnError(ErrDB)
-	_, err = repo.GetUserByID(expect[0].ID)
+	_, err = repo.GetUserByID(context.Background(), expect[0].ID)
 	if err == nil {
 		t.Errorf("expected error, got nil")
 		return
@@ -91,6 +96,20 @@ func TestGetUserByID(t *testing.T) {
 		t.Errorf("unexpected error: %v", err.Error())
 		return
 	}
+
+	// Canceled request
+	ctx, cancel := context.WithCancel(context.Background())
+	mock.
+		ExpectQuery("SELECT id, username, password FROM users WHERE id= ?").
+		WithArgs(expect[0].ID).
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password"}))
+	cancel()
+	_, err = repo.GetUserByID(ctx, expect[0].ID)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+		return
+	}
 }
 
 func TestGetUserByUsername(t *testing.T) {
@@ -114,11 +133,11 @@ func TestGetUserByUsername(t *testing.T) {
 
 	// Good query
 	mock.
-		ExpectQuery("SELECT id, username, password FROM users WHERE username= ?").
+		ExpectQuery("SELECT id, username, password FROM users WHERE username_key= ?").
 		WithArgs(expect[0].Username).
 		WillReturnRows(rows)
 	repo := &UserRepo{UserDB: db}
-	user, err := repo.GetUserByUsername(expect[0].Username)
+	user, err := repo.GetUserByUsername(context.Background(), expect[0].Username)
 	if err != nil {
 		t.Errorf("unexpected err: %s", err)
 		return
@@ -132,12 +151,23 @@ func TestGetUserByUsername(t *testing.T) {
 		return
 	}
 
+	// Lookup ignores case and width
+	mock.
+		ExpectQuery("SELECT id, username, password FROM users WHERE username_key= ?").
+		WithArgs("admin").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password"}).AddRow(10, "admin", expect[0].Password))
+	user, err = repo.GetUserByUsername(context.Background(), "ＡＤＭＩＮ")
+	if err != nil || user == nil || user.ID != 10 {
+		t.Errorf("expected admin, got %v, %v", user, err)
+		return
+	}
+
 	// Row not found
 	mock.
-		ExpectQuery("SELECT id, username, password FROM users WHERE username= ?").
+		ExpectQuery("SELECT id, username, password FROM users WHERE username_key= ?").
 		WithArgs("abacaba").
 		WillReturnError(sql.ErrNoRows)
-	user, err = repo.GetUserByUsername("abacaba")
+	user, err = repo.GetUserByUsername(context.Background(), "abacaba")
 	if err != nil {
 		t.Errorf("unexpected err: %s", err)
 		return
@@ -153,10 +183,10 @@ func TestGetUserByUsername(t *testing.T) {
 
 	// DB error
 	mock.
-		ExpectQuery("SELECT id, username, password FROM users WHERE username= ?").
+		ExpectQuery("SELECT id, username, password FROM users WHERE username_key= ?").
 		WithArgs(expect[0].Username).
 		WillReturnError(ErrDB)
-	_, err = repo.GetUserByUsername(expect[0].Username)
+	_, err = repo.GetUserByUsername(context.Background(), expect[0].Username)
 	if err == nil {
 		t.Errorf("expected error, got nil")
 		return
@@ -173,30 +203,13 @@ func TestAddUser(t *testing.T) {
 	}
 	defer db.Close()
 
-	rows := sqlmock.NewRows([]string{"id", "username", "password"})
-	expect := []*items.User{
-		{
-			Username: "admin",
-			ID:       10,
-			Password: "f6fdffe48c908deb0f4c3bd36c032e72",
-		},
-	}
-	for _, user := range expect {
-		rows.AddRow(user.ID, user.Username, user.Password)
-	}
-
 	// Good query
-	mock.
-		ExpectQuery("SELECT username FROM users WHERE").
-		WithArgs("abacaba").
-		WillReturnError(sql.ErrNoRows)
-		//WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("abacaba"))
 	mock.
 		ExpectExec("INSERT INTO `users`").
-		WithArgs("abacaba", "password").
+		WithArgs("Abacaba", "abacaba", HashPassword("password"), nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	repo := &UserRepo{UserDB: db}
-	id, err := repo.AddUser(&items.User{Username: "abacaba", Password: "password"})
+	id, err := repo.AddUser(context.Background(), &items.User{Username: "Abacaba", Password: "password"})
 	if err != nil {
 		t.Errorf("unexpected err: %s", err)
 		return
@@ -210,10 +223,10 @@ func TestAddUser(t *testing.T) {
 
 	// Already exsists
 	mock.
-		ExpectQuery("SELECT username FROM users WHERE").
-		WithArgs("abacaba").
-		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("abacaba"))
-	id, err = repo.AddUser(&items.User{Username: "abacaba", Password: "password"})
+		ExpectExec("INSERT INTO `users`").
+		WithArgs("ＡＢＡＣＡＢＡ", "abacaba", HashPassword("password"), nil).
+		WillReturnError(&mysql.MySQLError{Number: errDuplicateKey, Message: "Duplicate entry"})
+	_, err = repo.AddUser(context.Background(), &items.User{Username: "ＡＢＡＣＡＢＡ", Password: "password"})
 	if err == nil {
 		t.Errorf("expected error, got nil")
 		return
@@ -222,36 +235,158 @@ func TestAddUser(t *testing.T) {
 		return
 	}
 
-	// DB error in SELECT
-	mock.
-		ExpectQuery("SELECT username FROM users WHERE").
-		WithArgs("abacaba").
-		WillReturnError(ErrDB)
-	id, err = repo.AddUser(&items.User{Username: "abacaba", Password: "password"})
-	if err == nil {
-		t.Errorf("expected error, got nil")
+	// Reserved and invalid names never reach the DB
+	for name, expectErr := range map[string]error{
+		"Admin": items.ErrUsernameReserved,
+		"ME":    items.ErrUsernameReserved,
+		"a b":   items.ErrBadUsername,
+		"":      items.ErrBadUsername,
+	} {
+		_, err = repo.AddUser(context.Background(), &items.User{Username: name, Password: "password"})
+		if !errors.Is(err, expectErr) {
+			t.Errorf("expected %v for %q, got %v", expectErr, name, err)
+			return
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
 		return
-	} else if !errors.Is(err, ErrDB) {
+	}
+
+	// Email is stored normalized, it is unique too
+	mock.
+		ExpectExec("INSERT INTO `users`").
+		WithArgs("bob", "bob", HashPassword("password"), "bob@example.com").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	_, err = repo.AddUser(context.Background(), &items.User{Username: "bob", Password: "password", Email: " Bob@Example.com "})
+	if err != nil {
 		t.Errorf("unexpected err: %s", err)
 		return
 	}
+	mock.
+		ExpectExec("INSERT INTO `users`").
+		WithArgs("rob", "rob", HashPassword("password"), "bob@example.com").
+		WillReturnError(&mysql.MySQLError{Number: errDuplicateKey, Message: "Duplicate entry 'bob@example.com' for key 'users.users_email'"})
+	_, err = repo.AddUser(context.Background(), &items.User{Username: "rob", Password: "password", Email: "bob@example.com"})
+	if !errors.Is(err, items.ErrEmailTaken) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+	_, err = repo.AddUser(context.Background(), &items.User{Username: "rob", Password: "password", Email: "Bob <bob@example.com>"})
+	if !errors.Is(err, items.ErrBadEmail) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
 
 	// DB error in INSERT
-	mock.
-		ExpectQuery("SELECT username FROM users WHERE").
-		WithArgs("abacaba").
-		WillReturnError(sql.ErrNoRows)
 	mock.
 		ExpectExec("INSERT INTO `users`").
-		WithArgs("abacaba", "password").
+		WithArgs("abacaba", "abacaba", HashPassword("password"), nil).
 		WillReturnError(ErrDB)
-	id, err = repo.AddUser(&items.User{Username: "abacaba", Password: "password"})
+	_, err = repo.AddUser(context.Background(), &items.User{Username: "abacaba", Password: "password"})
 	if !errors.Is(err, ErrDB) {
 		t.Errorf("unexpected err: %s", err)
 		return
 	}
 }
 
+// TestAddUserConcurrent registers the same name from many goroutines, the
+// database lets one insert through and rejects the rest on the unique key.
+func TestAddUserConcurrent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+
+	const n = 20
+	mock.
+		ExpectExec("INSERT INTO `users`").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	for i := 1; i < n; i++ {
+		mock.
+			ExpectExec("INSERT INTO `users`").
+			WillReturnError(&mysql.MySQLError{Number: errDuplicateKey, Message: "Duplicate entry"})
+	}
+	repo := &UserRepo{UserDB: db}
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err := repo.AddUser(context.Background(), &items.User{Username: "racer", Password: "password"})
+			errs <- err
+		}()
+	}
+	created := 0
+	for i := 0; i < n; i++ {
+		err := <-errs
+		if err == nil {
+			created++
+		} else if !errors.Is(err, items.ErrUserAlreadyExists) {
+			t.Errorf("unexpected err: %s", err)
+			return
+		}
+	}
+	if created != 1 {
+		t.Errorf("expected one user to be created, got %d", created)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+// TestAddUserConcurrentMySQL runs the race against the MySQL in
+// TEST_MYSQL_DSN with the schema migrated, it is skipped when the variable is
+// unset.
+func TestAddUserConcurrentMySQL(t *testing.T) {
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("TEST_MYSQL_DSN is not set")
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatalf("cant open mysql: %s", err)
+	}
+	defer db.Close()
+	name := fmt.Sprintf("Racer%d", time.Now().UnixNano())
+	defer db.Exec("DELETE FROM users WHERE username_key = ?", strings.ToLower(name))
+
+	const n = 50
+	repo := &UserRepo{UserDB: db}
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		// every other attempt differs in case only
+		username := name
+		if i%2 == 1 {
+			username = strings.ToUpper(name)
+		}
+		go func() {
+			_, err := repo.AddUser(context.Background(), &items.User{Username: username, Password: "password"})
+			errs <- err
+		}()
+	}
+	created := 0
+	for i := 0; i < n; i++ {
+		err := <-errs
+		if err == nil {
+			created++
+		} else if !errors.Is(err, items.ErrUserAlreadyExists) {
+			t.Errorf("unexpected err: %s", err)
+			return
+		}
+	}
+	if created != 1 {
+		t.Errorf("expected one user to be created, got %d", created)
+		return
+	}
+}
+
 func TestAuthorize(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -273,11 +408,11 @@ func TestAuthorize(t *testing.T) {
 
 	// Good query
 	mock.
-		ExpectQuery("SELECT id, username, password FROM users WHERE username= ?").
+		ExpectQuery("SELECT id, username, password FROM users WHERE username_key= ?").
 		WithArgs(expect[0].Username).
 		WillReturnRows(rows)
 	repo := &UserRepo{UserDB: db}
-	user, err := repo.Authorize(expect[0].Username, "adminadmin")
+	user, err := repo.Authorize(context.Background(), expect[0].Username, "adminadmin")
 	if err != nil {
 		t.Errorf("unexpected err: %s", err)
 		return
@@ -293,10 +428,10 @@ func TestAuthorize(t *testing.T) {
 
 	// No user
 	mock.
-		ExpectQuery("SELECT id, username, password FROM users WHERE username= ?").
+		ExpectQuery("SELECT id, username, password FROM users WHERE username_key= ?").
 		WithArgs("abacaba").
 		WillReturnError(sql.ErrNoRows)
-	user, err = repo.Authorize("abacaba", "123456789")
+	user, err = repo.Authorize(context.Background(), "abacaba", "123456789")
 	if err == nil {
 		t.Errorf("expected error, got nil")
 		return
@@ -307,10 +442,10 @@ func TestAuthorize(t *testing.T) {
 
 	// DB error
 	mock.
-		ExpectQuery("SELECT id, username, password FROM users WHERE username= ?").
+		ExpectQuery("SELECT id, username, password FROM users WHERE username_key= ?").
 		WithArgs(expect[0].Username).
 		WillReturnError(ErrDB)
-	user, err = repo.Authorize(expect[0].Username, "adminadmin")
+	user, err = repo.Authorize(context.Background(), expect[0].Username, "adminadmin")
 	if err == nil {
 		t.Errorf("expected error, got nil")
 		return
@@ -324,10 +459,10 @@ func TestAuthorize(t *testing.T) {
 		rows.AddRow(user.ID, user.Username, user.Password)
 	}
 	mock.
-		ExpectQuery("SELECT id, username, password FROM users WHERE username= ?").
+		ExpectQuery("SELECT id, username, password FROM users WHERE username_key= ?").
 		WithArgs(expect[0].Username).
 		WillReturnRows(rows)
-	user, err = repo.Authorize(expect[0].Username, "neadminneadmin")
+	user, err = repo.Authorize(context.Background(), expect[0].Username, "neadminneadmin")
 	if err == nil {
 		t.Errorf("expected error, got nil")
 		return
@@ -336,3 +471,383 @@ func TestAuthorize(t *testing.T) {
 		return
 	}
 }
+
+func TestChangeUsername(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &UserRepo{UserDB: db}
+
+	// Good query
+	mock.
+		ExpectExec("UPDATE `users` SET `username` = \\?, `username_key` = \\? WHERE `id` = \\?").
+		WithArgs("Abacaba", "abacaba", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	err = repo.ChangeUsername(context.Background(), 1, "Abacaba")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	} else if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+
+	// Taken
+	mock.
+		ExpectExec("UPDATE `users`").
+		WithArgs("ABACABA", "abacaba", 2).
+		WillReturnError(&mysql.MySQLError{Number: errDuplicateKey, Message: "Duplicate entry"})
+	err = repo.ChangeUsername(context.Background(), 2, "ABACABA")
+	if !errors.Is(err, items.ErrUserAlreadyExists) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+
+	// Reserved names never reach the DB
+	err = repo.ChangeUsername(context.Background(), 1, "Admin")
+	if !errors.Is(err, items.ErrUsernameReserved) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &UserRepo{UserDB: db}
+
+	// Good query
+	mock.
+		ExpectExec("UPDATE `users` SET `password` = \\? WHERE `id` = \\?").
+		WithArgs(HashPassword("new password"), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	err = repo.ChangePassword(context.Background(), 1, "new password")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	} else if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+
+	// DB error
+	mock.
+		ExpectExec("UPDATE `users`").
+		WithArgs(HashPassword("new password"), 1).
+		WillReturnError(ErrDB)
+	err = repo.ChangePassword(context.Background(), 1, "new password")
+	if !errors.Is(err, ErrDB) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &UserRepo{UserDB: db}
+	tables := []string{"sessions", "profiles", "comments", "saved", "subscriptions", "notifications", "password_resets", "identities", "two_factor", "recovery_codes", "login_challenges"}
+
+	// Good query, content is kept
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `users` WHERE `id` = \\?").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	for _, table := range tables {
+		mock.ExpectExec("DELETE FROM `" + table + "` WHERE `userid` = \\?").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+	err = repo.DeleteUser(context.Background(), 1, false)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	} else if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+
+	// Content is removed with the notifications the user caused
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `users`").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	for _, table := range tables {
+		mock.ExpectExec("DELETE FROM `" + table + "`").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec("DELETE FROM `notifications` WHERE `author_id` = \\?").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+	err = repo.DeleteUser(context.Background(), 1, true)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	} else if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+
+	// No such user
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `users`").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	err = repo.DeleteUser(context.Background(), 2, false)
+	if !errors.Is(err, items.ErrNoUser) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	} else if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+
+	// DB error rolls everything back
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `users`").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM `sessions`").WithArgs(1).WillReturnError(ErrDB)
+	mock.ExpectRollback()
+	err = repo.DeleteUser(context.Background(), 1, false)
+	if !errors.Is(err, ErrDB) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	} else if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestGetUserByEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &UserRepo{UserDB: db}
+	expect := &items.User{ID: 10, Username: "admin", Password: "f6fdffe48c908deb0f4c3bd36c032e72", Email: "admin@example.com", EmailVerified: true}
+
+	// Good query
+	mock.
+		ExpectQuery("SELECT id, username, password, email, email_verified FROM users WHERE email= ?").
+		WithArgs("admin@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "email", "email_verified"}).
+			AddRow(expect.ID, expect.Username, expect.Password, expect.Email, expect.EmailVerified))
+	user, err := repo.GetUserByEmail(context.Background(), "Admin@Example.com")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	} else if !reflect.DeepEqual(user, expect) {
+		t.Errorf("results not match, want %v, have %v", expect, user)
+		return
+	}
+
+	// Row not found
+	mock.
+		ExpectQuery("SELECT id, username, password, email, email_verified FROM users WHERE email= ?").
+		WithArgs("nobody@example.com").
+		WillReturnError(sql.ErrNoRows)
+	user, err = repo.GetUserByEmail(context.Background(), "nobody@example.com")
+	if err != nil || user != nil {
+		t.Errorf("expected no user, got %v, %v", user, err)
+		return
+	}
+
+	// Invalid addresses never reach the DB
+	user, err = repo.GetUserByEmail(context.Background(), "not an address")
+	if err != nil || user != nil {
+		t.Errorf("expected no user, got %v, %v", user, err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestGetEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &UserRepo{UserDB: db}
+
+	// Good query
+	mock.
+		ExpectQuery("SELECT email, email_verified FROM users WHERE id= ?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "email_verified"}).AddRow("admin@example.com", true))
+	email, verified, err := repo.GetEmail(context.Background(), 1)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	} else if email != "admin@example.com" || !verified {
+		t.Errorf("results not match, want %v %v, have %v %v", "admin@example.com", true, email, verified)
+		return
+	}
+
+	// No address
+	mock.
+		ExpectQuery("SELECT email, email_verified FROM users WHERE id= ?").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "email_verified"}).AddRow(nil, false))
+	email, verified, err = repo.GetEmail(context.Background(), 2)
+	if err != nil || email != "" || verified {
+		t.Errorf("expected no address, got %q %v %v", email, verified, err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestSetEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &UserRepo{UserDB: db}
+
+	// Good query, the new address is not verified
+	mock.
+		ExpectExec("UPDATE `users` SET `email` = \\?, `email_verified` = FALSE WHERE `id` = \\?").
+		WithArgs("bob@example.com", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	err = repo.SetEmail(context.Background(), 1, "Bob@example.com")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+
+	// Removed
+	mock.
+		ExpectExec("UPDATE `users` SET `email`").
+		WithArgs(nil, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	err = repo.SetEmail(context.Background(), 1, "")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+
+	// Taken
+	mock.
+		ExpectExec("UPDATE `users` SET `email`").
+		WithArgs("bob@example.com", 2).
+		WillReturnError(&mysql.MySQLError{Number: errDuplicateKey, Message: "Duplicate entry 'bob@example.com' for key 'users_email'"})
+	err = repo.SetEmail(context.Background(), 2, "bob@example.com")
+	if !errors.Is(err, items.ErrEmailTaken) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+
+	// Invalid addresses never reach the DB
+	err = repo.SetEmail(context.Background(), 2, "bob")
+	if !errors.Is(err, items.ErrBadEmail) {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &UserRepo{UserDB: db}
+
+	// Good query
+	mock.
+		ExpectExec("UPDATE `users` SET `email_verified` = TRUE WHERE `id` = \\? AND `email` = \\?").
+		WithArgs(1, "bob@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	err = repo.VerifyEmail(context.Background(), 1, "bob@example.com")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	} else if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestMarkVerificationSent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &UserRepo{UserDB: db}
+
+	// Allowed
+	mock.
+		ExpectExec("UPDATE `users` SET `verification_sent` = \\? WHERE `id` = \\?").
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	ok, err := repo.MarkVerificationSent(context.Background(), 1, time.Minute)
+	if err != nil || !ok {
+		t.Errorf("expected to be allowed, got %v %v", ok, err)
+		return
+	}
+
+	// Sent recently
+	mock.
+		ExpectExec("UPDATE `users` SET `verification_sent`").
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	ok, err = repo.MarkVerificationSent(context.Background(), 1, time.Minute)
+	if err != nil || ok {
+		t.Errorf("expected to be throttled, got %v %v", ok, err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}
+
+func TestMarkResetSent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &UserRepo{UserDB: db}
+
+	// Allowed
+	mock.
+		ExpectExec("UPDATE `users` SET `reset_sent` = \\? WHERE `id` = \\?").
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	ok, err := repo.MarkResetSent(context.Background(), 1, time.Minute)
+	if err != nil || !ok {
+		t.Errorf("expected to be allowed, got %v %v", ok, err)
+		return
+	}
+
+	// Sent recently
+	mock.
+		ExpectExec("UPDATE `users` SET `reset_sent`").
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	ok, err = repo.MarkResetSent(context.Background(), 1, time.Minute)
+	if err != nil || ok {
+		t.Errorf("expected to be throttled, got %v %v", ok, err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+}